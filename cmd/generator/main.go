@@ -0,0 +1,7 @@
+package main
+
+import "github.com/nofacedb/generator/pkg/generator"
+
+func main() {
+	generator.Main()
+}
@@ -0,0 +1,162 @@
+// Package config loads YAML configurations of the generator and its
+// subcommands. Every key of a configuration can be overridden by an
+// environment variable, e.g. GENERATOR_STORAGE_ADDR for storage.addr, and by
+// a flag, e.g. -storage.addr, in this order of precedence.
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// EnvPrefix prefixes environment variables overriding configuration keys.
+const EnvPrefix = "GENERATOR_"
+
+// override sets a configuration key to a YAML value.
+type override struct {
+	key   string
+	value string
+}
+
+// Overrides are values of configuration key flags in command line order.
+type Overrides struct {
+	values []override
+}
+
+type overrideFlag struct {
+	key       string
+	overrides *Overrides
+	// Bool keys are set by bare flags, e.g. -storage.auto_create.
+	isBool bool
+}
+
+func (f overrideFlag) String() string {
+	return ""
+}
+
+func (f overrideFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+func (f overrideFlag) Set(value string) error {
+	f.overrides.values = append(f.overrides.values, override{key: f.key, value: value})
+	return nil
+}
+
+// RegisterFlags adds a flag per key of configurations like cfg, a struct or
+// a pointer to one, e.g. -storage.addr or -generator.n.
+func RegisterFlags(flags *flag.FlagSet, cfg interface{}) *Overrides {
+	overrides := &Overrides{}
+	t := structType(cfg)
+	walkKeys(t, "", func(key string, index []int) {
+		isBool := t.FieldByIndex(index).Type.Kind() == reflect.Bool
+		flags.Var(overrideFlag{key: key, overrides: overrides, isBool: isBool}, key, "override "+key)
+	})
+	return overrides
+}
+
+// Load reads the configuration file at path, if any, into cfg, a pointer to
+// a struct, and applies overrides from environment variables and then
+// flags, which may be nil.
+func Load(path string, cfg interface{}, flags *Overrides) error {
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "unable to read configuration file")
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return errors.Wrap(err, "unable to parse configuration file")
+		}
+	}
+
+	if err := apply(cfg, envOverrides(structType(cfg))); err != nil {
+		return errors.Wrap(err, "unable to apply environment overrides")
+	}
+	if flags == nil {
+		return nil
+	}
+	if err := apply(cfg, flags.values); err != nil {
+		return errors.Wrap(err, "unable to apply flag overrides")
+	}
+	return nil
+}
+
+func structType(cfg interface{}) reflect.Type {
+	t := reflect.TypeOf(cfg)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+var yamlUnmarshaler = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// walkKeys calls fn with dotted YAML keys of configuration values and
+// indices of their fields. Nested structs are walked unless they unmarshal
+// themselves.
+func walkKeys(t reflect.Type, prefix string, fn func(key string, index []int)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		key := prefix + name
+		if (field.Type.Kind() == reflect.Struct) && !reflect.PtrTo(field.Type).Implements(yamlUnmarshaler) {
+			walkKeys(field.Type, key+".", func(key string, index []int) {
+				fn(key, append([]int{i}, index...))
+			})
+			continue
+		}
+		fn(key, []int{i})
+	}
+}
+
+// envName returns the environment variable overriding key.
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// envOverrides collects overrides of keys of t from GENERATOR_* environment
+// variables.
+func envOverrides(t reflect.Type) []override {
+	overrides := []override{}
+	walkKeys(t, "", func(key string, index []int) {
+		if value, ok := os.LookupEnv(envName(key)); ok {
+			overrides = append(overrides, override{key: key, value: value})
+		}
+	})
+	return overrides
+}
+
+// apply sets configuration keys. Strings are taken as is, other values are
+// parsed as YAML, e.g. "[0.3, 0.5]" or "{min: 1, max: 3}".
+func apply(cfg interface{}, overrides []override) error {
+	fields := map[string][]int{}
+	v := reflect.ValueOf(cfg).Elem()
+	walkKeys(v.Type(), "", func(key string, index []int) {
+		fields[key] = index
+	})
+	for _, o := range overrides {
+		field := v.FieldByIndex(fields[o.key])
+		if field.Kind() == reflect.String {
+			field.SetString(o.value)
+			continue
+		}
+		value := reflect.New(field.Type())
+		if err := yaml.Unmarshal([]byte(o.value), value.Interface()); err != nil {
+			return errors.Wrapf(err, "invalid value of %s", o.key)
+		}
+		field.Set(value.Elem())
+	}
+	return nil
+}
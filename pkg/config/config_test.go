@@ -0,0 +1,121 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// rangeCFG unmarshals itself, so that it is set by a single key.
+type rangeCFG struct {
+	Min int
+	Max int
+}
+
+func (r *rangeCFG) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	v := struct {
+		Min int `yaml:"min"`
+		Max int `yaml:"max"`
+	}{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	r.Min, r.Max = v.Min, v.Max
+	return nil
+}
+
+type testConfig struct {
+	Storage struct {
+		Addr       string `yaml:"addr"`
+		Port       int    `yaml:"port"`
+		AutoCreate bool   `yaml:"auto_create"`
+	} `yaml:"storage"`
+	Generator struct {
+		N          int      `yaml:"n"`
+		NaturalKey bool     `yaml:"natural_key"`
+		FFVPerCOB  rangeCFG `yaml:"ffv_per_cob"`
+	} `yaml:"generator"`
+	ignored string
+}
+
+func TestFlags(t *testing.T) {
+	flags := flag.NewFlagSet("generator", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	overrides := RegisterFlags(flags, testConfig{})
+	args := []string{
+		"-storage.auto_create", "-generator.natural_key=false", "-storage.addr", "clickhouse",
+		"-generator.n", "42", "-generator.ffv_per_cob", "{min: 1, max: 3}", "-generator.n", "43",
+	}
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if flags.NArg() != 0 {
+		t.Fatalf("arguments %q are left after flags", flags.Args())
+	}
+	if flags.Lookup("generator.ffv_per_cob.min") != nil {
+		t.Error("keys of structs unmarshaling themselves have flags")
+	}
+	cfg := &testConfig{}
+	cfg.Generator.NaturalKey = true
+	if err := apply(cfg, overrides.values); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Storage.AutoCreate || cfg.Generator.NaturalKey {
+		t.Errorf("bool flags set auto_create %v and natural_key %v", cfg.Storage.AutoCreate, cfg.Generator.NaturalKey)
+	}
+	if cfg.Storage.Addr != "clickhouse" {
+		t.Errorf("storage.addr is %q", cfg.Storage.Addr)
+	}
+	// The last flag of a key wins.
+	if cfg.Generator.N != 43 {
+		t.Errorf("generator.n is %d, expected 43", cfg.Generator.N)
+	}
+	if r := cfg.Generator.FFVPerCOB; (r.Min != 1) || (r.Max != 3) {
+		t.Errorf("generator.ffv_per_cob is %+v", r)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	file, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("storage:\n  addr: file\n  port: 9000\ngenerator:\n  n: 1\n")
+	file.Close()
+	os.Setenv("GENERATOR_STORAGE_ADDR", "env")
+	os.Setenv("GENERATOR_GENERATOR_N", "2")
+	defer os.Unsetenv("GENERATOR_STORAGE_ADDR")
+	defer os.Unsetenv("GENERATOR_GENERATOR_N")
+
+	flags := flag.NewFlagSet("generator", flag.ContinueOnError)
+	overrides := RegisterFlags(flags, &testConfig{})
+	if err := flags.Parse([]string{"-generator.n", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &testConfig{}
+	if err := Load(file.Name(), cfg, overrides); err != nil {
+		t.Fatal(err)
+	}
+	if (cfg.Storage.Addr != "env") || (cfg.Storage.Port != 9000) || (cfg.Generator.N != 3) {
+		t.Errorf("addr %q, port %d and n %d, expected env, 9000 and 3", cfg.Storage.Addr, cfg.Storage.Port, cfg.Generator.N)
+	}
+
+	// Without flags only the environment overrides the file.
+	cfg = &testConfig{}
+	if err := Load(file.Name(), cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if (cfg.Storage.Addr != "env") || (cfg.Generator.N != 2) {
+		t.Errorf("addr %q and n %d, expected env and 2", cfg.Storage.Addr, cfg.Generator.N)
+	}
+}
+
+func TestInvalidOverride(t *testing.T) {
+	os.Setenv("GENERATOR_GENERATOR_N", "many")
+	defer os.Unsetenv("GENERATOR_GENERATOR_N")
+	if err := Load("", &testConfig{}, nil); err == nil {
+		t.Error("invalid generator.n is applied")
+	}
+}
@@ -0,0 +1,277 @@
+// Package datagen generates realistic locale-aware personal data of control
+// objects: names, birth dates, phone numbers, emails and addresses.
+package datagen
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Field names usable in Config.Fields.
+const (
+	FieldSurname    = "surname"
+	FieldName       = "name"
+	FieldPatronymic = "patronymic"
+	FieldSex        = "sex"
+	FieldBirthDate  = "birth_date"
+	FieldPhoneNum   = "phone_num"
+	FieldEmail      = "email"
+	FieldAddress    = "address"
+)
+
+// Field generation modes.
+const (
+	ModeFake  = "fake"
+	ModeFixed = "fixed"
+)
+
+const (
+	SexMale   = "M"
+	SexFemale = "F"
+)
+
+const birthDateLayout = "2006-01-02"
+
+// FieldConfig overrides generation of a single field. Fields missing from
+// Config.Fields are faked.
+type FieldConfig struct {
+	Mode  string `yaml:"mode"`
+	Value string `yaml:"value"`
+}
+
+// Config selects locale, age range and per-field overrides.
+type Config struct {
+	Locale string                 `yaml:"locale"`
+	MinAge int                    `yaml:"min_age"`
+	MaxAge int                    `yaml:"max_age"`
+	Fields map[string]FieldConfig `yaml:"fields"`
+	// Distinct values of surname, name, patronymic or address, unlimited
+	// when missing. Limited fields are drawn from pools of interned values.
+	Cardinality map[string]int `yaml:"cardinality"`
+	// Transliteration, patterns and uniqueness of emails.
+	Email EmailConfig `yaml:"email"`
+	// Seed of pool values, so that generators with the same seed intern
+	// the same values. Set by programs rather than configured.
+	Seed int64 `yaml:"-"`
+}
+
+// Person is a generated set of personal data.
+type Person struct {
+	Surname    string
+	Name       string
+	Patronymic string
+	Sex        string
+	BirthDate  string
+	PhoneNum   string
+	Email      string
+	Address    string
+}
+
+// Generator generates persons of one locale. It keeps no state between
+// persons except pools of limited fields, so it is safe for concurrent use
+// with distinct sources.
+type Generator struct {
+	cfg    Config
+	locale *locale
+	// Pools of fields with cardinality limits, nil for unlimited ones.
+	surnames, names, patronymics, addresses *pool
+	// Transliteration and patterns of emails, and emails given out, nil
+	// unless they are unique.
+	translit      func(s string) string
+	emailPatterns []emailPattern
+	emails        *emailSet
+}
+
+// Locales returns names of supported locales.
+func Locales() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New validates cfg and creates a generator.
+func New(cfg Config) (*Generator, error) {
+	l, ok := locales[cfg.Locale]
+	if !ok {
+		return nil, fmt.Errorf("unknown locale \"%s\", supported are %s",
+			cfg.Locale, strings.Join(Locales(), ", "))
+	}
+	if cfg.MinAge <= 0 {
+		cfg.MinAge = 18
+	}
+	if cfg.MaxAge < cfg.MinAge {
+		cfg.MaxAge = cfg.MinAge + 62
+	}
+	for field, fieldCFG := range cfg.Fields {
+		switch field {
+		case FieldSurname, FieldName, FieldPatronymic, FieldSex,
+			FieldBirthDate, FieldPhoneNum, FieldEmail, FieldAddress:
+		default:
+			return nil, fmt.Errorf("unknown field \"%s\"", field)
+		}
+		if (fieldCFG.Mode != ModeFake) && (fieldCFG.Mode != ModeFixed) {
+			return nil, fmt.Errorf("unknown mode \"%s\" of field %s", fieldCFG.Mode, field)
+		}
+	}
+	g := &Generator{
+		cfg:      cfg,
+		locale:   l,
+		translit: l.translit,
+	}
+	if cfg.Email.Translit != "" {
+		translit, ok := translitSchemes[cfg.Email.Translit]
+		if !ok {
+			return nil, fmt.Errorf("unknown transliteration \"%s\", supported are %s, %s, %s",
+				cfg.Email.Translit, TranslitPassport, TranslitBGN, TranslitGOST)
+		}
+		g.translit = translit
+	}
+	patterns := cfg.Email.Patterns
+	if len(patterns) == 0 {
+		patterns = defaultEmailPatterns
+	}
+	for _, pattern := range patterns {
+		p, err := parseEmailPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		g.emailPatterns = append(g.emailPatterns, p)
+	}
+	if cfg.Email.Unique {
+		g.emails = &emailSet{taken: map[string]int{}}
+	}
+	for field, size := range cfg.Cardinality {
+		if size <= 0 {
+			return nil, fmt.Errorf("cardinality of %s must be positive, got %d", field, size)
+		}
+		// Gendered values have a variant per sex.
+		switch field {
+		case FieldSurname:
+			g.surnames = newPool(field, size, 2, cfg.Seed)
+		case FieldName:
+			g.names = newPool(field, size, 2, cfg.Seed)
+		case FieldPatronymic:
+			g.patronymics = newPool(field, size, 2, cfg.Seed)
+		case FieldAddress:
+			g.addresses = newPool(field, size, 1, cfg.Seed)
+		default:
+			return nil, fmt.Errorf("cardinality of field \"%s\" can not be limited", field)
+		}
+	}
+	return g, nil
+}
+
+// Cities returns cities of generated addresses.
+func (g *Generator) Cities() []string {
+	return append([]string{}, g.locale.cities...)
+}
+
+// Person generates a person aged relative to now from rnd. Fields are
+// consistent with each other: surname and patronymic agree with sex, email
+// is derived from name and surname.
+func (g *Generator) Person(rnd *rand.Rand, now time.Time) Person {
+	return g.Complete(rnd, now, Person{})
+}
+
+// Complete keeps non-empty fields of known and generates the others
+// consistently with them, e.g. names of the known sex and email of the known
+// surname. Fixed fields of Config do not override known ones. It draws from
+// rnd as much as Person does, whatever is known.
+func (g *Generator) Complete(rnd *rand.Rand, now time.Time, known Person) Person {
+	l := g.locale
+	female := rnd.Intn(2) == 0
+	if known.Sex != "" {
+		female = known.Sex == SexFemale
+	}
+	p := Person{Sex: SexMale}
+	if female {
+		p.Sex = SexFemale
+	}
+	sex := 0
+	if female {
+		sex = 1
+	}
+	p.Name = g.names.get(rnd, sex, func(rnd *rand.Rand) string {
+		if female {
+			return pick(rnd, l.femaleNames)
+		}
+		return pick(rnd, l.maleNames)
+	})
+	p.Surname = g.surnames.get(rnd, sex, func(rnd *rand.Rand) string {
+		return l.surname(pick(rnd, l.surnames), female)
+	})
+	p.Patronymic = g.patronymics.get(rnd, sex, func(rnd *rand.Rand) string {
+		return l.patronymic(rnd, female)
+	})
+	keep(&p.Name, known.Name)
+	keep(&p.Surname, known.Surname)
+	keep(&p.Patronymic, known.Patronymic)
+
+	age := g.cfg.MinAge + rnd.Intn(g.cfg.MaxAge-g.cfg.MinAge+1)
+	birthDate := now.AddDate(-age, 0, -rnd.Intn(365))
+	p.BirthDate = birthDate.Format(birthDateLayout)
+	if known.BirthDate != "" {
+		p.BirthDate = known.BirthDate
+		if t, err := time.Parse(birthDateLayout, known.BirthDate); err == nil {
+			birthDate = t
+		}
+	}
+
+	p.PhoneNum = l.phone(rnd)
+	domain := pick(rnd, l.emailDomains)
+	pattern := g.emailPatterns[rnd.Intn(len(g.emailPatterns))]
+	p.Email = pattern.local(rnd, g.translit, &p, birthDate.Year()) + "@" + domain
+	p.Address = g.addresses.get(rnd, 0, l.address)
+	keep(&p.PhoneNum, known.PhoneNum)
+	keep(&p.Email, known.Email)
+	keep(&p.Address, known.Address)
+
+	g.override(FieldSurname, &p.Surname, known.Surname)
+	g.override(FieldName, &p.Name, known.Name)
+	g.override(FieldPatronymic, &p.Patronymic, known.Patronymic)
+	g.override(FieldSex, &p.Sex, known.Sex)
+	g.override(FieldBirthDate, &p.BirthDate, known.BirthDate)
+	g.override(FieldPhoneNum, &p.PhoneNum, known.PhoneNum)
+	g.override(FieldEmail, &p.Email, known.Email)
+	g.override(FieldAddress, &p.Address, known.Address)
+	// Only generated emails are made unique.
+	if (known.Email == "") && !g.fixed(FieldEmail) {
+		p.Email = g.emails.claim(p.Email)
+	}
+	return p
+}
+
+func keep(value *string, known string) {
+	if known != "" {
+		*value = known
+	}
+}
+
+func (g *Generator) override(field string, value *string, known string) {
+	if g.fixed(field) && (known == "") {
+		*value = g.cfg.Fields[field].Value
+	}
+}
+
+func (g *Generator) fixed(field string) bool {
+	fieldCFG, ok := g.cfg.Fields[field]
+	return ok && (fieldCFG.Mode == ModeFixed)
+}
+
+func pick(rnd *rand.Rand, values []string) string {
+	return values[rnd.Intn(len(values))]
+}
+
+func digits(rnd *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + rnd.Intn(10))
+	}
+	return string(b)
+}
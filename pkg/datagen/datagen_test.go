@@ -0,0 +1,186 @@
+package datagen
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func BenchmarkPerson(b *testing.B) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, locale := range Locales() {
+		b.Run(locale, func(b *testing.B) {
+			g, err := New(Config{Locale: locale})
+			if err != nil {
+				b.Fatal(err)
+			}
+			rnd := rand.New(rand.NewSource(1))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				g.Person(rnd, now)
+			}
+		})
+	}
+}
+
+func BenchmarkPersonCardinality(b *testing.B) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cardinality := map[string]int{FieldSurname: 1000, FieldPatronymic: 1000, FieldAddress: 10000}
+	for _, locale := range Locales() {
+		b.Run(locale, func(b *testing.B) {
+			g, err := New(Config{Locale: locale, Cardinality: cardinality, Seed: 1})
+			if err != nil {
+				b.Fatal(err)
+			}
+			rnd := rand.New(rand.NewSource(1))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				g.Person(rnd, now)
+			}
+		})
+	}
+}
+
+func TestCardinality(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := Config{Locale: "ru_RU", Cardinality: map[string]int{FieldSurname: 5, FieldAddress: 3}, Seed: 1}
+	g, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rows of a run are generated from their own sources in any order.
+	other, _ := New(cfg)
+	reversed := make([]Person, 1000)
+	for i := len(reversed) - 1; i >= 0; i-- {
+		reversed[i] = other.Person(rand.New(rand.NewSource(int64(i))), now)
+	}
+	surnames, addresses, names := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for i := range reversed {
+		p := g.Person(rand.New(rand.NewSource(int64(i))), now)
+		if p != reversed[i] {
+			t.Fatalf("person %d is %+v and %+v in generators of the same seed", i, p, reversed[i])
+		}
+		surnames[p.Sex+p.Surname], addresses[p.Address], names[p.Name] = true, true, true
+	}
+	if (len(surnames) > 2*5) || (len(addresses) > 3) {
+		t.Errorf("%d surnames and %d addresses are generated, limits are 5 per sex and 3", len(surnames), len(addresses))
+	}
+	if len(names) <= 10 {
+		t.Errorf("only %d names are generated without a limit", len(names))
+	}
+
+	cfg.Seed = 2
+	reseeded, _ := New(cfg)
+	differ := false
+	for i := 0; i < 100; i++ {
+		p := reseeded.Person(rand.New(rand.NewSource(int64(i))), now)
+		differ = differ || (p.Address != g.Person(rand.New(rand.NewSource(int64(i))), now).Address)
+	}
+	if !differ {
+		t.Error("pools of other seeds intern the same addresses")
+	}
+
+	for _, cardinality := range []map[string]int{{FieldEmail: 10}, {FieldSurname: 0}} {
+		if _, err := New(Config{Locale: "ru_RU", Cardinality: cardinality}); err == nil {
+			t.Errorf("cardinality %v is accepted", cardinality)
+		}
+	}
+}
+
+func TestCoordinates(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range Locales() {
+		t.Run(name, func(t *testing.T) {
+			g, err := New(Config{Locale: name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := g.locale
+			if len(l.bounds) != len(l.cities) {
+				t.Fatalf("%d bounding boxes of %d cities", len(l.bounds), len(l.cities))
+			}
+			rnd := rand.New(rand.NewSource(1))
+			for i := 0; i < 1000; i++ {
+				address := g.Person(rnd, now).Address
+				lat, lon := g.Coordinates(address)
+				if again, _ := g.Coordinates(address); again != lat {
+					t.Fatalf("coordinates of %s change", address)
+				}
+				inside := false
+				for c, city := range l.cities {
+					b := l.bounds[c]
+					if strings.Contains(address, city) {
+						inside = (lat >= b.south) && (lat <= b.north) && (lon >= b.west) && (lon <= b.east)
+						break
+					}
+				}
+				if !inside {
+					t.Fatalf("%v, %v is outside the city of %s", lat, lon, address)
+				}
+			}
+			// Unknown addresses are still in one of the cities.
+			lat, lon := g.Coordinates("somewhere")
+			if (lat == 0) || (lon == 0) {
+				t.Errorf("unknown address is at %v, %v", lat, lon)
+			}
+		})
+	}
+}
+
+func TestEmail(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	known := Person{Name: "Юлия", Surname: "Щукина", Patronymic: "Ивановна", Sex: SexFemale}
+	for scheme, expected := range map[string]string{
+		"":               "iuliia.shchukina.ii",
+		TranslitPassport: "iuliia.shchukina.ii",
+		TranslitBGN:      "yuliya.shchukina.yi",
+		TranslitGOST:     "yuliya.shhukina.yi",
+	} {
+		g, err := New(Config{Locale: "ru_RU", Email: EmailConfig{Translit: scheme, Patterns: []string{"{name}.{surname}.{n}{p}"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if email := g.Complete(rand.New(rand.NewSource(1)), now, known).Email; !strings.HasPrefix(email, expected+"@") {
+			t.Errorf("email of %s scheme is %s, expected local part %s", scheme, email, expected)
+		}
+	}
+
+	g, err := New(Config{Locale: "ru_RU", Email: EmailConfig{Patterns: []string{"{n}.{surname}"}, Unique: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	emails := map[string]bool{}
+	suffixes := map[string]int{}
+	for i := 0; i < 60; i++ {
+		email := g.Complete(rnd, now, Person{Name: "Иван", Surname: "Иванов", Sex: SexMale}).Email
+		if emails[email] {
+			t.Fatalf("email %s is repeated", email)
+		}
+		emails[email] = true
+		at := strings.Index(email, "@")
+		local, domain := email[:at], email[at:]
+		// Suffixes of a domain are 2, 3 and so on.
+		suffixes[domain]++
+		expected := "i.ivanov"
+		if suffixes[domain] > 1 {
+			expected += strconv.Itoa(suffixes[domain])
+		}
+		if local != expected {
+			t.Errorf("local part is %s, expected %s", local, expected)
+		}
+	}
+	if email := g.Complete(rnd, now, Person{Email: "known@example.com"}).Email; email != "known@example.com" {
+		t.Errorf("known email is replaced by %s", email)
+	}
+
+	for _, cfg := range []EmailConfig{{Translit: "iso"}, {Patterns: []string{"{middle}"}}, {Patterns: []string{"{name"}}} {
+		if _, err := New(Config{Locale: "ru_RU", Email: cfg}); err == nil {
+			t.Errorf("email configuration %+v is accepted", cfg)
+		}
+	}
+}
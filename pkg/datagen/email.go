@@ -0,0 +1,179 @@
+package datagen
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Transliteration schemes of email local parts.
+const (
+	TranslitPassport = "passport"
+	TranslitBGN      = "bgn"
+	TranslitGOST     = "gost"
+)
+
+// EmailConfig configures local parts of generated emails.
+type EmailConfig struct {
+	// Transliteration of Cyrillic names, passport by default, bgn for
+	// BGN/PCGN or gost for GOST 7.79-2000 system B.
+	Translit string `yaml:"translit"`
+	// Patterns of local parts, one picked per person. Placeholders are
+	// {name}, {surname} and {patronymic}, their initials {n}, {s} and {p},
+	// {yy} for the birth year modulo 100 and {dd} for two random digits.
+	Patterns []string `yaml:"patterns"`
+	// Unique emails get the lowest free numeric suffix when their local
+	// part is taken, e.g. i.ivanov2.
+	Unique bool `yaml:"unique"`
+}
+
+var defaultEmailPatterns = []string{"{name}.{surname}", "{n}{surname}", "{surname}{yy}", "{name}_{surname}{dd}"}
+
+// translitSchemes convert Cyrillic to Latin, other letters are kept.
+var translitSchemes = map[string]func(s string) string{
+	TranslitPassport: ruTranslit,
+	TranslitBGN: newTranslit(map[string]string{
+		"ё": "e", "й": "y", "х": "kh", "ц": "ts", "щ": "shch", "ы": "y", "ю": "yu", "я": "ya",
+	}),
+	TranslitGOST: newTranslit(map[string]string{
+		"ё": "yo", "й": "j", "х": "x", "ц": "cz", "щ": "shh", "ы": "y", "ю": "yu", "я": "ya",
+	}),
+}
+
+// newTranslit returns a transliteration with letters of the passport scheme
+// replaced by differing ones, given in lower case.
+func newTranslit(differing map[string]string) func(s string) string {
+	common := map[string]string{
+		"а": "a", "б": "b", "в": "v", "г": "g", "д": "d", "е": "e", "ж": "zh", "з": "z", "и": "i",
+		"к": "k", "л": "l", "м": "m", "н": "n", "о": "o", "п": "p", "р": "r", "с": "s", "т": "t",
+		"у": "u", "ф": "f", "ч": "ch", "ш": "sh", "ъ": "", "ь": "", "э": "e",
+	}
+	for letter, latin := range differing {
+		common[letter] = latin
+	}
+	letters := make([]string, 0, len(common))
+	for letter := range common {
+		letters = append(letters, letter)
+	}
+	sort.Strings(letters)
+	pairs := []string{}
+	for _, letter := range letters {
+		latin := common[letter]
+		upper := latin
+		if latin != "" {
+			upper = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+		pairs = append(pairs, letter, latin, strings.ToUpper(letter), upper)
+	}
+	return strings.NewReplacer(pairs...).Replace
+}
+
+// emailPart is literal text or a placeholder of a local part.
+type emailPart struct {
+	text        string
+	placeholder string
+}
+
+type emailPattern []emailPart
+
+var emailPlaceholders = map[string]bool{
+	"name": true, "surname": true, "patronymic": true, "n": true, "s": true, "p": true, "yy": true, "dd": true,
+}
+
+func parseEmailPattern(pattern string) (emailPattern, error) {
+	p := emailPattern{}
+	for pattern != "" {
+		open := strings.Index(pattern, "{")
+		if open < 0 {
+			p = append(p, emailPart{text: pattern})
+			break
+		}
+		if open > 0 {
+			p = append(p, emailPart{text: pattern[:open]})
+		}
+		end := strings.Index(pattern[open:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in email pattern \"%s\"", pattern)
+		}
+		placeholder := pattern[open+1 : open+end]
+		if !emailPlaceholders[placeholder] {
+			return nil, fmt.Errorf("unknown placeholder {%s} in email pattern", placeholder)
+		}
+		p = append(p, emailPart{placeholder: placeholder})
+		pattern = pattern[open+end+1:]
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("email pattern is empty")
+	}
+	return p, nil
+}
+
+// local returns the local part of p for a person born in year, drawing
+// digits from rnd.
+func (p emailPattern) local(rnd *rand.Rand, translit func(s string) string, person *Person, year int) string {
+	b := strings.Builder{}
+	for _, part := range p {
+		switch part.placeholder {
+		case "":
+			b.WriteString(part.text)
+		case "name", "n":
+			b.WriteString(emailName(translit, person.Name, part.placeholder == "n"))
+		case "surname", "s":
+			b.WriteString(emailName(translit, person.Surname, part.placeholder == "s"))
+		case "patronymic", "p":
+			b.WriteString(emailName(translit, person.Patronymic, part.placeholder == "p"))
+		case "yy":
+			b.WriteString(strconv.Itoa(year % 100))
+		case "dd":
+			b.WriteString(digits(rnd, 2))
+		}
+	}
+	return b.String()
+}
+
+func emailName(translit func(s string) string, name string, initial bool) string {
+	name = strings.ToLower(translit(name))
+	if initial && (name != "") {
+		_, size := utf8.DecodeRuneInString(name)
+		return name[:size]
+	}
+	return name
+}
+
+// emailSet tracks emails given out, so that repeated ones get suffixes.
+type emailSet struct {
+	mu sync.Mutex
+	// Last suffix of every taken email, 1 without a suffix.
+	taken map[string]int
+}
+
+// claim returns email if it is free, or else email with the lowest free
+// suffix from 2 appended to its local part.
+func (s *emailSet) claim(email string) string {
+	if s == nil {
+		return email
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.taken[email]
+	if !ok {
+		s.taken[email] = 1
+		return email
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		at = len(email)
+	}
+	for {
+		n++
+		candidate := email[:at] + strconv.Itoa(n) + email[at:]
+		if _, ok := s.taken[candidate]; !ok {
+			s.taken[email], s.taken[candidate] = n, 1
+			return candidate
+		}
+	}
+}
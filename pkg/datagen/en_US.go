@@ -0,0 +1,98 @@
+package datagen
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+var enUS = &locale{
+	maleNames: []string{
+		"James", "John", "Robert", "Michael", "William", "David", "Richard",
+		"Joseph", "Thomas", "Charles", "Christopher", "Daniel", "Matthew",
+		"Anthony", "Mark", "Steven", "Paul", "Andrew", "Joshua", "Kevin",
+		"Brian", "George", "Timothy", "Ryan", "Jacob", "Ethan", "Noah",
+	},
+	femaleNames: []string{
+		"Mary", "Patricia", "Jennifer", "Linda", "Elizabeth", "Barbara", "Susan",
+		"Jessica", "Sarah", "Karen", "Lisa", "Nancy", "Betty", "Margaret",
+		"Sandra", "Ashley", "Emily", "Donna", "Michelle", "Amanda", "Melissa",
+		"Rebecca", "Laura", "Olivia", "Emma", "Sophia", "Hannah",
+	},
+	surnames: []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller",
+		"Davis", "Rodriguez", "Martinez", "Hernandez", "Lopez", "Gonzalez",
+		"Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin",
+		"Lee", "Perez", "Thompson", "White", "Harris", "Sanchez", "Clark",
+		"Ramirez", "Lewis", "Robinson", "Walker", "Young", "Allen", "King",
+		"Wright", "Scott", "Torres", "Nguyen", "Hill", "Flores", "Green",
+	},
+	emailDomains: []string{"gmail.com", "yahoo.com", "outlook.com", "hotmail.com", "aol.com", "icloud.com"},
+	cities:       enUSCityNames(),
+	bounds:       enUSCityBounds,
+
+	surname: func(surname string, female bool) string {
+		return surname
+	},
+	// Middle name takes the place of patronymic.
+	patronymic: func(rnd *rand.Rand, female bool) string {
+		if female {
+			return pick(rnd, enUSMiddleFemale)
+		}
+		return pick(rnd, enUSMiddleMale)
+	},
+	phone: func(rnd *rand.Rand) string {
+		n := digits(rnd, 7)
+		return fmt.Sprintf("+1 (%d%s) %d%s-%s",
+			2+rnd.Intn(8), digits(rnd, 2), 2+rnd.Intn(8), n[:2], n[2:6])
+	},
+	address: func(rnd *rand.Rand) string {
+		city := enUSCities[rnd.Intn(len(enUSCities))]
+		address := fmt.Sprintf("%d %s %s", 1+rnd.Intn(9999), pick(rnd, enUSStreets), pick(rnd, enUSStreetSuffixes))
+		if rnd.Intn(4) == 0 {
+			address += fmt.Sprintf(" Apt %d", 1+rnd.Intn(400))
+		}
+		return fmt.Sprintf("%s, %s, %s %s", address, city[0], city[1], digits(rnd, 5))
+	},
+	translit: func(s string) string {
+		return s
+	},
+}
+
+var enUSMiddleMale = []string{"Lee", "James", "Allen", "Ray", "Wayne", "Edward", "Joseph", "Alan", "Scott", "Michael"}
+
+var enUSMiddleFemale = []string{"Marie", "Ann", "Lynn", "Elizabeth", "Rose", "Jean", "Louise", "Grace", "Kay", "Nicole"}
+
+// enUSCities are city and state pairs.
+var enUSCities = [][2]string{
+	{"New York", "NY"}, {"Los Angeles", "CA"}, {"Chicago", "IL"}, {"Houston", "TX"},
+	{"Phoenix", "AZ"}, {"Philadelphia", "PA"}, {"San Antonio", "TX"}, {"San Diego", "CA"},
+	{"Dallas", "TX"}, {"Austin", "TX"}, {"Jacksonville", "FL"}, {"Columbus", "OH"},
+	{"Charlotte", "NC"}, {"Indianapolis", "IN"}, {"Seattle", "WA"}, {"Denver", "CO"},
+	{"Boston", "MA"}, {"Portland", "OR"}, {"Springfield", "IL"}, {"Madison", "WI"},
+}
+
+// enUSCityBounds are bounding boxes of enUSCities.
+var enUSCityBounds = []bounds{
+	{40.50, -74.25, 40.91, -73.70}, {33.70, -118.67, 34.34, -118.16}, {41.64, -87.94, 42.02, -87.52},
+	{29.52, -95.79, 30.11, -95.01}, {33.29, -112.32, 33.92, -111.93}, {39.87, -75.28, 40.14, -74.96},
+	{29.22, -98.81, 29.73, -98.22}, {32.53, -117.28, 33.11, -116.91}, {32.62, -96.99, 33.02, -96.56},
+	{30.10, -97.94, 30.52, -97.56}, {30.10, -82.05, 30.59, -81.39}, {39.81, -83.21, 40.16, -82.77},
+	{35.01, -81.01, 35.40, -80.65}, {39.63, -86.33, 39.93, -85.94}, {47.49, -122.44, 47.73, -122.24},
+	{39.61, -105.11, 39.91, -104.60}, {42.23, -71.19, 42.40, -70.99}, {45.43, -122.84, 45.65, -122.47},
+	{39.70, -89.75, 39.87, -89.56}, {43.00, -89.56, 43.17, -89.25},
+}
+
+func enUSCityNames() []string {
+	names := make([]string, len(enUSCities))
+	for i, city := range enUSCities {
+		names[i] = city[0] + ", " + city[1]
+	}
+	return names
+}
+
+var enUSStreets = []string{
+	"Main", "Oak", "Pine", "Maple", "Cedar", "Elm", "Washington", "Lake",
+	"Hill", "Park", "Lincoln", "Jackson", "Franklin", "Highland", "Sunset",
+}
+
+var enUSStreetSuffixes = []string{"St", "Ave", "Blvd", "Rd", "Ln", "Dr", "Ct", "Way"}
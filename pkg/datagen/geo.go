@@ -0,0 +1,33 @@
+package datagen
+
+import (
+	"hash/fnv"
+	"strings"
+)
+
+// bounds is a bounding box of a city in degrees.
+type bounds struct {
+	south, west, north, east float64
+}
+
+// Coordinates returns latitude and longitude of address within the bounding
+// box of its city. The point is derived from the address, so that the same
+// address is always at the same place. Addresses naming no city of the
+// locale, e.g. listed ones, are placed in a city picked by the address.
+func (g *Generator) Coordinates(address string) (latitude, longitude float64) {
+	l := g.locale
+	h := fnv.New64a()
+	h.Write([]byte(address))
+	sum := h.Sum64()
+	city := int(sum % uint64(len(l.cities)))
+	for i, name := range l.cities {
+		if strings.Contains(address, name) {
+			city = i
+			break
+		}
+	}
+	b := l.bounds[city]
+	// Halves of the hash place the point along each axis.
+	x, y := float64(sum>>32)/(1<<32), float64(uint32(sum))/(1<<32)
+	return b.south + y*(b.north-b.south), b.west + x*(b.east-b.west)
+}
@@ -0,0 +1,27 @@
+package datagen
+
+import "math/rand"
+
+// locale holds dictionaries and formats of one locale. surnames are in male
+// form, surname derives the female one where the language has it.
+type locale struct {
+	maleNames    []string
+	femaleNames  []string
+	surnames     []string
+	emailDomains []string
+	// Cities of addresses and their bounding boxes.
+	cities []string
+	bounds []bounds
+
+	surname    func(surname string, female bool) string
+	patronymic func(rnd *rand.Rand, female bool) string
+	phone      func(rnd *rand.Rand) string
+	address    func(rnd *rand.Rand) string
+	// translit converts names to ASCII for emails.
+	translit func(s string) string
+}
+
+var locales = map[string]*locale{
+	"ru_RU": ruRU,
+	"en_US": enUS,
+}
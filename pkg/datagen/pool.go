@@ -0,0 +1,52 @@
+package datagen
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+)
+
+// pool interns values of a field with limited cardinality. A row picks one
+// of size values per variant, e.g. sex of surnames, and every value is
+// generated once on first use from its own source derived from the seed, so
+// that values do not depend on the order rows pick them in.
+type pool struct {
+	size     int
+	variants int
+	seed     int64
+	mu       sync.RWMutex
+	values   []string
+}
+
+func newPool(field string, size, variants int, seed int64) *pool {
+	h := fnv.New64a()
+	h.Write([]byte(field))
+	return &pool{
+		size:     size,
+		variants: variants,
+		seed:     seed ^ int64(h.Sum64()),
+		values:   make([]string, size*variants),
+	}
+}
+
+// get picks a value of variant with rnd, generating it when it is missing.
+// nil pool generates a value from rnd, limiting nothing.
+func (p *pool) get(rnd *rand.Rand, variant int, generate func(rnd *rand.Rand) string) string {
+	if p == nil {
+		return generate(rnd)
+	}
+	i := rnd.Intn(p.size)*p.variants + variant
+	p.mu.RLock()
+	value := p.values[i]
+	p.mu.RUnlock()
+	if value != "" {
+		return value
+	}
+	value = generate(rand.New(rand.NewSource(p.seed + int64(i))))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.values[i] == "" {
+		p.values[i] = value
+	}
+	return p.values[i]
+}
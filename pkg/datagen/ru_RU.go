@@ -0,0 +1,146 @@
+package datagen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// ruFathers are male names with male and female patronymics derived from
+// them.
+var ruFathers = [][3]string{
+	{"Александр", "Александрович", "Александровна"},
+	{"Алексей", "Алексеевич", "Алексеевна"},
+	{"Андрей", "Андреевич", "Андреевна"},
+	{"Борис", "Борисович", "Борисовна"},
+	{"Василий", "Васильевич", "Васильевна"},
+	{"Виктор", "Викторович", "Викторовна"},
+	{"Владимир", "Владимирович", "Владимировна"},
+	{"Дмитрий", "Дмитриевич", "Дмитриевна"},
+	{"Евгений", "Евгеньевич", "Евгеньевна"},
+	{"Иван", "Иванович", "Ивановна"},
+	{"Игорь", "Игоревич", "Игоревна"},
+	{"Илья", "Ильич", "Ильинична"},
+	{"Константин", "Константинович", "Константиновна"},
+	{"Михаил", "Михайлович", "Михайловна"},
+	{"Никита", "Никитич", "Никитична"},
+	{"Николай", "Николаевич", "Николаевна"},
+	{"Олег", "Олегович", "Олеговна"},
+	{"Павел", "Павлович", "Павловна"},
+	{"Пётр", "Петрович", "Петровна"},
+	{"Сергей", "Сергеевич", "Сергеевна"},
+	{"Юрий", "Юрьевич", "Юрьевна"},
+}
+
+var ruRU = &locale{
+	maleNames: []string{
+		"Александр", "Алексей", "Андрей", "Артём", "Борис", "Вадим", "Василий",
+		"Виктор", "Владимир", "Глеб", "Дмитрий", "Евгений", "Егор", "Иван",
+		"Игорь", "Илья", "Кирилл", "Константин", "Максим", "Матвей", "Михаил",
+		"Никита", "Николай", "Олег", "Павел", "Роман", "Сергей", "Тимур",
+		"Фёдор", "Юрий", "Ярослав",
+	},
+	femaleNames: []string{
+		"Александра", "Алина", "Анастасия", "Анна", "Валентина", "Вера",
+		"Виктория", "Дарья", "Екатерина", "Елена", "Елизавета", "Ирина",
+		"Ксения", "Лариса", "Любовь", "Марина", "Мария", "Надежда", "Наталья",
+		"Ольга", "Полина", "Светлана", "Софья", "Татьяна", "Юлия",
+	},
+	surnames: []string{
+		"Иванов", "Смирнов", "Кузнецов", "Попов", "Васильев", "Петров",
+		"Соколов", "Михайлов", "Новиков", "Фёдоров", "Морозов", "Волков",
+		"Алексеев", "Лебедев", "Семёнов", "Егоров", "Павлов", "Козлов",
+		"Степанов", "Николаев", "Орлов", "Андреев", "Макаров", "Никитин",
+		"Захаров", "Зайцев", "Соловьёв", "Борисов", "Яковлев", "Григорьев",
+		"Романов", "Воробьёв", "Сергеев", "Фролов", "Белов", "Ильин",
+		"Гусев", "Титов", "Кузьмин", "Баранов", "Куликов", "Карпов",
+		"Ковалевский", "Вишневский", "Зарецкий", "Черных", "Шевченко", "Кравец",
+	},
+	emailDomains: []string{"mail.ru", "yandex.ru", "gmail.com", "rambler.ru", "bk.ru", "list.ru"},
+	cities:       ruCities,
+	bounds:       ruCityBounds,
+
+	surname: func(surname string, female bool) string {
+		if !female {
+			return surname
+		}
+		switch {
+		case strings.HasSuffix(surname, "ский"), strings.HasSuffix(surname, "цкий"):
+			return strings.TrimSuffix(surname, "ий") + "ая"
+		case strings.HasSuffix(surname, "ов"), strings.HasSuffix(surname, "ев"),
+			strings.HasSuffix(surname, "ёв"), strings.HasSuffix(surname, "ин"),
+			strings.HasSuffix(surname, "ын"):
+			return surname + "а"
+		}
+		return surname
+	},
+	patronymic: func(rnd *rand.Rand, female bool) string {
+		father := ruFathers[rnd.Intn(len(ruFathers))]
+		if female {
+			return father[2]
+		}
+		return father[1]
+	},
+	phone: func(rnd *rand.Rand) string {
+		n := digits(rnd, 9)
+		return fmt.Sprintf("+7 (9%s) %s-%s-%s", n[:2], n[2:5], n[5:7], n[7:])
+	},
+	address: func(rnd *rand.Rand) string {
+		city := pick(rnd, ruCities)
+		street := pick(rnd, ruStreets)
+		address := fmt.Sprintf("г. %s, %s, д. %d", city, street, 1+rnd.Intn(150))
+		if rnd.Intn(4) == 0 {
+			address += fmt.Sprintf(", корп. %d", 1+rnd.Intn(5))
+		}
+		if rnd.Intn(5) != 0 {
+			address += fmt.Sprintf(", кв. %d", 1+rnd.Intn(300))
+		}
+		return address
+	},
+	translit: ruTranslit,
+}
+
+var ruCities = []string{
+	"Москва", "Санкт-Петербург", "Новосибирск", "Екатеринбург", "Казань",
+	"Нижний Новгород", "Челябинск", "Самара", "Омск", "Ростов-на-Дону",
+	"Уфа", "Красноярск", "Воронеж", "Пермь", "Волгоград", "Краснодар",
+	"Тюмень", "Иркутск", "Ярославль", "Владивосток",
+}
+
+// ruCityBounds are bounding boxes of ruCities.
+var ruCityBounds = []bounds{
+	{55.57, 37.37, 55.91, 37.85}, {59.80, 30.10, 60.09, 30.55}, {54.91, 82.75, 55.12, 83.15},
+	{56.74, 60.47, 56.93, 60.75}, {55.71, 48.98, 55.88, 49.25}, {56.21, 43.78, 56.38, 44.10},
+	{55.06, 61.28, 55.27, 61.55}, {53.14, 50.05, 53.32, 50.30}, {54.88, 73.20, 55.08, 73.52},
+	{47.18, 39.58, 47.30, 39.82}, {54.65, 55.87, 54.84, 56.12}, {55.96, 92.75, 56.08, 93.07},
+	{51.60, 39.08, 51.76, 39.30}, {57.93, 56.10, 58.10, 56.38}, {48.60, 44.37, 48.82, 44.60},
+	{44.99, 38.90, 45.10, 39.10}, {57.09, 65.43, 57.20, 65.65}, {52.22, 104.20, 52.35, 104.38},
+	{57.57, 39.78, 57.71, 39.97}, {43.08, 131.85, 43.20, 132.00},
+}
+
+var ruStreets = []string{
+	"ул. Ленина", "ул. Гагарина", "ул. Мира", "ул. Советская", "ул. Садовая",
+	"ул. Пушкина", "ул. Лесная", "ул. Школьная", "ул. Молодёжная",
+	"ул. Центральная", "пр-т Победы", "пр-т Ленинградский", "ул. Набережная",
+	"пер. Почтовый", "ул. Строителей", "б-р Цветной", "ш. Энтузиастов",
+}
+
+// ruTranslit follows the simplified passport transliteration.
+var ruTranslit = strings.NewReplacer(
+	"А", "A", "Б", "B", "В", "V", "Г", "G", "Д", "D", "Е", "E", "Ё", "E",
+	"Ж", "Zh", "З", "Z", "И", "I", "Й", "I", "К", "K", "Л", "L", "М", "M",
+	"Н", "N", "О", "O", "П", "P", "Р", "R", "С", "S", "Т", "T", "У", "U",
+	"Ф", "F", "Х", "Kh", "Ц", "Ts", "Ч", "Ch", "Ш", "Sh", "Щ", "Shch",
+	"Ъ", "", "Ы", "Y", "Ь", "", "Э", "E", "Ю", "Iu", "Я", "Ia",
+	"а", "a", "б", "b", "в", "v", "г", "g", "д", "d", "е", "e", "ё", "e",
+	"ж", "zh", "з", "z", "и", "i", "й", "i", "к", "k", "л", "l", "м", "m",
+	"н", "n", "о", "o", "п", "p", "р", "r", "с", "s", "т", "t", "у", "u",
+	"ф", "f", "х", "kh", "ц", "ts", "ч", "ch", "ш", "sh", "щ", "shch",
+	"ъ", "", "ы", "y", "ь", "", "э", "e", "ю", "iu", "я", "ia",
+).Replace
+
+// Translit converts Cyrillic letters of s to Latin ones by the simplified
+// passport transliteration and keeps other characters.
+func Translit(s string) string {
+	return ruTranslit(s)
+}
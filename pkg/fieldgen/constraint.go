@@ -0,0 +1,243 @@
+package fieldgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Constraint is a rule fields of a row satisfy:
+//
+//	birthdate < ts
+//	if sex == F then patronymic endswith 'вна'
+//	if tier == gold then age >= 30 and age <= 70 or vip == yes
+//
+// Comparisons are ==, !=, <, <=, >, >=, startswith, endswith and contains.
+// Values compare as numbers when both are numbers and as strings otherwise,
+// so that dates and timestamps compare in time order. The left side of a
+// comparison is a field, the right side a field, a quoted string or a word
+// naming no field. "and" binds tighter than "or".
+type Constraint struct {
+	expr string
+	// Conditions of if, nil without it, and the rule, each a disjunction of
+	// conjunctions.
+	cond, rule [][]comparison
+}
+
+type operand struct {
+	field string
+	value string
+}
+
+func (o operand) get(row map[string]string) string {
+	if o.field != "" {
+		return row[o.field]
+	}
+	return o.value
+}
+
+type comparison struct {
+	left, right operand
+	op          string
+}
+
+var comparisonOps = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+	"startswith": true, "endswith": true, "contains": true,
+}
+
+// ParseConstraint parses a constraint on known fields.
+func ParseConstraint(expr string, known []string) (*Constraint, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint \"%s\": %v", expr, err)
+	}
+	p := &constraintParser{tokens: tokens, known: map[string]bool{}}
+	for _, name := range known {
+		p.known[name] = true
+	}
+	c := &Constraint{expr: expr}
+	if p.keyword("if") {
+		if c.cond, err = p.disjunction(); err == nil {
+			if !p.keyword("then") {
+				err = fmt.Errorf("if has no then")
+			}
+		}
+	}
+	if err == nil {
+		c.rule, err = p.disjunction()
+	}
+	if (err == nil) && (p.pos < len(p.tokens)) {
+		err = fmt.Errorf("unexpected \"%s\"", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint \"%s\": %v", expr, err)
+	}
+	return c, nil
+}
+
+// String returns the expression of c.
+func (c *Constraint) String() string {
+	return c.expr
+}
+
+// Check reports whether row satisfies c.
+func (c *Constraint) Check(row map[string]string) bool {
+	if (c.cond != nil) && !holds(c.cond, row) {
+		return true
+	}
+	return holds(c.rule, row)
+}
+
+func holds(disjunction [][]comparison, row map[string]string) bool {
+	for _, conjunction := range disjunction {
+		all := true
+		for _, cmp := range conjunction {
+			if !cmp.holds(row) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparison) holds(row map[string]string) bool {
+	left, right := c.left.get(row), c.right.get(row)
+	switch c.op {
+	case "startswith":
+		return strings.HasPrefix(left, right)
+	case "endswith":
+		return strings.HasSuffix(left, right)
+	case "contains":
+		return strings.Contains(left, right)
+	}
+	order := compareValues(left, right)
+	switch c.op {
+	case "==":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	}
+	return order >= 0
+}
+
+func compareValues(a, b string) int {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if (errX != nil) || (errY != nil) {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func isOperatorByte(b byte) bool {
+	return (b == '=') || (b == '!') || (b == '<') || (b == '>')
+}
+
+func tokenize(expr string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(expr); {
+		switch b := expr[i]; {
+		case (b == ' ') || (b == '\t'):
+			i++
+		case (b == '\'') || (b == '"'):
+			end := strings.IndexByte(expr[i+1:], b)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed quote")
+			}
+			tokens = append(tokens, token{text: expr[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case isOperatorByte(b):
+			j := i + 1
+			if (j < len(expr)) && (expr[j] == '=') {
+				j++
+			}
+			tokens = append(tokens, token{text: expr[i:j]})
+			i = j
+		default:
+			j := i
+			for (j < len(expr)) && !strings.ContainsRune(" \t'\"", rune(expr[j])) && !isOperatorByte(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, token{text: expr[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type constraintParser struct {
+	tokens []token
+	pos    int
+	known  map[string]bool
+}
+
+// keyword consumes the unquoted word if it is next.
+func (p *constraintParser) keyword(word string) bool {
+	if (p.pos < len(p.tokens)) && !p.tokens[p.pos].quoted && (p.tokens[p.pos].text == word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *constraintParser) disjunction() ([][]comparison, error) {
+	disjunction := [][]comparison{}
+	for {
+		conjunction := []comparison{}
+		for {
+			cmp, err := p.comparison()
+			if err != nil {
+				return nil, err
+			}
+			conjunction = append(conjunction, cmp)
+			if !p.keyword("and") {
+				break
+			}
+		}
+		disjunction = append(disjunction, conjunction)
+		if !p.keyword("or") {
+			return disjunction, nil
+		}
+	}
+}
+
+func (p *constraintParser) comparison() (comparison, error) {
+	if p.pos+3 > len(p.tokens) {
+		return comparison{}, fmt.Errorf("comparison is incomplete")
+	}
+	left, op, right := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	p.pos += 3
+	if left.quoted || !p.known[left.text] {
+		return comparison{}, fmt.Errorf("\"%s\" is not a known field", left.text)
+	}
+	if op.quoted || !comparisonOps[op.text] {
+		return comparison{}, fmt.Errorf("unknown comparison \"%s\"", op.text)
+	}
+	cmp := comparison{left: operand{field: left.text}, op: op.text, right: operand{value: right.text}}
+	if !right.quoted && p.known[right.text] {
+		cmp.right = operand{field: right.text}
+	}
+	return cmp, nil
+}
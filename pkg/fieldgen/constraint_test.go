@@ -0,0 +1,43 @@
+package fieldgen
+
+import "testing"
+
+func TestConstraint(t *testing.T) {
+	known := []string{"sex", "patronymic", "birthdate", "ts", "age"}
+	female := map[string]string{"sex": "F", "patronymic": "Ивановна", "birthdate": "1980-05-01",
+		"ts": "2020-01-01 00:00:00", "age": "39"}
+	male := map[string]string{"sex": "M", "patronymic": "Иванович", "birthdate": "2021-05-01",
+		"ts": "2020-01-01 00:00:00", "age": "9"}
+	for _, test := range []struct {
+		expr         string
+		female, male bool
+	}{
+		{"birthdate < ts", true, false},
+		{"if sex == F then patronymic endswith 'вна'", true, true},
+		{"if sex == 'M' then patronymic endswith вна", true, false},
+		{"age >= 18 and age < 100", true, false},
+		// Numbers compare as numbers, "9" > "10" as strings.
+		{"age < 10", false, true},
+		{"sex == M or patronymic contains ван", true, true},
+		{"if sex != F then birthdate <= ts and patronymic startswith Иван", true, false},
+	} {
+		c, err := ParseConstraint(test.expr, known)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Check(female); got != test.female {
+			t.Errorf("%s is %v for %v", test.expr, got, female)
+		}
+		if got := c.Check(male); got != test.male {
+			t.Errorf("%s is %v for %v", test.expr, got, male)
+		}
+	}
+	for _, expr := range []string{
+		"birthdat < ts", "'sex' == F", "sex = F", "sex ==", "if sex == F patronymic endswith вна",
+		"sex == F and", "sex == 'F", "sex == F extra",
+	} {
+		if _, err := ParseConstraint(expr, known); err == nil {
+			t.Errorf("%s is accepted", expr)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package fieldgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/datagen"
+)
+
+const timestampLayout = "2006-01-02 15:04:05"
+
+// exprNode is a field, a literal or a function call of a computed value.
+type exprNode interface {
+	eval(row map[string]string) string
+	// fields adds fields the node refers to.
+	fields(refs []string) []string
+}
+
+type fieldRef string
+
+func (n fieldRef) eval(row map[string]string) string {
+	return row[string(n)]
+}
+
+func (n fieldRef) fields(refs []string) []string {
+	return append(refs, string(n))
+}
+
+type literal string
+
+func (n literal) eval(row map[string]string) string {
+	return string(n)
+}
+
+func (n literal) fields(refs []string) []string {
+	return refs
+}
+
+type call struct {
+	f    function
+	args []exprNode
+}
+
+func (n *call) eval(row map[string]string) string {
+	args := make([]string, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.eval(row)
+	}
+	return n.f.eval(args)
+}
+
+func (n *call) fields(refs []string) []string {
+	for _, arg := range n.args {
+		refs = arg.fields(refs)
+	}
+	return refs
+}
+
+// function takes from min to max arguments, any number from min with
+// negative max.
+type function struct {
+	min, max int
+	eval     func(args []string) string
+}
+
+var functions = map[string]function{
+	"upper":    {1, 1, func(args []string) string { return strings.ToUpper(args[0]) }},
+	"lower":    {1, 1, func(args []string) string { return strings.ToLower(args[0]) }},
+	"trim":     {1, 1, func(args []string) string { return strings.TrimSpace(args[0]) }},
+	"translit": {1, 1, func(args []string) string { return datagen.Translit(args[0]) }},
+	"concat":   {1, -1, func(args []string) string { return strings.Join(args, "") }},
+	"length":   {1, 1, func(args []string) string { return strconv.Itoa(len([]rune(args[0]))) }},
+	"substr":   {2, 3, substr},
+	"year": {1, 1, func(args []string) string {
+		if t, ok := parseTime(args[0]); ok {
+			return strconv.Itoa(t.Year())
+		}
+		return ""
+	}},
+	"yearsBetween": {2, 2, yearsBetween},
+	"daysBetween": {2, 2, func(args []string) string {
+		from, okFrom := parseTime(args[0])
+		to, okTo := parseTime(args[1])
+		if !okFrom || !okTo {
+			return ""
+		}
+		return strconv.Itoa(int(to.Sub(from).Hours() / 24))
+	}},
+}
+
+// substr returns length characters of s from start, counted from 1, or the
+// rest of s without length.
+func substr(args []string) string {
+	s := []rune(args[0])
+	start, err := strconv.Atoi(args[1])
+	if (err != nil) || (start < 1) || (start > len(s)) {
+		return ""
+	}
+	end := len(s)
+	if len(args) == 3 {
+		length, err := strconv.Atoi(args[2])
+		if (err != nil) || (length < 0) {
+			return ""
+		}
+		if start-1+length < end {
+			end = start - 1 + length
+		}
+	}
+	return string(s[start-1 : end])
+}
+
+// yearsBetween returns full years from the first date to the second, e.g.
+// the age at a timestamp.
+func yearsBetween(args []string) string {
+	from, okFrom := parseTime(args[0])
+	to, okTo := parseTime(args[1])
+	if !okFrom || !okTo {
+		return ""
+	}
+	years := to.Year() - from.Year()
+	if (to.Month() < from.Month()) || ((to.Month() == from.Month()) && (to.Day() < from.Day())) {
+		years--
+	}
+	return strconv.Itoa(years)
+}
+
+// parseTime parses dates and timestamps of generated columns.
+func parseTime(s string) (time.Time, bool) {
+	layout := dateLayout
+	if len(s) > len(dateLayout) {
+		layout = timestampLayout
+	}
+	t, err := time.Parse(layout, s)
+	return t, err == nil
+}
+
+// computed is a value computed from other fields of the row.
+type computed struct {
+	root exprNode
+}
+
+func (g *computed) generate(rnd *rand.Rand, row map[string]string) string {
+	return g.root.eval(row)
+}
+
+func newComputed(arg string) (*computed, error) {
+	p := &exprParser{s: arg}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected \"%s\"", p.s[p.pos:])
+	}
+	return &computed{root: root}, nil
+}
+
+func isNameByte(b byte) bool {
+	return (b == '_') || ((b >= 'a') && (b <= 'z')) || ((b >= 'A') && (b <= 'Z')) || ((b >= '0') && (b <= '9'))
+}
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func (p *exprParser) skipSpaces() {
+	for (p.pos < len(p.s)) && (p.s[p.pos] == ' ') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) parse() (exprNode, error) {
+	p.skipSpaces()
+	if p.pos == len(p.s) {
+		return nil, fmt.Errorf("expression is incomplete")
+	}
+	switch b := p.s[p.pos]; {
+	case (b == '\'') || (b == '"'):
+		end := strings.IndexByte(p.s[p.pos+1:], b)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed quote")
+		}
+		value := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return literal(value), nil
+	case (b == '-') || ((b >= '0') && (b <= '9')):
+		start := p.pos
+		p.pos++
+		for (p.pos < len(p.s)) && (((p.s[p.pos] >= '0') && (p.s[p.pos] <= '9')) || (p.s[p.pos] == '.')) {
+			p.pos++
+		}
+		return literal(p.s[start:p.pos]), nil
+	}
+	start := p.pos
+	for (p.pos < len(p.s)) && isNameByte(p.s[p.pos]) {
+		p.pos++
+	}
+	name := p.s[start:p.pos]
+	if name == "" {
+		return nil, fmt.Errorf("unexpected \"%s\"", p.s[p.pos:])
+	}
+	p.skipSpaces()
+	if (p.pos == len(p.s)) || (p.s[p.pos] != '(') {
+		return fieldRef(name), nil
+	}
+	p.pos++
+	f, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	n := &call{f: f}
+	p.skipSpaces()
+	if (p.pos < len(p.s)) && (p.s[p.pos] == ')') {
+		p.pos++
+	} else {
+		for {
+			arg, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			n.args = append(n.args, arg)
+			p.skipSpaces()
+			if p.pos == len(p.s) {
+				return nil, fmt.Errorf("unclosed ( of %s", name)
+			}
+			p.pos++
+			if p.s[p.pos-1] == ')' {
+				break
+			}
+			if p.s[p.pos-1] != ',' {
+				return nil, fmt.Errorf("unexpected \"%s\" in arguments of %s", p.s[p.pos-1:], name)
+			}
+		}
+	}
+	if (len(n.args) < f.min) || ((f.max >= 0) && (len(n.args) > f.max)) {
+		return nil, fmt.Errorf("wrong number of arguments of %s: %d", name, len(n.args))
+	}
+	return n, nil
+}
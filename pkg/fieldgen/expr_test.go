@@ -0,0 +1,37 @@
+package fieldgen
+
+import "testing"
+
+func TestComputed(t *testing.T) {
+	known := []string{"name", "surname", "birthdate", "ts"}
+	e, err := New(map[string]string{
+		"age":       "expr:yearsBetween(birthdate, ts)",
+		"days":      "expr:daysBetween('2019-12-30', ts)",
+		"name_norm": "expr:upper(translit(name))",
+		"initials":  "expr:concat(substr(name, 1, 1), '. ', substr(surname, 1, 1), '.')",
+		"login":     "template:{name|lower}",
+		"login_len": "expr:length(login)",
+		"born":      "expr:year(birthdate)",
+	}, known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := map[string]string{"name": "Юлия", "surname": "Щукина", "birthdate": "1990-01-02", "ts": "2020-01-01 12:00:00"}
+	e.Fill(nil, row)
+	for field, expected := range map[string]string{
+		"age": "29", "days": "2", "name_norm": "IULIIA", "initials": "Ю. Щ.", "login_len": "4", "born": "1990",
+	} {
+		if row[field] != expected {
+			t.Errorf("%s is %q, expected %q", field, row[field], expected)
+		}
+	}
+
+	for _, expr := range []string{
+		"expr:upper(name", "expr:unknown(name)", "expr:upper(name, surname)", "expr:upper(nam)",
+		"expr:upper(name) name", "expr:concat()", "expr:substr(name)", "expr:upper(age)",
+	} {
+		if _, err := New(map[string]string{"age": "expr:yearsBetween(birthdate, ts)", "x": expr}, known); err == nil {
+			t.Errorf("%s is accepted", expr)
+		}
+	}
+}
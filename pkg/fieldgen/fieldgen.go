@@ -0,0 +1,213 @@
+// Package fieldgen generates field values from configuration expressions:
+//
+//	regex:\d{2} \d{2} \d{6}                    string matching the regexp
+//	template:{name|lower}.{surname}@mail.com   other fields of the row
+//	date:1950-01-01..2005-12-31                uniform date in the range
+//	int:1..100                                 uniform integer in the range
+//	choice:red|green|blue                      one of the values
+//	const:value                                the value as is
+//	expr:upper(translit(name))                 computed from other fields
+//
+// Functions of expr: are upper, lower, trim, translit, concat(a, b, ...),
+// length, substr(s, start[, length]) counting from 1, year of a date, and
+// yearsBetween and daysBetween of dates or timestamps. Arguments are
+// fields, quoted strings, numbers and calls.
+//
+// Constraints check fields of generated rows, see Constraint.
+package fieldgen
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+type generator interface {
+	generate(rnd *rand.Rand, row map[string]string) string
+}
+
+type field struct {
+	name string
+	gen  generator
+}
+
+// Engine fills fields of rows. Templates are filled after other fields, so
+// they may refer to them, and computed fields last, so they may refer to
+// every field but computed ones.
+type Engine struct {
+	fields []field
+}
+
+// New parses expressions of fields. Templates may refer to known fields and
+// to fields of exprs that are not templates, computed fields to known fields
+// and fields of exprs that are not computed.
+func New(exprs map[string]string, known []string) (*Engine, error) {
+	names := make([]string, 0, len(exprs))
+	for name := range exprs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	e := &Engine{}
+	templates, computedFields := []field{}, []field{}
+	refs := map[string]bool{}
+	for _, name := range known {
+		refs[name] = true
+	}
+	for _, name := range names {
+		gen, err := parse(exprs[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression of field %s: %v", name, err)
+		}
+		switch gen.(type) {
+		case *template:
+			templates = append(templates, field{name: name, gen: gen})
+			continue
+		case *computed:
+			computedFields = append(computedFields, field{name: name, gen: gen})
+			continue
+		}
+		refs[name] = true
+		e.fields = append(e.fields, field{name: name, gen: gen})
+	}
+	for _, f := range templates {
+		for _, part := range f.gen.(*template).parts {
+			if (part.field != "") && !refs[part.field] {
+				return nil, fmt.Errorf("template of field %s refers to unknown field %s", f.name, part.field)
+			}
+		}
+	}
+	for _, f := range templates {
+		refs[f.name] = true
+	}
+	for _, f := range computedFields {
+		for _, ref := range f.gen.(*computed).root.fields(nil) {
+			if !refs[ref] {
+				return nil, fmt.Errorf("expression of field %s refers to unknown field %s", f.name, ref)
+			}
+		}
+	}
+	e.fields = append(append(e.fields, templates...), computedFields...)
+	return e, nil
+}
+
+// Names returns names of fields in the order they are filled.
+func (e *Engine) Names() []string {
+	names := make([]string, len(e.fields))
+	for i, f := range e.fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// Fill sets generated fields of row.
+func (e *Engine) Fill(rnd *rand.Rand, row map[string]string) {
+	for _, f := range e.fields {
+		row[f.name] = f.gen.generate(rnd, row)
+	}
+}
+
+func parse(expr string) (generator, error) {
+	colon := strings.Index(expr, ":")
+	if colon < 0 {
+		return nil, fmt.Errorf("expression \"%s\" has no kind", expr)
+	}
+	kind, arg := expr[:colon], expr[colon+1:]
+	switch kind {
+	case "regex":
+		return newRegex(arg)
+	case "template":
+		return newTemplate(arg)
+	case "date":
+		return newDateRange(arg)
+	case "int":
+		return newIntRange(arg)
+	case "choice":
+		return choice(strings.Split(arg, "|")), nil
+	case "const":
+		return constant(arg), nil
+	case "expr":
+		return newComputed(arg)
+	}
+	return nil, fmt.Errorf("unknown expression kind \"%s\"", kind)
+}
+
+func splitRange(arg string) (string, string, error) {
+	bounds := strings.Split(arg, "..")
+	if len(bounds) != 2 {
+		return "", "", fmt.Errorf("range \"%s\" is not min..max", arg)
+	}
+	return strings.TrimSpace(bounds[0]), strings.TrimSpace(bounds[1]), nil
+}
+
+type dateRange struct {
+	min  time.Time
+	days int
+}
+
+func newDateRange(arg string) (*dateRange, error) {
+	from, to, err := splitRange(arg)
+	if err != nil {
+		return nil, err
+	}
+	min, err := time.Parse(dateLayout, from)
+	if err != nil {
+		return nil, err
+	}
+	max, err := time.Parse(dateLayout, to)
+	if err != nil {
+		return nil, err
+	}
+	if max.Before(min) {
+		return nil, fmt.Errorf("date range %s is empty", arg)
+	}
+	return &dateRange{min: min, days: int(max.Sub(min).Hours()/24) + 1}, nil
+}
+
+func (g *dateRange) generate(rnd *rand.Rand, row map[string]string) string {
+	return g.min.AddDate(0, 0, rnd.Intn(g.days)).Format(dateLayout)
+}
+
+type intRange struct {
+	min, max int64
+}
+
+func newIntRange(arg string) (*intRange, error) {
+	from, to, err := splitRange(arg)
+	if err != nil {
+		return nil, err
+	}
+	min, err := strconv.ParseInt(from, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	max, err := strconv.ParseInt(to, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if max < min {
+		return nil, fmt.Errorf("integer range %s is empty", arg)
+	}
+	return &intRange{min: min, max: max}, nil
+}
+
+func (g *intRange) generate(rnd *rand.Rand, row map[string]string) string {
+	return strconv.FormatInt(g.min+rnd.Int63n(g.max-g.min+1), 10)
+}
+
+type choice []string
+
+func (g choice) generate(rnd *rand.Rand, row map[string]string) string {
+	return g[rnd.Intn(len(g))]
+}
+
+type constant string
+
+func (g constant) generate(rnd *rand.Rand, row map[string]string) string {
+	return string(g)
+}
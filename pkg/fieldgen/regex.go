@@ -0,0 +1,105 @@
+package fieldgen
+
+import (
+	"math/rand"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// maxRepeat bounds unbounded repetitions like * and +.
+const maxRepeat = 8
+
+// Printable ASCII, which replaces the rest of Unicode in negated classes and
+// the dot.
+const (
+	minPrintable = 0x20
+	maxPrintable = 0x7e
+)
+
+type regex struct {
+	re *syntax.Regexp
+}
+
+func newRegex(arg string) (*regex, error) {
+	re, err := syntax.Parse(arg, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	return &regex{re: re}, nil
+}
+
+func (g *regex) generate(rnd *rand.Rand, row map[string]string) string {
+	b := strings.Builder{}
+	generateRegex(rnd, g.re, &b)
+	return b.String()
+}
+
+func generateRegex(rnd *rand.Rand, re *syntax.Regexp, b *strings.Builder) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			b.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		b.WriteRune(randomClassRune(rnd, re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteRune(rune(minPrintable + rnd.Intn(maxPrintable-minPrintable+1)))
+	case syntax.OpCapture, syntax.OpConcat:
+		for _, sub := range re.Sub {
+			generateRegex(rnd, sub, b)
+		}
+	case syntax.OpAlternate:
+		generateRegex(rnd, re.Sub[rnd.Intn(len(re.Sub))], b)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, maxRepeat
+		case syntax.OpPlus:
+			min, max = 1, maxRepeat
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+		if max < 0 {
+			max = min + maxRepeat
+		}
+		for n := min + rnd.Intn(max-min+1); n > 0; n-- {
+			generateRegex(rnd, re.Sub[0], b)
+		}
+	}
+}
+
+// randomClassRune picks a rune of a class given as pairs of bounds,
+// uniformly over its runes. Control characters are skipped, and ranges up to
+// the last rune, as in negated classes, end with printable ASCII.
+func randomClassRune(rnd *rand.Rand, ranges []rune) rune {
+	clipped := []rune{}
+	total := 0
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		if hi == unicode.MaxRune {
+			hi = maxPrintable
+		}
+		if (lo < minPrintable) && (hi >= minPrintable) {
+			lo = minPrintable
+		}
+		if lo > hi {
+			continue
+		}
+		clipped = append(clipped, lo, hi)
+		total += int(hi-lo) + 1
+	}
+	if total == 0 {
+		return '?'
+	}
+	n := rnd.Intn(total)
+	for i := 0; i < len(clipped); i += 2 {
+		size := int(clipped[i+1]-clipped[i]) + 1
+		if n < size {
+			return clipped[i] + rune(n)
+		}
+		n -= size
+	}
+	return '?'
+}
@@ -0,0 +1,70 @@
+package fieldgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// templatePart is literal text or a field with an optional lower or upper
+// modifier.
+type templatePart struct {
+	text     string
+	field    string
+	modifier string
+}
+
+type template struct {
+	parts []templatePart
+}
+
+func newTemplate(arg string) (*template, error) {
+	t := &template{}
+	for arg != "" {
+		open := strings.Index(arg, "{")
+		if open < 0 {
+			t.parts = append(t.parts, templatePart{text: arg})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{text: arg[:open]})
+		}
+		end := strings.Index(arg[open:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in template")
+		}
+		ref := arg[open+1 : open+end]
+		part := templatePart{field: ref}
+		if bar := strings.Index(ref, "|"); bar >= 0 {
+			part.field, part.modifier = ref[:bar], ref[bar+1:]
+			if (part.modifier != "lower") && (part.modifier != "upper") {
+				return nil, fmt.Errorf("unknown template modifier \"%s\"", part.modifier)
+			}
+		}
+		if part.field == "" {
+			return nil, fmt.Errorf("empty field reference in template")
+		}
+		t.parts = append(t.parts, part)
+		arg = arg[open+end+1:]
+	}
+	return t, nil
+}
+
+func (t *template) generate(rnd *rand.Rand, row map[string]string) string {
+	b := strings.Builder{}
+	for _, part := range t.parts {
+		if part.field == "" {
+			b.WriteString(part.text)
+			continue
+		}
+		value := row[part.field]
+		switch part.modifier {
+		case "lower":
+			value = strings.ToLower(value)
+		case "upper":
+			value = strings.ToUpper(value)
+		}
+		b.WriteString(value)
+	}
+	return b.String()
+}
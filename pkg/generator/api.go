@@ -0,0 +1,188 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// APICFG configures posting generated records to the nofacedb REST API,
+// so the whole ingestion path is loaded rather than the storage only.
+type APICFG struct {
+	BaseURL   string       `yaml:"base_url"`
+	Endpoints APIEndpoints `yaml:"endpoints"`
+	// Header sent with every request, e.g. Authorization: Bearer <token>.
+	AuthHeader string `yaml:"auth_header"`
+	AuthValue  string `yaml:"auth_value"`
+	// Records per request, 1 (default) posts JSON objects, more post JSON
+	// arrays.
+	RecordsPerRequest int `yaml:"records_per_request"`
+	// Requests in flight across workers, 4 by default.
+	Concurrency int `yaml:"concurrency"`
+	// Max requests per second across workers, 0 for unlimited.
+	RateLimit float64 `yaml:"rate_limit"`
+	TimeoutMS int     `yaml:"timeout_ms"`
+}
+
+// APIEndpoints are paths of REST endpoints records of tables are posted to.
+type APIEndpoints struct {
+	ControlObjects string `yaml:"control_objects"`
+	FFVs           string `yaml:"facial_features"`
+}
+
+func (cfg APICFG) validate() error {
+	if cfg.BaseURL == "" {
+		return fmt.Errorf("no base URL")
+	}
+	if (cfg.Endpoints.ControlObjects == "") || (cfg.Endpoints.FFVs == "") {
+		return fmt.Errorf("endpoints of both tables are required")
+	}
+	if (cfg.RecordsPerRequest < 0) || (cfg.Concurrency < 0) || (cfg.RateLimit < 0) {
+		return fmt.Errorf("records per request, concurrency and rate limit must not be negative")
+	}
+	return nil
+}
+
+// apiDriver posts batches of records to REST endpoints.
+type apiDriver struct {
+	cfg      APICFG
+	opts     insertOptions
+	client   *http.Client
+	inFlight chan struct{}
+	limiter  *rateLimiter
+}
+
+func newAPIDriver(cfg APICFG, opts insertOptions) *apiDriver {
+	concurrency := cfg.Concurrency
+	if concurrency == 0 {
+		concurrency = 4
+	}
+	return &apiDriver{
+		cfg:      cfg,
+		opts:     opts,
+		client:   &http.Client{Timeout: time.Duration(cfg.TimeoutMS) * time.Millisecond},
+		inFlight: make(chan struct{}, concurrency),
+		limiter:  newRateLimiter(cfg.RateLimit, 1),
+	}
+}
+
+func (d *apiDriver) InsertControlObjects(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+	rows := make([][]interface{}, len(cobs))
+	for i, cob := range cobs {
+		rows[i] = d.opts.controlObjectRow(cob)
+	}
+	return d.post(ctx, d.cfg.Endpoints.ControlObjects, d.opts.controlObjectsColumns(), rows, times)
+}
+
+func (d *apiDriver) InsertFFVs(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+	rows := make([][]interface{}, len(ffvs))
+	for i, fv := range ffvs {
+		rows[i] = d.opts.ffvRow(fv)
+	}
+	return d.post(ctx, d.cfg.Endpoints.FFVs, d.opts.ffvsColumns(), rows, times)
+}
+
+// post sends rows in requests of records_per_request records, concurrently
+// within the concurrency limit.
+func (d *apiDriver) post(ctx context.Context, endpoint string, columns []string, rows [][]interface{}, times *batchTimes) error {
+	perRequest := d.cfg.RecordsPerRequest
+	if perRequest == 0 {
+		perRequest = 1
+	}
+	serializationStart := time.Now()
+	bodies := [][]byte{}
+	for from := 0; from < len(rows); from += perRequest {
+		to := from + perRequest
+		if to > len(rows) {
+			to = len(rows)
+		}
+		records := make([]map[string]interface{}, 0, to-from)
+		for _, row := range rows[from:to] {
+			records = append(records, jsonRow(columns, row))
+		}
+		var body []byte
+		var err error
+		if perRequest == 1 {
+			body, err = json.Marshal(records[0])
+		} else {
+			body, err = json.Marshal(records)
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to encode records")
+		}
+		bodies = append(bodies, body)
+	}
+	times.serialization += time.Now().Sub(serializationStart)
+
+	commitStart := time.Now()
+	url := strings.TrimSuffix(d.cfg.BaseURL, "/") + "/" + strings.TrimPrefix(endpoint, "/")
+	wg := sync.WaitGroup{}
+	errs := make(chan error, len(bodies))
+	for _, body := range bodies {
+		if err := d.limiter.wait(ctx); err != nil {
+			errs <- err
+			break
+		}
+		d.inFlight <- struct{}{}
+		wg.Add(1)
+		go func(body []byte) {
+			defer wg.Done()
+			defer func() { <-d.inFlight }()
+			errs <- d.send(ctx, url, body)
+		}(body)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	times.commit += time.Now().Sub(commitStart)
+	return nil
+}
+
+func (d *apiDriver) send(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to create API request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.cfg.AuthHeader != "" {
+		req.Header.Set(d.cfg.AuthHeader, d.cfg.AuthValue)
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(&commitError{err}, "unable to send API request")
+	}
+	defer resp.Body.Close()
+	if (resp.StatusCode < 200) || (resp.StatusCode >= 300) {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return &apiStatusError{url: url, status: resp.StatusCode, message: strings.TrimSpace(string(message))}
+	}
+	return nil
+}
+
+// apiStatusError is a non-2xx response of the API.
+type apiStatusError struct {
+	url     string
+	status  int
+	message string
+}
+
+func (e *apiStatusError) Error() string {
+	return fmt.Sprintf("POST %s failed with %d %s: %s", e.url, e.status, http.StatusText(e.status), e.message)
+}
+
+// transient reports overload and server errors worth retrying.
+func (e *apiStatusError) transient() bool {
+	return (e.status == http.StatusTooManyRequests) || (e.status >= 500)
+}
@@ -0,0 +1,101 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AsyncInsertCFG configures asynchronous inserts of ClickHouse.
+type AsyncInsertCFG struct {
+	Enabled bool `yaml:"enabled"`
+	// Acknowledge inserts only after the buffer is flushed.
+	WaitForAsyncInsert bool `yaml:"wait_for_async_insert"`
+	// Poll system.asynchronous_inserts after the run until buffers of
+	// generated tables are empty and row counts grew by inserted rows.
+	ConfirmFlush   bool `yaml:"confirm_flush"`
+	PollIntervalMS int  `yaml:"poll_interval_ms"`
+	TimeoutMS      int  `yaml:"timeout_ms"`
+}
+
+func (cfg AsyncInsertCFG) settings() []string {
+	if !cfg.Enabled {
+		return nil
+	}
+	wait := 0
+	if cfg.WaitForAsyncInsert {
+		wait = 1
+	}
+	return []string{
+		"SET async_insert = 1",
+		fmt.Sprintf("SET wait_for_async_insert = %d", wait),
+	}
+}
+
+const pendingAsyncInsertsQuery = `
+SELECT
+    count()
+FROM
+    system.asynchronous_inserts
+WHERE
+    database = currentDatabase() AND table IN (%s);
+`
+
+// countGeneratedRows counts rows of generated tables by their database
+// names.
+func countGeneratedRows(ctx context.Context, db *sql.DB, opts insertOptions) (map[string]uint64, error) {
+	counts := make(map[string]uint64, len(generatedTables))
+	for _, table := range opts.tableNames() {
+		count := uint64(0)
+		if err := db.QueryRowContext(ctx, "SELECT count() FROM "+table).Scan(&count); err != nil {
+			return nil, errors.Wrapf(err, "unable to count rows of %s", table)
+		}
+		counts[table] = count
+	}
+	return counts, nil
+}
+
+// confirmAsyncFlush waits until no async insert buffers of generated tables
+// are pending and every table holds inserted rows more than before the run.
+func confirmAsyncFlush(ctx context.Context, db *sql.DB, cfg AsyncInsertCFG, opts insertOptions,
+	before map[string]uint64, inserted int64) (time.Duration, error) {
+	startTime := time.Now()
+	pollInterval := time.Duration(cfg.PollIntervalMS) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	for {
+		pending := uint64(0)
+		if err := db.QueryRowContext(ctx, fmt.Sprintf(pendingAsyncInsertsQuery, opts.tableList())).Scan(&pending); err != nil {
+			return 0, errors.Wrap(err, "unable to query system.asynchronous_inserts")
+		}
+		missing := ""
+		if pending == 0 {
+			after, err := countGeneratedRows(ctx, db, opts)
+			if err != nil {
+				return 0, err
+			}
+			for _, table := range opts.tableNames() {
+				if flushed := int64(after[table] - before[table]); flushed < inserted {
+					missing = fmt.Sprintf("%s has %d of %d inserted rows", table, flushed, inserted)
+					break
+				}
+			}
+			if missing == "" {
+				return time.Now().Sub(startTime), nil
+			}
+		}
+		if (cfg.TimeoutMS > 0) && (time.Now().Sub(startTime) > time.Duration(cfg.TimeoutMS)*time.Millisecond) {
+			if missing == "" {
+				missing = fmt.Sprintf("%d buffers still pending", pending)
+			}
+			return 0, fmt.Errorf("async inserts did not flush in %dms, %s", cfg.TimeoutMS, missing)
+		}
+		if err := sleepContext(ctx, pollInterval); err != nil {
+			return 0, err
+		}
+	}
+}
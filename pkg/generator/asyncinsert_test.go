@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAsyncInsertSettings(t *testing.T) {
+	cfg := StorageCFG{AsyncInsert: AsyncInsertCFG{Enabled: true}, InsertQuorum: 2}
+	expected := []string{"SET async_insert = 1", "SET wait_for_async_insert = 0", "SET insert_quorum = 2"}
+	if queries := insertSettingsQueries(cfg); !reflect.DeepEqual(queries, expected) {
+		t.Errorf("async inserts apply %q, expected %q", queries, expected)
+	}
+	cfg.AsyncInsert.WaitForAsyncInsert = true
+	if queries := cfg.AsyncInsert.settings(); queries[1] != "SET wait_for_async_insert = 1" {
+		t.Errorf("async inserts waiting for flushes apply %q", queries)
+	}
+	if queries := (AsyncInsertCFG{WaitForAsyncInsert: true}).settings(); queries != nil {
+		t.Errorf("disabled async inserts apply %q", queries)
+	}
+}
+
+func TestConfirmAsyncFlush(t *testing.T) {
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	mu := sync.Mutex{}
+	var pending []uint64
+	var counts []map[string]uint64
+	server.answer = func(query string) (nativeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		count := uint64(0)
+		switch {
+		case strings.Contains(query, "system.asynchronous_inserts"):
+			count = pending[0]
+			if len(pending) > 1 {
+				pending = pending[1:]
+			}
+		case strings.HasPrefix(query, "SELECT count() FROM "):
+			table := strings.TrimPrefix(query, "SELECT count() FROM ")
+			count = counts[0][table]
+			// Tables are counted in order.
+			if (table == "facial_features") && (len(counts) > 1) {
+				counts = counts[1:]
+			}
+		default:
+			return nativeResult{}, fmt.Errorf("unexpected query %s", query)
+		}
+		return nativeResult{names: []string{"count()"}, types: []string{"UInt64"}, rows: [][]interface{}{{count}}}, nil
+	}
+	db := server.connect(t)
+	opts := testInsertOptions(t, SchemaCFG{})
+	before := map[string]uint64{"control_objects": 100, "facial_features": 200}
+	ctx := context.Background()
+
+	// Buffers are pending at first, then rows of control objects are
+	// partly flushed.
+	mu.Lock()
+	pending = []uint64{1, 0}
+	counts = []map[string]uint64{
+		{"control_objects": 105, "facial_features": 210},
+		{"control_objects": 110, "facial_features": 210},
+	}
+	mu.Unlock()
+	if _, err := confirmAsyncFlush(ctx, db, AsyncInsertCFG{PollIntervalMS: 1}, opts, before, 10); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(counts) != 1 {
+		t.Errorf("flush is confirmed after %d counts, expected 2", 3-len(counts))
+	}
+	mu.Unlock()
+
+	// Rows get lost.
+	mu.Lock()
+	pending = []uint64{0}
+	counts = []map[string]uint64{{"control_objects": 105, "facial_features": 210}}
+	mu.Unlock()
+	_, err := confirmAsyncFlush(ctx, db, AsyncInsertCFG{PollIntervalMS: 1, TimeoutMS: 10}, opts, before, 10)
+	if (err == nil) || !strings.HasSuffix(err.Error(), "control_objects has 5 of 10 inserted rows") {
+		t.Errorf("lost rows return %v", err)
+	}
+	// Buffers are never flushed.
+	mu.Lock()
+	pending = []uint64{3}
+	mu.Unlock()
+	_, err = confirmAsyncFlush(ctx, db, AsyncInsertCFG{PollIntervalMS: 1, TimeoutMS: 10}, opts, before, 10)
+	if (err == nil) || !strings.HasSuffix(err.Error(), "3 buffers still pending") {
+		t.Errorf("pending buffers return %v", err)
+	}
+}
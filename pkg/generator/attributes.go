@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+const (
+	attributeString = "string"
+	attributeInt    = "int"
+	attributeFloat  = "float"
+	attributeBool   = "bool"
+)
+
+// AttributesCFG configures extended key-value attributes of control objects,
+// stored in a Nested column as parallel key and value arrays.
+type AttributesCFG struct {
+	Enabled      bool              `yaml:"enabled"`
+	Column       string            `yaml:"column"`
+	Keys         map[string]string `yaml:"keys"`
+	MinPerObject int               `yaml:"min_per_object"`
+	MaxPerObject int               `yaml:"max_per_object"`
+}
+
+type attributesGenerator struct {
+	column   string
+	keys     []string
+	types    map[string]string
+	min, max int
+}
+
+func newAttributesGenerator(cfg AttributesCFG) (*attributesGenerator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	g := &attributesGenerator{
+		column: cfg.Column,
+		types:  cfg.Keys,
+		min:    cfg.MinPerObject,
+		max:    cfg.MaxPerObject,
+	}
+	if g.column == "" {
+		g.column = "attrs"
+	}
+	for key, valueType := range cfg.Keys {
+		switch valueType {
+		case attributeString, attributeInt, attributeFloat, attributeBool:
+		default:
+			return nil, fmt.Errorf("unknown type \"%s\" of attribute \"%s\"", valueType, key)
+		}
+		g.keys = append(g.keys, key)
+	}
+	sort.Strings(g.keys)
+	if g.max > len(g.keys) {
+		g.max = len(g.keys)
+	}
+	if (g.min < 0) || (g.min > g.max) {
+		return nil, fmt.Errorf("invalid attributes per object range [%d, %d]", cfg.MinPerObject, cfg.MaxPerObject)
+	}
+	return g, nil
+}
+
+func (g *attributesGenerator) columns() []string {
+	return []string{g.column + ".key", g.column + ".value"}
+}
+
+func (g *attributesGenerator) fill(rnd *rand.Rand, cob *controlObject) {
+	if g == nil {
+		return
+	}
+	n := g.min + rnd.Intn(g.max-g.min+1)
+	cob.attrKeys = make([]string, n)
+	cob.attrValues = make([]string, n)
+	for i, j := range rnd.Perm(len(g.keys))[:n] {
+		key := g.keys[j]
+		cob.attrKeys[i] = key
+		cob.attrValues[i] = generateAttributeValue(rnd, g.types[key])
+	}
+}
+
+func generateAttributeValue(rnd *rand.Rand, valueType string) string {
+	switch valueType {
+	case attributeInt:
+		return strconv.Itoa(rnd.Intn(1000000))
+	case attributeFloat:
+		return strconv.FormatFloat(rnd.Float64()*1000, 'f', 3, 64)
+	case attributeBool:
+		return strconv.FormatBool(rnd.Intn(2) == 0)
+	}
+	return strconv.FormatUint(rnd.Uint64(), 36)
+}
@@ -0,0 +1,84 @@
+package generator
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parseTSVStrings parses a String array of a TSV file without escapes.
+func parseTSVStrings(field string) []string {
+	field = strings.Trim(field, "[]")
+	if field == "" {
+		return nil
+	}
+	elems := strings.Split(field, ",")
+	for i, elem := range elems {
+		elems[i] = strings.Trim(elem, "'")
+	}
+	return elems
+}
+
+func TestAttributes(t *testing.T) {
+	cfg, dir := testConfig(t, 200)
+	cfg.GeneratorCFG.Attributes = AttributesCFG{
+		Enabled:      true,
+		Keys:         map[string]string{"region": attributeString, "age": attributeInt, "score": attributeFloat, "vip": attributeBool},
+		MinPerObject: 1,
+		MaxPerObject: 3,
+	}
+	testRun(t, cfg)
+
+	counts := map[int]int{}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		keys, values := parseTSVStrings(row[len(row)-2]), parseTSVStrings(row[len(row)-1])
+		if len(keys) != len(values) {
+			t.Fatalf("%d attribute keys have %d values", len(keys), len(values))
+		}
+		counts[len(keys)]++
+		seen := map[string]bool{}
+		for i, key := range keys {
+			if seen[key] {
+				t.Fatalf("attribute %s repeats in %q", key, keys)
+			}
+			seen[key] = true
+			var err error
+			switch cfg.GeneratorCFG.Attributes.Keys[key] {
+			case attributeString:
+			case attributeInt:
+				_, err = strconv.Atoi(values[i])
+			case attributeFloat:
+				_, err = strconv.ParseFloat(values[i], 64)
+			case attributeBool:
+				_, err = strconv.ParseBool(values[i])
+			default:
+				t.Fatalf("unknown attribute %s", key)
+			}
+			if err != nil {
+				t.Errorf("%s attribute %s has value %s", cfg.GeneratorCFG.Attributes.Keys[key], key, values[i])
+			}
+		}
+	}
+	if (len(counts) != 3) || (counts[1] == 0) || (counts[2] == 0) || (counts[3] == 0) {
+		t.Errorf("control objects have numbers of attributes %v, expected 1 to 3", counts)
+	}
+
+	g, err := newGeneration(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := createTableQuery(g.opts.cobTable, g.opts.controlObjectsColumns(), nil, TableSchemaCFG{}, "id")
+	if !strings.Contains(query, "attrs Nested(key String, value String)") || strings.Contains(query, "attrs.") {
+		t.Errorf("DDL of attributes is\n%s", query)
+	}
+
+	for _, attributes := range []AttributesCFG{
+		{Enabled: true, Keys: map[string]string{"age": "uint"}},
+		{Enabled: true, Keys: map[string]string{"age": attributeInt}, MinPerObject: 2, MaxPerObject: 3},
+	} {
+		if _, err := newAttributesGenerator(attributes); err == nil {
+			t.Errorf("invalid attributes %+v are accepted", attributes)
+		}
+	}
+}
@@ -0,0 +1,511 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/nofacedb/generator/pkg/storage/clickhouse"
+	"github.com/pkg/errors"
+)
+
+// Ingestion paths compared by the bench subcommand.
+const (
+	benchNative   = "native"
+	benchHTTPCSV  = "http_csv"
+	benchHTTPJSON = "http_json"
+	benchAsync    = "async"
+)
+
+var benchPaths = []string{benchNative, benchHTTPCSV, benchHTTPJSON, benchAsync}
+
+// benchLoader inserts batches of both tables via one ingestion path.
+type benchLoader struct {
+	controlObjects func(ctx context.Context, cobs []controlObject) error
+	ffvs           func(ctx context.Context, ffvs []ffv) error
+	// HTTP paths also encode batches once and send encoded bodies, both are
+	// nil for native paths.
+	encode rowsEncoder
+	send   httpSender
+}
+
+// rowsEncoder encodes rows in an input format of the HTTP interface.
+type rowsEncoder func(columns []string, rows [][]interface{}) ([]byte, error)
+
+type httpInserter func(ctx context.Context, table string, columns []string, rows [][]interface{}) error
+
+type httpSender func(ctx context.Context, table string, columns []string, body []byte) error
+
+// serializedBatch is an encoded insert body re-sent by every iteration of
+// an HTTP path with -preserialize.
+type serializedBatch struct {
+	table   string
+	columns []string
+	body    []byte
+	rows    int
+	// Payload size of rows, comparable with other paths.
+	bytes int
+}
+
+type benchResult struct {
+	path          string
+	iteration     int
+	preserialized bool
+	// Excluded load before the measured one.
+	warmup   time.Duration
+	rows     int
+	bytes    int
+	duration time.Duration
+	cpu      time.Duration
+	// Latencies and attempts of measured batch loads.
+	slo *sloStats
+}
+
+func (r benchResult) String() string {
+	seconds := r.duration.Seconds()
+	if seconds == 0 {
+		seconds = 1e-9
+	}
+	path := r.path
+	if r.iteration > 0 {
+		path = fmt.Sprintf("%s#%d", r.path, r.iteration)
+	}
+	result := fmt.Sprintf("%-10s %d rows in %v: %.0f rows/s, %.2f MiB/s, client cpu %v (%.1f%% of wall time)",
+		path, r.rows, r.duration, float64(r.rows)/seconds, float64(r.bytes)/seconds/(1<<20),
+		r.cpu, 100*r.cpu.Seconds()/seconds)
+	if r.preserialized {
+		result += ", pre-serialized"
+	}
+	if r.warmup > 0 {
+		result += fmt.Sprintf(", after %v warm-up", r.warmup)
+	}
+	return result
+}
+
+// benchWindows are the warm-up window, whose loads are excluded from
+// results, and the measurement window of a path. Loads cycle through the
+// dataset until a window ends. Without a measurement window the dataset is
+// loaded once after the warm-up.
+type benchWindows struct {
+	warmup  time.Duration
+	measure time.Duration
+}
+
+// benchBatch is a batch of the dataset loaded by a path.
+type benchBatch struct {
+	rows  int
+	bytes int
+	load  func(ctx context.Context) error
+}
+
+// runBench generates a dataset once and loads identical copies of it through
+// each ingestion path, reporting throughput and client CPU per path and
+// iteration, and generator.slos of every load. With -preserialize HTTP paths
+// encode batches once and re-send identical bodies, so that iterations differ
+// only in the insert path.
+func runBench(ctx context.Context, args []string) (err error) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file")
+	paths := flags.String("paths", strings.Join(benchPaths, ","), "comma-separated ingestion paths to compare")
+	truncate := flags.Bool("truncate", false, "truncate generated tables before every path and iteration")
+	iterations := flags.Int("iterations", 1, "loads of the dataset via every path")
+	preserialize := flags.Bool("preserialize", false, "encode batches of HTTP paths once and re-send identical bodies")
+	windows := benchWindows{}
+	flags.DurationVar(&windows.warmup, "warmup", 0, "load batches for this long before measuring, excluded from results")
+	flags.DurationVar(&windows.measure, "measure", 0, "measure loads for this long, 0 to load the dataset once")
+	junitPath := flags.String("junit", "", "write loads and SLOs of every path as JUnit XML to this file")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+	junit := newJUnitReport(*junitPath, "bench")
+	defer func() {
+		if saveErr := junit.save(*junitPath); (saveErr != nil) && (err == nil) {
+			err = saveErr
+		}
+	}()
+
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	if *iterations <= 0 {
+		return fmt.Errorf("iterations must be positive, got %d", *iterations)
+	}
+	if (windows.warmup < 0) || (windows.measure < 0) {
+		return fmt.Errorf("warm-up and measurement windows can not be negative")
+	}
+	selected := strings.Split(*paths, ",")
+	for _, path := range selected {
+		if !isBenchPath(path) {
+			return fmt.Errorf("unknown ingestion path \"%s\", supported are %s", path, strings.Join(benchPaths, ", "))
+		}
+	}
+
+	seed := cfg.GeneratorCFG.Seed
+	if seed == 0 {
+		seed = time.Now().Unix()
+	}
+	g, err := newGeneration(cfg, seed)
+	if err != nil {
+		return err
+	}
+	// n may be taken from identities.
+	cfg = g.cfg
+	if g.metrics, err = newStageMetrics(""); err != nil {
+		return err
+	}
+	if g.idOffsets, err = resolveIDOffsets(ctx, nil, cfg.GeneratorCFG.IDs, g.opts); err != nil {
+		return err
+	}
+	cobs, ffvs := [][]controlObject{}, [][]ffv{}
+	mu := sync.Mutex{}
+	g.writeControlObjects = func(ctx context.Context, batch []controlObject, times *batchTimes) error {
+		mu.Lock()
+		defer mu.Unlock()
+		cobs = append(cobs, batch)
+		return nil
+	}
+	g.writeFFVs = func(ctx context.Context, batch []ffv, times *batchTimes) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ffvs = append(ffvs, batch)
+		return nil
+	}
+	if _, _, err := g.runWorkers(ctx, splitRows(cfg.GeneratorCFG.Workers, cfg.GeneratorCFG.N)); err != nil {
+		return errors.Wrap(err, "unable to generate benchmark dataset")
+	}
+
+	db, err := connectClickHouse(cfg.StorageCFG, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if cfg.StorageCFG.AutoCreate {
+		if err := createTables(ctx, db, cfg.StorageCFG.Schema, g.opts); err != nil {
+			return err
+		}
+	}
+
+	violations := []string{}
+	for _, path := range selected {
+		suite := junit.suite(path)
+		load, err := newBenchLoader(db, cfg.StorageCFG, g.opts, path)
+		if err != nil {
+			return err
+		}
+		var serialized []serializedBatch
+		if *preserialize && (load.encode != nil) {
+			startTime := time.Now()
+			if serialized, err = serializeBatches(load.encode, g.opts, cobs, ffvs); err != nil {
+				return errors.Wrapf(err, "unable to serialize dataset for %s", path)
+			}
+			size := 0
+			for _, batch := range serialized {
+				size += len(batch.body)
+			}
+			fmt.Printf("%-10s serialized %d batches into %d bytes once in %v\n", path, len(serialized), size, time.Now().Sub(startTime))
+		}
+		for i := 0; i < *iterations; i++ {
+			if *truncate {
+				for _, table := range g.opts.tableNames() {
+					if _, err := db.ExecContext(ctx, "TRUNCATE TABLE "+table); err != nil {
+						return errors.Wrapf(err, "unable to truncate %s", table)
+					}
+				}
+			}
+			result, err := benchPath(ctx, load, path, cobs, ffvs, serialized, windows)
+			if *iterations > 1 {
+				result.iteration = i + 1
+			}
+			name := fmt.Sprintf("load #%d", i+1)
+			if err != nil {
+				err = errors.Wrapf(err, "unable to load dataset via %s", path)
+				suite.add(name, result.duration, result.String(), err.Error())
+				return err
+			}
+			suite.add(name, result.duration, result.String(), "")
+			fmt.Println(result)
+			if len(cfg.GeneratorCFG.SLOs) > 0 {
+				report, violated := result.slo.evaluate(cfg.GeneratorCFG.SLOs, int64(result.rows), result.duration, suite)
+				fmt.Printf("%-10s SLOs: %s\n", path, strings.Join(report, ", "))
+				for _, violation := range violated {
+					violations = append(violations, fmt.Sprintf("%s: %s", path, violation))
+				}
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return &sloViolationError{violations: violations}
+	}
+	return nil
+}
+
+// serializeBatches encodes batches of both tables with database names of
+// tables and columns.
+func serializeBatches(encode rowsEncoder, opts insertOptions, cobs [][]controlObject, ffvs [][]ffv) ([]serializedBatch, error) {
+	serialized := []serializedBatch{}
+	for _, batch := range cobs {
+		rows := make([][]interface{}, len(batch))
+		for i, cob := range batch {
+			rows[i] = opts.cobTable.row(opts.controlObjectRow(cob))
+		}
+		body, err := encode(opts.cobTable.columns, rows)
+		if err != nil {
+			return nil, err
+		}
+		serialized = append(serialized, serializedBatch{
+			table:   opts.cobTable.name,
+			columns: opts.cobTable.columns,
+			body:    body,
+			rows:    len(batch),
+			bytes:   controlObjectsPayloadSize(batch),
+		})
+	}
+	for _, batch := range ffvs {
+		rows := make([][]interface{}, len(batch))
+		for i, fv := range batch {
+			rows[i] = opts.ffvTable.row(opts.ffvRow(fv))
+		}
+		body, err := encode(opts.ffvTable.columns, rows)
+		if err != nil {
+			return nil, err
+		}
+		serialized = append(serialized, serializedBatch{
+			table:   opts.ffvTable.name,
+			columns: opts.ffvTable.columns,
+			body:    body,
+			rows:    len(batch),
+			bytes:   ffvsPayloadSize(batch),
+		})
+	}
+	return serialized, nil
+}
+
+func isBenchPath(path string) bool {
+	for _, p := range benchPaths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// benchPath loads the dataset within windows, sending serialized batches
+// instead of encoding rows when there are any.
+func benchPath(ctx context.Context, load benchLoader, path string,
+	cobs [][]controlObject, ffvs [][]ffv, serialized []serializedBatch, windows benchWindows) (benchResult, error) {
+	result := benchResult{path: path, preserialized: serialized != nil, warmup: windows.warmup, slo: &sloStats{}}
+	batches := benchBatches(load, cobs, ffvs, serialized)
+	if len(batches) == 0 {
+		return result, fmt.Errorf("benchmark dataset is empty")
+	}
+	if _, _, err := loadBenchBatches(ctx, batches, windows.warmup, false, nil); err != nil {
+		return result, errors.Wrap(err, "unable to warm up")
+	}
+	usageBefore := readResourceUsage()
+	startTime := time.Now()
+	var err error
+	result.rows, result.bytes, err = loadBenchBatches(ctx, batches, windows.measure, windows.measure == 0, result.slo)
+	result.duration = time.Now().Sub(startTime)
+	usageAfter := readResourceUsage()
+	result.cpu = (usageAfter.userCPU + usageAfter.sysCPU) - (usageBefore.userCPU + usageBefore.sysCPU)
+	return result, err
+}
+
+// benchBatches returns batches of the dataset in load order, serialized
+// ones when there are any.
+func benchBatches(load benchLoader, cobs [][]controlObject, ffvs [][]ffv, serialized []serializedBatch) []benchBatch {
+	batches := []benchBatch{}
+	if serialized != nil {
+		for _, batch := range serialized {
+			batch := batch
+			batches = append(batches, benchBatch{rows: batch.rows, bytes: batch.bytes, load: func(ctx context.Context) error {
+				return load.send(ctx, batch.table, batch.columns, batch.body)
+			}})
+		}
+		return batches
+	}
+	for _, batch := range cobs {
+		batch := batch
+		batches = append(batches, benchBatch{rows: len(batch), bytes: controlObjectsPayloadSize(batch),
+			load: func(ctx context.Context) error { return load.controlObjects(ctx, batch) }})
+	}
+	for _, batch := range ffvs {
+		batch := batch
+		batches = append(batches, benchBatch{rows: len(batch), bytes: ffvsPayloadSize(batch),
+			load: func(ctx context.Context) error { return load.ffvs(ctx, batch) }})
+	}
+	return batches
+}
+
+// loadBenchBatches loads batches once, or cycles through them until window
+// ends unless once is set, and returns loaded rows and their payload size.
+// Latencies and attempts of loads are collected into slo unless it is nil.
+func loadBenchBatches(ctx context.Context, batches []benchBatch, window time.Duration, once bool,
+	slo *sloStats) (int, int, error) {
+	rows, bytes := 0, 0
+	deadline := time.Now().Add(window)
+	for i := 0; (once && (i < len(batches))) || (!once && time.Now().Before(deadline)); i++ {
+		batch := batches[i%len(batches)]
+		loadStart := time.Now()
+		err := batch.load(ctx)
+		if slo != nil {
+			slo.attempt(err)
+			if err == nil {
+				slo.batch(time.Now().Sub(loadStart))
+			}
+		}
+		if err != nil {
+			return rows, bytes, err
+		}
+		rows, bytes = rows+batch.rows, bytes+batch.bytes
+	}
+	return rows, bytes, nil
+}
+
+func newBenchLoader(db *sql.DB, cfg StorageCFG, opts insertOptions, path string) (benchLoader, error) {
+	encode, format := rowsEncoder(encodeCSVRows), "CSV"
+	// HTTP paths are compared with synchronous native inserts.
+	cfg.AsyncInsert = AsyncInsertCFG{}
+	switch path {
+	case benchNative, benchAsync:
+		cfg.AsyncInsert = AsyncInsertCFG{
+			Enabled:            path == benchAsync,
+			WaitForAsyncInsert: true,
+		}
+		opts.settings = insertSettingsQueries(cfg)
+		return benchLoader{
+			controlObjects: func(ctx context.Context, cobs []controlObject) error {
+				return insertControlObjects(ctx, db, cobs, opts, &batchTimes{})
+			},
+			ffvs: func(ctx context.Context, ffvs []ffv) error {
+				return insertFFVs(ctx, db, ffvs, opts, &batchTimes{})
+			},
+		}, nil
+	case benchHTTPCSV:
+	case benchHTTPJSON:
+		encode, format = encodeJSONRows, "JSONEachRow"
+	default:
+		return benchLoader{}, fmt.Errorf("unknown ingestion path \"%s\"", path)
+	}
+	c, err := newClickHouseHTTP(cfg)
+	if err != nil {
+		return benchLoader{}, err
+	}
+	post := newHTTPInserter(c, format, encode)
+	return benchLoader{
+		encode: encode,
+		send:   newHTTPSender(c, format),
+		controlObjects: func(ctx context.Context, cobs []controlObject) error {
+			rows := make([][]interface{}, len(cobs))
+			for i, cob := range cobs {
+				rows[i] = opts.cobTable.row(opts.controlObjectRow(cob))
+			}
+			return post(ctx, opts.cobTable.name, opts.cobTable.columns, rows)
+		},
+		ffvs: func(ctx context.Context, ffvs []ffv) error {
+			rows := make([][]interface{}, len(ffvs))
+			for i, fv := range ffvs {
+				rows[i] = opts.ffvTable.row(opts.ffvRow(fv))
+			}
+			return post(ctx, opts.ffvTable.name, opts.ffvTable.columns, rows)
+		},
+	}, nil
+}
+
+// newHTTPInserter posts rows to the ClickHouse HTTP interface in the given
+// input format.
+func newHTTPInserter(c *clickHouseHTTP, format string, encode rowsEncoder) httpInserter {
+	send := newHTTPSender(c, format)
+	return func(ctx context.Context, table string, columns []string, rows [][]interface{}) error {
+		body, err := encode(columns, rows)
+		if err != nil {
+			return err
+		}
+		return send(ctx, table, columns, body)
+	}
+}
+
+// newHTTPSender posts bodies encoded in the given input format to the
+// ClickHouse HTTP interface.
+func newHTTPSender(c *clickHouseHTTP, format string) httpSender {
+	cfg := c.cfg
+	settings := map[string]string{}
+	if cfg.InsertQuorum > 0 {
+		settings["insert_quorum"] = fmt.Sprint(cfg.InsertQuorum)
+		if cfg.InsertQuorumTimeoutMS > 0 {
+			settings["insert_quorum_timeout"] = fmt.Sprint(cfg.InsertQuorumTimeoutMS)
+		}
+	}
+	if cfg.AsyncInsert.Enabled {
+		settings["async_insert"] = "1"
+		settings["wait_for_async_insert"] = "0"
+		if cfg.AsyncInsert.WaitForAsyncInsert {
+			settings["wait_for_async_insert"] = "1"
+		}
+	}
+	return func(ctx context.Context, table string, columns []string, body []byte) error {
+		encoding := ""
+		if c.compression != nil {
+			var err error
+			if body, err = c.compression.compress(body); err != nil {
+				return errors.Wrap(err, "unable to compress HTTP insert request")
+			}
+			encoding = cfg.Compression.Algorithm
+		}
+		query := fmt.Sprintf("INSERT INTO %s (%s) FORMAT %s", table, strings.Join(columns, ", "), format)
+		err := c.Insert(ctx, query, settings, body, encoding)
+		if sendErr, ok := err.(*clickhouse.SendError); ok {
+			// The request commits the insert.
+			return errors.Wrap(&commitError{sendErr.Err}, "unable to send HTTP insert request")
+		}
+		return errors.Wrapf(err, "unable to insert into %s", table)
+	}
+}
+
+func encodeCSVRows(columns []string, rows [][]interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	fields := make([]string, len(columns))
+	for _, row := range rows {
+		for i, value := range row {
+			fields[i] = formatFileValue(value, true)
+		}
+		if err := w.Write(fields); err != nil {
+			return nil, errors.Wrap(err, "unable to encode CSV row")
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func encodeJSONRows(columns []string, rows [][]interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, row := range rows {
+		if err := enc.Encode(jsonRow(columns, row)); err != nil {
+			return nil, errors.Wrap(err, "unable to encode JSON row")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonRow returns a JSON object of a row, with timestamps in ClickHouse
+// format.
+func jsonRow(columns []string, row []interface{}) map[string]interface{} {
+	object := make(map[string]interface{}, len(columns))
+	for i, value := range row {
+		if t, ok := value.(time.Time); ok {
+			value = formatTSVValue(t)
+		}
+		object[columns[i]] = value
+	}
+	return object
+}
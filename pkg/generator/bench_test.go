@@ -0,0 +1,281 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBenchWindows(t *testing.T) {
+	cobs, ffvs := testBatches(10)
+	loaded := 0
+	load := benchLoader{
+		controlObjects: func(ctx context.Context, batch []controlObject) error {
+			loaded += len(batch)
+			time.Sleep(time.Millisecond)
+			return nil
+		},
+		ffvs: func(ctx context.Context, batch []ffv) error {
+			loaded += len(batch)
+			time.Sleep(time.Millisecond)
+			return nil
+		},
+	}
+	dataset := [][]controlObject{cobs}
+	facialFeatures := [][]ffv{ffvs}
+
+	result, err := benchPath(context.Background(), load, benchNative, dataset, facialFeatures, nil, benchWindows{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (result.rows != len(cobs)+len(ffvs)) || (loaded != result.rows) {
+		t.Errorf("%d rows are measured and %d loaded without windows, expected the dataset once", result.rows, loaded)
+	}
+	if (len(result.slo.latencies) != 2) || (result.slo.attempts != 2) || (result.slo.percentile(100) < 1) {
+		t.Errorf("SLO stats of 2 loaded batches have latencies %v and %d attempts", result.slo.latencies, result.slo.attempts)
+	}
+
+	loaded = 0
+	windows := benchWindows{warmup: 30 * time.Millisecond, measure: 50 * time.Millisecond}
+	result, err = benchPath(context.Background(), load, benchNative, dataset, facialFeatures, nil, windows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.duration < windows.measure {
+		t.Errorf("measurement took %v, shorter than its window", result.duration)
+	}
+	if (result.rows <= len(cobs)+len(ffvs)) || (result.rows >= loaded) {
+		t.Errorf("%d rows are measured of %d loaded, expected cycles of the dataset without the warm-up", result.rows, loaded)
+	}
+	if result.warmup != windows.warmup {
+		t.Errorf("result has warm-up %v", result.warmup)
+	}
+
+	if _, err := benchPath(context.Background(), load, benchNative, nil, nil, nil, windows); err == nil {
+		t.Error("empty dataset is loaded in windows")
+	}
+}
+
+// TestBenchPaths checks that every ingestion path loads the same rows in its
+// format and with its settings.
+func TestBenchPaths(t *testing.T) {
+	cobs, ffvs := testBatches(5)
+	ids := []string{}
+	for _, cob := range cobs {
+		ids = append(ids, cob.id)
+	}
+	opts := testInsertOptions(t, SchemaCFG{})
+
+	mu := sync.Mutex{}
+	settings := []string{}
+	b := newFakeBackend()
+	native := newFakeNative(t, b, columnTypes)
+	defer native.close()
+	native.answer = func(query string) (nativeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		settings = append(settings, query)
+		return nativeResult{}, nil
+	}
+	db := native.connect(t)
+
+	// IDs of control objects posted over HTTP by format.
+	posted := map[string][]string{}
+	var params url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		params = r.URL.Query()
+		query := params.Get("query")
+		if !strings.HasPrefix(query, "INSERT INTO control_objects (") {
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		format := query[strings.LastIndex(query, " ")+1:]
+		switch format {
+		case "CSV":
+			records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+			if err != nil {
+				http.Error(w, "Code: 27. DB::Exception: Cannot parse input", http.StatusBadRequest)
+				return
+			}
+			for _, record := range records {
+				posted[format] = append(posted[format], record[0])
+			}
+		case "JSONEachRow":
+			for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+				record := map[string]interface{}{}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					http.Error(w, "Code: 26. DB::Exception: Cannot parse input", http.StatusBadRequest)
+					return
+				}
+				posted[format] = append(posted[format], record["id"].(string))
+			}
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := StorageCFG{Addr: u.Hostname(), HTTPPort: port, AsyncInsert: AsyncInsertCFG{Enabled: true}}
+
+	for _, test := range []struct {
+		path     string
+		settings []string
+		stored   func() []string
+	}{
+		{benchNative, []string{}, func() []string {
+			stored, _ := b.Stored("control_objects")
+			return stored
+		}},
+		{benchAsync, []string{"SET async_insert = 1", "SET wait_for_async_insert = 1"}, func() []string {
+			stored, _ := b.Stored("control_objects")
+			return stored[len(ids):]
+		}},
+		{benchHTTPCSV, nil, func() []string { return posted["CSV"] }},
+		{benchHTTPJSON, nil, func() []string { return posted["JSONEachRow"] }},
+	} {
+		load, err := newBenchLoader(db, cfg, opts, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		settings = []string{}
+		mu.Unlock()
+		result, err := benchPath(context.Background(), load, test.path, [][]controlObject{cobs}, [][]ffv{ffvs}, nil,
+			benchWindows{})
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		mu.Lock()
+		if result.rows != 10 {
+			t.Errorf("%s loaded %d rows of 10", test.path, result.rows)
+		}
+		if stored := test.stored(); !reflect.DeepEqual(stored, ids) {
+			t.Errorf("%s loaded control objects %v, expected %v", test.path, stored, ids)
+		}
+		// Settings of native paths are applied before both inserts.
+		if (test.settings != nil) && !reflect.DeepEqual(settings, append(test.settings, test.settings...)) {
+			t.Errorf("%s applies %q", test.path, settings)
+		}
+		// HTTP paths are compared with synchronous native inserts.
+		if (test.settings == nil) && (params.Get("async_insert") != "") {
+			t.Errorf("%s inserts asynchronously", test.path)
+		}
+		mu.Unlock()
+	}
+
+	// Pre-serialized bodies are the encoded batches.
+	load, err := newBenchLoader(db, cfg, opts, benchHTTPJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := serializeBatches(load.encode, opts, [][]controlObject{cobs}, [][]ffv{ffvs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := benchPath(context.Background(), load, benchHTTPJSON, nil, nil, serialized, benchWindows{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if !result.preserialized || (result.rows != 10) || !reflect.DeepEqual(posted["JSONEachRow"][len(ids):], ids) {
+		t.Errorf("pre-serialized bodies load %d rows and control objects %v", result.rows, posted["JSONEachRow"])
+	}
+	mu.Unlock()
+
+	if _, err := newBenchLoader(db, cfg, opts, "grpc"); err == nil {
+		t.Error("unknown ingestion path is accepted")
+	}
+}
+
+// TestPreserializedBatches checks that batches are encoded once with mapped
+// names and the identical bodies are re-sent by every load.
+func TestPreserializedBatches(t *testing.T) {
+	cobs, ffvs := testBatches(10)
+	opts := testInsertOptions(t, SchemaCFG{
+		ControlObjects: TableSchemaCFG{Name: "persons", Columns: map[string]string{"id": "person_id"}},
+	})
+	encoded := 0
+	sent := [][]byte{}
+	load := benchLoader{
+		encode: func(columns []string, rows [][]interface{}) ([]byte, error) {
+			encoded++
+			var body bytes.Buffer
+			for _, row := range rows {
+				fmt.Fprintf(&body, "%s=%s\n", columns[0], row[0])
+			}
+			return body.Bytes(), nil
+		},
+		send: func(ctx context.Context, table string, columns []string, body []byte) error {
+			sent = append(sent, append([]byte(table+":"), body...))
+			return nil
+		},
+	}
+	serialized, err := serializeBatches(load.encode, opts, [][]controlObject{cobs[:6], cobs[6:]}, [][]ffv{ffvs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(serialized) != 3) || (encoded != 3) {
+		t.Fatalf("%d batches are serialized with %d encodings, expected 3", len(serialized), encoded)
+	}
+	for i, expected := range []struct {
+		table  string
+		column string
+		rows   int
+		bytes  int
+	}{
+		{"persons", "person_id", 6, controlObjectsPayloadSize(cobs[:6])},
+		{"persons", "person_id", 4, controlObjectsPayloadSize(cobs[6:])},
+		{"facial_features", "id", 10, ffvsPayloadSize(ffvs)},
+	} {
+		batch := serialized[i]
+		if (batch.table != expected.table) || (batch.columns[0] != expected.column) || (batch.rows != expected.rows) ||
+			(batch.bytes != expected.bytes) {
+			t.Errorf("batch %d is %s of %d rows and %d bytes with columns %v", i, batch.table, batch.rows, batch.bytes,
+				batch.columns)
+		}
+	}
+	if !strings.HasPrefix(string(serialized[0].body), "person_id="+cobs[0].id+"\n") {
+		t.Errorf("batch of control objects is %q", serialized[0].body)
+	}
+
+	results := []benchResult{}
+	for i := 0; i < 2; i++ {
+		result, err := benchPath(context.Background(), load, benchHTTPJSON, nil, nil, serialized, benchWindows{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+	if (encoded != 3) || (len(sent) != 6) {
+		t.Fatalf("2 loads encode %d times and send %d bodies, expected 3 and 6", encoded-3, len(sent))
+	}
+	for i := 0; i < 3; i++ {
+		if !bytes.Equal(sent[i], sent[i+3]) {
+			t.Errorf("body %d differs between loads", i)
+		}
+	}
+	for _, result := range results {
+		if (result.rows != 20) || !strings.HasSuffix(result.String(), ", pre-serialized") {
+			t.Errorf("pre-serialized load is %v", result)
+		}
+	}
+}
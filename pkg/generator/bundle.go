@@ -0,0 +1,168 @@
+package generator
+
+import (
+	"archive/zip"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// runSummary is written to generator.summary_path at the end of a run.
+type runSummary struct {
+	Status   string    `yaml:"status"`
+	Rows     int64     `yaml:"rows"`
+	Started  time.Time `yaml:"started"`
+	Duration string    `yaml:"duration"`
+	Seed     int64     `yaml:"seed"`
+	Error    string    `yaml:"error,omitempty"`
+	// Violated SLOs of runs with status slo_violated.
+	SLOViolations []string `yaml:"slo_violations,omitempty"`
+}
+
+func (s runSummary) save(path string) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode run summary")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, data, 0644), "unable to write run summary")
+}
+
+// bundleTime is the modification time of every bundle entry, so bundles of
+// the same files are identical.
+var bundleTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// bundleEntry is a file of a run, or generated data, stored in the bundle
+// under name.
+type bundleEntry struct {
+	name string
+	path string
+	data []byte
+}
+
+// runBundle zips artifacts of a run described by its configuration into
+// one archive with fixed names:
+//
+//	summary.yaml, seed, config.yaml, run.log, stage_metrics.tsv,
+//	manifests/<table>.manifest.tsv, ground_truth/<labels>.tsv
+//
+// Files the configuration does not produce are left out.
+func runBundle(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("bundle", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file of the run")
+	out := flags.String("out", "bundle.zip", "path of the archive to write")
+	logPath := flags.String("log", "", "file with captured output of the run")
+	seed := flags.Int64("seed", 0, "seed of the run, read from the run summary by default")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	entries := []bundleEntry{}
+	if path := cfg.GeneratorCFG.SummaryPath; path != "" {
+		summary := runSummary{}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "unable to read run summary")
+		}
+		if err := yaml.Unmarshal(data, &summary); err != nil {
+			return errors.Wrap(err, "unable to parse run summary")
+		}
+		if *seed == 0 {
+			*seed = summary.Seed
+		}
+		entries = append(entries, bundleEntry{name: "summary.yaml", path: path})
+	}
+	if *seed == 0 {
+		*seed = cfg.GeneratorCFG.Seed
+	}
+	if *seed == 0 {
+		return fmt.Errorf("seed of the run is unknown, set generator.summary_path or -seed")
+	}
+	effective, err := yaml.Marshal(effectiveConfig(cfg, *seed))
+	if err != nil {
+		return errors.Wrap(err, "unable to encode configuration")
+	}
+	entries = append(entries, bundleEntry{name: "seed", data: []byte(fmt.Sprintln(*seed))},
+		bundleEntry{name: "config.yaml", data: effective})
+
+	if *logPath != "" {
+		entries = append(entries, bundleEntry{name: "run.log", path: *logPath})
+	}
+	if path := cfg.GeneratorCFG.StageMetricsPath; path != "" {
+		entries = append(entries, bundleEntry{name: "stage_metrics.tsv", path: path})
+	}
+	if cfg.Output == outputFile {
+		// Manifests are named after mapped tables, and stored under
+		// generated names.
+		opts, err := mappedOptions(cfg)
+		if err != nil {
+			return err
+		}
+		for _, table := range generatedTables {
+			entries = append(entries, bundleEntry{
+				name: "manifests/" + table + ".manifest.tsv",
+				path: filepath.Join(cfg.File.Dir, opts.table(table).name+".manifest.tsv"),
+			})
+		}
+	}
+	for name, path := range map[string]string{
+		"outliers":        cfg.GeneratorCFG.Outliers.LabelsPath,
+		"planted_pairs":   cfg.GeneratorCFG.PlantedPairs.LabelsPath,
+		"identity_events": cfg.GeneratorCFG.IdentityEvents.EventsPath,
+		"name_variants":   cfg.GeneratorCFG.NameVariants.LabelsPath,
+		"duplicates":      cfg.GeneratorCFG.DuplicatesLabelsPath,
+		"upserts":         cfg.GeneratorCFG.Upsert.LabelsPath,
+		"probes":          cfg.GeneratorCFG.Probes.Path,
+	} {
+		if path != "" {
+			entries = append(entries, bundleEntry{name: "ground_truth/" + name + ".tsv", path: path})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return errors.Wrap(err, "unable to create bundle")
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	bundled := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data := entry.data
+		if entry.path != "" {
+			if data, err = ioutil.ReadFile(entry.path); os.IsNotExist(err) {
+				fmt.Printf("%s is missing, not bundled as %s\n", entry.path, entry.name)
+				continue
+			} else if err != nil {
+				return errors.Wrapf(err, "unable to read %s", entry.path)
+			}
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: bundleTime})
+		if err != nil {
+			return errors.Wrapf(err, "unable to add %s to bundle", entry.name)
+		}
+		if _, err := w.Write(data); err != nil {
+			return errors.Wrapf(err, "unable to add %s to bundle", entry.name)
+		}
+		bundled++
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "unable to write bundle")
+	}
+	fmt.Printf("bundled %d files of the run with seed %d to %s\n", bundled, *seed, *out)
+	return f.Close()
+}
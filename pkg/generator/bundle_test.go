@@ -0,0 +1,127 @@
+package generator
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// readBundle returns entries of a bundle by name.
+func readBundle(t *testing.T, path string) map[string][]byte {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	entries := map[string][]byte{}
+	for _, f := range zr.File {
+		if !f.Modified.Equal(bundleTime) {
+			t.Errorf("%s is modified at %v, expected %v", f.Name, f.Modified, bundleTime)
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries[f.Name], err = ioutil.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+	}
+	return entries
+}
+
+// TestBundle checks that bundles hold artifacts of a run under fixed names,
+// leave out missing files and are identical for the same files.
+func TestBundle(t *testing.T) {
+	cfg, dir := testConfig(t, 10)
+	cfg.GeneratorCFG.Probes.Rate = 1
+	testRun(t, cfg)
+	cfg.GeneratorCFG.Seed = 0
+	cfg.GeneratorCFG.SummaryPath = filepath.Join(dir, "summary.yaml")
+	cfg.GeneratorCFG.StageMetricsPath = filepath.Join(dir, "missing.tsv")
+	summary := runSummary{Status: "ok", Rows: 10, Started: time.Now(), Duration: "1s", Seed: 5}
+	if err := summary.save(cfg.GeneratorCFG.SummaryPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath, logPath := filepath.Join(dir, "config.yaml"), filepath.Join(dir, "run.log")
+	if err := ioutil.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(logPath, []byte("inserted 10 pairs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := func(out string) []byte {
+		var err error
+		output := captureStdout(t, func() {
+			err = runBundle(context.Background(), []string{"-config", configPath, "-log", logPath, "-out", out})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(output, "missing.tsv is missing") || !strings.Contains(output, "with seed 5") {
+			t.Errorf("bundle prints:\n%s", output)
+		}
+		data, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	first := bundle(filepath.Join(dir, "first.zip"))
+	if second := bundle(filepath.Join(dir, "second.zip")); !bytes.Equal(first, second) {
+		t.Error("bundles of the same files differ")
+	}
+
+	entries := readBundle(t, filepath.Join(dir, "first.zip"))
+	names := []string{}
+	for name := range entries {
+		names = append(names, name)
+	}
+	expected := []string{
+		"config.yaml", "ground_truth/probes.tsv", "manifests/control_objects.manifest.tsv",
+		"manifests/facial_features.manifest.tsv", "run.log", "seed", "summary.yaml",
+	}
+	if sort.Strings(names); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("bundle holds %v, expected %v", names, expected)
+	}
+	if seed := string(entries["seed"]); seed != "5\n" {
+		t.Errorf("bundle holds seed %q, expected the seed of the summary", seed)
+	}
+	if !strings.Contains(string(entries["config.yaml"]), "seed: 5\n") {
+		t.Errorf("bundled configuration is not effective:\n%s", entries["config.yaml"])
+	}
+	probes, err := ioutil.ReadFile(cfg.GeneratorCFG.Probes.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(entries["ground_truth/probes.tsv"], probes) {
+		t.Error("bundled probes differ from the probes file")
+	}
+
+	// Without summary nor seed the run is unknown.
+	cfg.GeneratorCFG.SummaryPath = ""
+	if data, err = yaml.Marshal(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = runBundle(context.Background(), []string{"-config", configPath, "-out", filepath.Join(dir, "third.zip")})
+	if (err == nil) || !strings.Contains(err.Error(), "seed of the run is unknown") {
+		t.Errorf("bundle without seed returns %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// CheckpointCFG configures checkpoints interrupted runs are resumed from.
+type CheckpointCFG struct {
+	// Empty disables checkpoints.
+	Path string `yaml:"path"`
+	// Time batches in flight and generated rows have to be written after a
+	// stop, 10s by default.
+	FlushTimeoutMS int `yaml:"flush_timeout_ms"`
+}
+
+// workerRange is a share of rows of one worker, rows before next are
+// inserted into both tables.
+type workerRange struct {
+	From int `yaml:"from"`
+	Next int `yaml:"next"`
+	To   int `yaml:"to"`
+}
+
+func splitRows(workers, n int) []workerRange {
+	if workers <= 0 {
+		workers = 1
+	}
+	ranges := make([]workerRange, workers)
+	for w := range ranges {
+		ranges[w] = workerRange{From: w * n / workers, Next: w * n / workers, To: (w + 1) * n / workers}
+	}
+	return ranges
+}
+
+// checkpoint records progress of an interrupted run. Resumed runs keep the
+// seed and the split of rows between workers, so deterministic IDs of the
+// remaining rows are the same as without interruption.
+type checkpoint struct {
+	Seed     int64         `yaml:"seed"`
+	Inserted int           `yaml:"inserted"`
+	Ranges   []workerRange `yaml:"ranges"`
+	// First numeric IDs per table.
+	IDOffsets map[string]uint64 `yaml:"id_offsets,omitempty"`
+}
+
+func newCheckpoint(seed int64, ranges []workerRange, idOffsets map[string]uint64) checkpoint {
+	c := checkpoint{Seed: seed, Ranges: ranges, IDOffsets: idOffsets}
+	for _, r := range ranges {
+		c.Inserted += r.Next - r.From
+	}
+	return c
+}
+
+func (c checkpoint) done() bool {
+	for _, r := range c.Ranges {
+		if r.Next < r.To {
+			return false
+		}
+	}
+	return true
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read checkpoint")
+	}
+	c := &checkpoint{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrap(err, "unable to parse checkpoint")
+	}
+	if len(c.Ranges) == 0 {
+		return nil, errors.Errorf("checkpoint %s has no worker ranges", path)
+	}
+	return c, nil
+}
+
+// save writes the checkpoint atomically, or removes it once every row is
+// inserted.
+func (c checkpoint) save(path string) error {
+	if c.done() {
+		if err := os.Remove(path); (err != nil) && !os.IsNotExist(err) {
+			return errors.Wrap(err, "unable to remove checkpoint")
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode checkpoint")
+	}
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return errors.Wrap(err, "unable to write checkpoint")
+	}
+	return errors.Wrap(os.Rename(path+".tmp", path), "unable to write checkpoint")
+}
+
+// rowProgress tracks the first row of a worker range not written to a
+// table yet. Batches may complete out of order.
+type rowProgress struct {
+	mu   sync.Mutex
+	next int
+	done map[int]int
+}
+
+func newRowProgress(from int) *rowProgress {
+	return &rowProgress{next: from, done: make(map[int]int)}
+}
+
+// mark records rows [from, to) as written.
+func (p *rowProgress) mark(from, to int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[from] = to
+	for {
+		to, ok := p.done[p.next]
+		if !ok {
+			break
+		}
+		delete(p.done, p.next)
+		p.next = to
+	}
+}
+
+func (p *rowProgress) position() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.next
+}
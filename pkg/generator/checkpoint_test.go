@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRowProgress(t *testing.T) {
+	p := newRowProgress(10)
+	p.mark(20, 30)
+	p.mark(30, 35)
+	if next := p.position(); next != 10 {
+		t.Errorf("progress is %d before rows [10, 20) are written", next)
+	}
+	p.mark(10, 20)
+	if next := p.position(); next != 35 {
+		t.Errorf("progress is %d after rows [10, 35) are written", next)
+	}
+}
+
+func TestCheckpointSave(t *testing.T) {
+	_, dir := testConfig(t, 0)
+	path := filepath.Join(dir, "checkpoint.yaml")
+	ranges := []workerRange{{From: 0, Next: 4, To: 5}, {From: 5, Next: 7, To: 10}}
+	c := newCheckpoint(3, ranges, map[string]uint64{"control_objects": 100})
+	if c.Inserted != 6 {
+		t.Errorf("checkpoint has %d inserted rows, expected 6", c.Inserted)
+	}
+	if err := c.save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*loaded, c) {
+		t.Errorf("loaded checkpoint %+v, expected %+v", *loaded, c)
+	}
+
+	// Finished runs leave no checkpoint.
+	c = newCheckpoint(3, []workerRange{{From: 0, Next: 5, To: 5}}, nil)
+	if err := c.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of a finished run is kept: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("seed: 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCheckpoint(path); err == nil {
+		t.Error("checkpoint without ranges is loaded")
+	}
+}
+
+// TestResume checks that an interrupted and resumed run writes rows with IDs
+// of an uninterrupted one exactly once.
+func TestResume(t *testing.T) {
+	readIDs := func(dir, table string) []string {
+		paths, err := filepath.Glob(filepath.Join(dir, table+".0*.tsv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, path := range paths {
+			for _, row := range readTSV(t, path) {
+				ids = append(ids, row[0])
+			}
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	cfg, dir := testConfig(t, 60)
+	cfg.GeneratorCFG.Workers = 2
+	testRun(t, cfg)
+
+	cfg, resumedDir := testConfig(t, 60)
+	cfg.GeneratorCFG.Workers = 2
+	cfg.GeneratorCFG.InIter = 5
+	cfg.GeneratorCFG.ThinkTime = ThinkTimeCFG{Per: thinkTimePerRow, MinMS: 2, MaxMS: 2}
+	cfg.GeneratorCFG.Checkpoint.Path = filepath.Join(resumedDir, "checkpoint.yaml")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := run(ctx, cfg, Options{}, cfg.GeneratorCFG.Seed, nil, time.Now(), &logger{quiet: true}); err == nil {
+		t.Fatal("interrupted run succeeds")
+	}
+	c, err := loadCheckpoint(cfg.GeneratorCFG.Checkpoint.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (c.Inserted == 0) || (c.Inserted == 60) || (len(readIDs(resumedDir, "control_objects")) != c.Inserted) {
+		t.Fatalf("checkpoint of %d inserted rows", c.Inserted)
+	}
+
+	cfg.GeneratorCFG.ThinkTime = ThinkTimeCFG{}
+	if _, err := run(context.Background(), cfg, Options{}, c.Seed, c, time.Now(), &logger{quiet: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"control_objects", "facial_features"} {
+		if !reflect.DeepEqual(readIDs(resumedDir, table), readIDs(dir, table)) {
+			t.Errorf("resumed run writes other %s than an uninterrupted one", table)
+		}
+	}
+	if _, err := os.Stat(cfg.GeneratorCFG.Checkpoint.Path); !os.IsNotExist(err) {
+		t.Errorf("checkpoint of the resumed run is kept: %v", err)
+	}
+}
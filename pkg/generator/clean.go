@@ -0,0 +1,167 @@
+package generator
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// Ways the clean subcommand empties generated tables.
+const (
+	cleanTruncate = "truncate"
+	cleanRecreate = "recreate"
+)
+
+// runClean empties generated tables before repeated runs, either with
+// TRUNCATE or by dropping them and creating them again from the configured
+// schema, e.g. after changing engine or columns. It asks for confirmation
+// unless -yes is given.
+func runClean(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file")
+	mode := flags.String("mode", cleanTruncate, "truncate to empty tables, recreate to drop and create them")
+	yes := flags.Bool("yes", false, "do not ask for confirmation")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+
+	if (*mode != cleanTruncate) && (*mode != cleanRecreate) {
+		return fmt.Errorf("unknown mode \"%s\", supported are %s, %s", *mode, cleanTruncate, cleanRecreate)
+	}
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	admin, err := newTableAdmin(cfg)
+	if err != nil {
+		return err
+	}
+	defer admin.close()
+	tables := admin.opts.tableNames()
+
+	if !*yes {
+		fmt.Printf("%s %s in database %s at %s? [y/N] ", *mode, strings.Join(tables, ", "),
+			cfg.StorageCFG.DefaultDB, cfg.StorageCFG.Addr)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); (answer != "y") && (answer != "yes") {
+			return fmt.Errorf("not confirmed")
+		}
+	}
+
+	if err := admin.clean(ctx, *mode); err != nil {
+		return err
+	}
+	done := "truncated"
+	if *mode == cleanRecreate {
+		done = "recreated"
+	}
+	fmt.Printf("%s %s\n", done, strings.Join(tables, ", "))
+	return nil
+}
+
+// tableAdmin runs statements and queries against generated tables of the
+// configured storage.
+type tableAdmin struct {
+	opts insertOptions
+	// Native ClickHouse connection, nil for other storages.
+	db *sql.DB
+	// exec runs a statement, query reads all rows of a query.
+	exec   func(ctx context.Context, query string) error
+	query  func(ctx context.Context, query string) error
+	create func(ctx context.Context) error
+	close  func()
+}
+
+func newTableAdmin(cfg *Config) (*tableAdmin, error) {
+	// Mapped names and columns of generated tables follow the generator
+	// configuration.
+	opts, err := mappedOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	a := &tableAdmin{opts: opts}
+	switch {
+	case cfg.StorageCFG.Type == storagePostgres:
+		pg, err := connectPostgres(cfg.StorageCFG, nil)
+		if err != nil {
+			return nil, err
+		}
+		a.exec = func(ctx context.Context, query string) error {
+			_, err := pg.ExecContext(ctx, query)
+			return err
+		}
+		a.query = func(ctx context.Context, query string) error {
+			return drainRows(pg.QueryContext(ctx, query))
+		}
+		a.create = func(ctx context.Context) error {
+			return createPostgresTables(ctx, pg, opts)
+		}
+		a.close = func() { pg.Close() }
+	case cfg.StorageCFG.Protocol == protocolHTTP:
+		ch, err := connectClickHouseHTTP(cfg.StorageCFG, nil)
+		if err != nil {
+			return nil, err
+		}
+		a.exec = func(ctx context.Context, query string) error {
+			_, err := ch.Query(ctx, query)
+			return err
+		}
+		a.query = a.exec
+		a.create = func(ctx context.Context) error {
+			return ch.createTables(ctx, cfg.StorageCFG.Schema, opts)
+		}
+		a.close = func() {}
+	default:
+		db, err := connectClickHouse(cfg.StorageCFG, nil)
+		if err != nil {
+			return nil, err
+		}
+		a.exec = func(ctx context.Context, query string) error {
+			_, err := db.ExecContext(ctx, query)
+			return err
+		}
+		a.query = func(ctx context.Context, query string) error {
+			return drainRows(db.QueryContext(ctx, query))
+		}
+		a.create = func(ctx context.Context) error {
+			return createTables(ctx, db, cfg.StorageCFG.Schema, opts)
+		}
+		a.db, a.close = db, func() { db.Close() }
+	}
+	return a, nil
+}
+
+// clean truncates generated tables, or drops and creates them again in
+// recreate mode.
+func (a *tableAdmin) clean(ctx context.Context, mode string) error {
+	for _, table := range a.opts.tableNames() {
+		query := "TRUNCATE TABLE " + table
+		if mode == cleanRecreate {
+			query = "DROP TABLE IF EXISTS " + table
+		}
+		if err := a.exec(ctx, query); err != nil {
+			return errors.Wrapf(err, "unable to %s %s", mode, table)
+		}
+	}
+	if mode == cleanRecreate {
+		return a.create(ctx)
+	}
+	return nil
+}
+
+// drainRows reads and closes rows of a query.
+func drainRows(rows *sql.Rows, err error) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
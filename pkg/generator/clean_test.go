@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// withStdin runs f reading input from stdin.
+func withStdin(t *testing.T, input string, f func()) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := w.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	f()
+}
+
+// TestClean checks that generated tables are truncated, or dropped and
+// created again, after confirmation.
+func TestClean(t *testing.T) {
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	mu := sync.Mutex{}
+	var statements []string
+	server.answer = func(query string) (nativeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Statements are recorded by verb and their last word, the table
+		// of TRUNCATE and DROP.
+		words := strings.Fields(query)
+		statements = append(statements, words[0]+" "+words[len(words)-1])
+		return nativeResult{}, nil
+	}
+	clean := func(input string, args ...string) (string, []string, error) {
+		mu.Lock()
+		statements = nil
+		mu.Unlock()
+		var err error
+		output := ""
+		withStdin(t, input, func() {
+			output = captureStdout(t, func() {
+				err = runClean(context.Background(), append([]string{"-config", "../../config.yaml",
+					"-storage.port", fmt.Sprint(server.port()), "-storage.max_pings", "1"}, args...))
+			})
+		})
+		mu.Lock()
+		defer mu.Unlock()
+		return output, statements, err
+	}
+
+	output, executed, err := clean("", "-yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"TRUNCATE control_objects", "TRUNCATE facial_features"}; !reflect.DeepEqual(executed, expected) {
+		t.Errorf("truncate runs %q, expected %q", executed, expected)
+	}
+	if output != "truncated control_objects, facial_features\n" {
+		t.Errorf("truncate prints %q", output)
+	}
+
+	output, executed, err = clean("yes\n", "-mode", cleanRecreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(executed) < 4) || (executed[0] != "DROP control_objects") || (executed[1] != "DROP facial_features") ||
+		!strings.HasPrefix(executed[2], "CREATE") {
+		t.Errorf("recreate runs %q", executed)
+	}
+	if !strings.HasPrefix(output, cleanRecreate+" control_objects, facial_features in database ") ||
+		!strings.HasSuffix(output, "? [y/N] recreated control_objects, facial_features\n") {
+		t.Errorf("recreate prints %q", output)
+	}
+
+	for _, input := range []string{"\n", "n\n", ""} {
+		if _, executed, err := clean(input); (err == nil) || (err.Error() != "not confirmed") || (len(executed) != 0) {
+			t.Errorf("answer %q runs %q and returns %v", input, executed, err)
+		}
+	}
+	if err := runClean(context.Background(), []string{"-mode", "drop"}); err == nil {
+		t.Error("unknown clean mode is accepted")
+	}
+}
@@ -0,0 +1,71 @@
+package generator
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestClusters(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	g, err := newFFVGenerator(FFVCFG{Clusters: 4}, FFVStructureCFG{}, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(g.centroids) != 4) || (g.spread != 0.05) {
+		t.Fatalf("%d centroids with spread %v, expected 4 with the default 0.05", len(g.centroids), g.spread)
+	}
+	persons := make([]int, 4)
+	for i := 0; i < 200; i++ {
+		identity := g.identity(rnd)
+		c := g.cluster(identity)
+		if c < 0 {
+			t.Fatal("person is not assigned to a centroid")
+		}
+		persons[c]++
+		// Sightings are within a few stddevs of noise of their centroid,
+		// about 0.05 * sqrt(128) away, and far from other centroids.
+		for j := 0; j < 3; j++ {
+			ffv := g.sighting(rnd, identity)
+			for k, centroid := range g.centroids {
+				if d := l2Distance(ffv, centroid); (k == c) != (d < 0.05*math.Sqrt(128)*1.5) {
+					t.Fatalf("sighting of a person of centroid %d is %v away from centroid %d", c, d, k)
+				}
+			}
+		}
+	}
+	for c, n := range persons {
+		if (n < 25) || (n > 75) {
+			t.Errorf("%d of 200 persons are assigned to centroid %d, expected about 50", n, c)
+		}
+	}
+	if identity := (&ffvGenerator{}).identity(rnd); identity != nil {
+		t.Error("persons get centroids without clusters")
+	}
+}
+
+// TestClustersRun checks that control objects get several FFVs near each
+// other.
+func TestClustersRun(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	cfg.GeneratorCFG.FFV.Clusters = 8
+	cfg.GeneratorCFG.FFVPerCOB = CountCFG{Min: 1, Max: 3}
+	testRun(t, cfg)
+	vectors := map[string][][]float64{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		vectors[row[1]] = append(vectors[row[1]], parseTSVVector(t, row[4]))
+	}
+	counts := map[int]int{}
+	for cobID, ffvs := range vectors {
+		counts[len(ffvs)]++
+		for _, ffv := range ffvs[1:] {
+			if d := l2Distance(ffv, ffvs[0]); d > 2*0.05*math.Sqrt(2*128) {
+				t.Errorf("FFVs of control object %s are %v away", cobID, d)
+			}
+		}
+	}
+	if (len(vectors) != 100) || (len(counts) != 3) || (counts[1] == 0) || (counts[3] == 0) {
+		t.Errorf("numbers of FFVs of control objects are %v, expected 1 to 3", counts)
+	}
+}
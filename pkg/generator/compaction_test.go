@@ -0,0 +1,78 @@
+package generator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestCompaction checks that compacted files hold rows of rotated files in
+// order and are listed in the manifest.
+func TestCompaction(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	testRun(t, cfg)
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "control_objects.0001.tsv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compression := range []CompressionCFG{{}, {Algorithm: compressionGzip}, {Algorithm: compressionZstd}} {
+		cfg, dir := testConfig(t, 100)
+		cfg.GeneratorCFG.InIter = 10
+		cfg.File.RotateRows = 10
+		cfg.File.Compression = compression
+		testRun(t, cfg)
+		parts, err := readManifest(filepath.Join(dir, "control_objects.manifest.tsv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(parts) != 10 {
+			t.Fatalf("%d rotated files are listed without compaction", len(parts))
+		}
+
+		cfg, dir = testConfig(t, 100)
+		cfg.GeneratorCFG.InIter = 10
+		cfg.File.RotateRows = 10
+		cfg.File.Compression = compression
+		cfg.File.CompactBytes = 3*parts[0].bytes + parts[0].bytes/2
+		testRun(t, cfg)
+		if parts, err = readManifest(filepath.Join(dir, "control_objects.manifest.tsv")); err != nil {
+			t.Fatal(err)
+		}
+		if (len(parts) < 3) || (len(parts) > 5) {
+			t.Errorf("10 files of %v are compacted into %d files of at most 3.5 files", compression, len(parts))
+		}
+		rows := 0
+		data := []byte{}
+		for _, part := range parts {
+			file, err := ioutil.ReadFile(part.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (int64(len(file)) != part.bytes) || (part.bytes > cfg.File.CompactBytes) {
+				t.Errorf("manifest lists %d bytes of %s of %d bytes", part.bytes, part.path, len(file))
+			}
+			if compression.enabled() {
+				file = decompress(t, compression.Algorithm, file)
+			}
+			data = append(data, file...)
+			rows += part.rows
+		}
+		if (rows != 100) || !bytes.Equal(data, expected) {
+			t.Errorf("compacted files of %v hold %d rows, other than written ones", compression, rows)
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "control_objects.0*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != len(parts) {
+			t.Errorf("compaction leaves files %v", files)
+		}
+	}
+
+	cfg.File.Format, cfg.File.CompactBytes = fileFormatParquet, 1<<20
+	if err := cfg.File.validate(); err == nil {
+		t.Error("compaction of Parquet files is accepted")
+	}
+}
@@ -0,0 +1,50 @@
+package generator
+
+import (
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+var complianceColumns = []string{"consent_status", "legal_basis", "retention_class"}
+
+// ComplianceCFG configures weights of values of compliance columns.
+type ComplianceCFG struct {
+	Enabled        bool               `yaml:"enabled"`
+	ConsentStatus  map[string]float64 `yaml:"consent_status"`
+	LegalBasis     map[string]float64 `yaml:"legal_basis"`
+	RetentionClass map[string]float64 `yaml:"retention_class"`
+}
+
+type complianceGenerator struct {
+	consentStatus  *weightedPool
+	legalBasis     *weightedPool
+	retentionClass *weightedPool
+}
+
+func newComplianceGenerator(cfg ComplianceCFG) (*complianceGenerator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	g := &complianceGenerator{}
+	var err error
+	if g.consentStatus, err = newWeightedPool(cfg.ConsentStatus); err != nil {
+		return nil, errors.Wrap(err, "invalid consent_status distribution")
+	}
+	if g.legalBasis, err = newWeightedPool(cfg.LegalBasis); err != nil {
+		return nil, errors.Wrap(err, "invalid legal_basis distribution")
+	}
+	if g.retentionClass, err = newWeightedPool(cfg.RetentionClass); err != nil {
+		return nil, errors.Wrap(err, "invalid retention_class distribution")
+	}
+	return g, nil
+}
+
+func (g *complianceGenerator) fill(rnd *rand.Rand, cob *controlObject) {
+	if g == nil {
+		return
+	}
+	cob.consentStatus = g.consentStatus.pick(rnd)
+	cob.legalBasis = g.legalBasis.pick(rnd)
+	cob.retentionClass = g.retentionClass.pick(rnd)
+}
@@ -0,0 +1,46 @@
+package generator
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestComplianceColumns(t *testing.T) {
+	cfg, dir := testConfig(t, 1000)
+	cfg.GeneratorCFG.Compliance = ComplianceCFG{
+		Enabled:        true,
+		ConsentStatus:  map[string]float64{"granted": 3, "withdrawn": 1},
+		LegalBasis:     map[string]float64{"consent": 1, "contract": 0},
+		RetentionClass: map[string]float64{"short": 1, "long": 1},
+	}
+	testRun(t, cfg)
+
+	counts := map[string]int{}
+	rows := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+	for _, row := range rows {
+		if len(row) != len(controlObjectsColumns)+len(complianceColumns) {
+			t.Fatalf("control object has %d columns, expected %d with compliance columns",
+				len(row), len(controlObjectsColumns)+len(complianceColumns))
+		}
+		for i, column := range complianceColumns {
+			counts[column+"="+row[len(controlObjectsColumns)+i]]++
+		}
+	}
+	for value, expected := range map[string]float64{
+		"consent_status=granted": 0.75, "consent_status=withdrawn": 0.25,
+		"legal_basis=consent":   1,
+		"retention_class=short": 0.5, "retention_class=long": 0.5,
+	} {
+		if share := float64(counts[value]) / float64(len(rows)); (share < expected-0.05) || (share > expected+0.05) {
+			t.Errorf("%s in %.2f of rows, expected %.2f", value, share, expected)
+		}
+	}
+	if len(counts) != 5 {
+		t.Errorf("unexpected values of compliance columns: %v", counts)
+	}
+
+	cfg.GeneratorCFG.Compliance.LegalBasis = map[string]float64{"consent": -1}
+	if _, err := newComplianceGenerator(cfg.GeneratorCFG.Compliance); err == nil {
+		t.Error("negative weights are accepted")
+	}
+}
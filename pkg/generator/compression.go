@@ -0,0 +1,220 @@
+package generator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	compressionNone   = "none"
+	compressionLZ4    = "lz4"
+	compressionGzip   = "gzip"
+	compressionZstd   = "zstd"
+	compressionSnappy = "snappy"
+)
+
+// CompressionCFG selects compression of a sink. ClickHouse native protocol
+// of the vendored driver supports lz4 without levels, the HTTP interface
+// and files support gzip and zstd, Kafka compresses in its producer.
+type CompressionCFG struct {
+	Algorithm string `yaml:"algorithm"`
+	// Level of gzip (1 to 9) or zstd (1 to 22), their defaults when 0.
+	Level int `yaml:"level"`
+}
+
+func (cfg CompressionCFG) enabled() bool {
+	return (cfg.Algorithm != "") && (cfg.Algorithm != compressionNone)
+}
+
+func (cfg CompressionCFG) validate(supported ...string) error {
+	if !cfg.enabled() {
+		return nil
+	}
+	for _, algorithm := range supported {
+		if cfg.Algorithm == algorithm {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported compression \"%s\", supported are %v", cfg.Algorithm, supported)
+}
+
+func (cfg CompressionCFG) String() string {
+	if !cfg.enabled() {
+		return compressionNone
+	}
+	if cfg.Level != 0 {
+		return fmt.Sprintf("%s level %d", cfg.Algorithm, cfg.Level)
+	}
+	return cfg.Algorithm
+}
+
+// extension is the suffix of compressed files.
+func (cfg CompressionCFG) extension() string {
+	if cfg.Algorithm == compressionZstd {
+		return ".zst"
+	}
+	return ".gz"
+}
+
+// decompressCommand prints decompressed files given as arguments.
+func (cfg CompressionCFG) decompressCommand() string {
+	if cfg.Algorithm == compressionZstd {
+		return "zstd -dc"
+	}
+	return "gzip -dc"
+}
+
+func (cfg CompressionCFG) gzipLevel() int {
+	if cfg.Level == 0 {
+		return gzip.DefaultCompression
+	}
+	return cfg.Level
+}
+
+func (cfg CompressionCFG) zstdLevel() zstd.EncoderLevel {
+	if cfg.Level == 0 {
+		return zstd.SpeedDefault
+	}
+	return zstd.EncoderLevelFromZstd(cfg.Level)
+}
+
+// compressor compresses whole buffers with gzip or zstd and measures the
+// time it takes. It is safe for concurrent use.
+type compressor struct {
+	cfg CompressionCFG
+	// Shared by all buffers, zstd encoders compress with EncodeAll
+	// concurrently.
+	zstd *zstd.Encoder
+
+	mu       sync.Mutex
+	raw      int64
+	written  int64
+	duration time.Duration
+}
+
+// newCompressor returns nil when cfg disables compression.
+func newCompressor(cfg CompressionCFG) (*compressor, error) {
+	if !cfg.enabled() {
+		return nil, nil
+	}
+	c := &compressor{cfg: cfg}
+	switch cfg.Algorithm {
+	case compressionGzip:
+		if _, err := gzip.NewWriterLevel(nil, cfg.gzipLevel()); err != nil {
+			return nil, err
+		}
+	case compressionZstd:
+		var err error
+		if c.zstd, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(cfg.zstdLevel())); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression \"%s\"", cfg.Algorithm)
+	}
+	return c, nil
+}
+
+func (c *compressor) compress(data []byte) ([]byte, error) {
+	start := time.Now()
+	var compressed []byte
+	if c.zstd != nil {
+		compressed = c.zstd.EncodeAll(data, nil)
+	} else {
+		buf := &bytes.Buffer{}
+		zw, err := gzip.NewWriterLevel(buf, c.cfg.gzipLevel())
+		if err != nil {
+			return nil, err
+		}
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		compressed = buf.Bytes()
+	}
+	c.add(int64(len(data)), int64(len(compressed)), time.Now().Sub(start))
+	return compressed, nil
+}
+
+func (c *compressor) add(raw, written int64, duration time.Duration) {
+	c.mu.Lock()
+	c.raw += raw
+	c.written += written
+	c.duration += duration
+	c.mu.Unlock()
+}
+
+// newWriter returns a writer compressing a stream into w. Bytes and time of
+// writes are counted like compression of buffers, compressed bytes are left to
+// the caller.
+func (c *compressor) newWriter(w io.Writer) (io.WriteCloser, error) {
+	var zw io.WriteCloser
+	var err error
+	if c.zstd != nil {
+		// One goroutine, so that writes take the time of compression.
+		zw, err = zstd.NewWriter(w, zstd.WithEncoderLevel(c.cfg.zstdLevel()), zstd.WithEncoderConcurrency(1))
+	} else {
+		zw, err = gzip.NewWriterLevel(w, c.cfg.gzipLevel())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &timedWriter{WriteCloser: zw, c: c}, nil
+}
+
+// report returns compression time and throughput of compressed bytes.
+func (c *compressor) report() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	throughput := 0.0
+	if c.duration > 0 {
+		throughput = float64(c.raw) / c.duration.Seconds() / (1 << 20)
+	}
+	return fmt.Sprintf("compressing took %v (%.1f MiB/s)", c.duration, throughput)
+}
+
+func (c *compressor) String() string {
+	c.mu.Lock()
+	raw, written := c.raw, c.written
+	c.mu.Unlock()
+	ratio := 1.0
+	if written != 0 {
+		ratio = float64(raw) / float64(written)
+	}
+	return fmt.Sprintf("%d bytes, %d sent with %v (ratio %.2f), %s", raw, written, c.cfg, ratio, c.report())
+}
+
+type timedWriter struct {
+	io.WriteCloser
+	c *compressor
+}
+
+func (w *timedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := w.WriteCloser.Write(p)
+	w.c.add(int64(n), 0, time.Now().Sub(start))
+	return n, err
+}
+
+func (w *timedWriter) Close() error {
+	start := time.Now()
+	err := w.WriteCloser.Close()
+	w.c.add(0, 0, time.Now().Sub(start))
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,133 @@
+package generator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func decompress(t *testing.T, algorithm string, data []byte) []byte {
+	var r io.Reader
+	switch algorithm {
+	case compressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case compressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	decompressed, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decompressed
+}
+
+func TestCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("control_object\t[0.5,0.25]\n"), 1000)
+	for _, cfg := range []CompressionCFG{
+		{Algorithm: compressionGzip},
+		{Algorithm: compressionGzip, Level: 1},
+		{Algorithm: compressionZstd},
+		{Algorithm: compressionZstd, Level: 19},
+	} {
+		t.Run(cfg.String(), func(t *testing.T) {
+			c, err := newCompressor(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compressed, err := c.compress(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decompress(t, cfg.Algorithm, compressed), data) {
+				t.Error("compressed buffer does not decompress to its data")
+			}
+			if (c.raw != int64(len(data))) || (c.written != int64(len(compressed))) || (c.written >= c.raw/10) {
+				t.Errorf("compressing %d bytes to %d counts %d and %d bytes", len(data), len(compressed), c.raw, c.written)
+			}
+
+			buf := &bytes.Buffer{}
+			zw, err := c.newWriter(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			zw.Write(data[:100])
+			zw.Write(data[100:])
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decompress(t, cfg.Algorithm, buf.Bytes()), data) {
+				t.Error("compressed stream does not decompress to its data")
+			}
+			if c.raw != 2*int64(len(data)) {
+				t.Errorf("streams count %d raw bytes of %d", c.raw-int64(len(data)), len(data))
+			}
+			if !strings.Contains(c.String(), "sent with "+cfg.String()) || !strings.Contains(c.report(), "MiB/s") {
+				t.Errorf("unexpected report %s", c)
+			}
+		})
+	}
+
+	if c, err := newCompressor(CompressionCFG{Algorithm: compressionNone}); (c != nil) || (err != nil) {
+		t.Errorf("compression none returns %v, %v", c, err)
+	}
+	if err := (CompressionCFG{Algorithm: compressionZstd}).validate(compressionLZ4); err == nil {
+		t.Error("zstd is accepted where only lz4 is supported")
+	}
+	for _, cfg := range []CompressionCFG{{Algorithm: compressionZstd}, {Algorithm: compressionLZ4, Level: 3}} {
+		if _, err := connectClickHouse(StorageCFG{Compression: cfg}, &logger{quiet: true}); err == nil {
+			t.Errorf("native protocol accepts compression %v", cfg)
+		}
+	}
+}
+
+// TestCompressedFiles checks that compressed output files hold the rows of
+// uncompressed ones.
+func TestCompressedFiles(t *testing.T) {
+	cfg, dir := testConfig(t, 20)
+	testRun(t, cfg)
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "control_objects.0001.tsv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		compression CompressionCFG
+		name        string
+	}{
+		{CompressionCFG{Algorithm: compressionGzip, Level: 9}, "control_objects.0001.tsv.gz"},
+		{CompressionCFG{Algorithm: compressionZstd}, "control_objects.0001.tsv.zst"},
+	} {
+		cfg, dir := testConfig(t, 20)
+		cfg.File.Compression = test.compression
+		testRun(t, cfg)
+		data, err := ioutil.ReadFile(filepath.Join(dir, test.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decompress(t, test.compression.Algorithm, data), expected) {
+			t.Errorf("%s does not decompress to rows of uncompressed files", test.name)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "control_objects.0001.tsv")); !os.IsNotExist(err) {
+			t.Errorf("%v compression leaves uncompressed files", test.compression)
+		}
+	}
+	if err := (FileOutputCFG{Format: fileFormatTSV, Compression: CompressionCFG{Algorithm: compressionLZ4}}).validate(); err == nil {
+		t.Error("lz4 is accepted for files")
+	}
+}
@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const redacted = "<redacted>"
+
+// effectiveConfig returns configuration of the run with flags applied, the
+// seed resolved and secrets redacted.
+func effectiveConfig(c *Config, seed int64) Config {
+	effective := *c
+	effective.GeneratorCFG.Seed = seed
+	for _, secret := range []*string{
+		&effective.StorageCFG.Passwd,
+		&effective.StorageCFG.Proxy.Passwd,
+		&effective.Masking.Key,
+		&effective.Masking.RemapKey,
+		&effective.GeneratorCFG.Pseudonyms.Key,
+		&effective.API.AuthValue,
+		&effective.GeneratorCFG.Enrollment.AuthValue,
+	} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	return effective
+}
+
+// startConfigServer serves the effective configuration as YAML until the
+// process exits.
+func startConfigServer(addr string, c *Config, seed int64, log *logger) error {
+	data, err := yaml.Marshal(effectiveConfig(c, seed))
+	if err != nil {
+		return errors.Wrap(err, "unable to encode effective configuration")
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "unable to listen on %s", addr)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-yaml")
+		w.Write(data)
+	})
+	go http.Serve(listener, mux)
+	log.logf("serving effective configuration on http://%s/config\n", listener.Addr())
+	return nil
+}
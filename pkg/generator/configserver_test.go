@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	cfg, _ := testConfig(t, 10)
+	cfg.StorageCFG.Passwd = "secret"
+	cfg.Masking.Key = "masking key"
+	cfg.API.AuthValue = ""
+	effective := effectiveConfig(cfg, 42)
+	if (effective.StorageCFG.Passwd != redacted) || (effective.Masking.Key != redacted) {
+		t.Errorf("secrets are not redacted: %q, %q", effective.StorageCFG.Passwd, effective.Masking.Key)
+	}
+	if effective.API.AuthValue != "" {
+		t.Errorf("empty secret is redacted as %q", effective.API.AuthValue)
+	}
+	if effective.GeneratorCFG.Seed != 42 {
+		t.Errorf("effective seed is %d, expected the resolved 42", effective.GeneratorCFG.Seed)
+	}
+	if (cfg.StorageCFG.Passwd != "secret") || (cfg.GeneratorCFG.Seed != 1) {
+		t.Error("redaction changes configuration of the run")
+	}
+}
+
+func TestConfigServer(t *testing.T) {
+	cfg, _ := testConfig(t, 10)
+	cfg.StorageCFG.Passwd = "secret"
+	output := captureStdout(t, func() {
+		if err := startConfigServer("127.0.0.1:0", cfg, 42, &logger{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	url := strings.TrimSpace(strings.TrimPrefix(output, "serving effective configuration on "))
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (resp.StatusCode != http.StatusOK) || (resp.Header.Get("Content-Type") != "application/x-yaml") {
+		t.Fatalf("GET /config returns %s of %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Error("served configuration has a secret")
+	}
+	served := Config{}
+	if err := yaml.Unmarshal(data, &served); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := yaml.Marshal(effectiveConfig(cfg, 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserialized, err := yaml.Marshal(served); (err != nil) || !reflect.DeepEqual(reserialized, expected) {
+		t.Errorf("served configuration differs from the effective one:\n%s", data)
+	}
+
+	resp, err = http.Post(url, "application/x-yaml", strings.NewReader("seed: 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /config returns %s", resp.Status)
+	}
+}
@@ -0,0 +1,106 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConsistencyCFG configures readers checking inserted rows during runs.
+type ConsistencyCFG struct {
+	Readers    int `yaml:"readers"`
+	IntervalMS int `yaml:"interval_ms"`
+}
+
+// consistencyChecker runs reader goroutines that count rows of generated
+// tables while inserts are running and reports counts that went backwards.
+type consistencyChecker struct {
+	db       *sql.DB
+	tables   []string
+	interval time.Duration
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu           sync.Mutex
+	queries      int
+	errors       int
+	totalLatency time.Duration
+	maxLatency   time.Duration
+	anomalies    []string
+}
+
+// startConsistencyChecker starts readers counting rows of tables, database
+// names of generated tables.
+func startConsistencyChecker(ctx context.Context, db *sql.DB, cfg ConsistencyCFG, tables []string) *consistencyChecker {
+	if cfg.Readers <= 0 {
+		return nil
+	}
+	c := &consistencyChecker{
+		db:       db,
+		tables:   tables,
+		interval: time.Duration(cfg.IntervalMS) * time.Millisecond,
+	}
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.wg.Add(cfg.Readers)
+	for i := 0; i < cfg.Readers; i++ {
+		go c.read(i + 1)
+	}
+	return c
+}
+
+func (c *consistencyChecker) read(reader int) {
+	defer c.wg.Done()
+	last := make(map[string]uint64)
+	for c.ctx.Err() == nil {
+		for _, table := range c.tables {
+			start := time.Now()
+			count := uint64(0)
+			err := c.db.QueryRowContext(c.ctx, "SELECT count() FROM "+table).Scan(&count)
+			latency := time.Now().Sub(start)
+
+			if c.ctx.Err() != nil {
+				return
+			}
+			c.mu.Lock()
+			c.queries++
+			c.totalLatency += latency
+			if latency > c.maxLatency {
+				c.maxLatency = latency
+			}
+			if err != nil {
+				c.errors++
+			} else if previous, ok := last[table]; ok && (count < previous) {
+				c.anomalies = append(c.anomalies, fmt.Sprintf("reader %d: %s count went from %d down to %d at %s",
+					reader, table, previous, count, start.Format(time.RFC3339Nano)))
+			}
+			c.mu.Unlock()
+
+			if err == nil {
+				last[table] = count
+			}
+		}
+		sleepContext(c.ctx, c.interval)
+	}
+}
+
+func (c *consistencyChecker) stop() string {
+	c.cancel()
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	avgLatency := time.Duration(0)
+	if c.queries != 0 {
+		avgLatency = c.totalLatency / time.Duration(c.queries)
+	}
+	report := fmt.Sprintf("%d count queries (%d failed), latency avg %v max %v, %d monotonicity anomalies",
+		c.queries, c.errors, avgLatency, c.maxLatency, len(c.anomalies))
+	if len(c.anomalies) != 0 {
+		report += "\n" + strings.Join(c.anomalies, "\n")
+	}
+	return report
+}
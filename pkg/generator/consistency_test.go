@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsistencyChecker(t *testing.T) {
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	mu := sync.Mutex{}
+	// Counts of control objects go back once.
+	counts := []uint64{5, 7, 6, 8}
+	served := make(chan struct{})
+	server.answer = func(query string) (nativeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		count := uint64(10)
+		switch query {
+		case "SELECT count() FROM control_objects":
+			count = counts[0]
+			if len(counts) > 1 {
+				counts = counts[1:]
+			} else if served != nil {
+				close(served)
+				served = nil
+			}
+		case "SELECT count() FROM facial_features":
+		default:
+			return nativeResult{}, fmt.Errorf("unexpected query %s", query)
+		}
+		return nativeResult{names: []string{"count()"}, types: []string{"UInt64"}, rows: [][]interface{}{{count}}}, nil
+	}
+	db := server.connect(t)
+
+	if c := startConsistencyChecker(context.Background(), db, ConsistencyCFG{}, generatedTables); c != nil {
+		t.Fatal("consistency is checked without readers")
+	}
+	c := startConsistencyChecker(context.Background(), db, ConsistencyCFG{Readers: 1, IntervalMS: 1}, generatedTables)
+	mu.Lock()
+	wait := served
+	mu.Unlock()
+	select {
+	case <-wait:
+	case <-time.After(10 * time.Second):
+		t.Fatal("readers do not count rows")
+	}
+	report := c.stop()
+	if !strings.Contains(report, "(0 failed)") || !strings.Contains(report, ", 1 monotonicity anomalies\n") ||
+		!strings.Contains(report, "reader 1: control_objects count went from 7 down to 6 at ") {
+		t.Errorf("consistency report is\n%s", report)
+	}
+}
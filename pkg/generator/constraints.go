@@ -0,0 +1,81 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/nofacedb/generator/pkg/fieldgen"
+)
+
+const defaultConstraintAttempts = 100
+
+// ConstraintsCFG lists rules control objects satisfy, e.g. birthdate < ts,
+// see fieldgen.Constraint.
+type ConstraintsCFG struct {
+	Rules []string `yaml:"rules"`
+	// Attempts to generate personal data satisfying every rule, 100 by
+	// default.
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// constraints check personal data and field expressions of control objects,
+// which are generated again until they satisfy every rule.
+type constraints struct {
+	rules       []*fieldgen.Constraint
+	maxAttempts int
+	custom      []string
+}
+
+func newConstraints(cfg ConstraintsCFG, fields *fieldExpressions) (*constraints, error) {
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+	if cfg.MaxAttempts < 0 {
+		return nil, fmt.Errorf("max_attempts must be positive, got %d", cfg.MaxAttempts)
+	}
+	c := &constraints{maxAttempts: cfg.MaxAttempts}
+	if c.maxAttempts == 0 {
+		c.maxAttempts = defaultConstraintAttempts
+	}
+	if fields != nil {
+		c.custom = fields.custom
+	}
+	known := append(append([]string{}, controlObjectsColumns...), c.custom...)
+	for _, expr := range cfg.Rules {
+		rule, err := fieldgen.ParseConstraint(expr, known)
+		if err != nil {
+			return nil, err
+		}
+		c.rules = append(c.rules, rule)
+	}
+	return c, nil
+}
+
+// violated returns the first rule cob violates, nil when it satisfies all
+// of them or there are no rules.
+func (c *constraints) violated(cob controlObject) *fieldgen.Constraint {
+	if c == nil {
+		return nil
+	}
+	row := map[string]string{
+		"id":         cob.id,
+		"ts":         cob.ts.Format("2006-01-02 15:04:05"),
+		"passport":   cob.passport,
+		"surname":    cob.surname,
+		"name":       cob.name,
+		"patronymic": cob.patronymic,
+		"sex":        cob.sex,
+		"birthdate":  cob.birthDate,
+		"phone_num":  cob.phoneNum,
+		"email":      cob.email,
+		"address":    cob.address,
+	}
+	for i, column := range c.custom {
+		row[column] = cob.custom[i]
+	}
+	for _, rule := range c.rules {
+		if !rule.Check(row) {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package generator
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConstraints(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	cfg.GeneratorCFG.Constraints.Rules = []string{
+		"birthdate < '1980-01-01'",
+		"if sex == F then patronymic endswith 'вна'",
+		"sex == F or surname endswith ов",
+	}
+	testRun(t, cfg)
+	rows := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+	if len(rows) != 100 {
+		t.Fatalf("%d control objects are generated, expected 100", len(rows))
+	}
+	for _, row := range rows {
+		sex, surname, patronymic, birthdate := row[6], row[3], row[5], row[7]
+		if (birthdate >= "1980-01-01") || ((sex == "F") && !strings.HasSuffix(patronymic, "вна")) ||
+			((sex != "F") && !strings.HasSuffix(surname, "ов")) {
+			t.Errorf("row %q violates constraints", row)
+		}
+	}
+
+	cfg.GeneratorCFG.Constraints = ConstraintsCFG{Rules: []string{"name == Nobody"}, MaxAttempts: 5}
+	_, err := run(context.Background(), cfg, Options{}, 1, nil, time.Now(), &logger{quiet: true})
+	if (err == nil) || !strings.Contains(err.Error(), "violates constraint \"name == Nobody\" after 5 attempts") {
+		t.Errorf("unsatisfiable constraint got error %v", err)
+	}
+	cfg.GeneratorCFG.Constraints = ConstraintsCFG{Rules: []string{"nam == Nobody"}}
+	if _, err := newGeneration(cfg, 1); err == nil {
+		t.Error("constraint of an unknown column is accepted")
+	}
+}
@@ -0,0 +1,47 @@
+package generator
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TestMaxDuration checks that runs stop promptly when the root context is
+// done, also while workers think.
+func TestMaxDuration(t *testing.T) {
+	cfg, _ := testConfig(t, 1000000)
+	cfg.GeneratorCFG.Workers = 4
+	cfg.GeneratorCFG.ThinkTime = ThinkTimeCFG{Per: thinkTimePerRow, MinMS: 1000}
+	g := New(cfg)
+	g.Options.Machine, g.Options.MaxDuration = true, 50*time.Millisecond
+	startTime := time.Now()
+	inserted, err := g.Run(context.Background())
+	if elapsed := time.Now().Sub(startTime); elapsed > 5*time.Second {
+		t.Errorf("run limited to 50ms stopped in %v", elapsed)
+	}
+	if (err == nil) || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("run limited to 50ms returns %v after %d pairs", err, inserted)
+	}
+}
+
+func TestRetriesStopOnContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	cfg := RetriesCFG{Transient: RetryPolicyCFG{MaxRetries: 10, BackoffMS: 3600000}}
+	attempts := 0
+	startTime := time.Now()
+	err := insertWithRetries(ctx, cfg, &logger{quiet: true}, func() error {
+		attempts++
+		return io.EOF
+	})
+	if elapsed := time.Now().Sub(startTime); elapsed > 5*time.Second {
+		t.Errorf("backoff of an hour stopped in %v", elapsed)
+	}
+	if (errors.Cause(err) != context.DeadlineExceeded) || (attempts != 1) {
+		t.Errorf("retries stopped with %v after %d attempts", err, attempts)
+	}
+}
@@ -0,0 +1,45 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// CountCFG is a count configured either as a single number or as a
+// {min, max} range picked uniformly.
+type CountCFG struct {
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+}
+
+func (c *CountCFG) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	fixed := 0
+	if err := unmarshal(&fixed); err == nil {
+		c.Min, c.Max = fixed, fixed
+		return nil
+	}
+	type plain CountCFG
+	return unmarshal((*plain)(c))
+}
+
+func (c CountCFG) MarshalYAML() (interface{}, error) {
+	if c.Min == c.Max {
+		return c.Min, nil
+	}
+	type plain CountCFG
+	return plain(c), nil
+}
+
+func (c CountCFG) validate() error {
+	if (c.Min < 0) || (c.Max < c.Min) {
+		return fmt.Errorf("invalid range [%d, %d]", c.Min, c.Max)
+	}
+	return nil
+}
+
+func (c CountCFG) pick(rnd *rand.Rand) int {
+	if c.Max <= c.Min {
+		return c.Min
+	}
+	return c.Min + rnd.Intn(c.Max-c.Min+1)
+}
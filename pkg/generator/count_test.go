@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestCountCFG(t *testing.T) {
+	for _, test := range []struct {
+		yaml     string
+		expected CountCFG
+	}{
+		{"3", CountCFG{Min: 3, Max: 3}},
+		{"{min: 1, max: 4}", CountCFG{Min: 1, Max: 4}},
+	} {
+		c := CountCFG{}
+		if err := yaml.Unmarshal([]byte(test.yaml), &c); err != nil {
+			t.Fatal(err)
+		}
+		if c != test.expected {
+			t.Errorf("%s is parsed as %+v", test.yaml, c)
+		}
+		data, err := yaml.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed := (CountCFG{}); (yaml.Unmarshal(data, &parsed) != nil) || (parsed != c) {
+			t.Errorf("%+v is encoded as %s", c, data)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	picked := map[int]int{}
+	for i := 0; i < 1000; i++ {
+		picked[(CountCFG{Min: 1, Max: 4}).pick(rnd)]++
+	}
+	if (len(picked) != 4) || (picked[1] == 0) || (picked[4] == 0) {
+		t.Errorf("counts in [1, 4] are picked %v", picked)
+	}
+	for _, c := range []CountCFG{{Min: -1, Max: 1}, {Min: 3, Max: 2}} {
+		if err := c.validate(); err == nil {
+			t.Errorf("count %+v is accepted", c)
+		}
+	}
+}
+
+// TestFFVsPerCOB checks that control objects get a range of FFVs of distinct
+// images.
+func TestFFVsPerCOB(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	cfg.GeneratorCFG.FFVPerCOB = CountCFG{Min: 2, Max: 4}
+	testRun(t, cfg)
+	cobs := map[string]bool{}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		cobs[row[0]] = true
+	}
+	perCOB := map[string]int{}
+	ids, images := map[string]bool{}, map[string]bool{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		if !cobs[row[1]] {
+			t.Errorf("FFV %s refers to unknown control object %s", row[0], row[1])
+		}
+		if ids[row[0]] || images[row[2]] {
+			t.Errorf("FFV %s of image %s is not distinct", row[0], row[2])
+		}
+		ids[row[0]], images[row[2]] = true, true
+		perCOB[row[1]]++
+	}
+	counts := map[int]int{}
+	for _, n := range perCOB {
+		counts[n]++
+	}
+	if (len(perCOB) != 100) || (len(counts) != 3) || (counts[2] == 0) || (counts[4] == 0) {
+		t.Errorf("numbers of FFVs of control objects are %v, expected 2 to 4", counts)
+	}
+}
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// panicError is a recovered panic of a worker or of one of its batch
+// inserts, reported in a crash report file.
+type panicError struct {
+	value  interface{}
+	where  string
+	report string
+}
+
+func (e *panicError) Error() string {
+	if e.report == "" {
+		return fmt.Sprintf("panic in %s: %v", e.where, e.value)
+	}
+	return fmt.Sprintf("panic in %s: %v, crash report written to %s", e.where, e.value, e.report)
+}
+
+// crashReports appends reports of recovered panics of a run to one file,
+// generator-crash-<time>.txt in the working directory by default.
+type crashReports struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newCrashReports(path string) *crashReports {
+	if path == "" {
+		path = fmt.Sprintf("generator-crash-%s.txt", time.Now().Format("20060102-150405"))
+	}
+	return &crashReports{path: path}
+}
+
+// recoverPanic turns a panic of the calling goroutine into a *panicError in
+// err, writes a crash report with the stack and where the panic happened
+// and stops the other workers, which flush rows generated so far. It must
+// be deferred directly.
+func (g *generation) recoverPanic(where func() string, err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	stack := debug.Stack()
+	perr := &panicError{value: value, where: where()}
+	if path, reportErr := g.crashes.write(g, perr, stack); reportErr != nil {
+		g.log.logln(reportErr)
+	} else {
+		perr.report = path
+	}
+	if g.stopWorkers != nil {
+		g.stopWorkers()
+	}
+	*err = perr
+}
+
+func (c *crashReports) write(g *generation, perr *panicError, stack []byte) (string, error) {
+	hash, err := configHash(g)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.OpenFile(c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to open crash report")
+	}
+	fmt.Fprintf(f, "time: %s\nwhere: %s\npanic: %v\nseed: %d\nconfig sha256: %s\ninserted pairs: %d\n\n%s\n",
+		time.Now().Format(time.RFC3339), perr.where, perr.value, g.seed, hash,
+		atomic.LoadInt64(&g.inserted), stack)
+	if err := f.Close(); err != nil {
+		return "", errors.Wrap(err, "unable to write crash report")
+	}
+	return c.path, nil
+}
+
+// configHash returns the SHA-256 of the effective configuration of the run,
+// secrets redacted.
+func configHash(g *generation) (string, error) {
+	config, err := yaml.Marshal(effectiveConfig(g.cfg, g.seed))
+	if err != nil {
+		return "", errors.Wrap(err, "unable to hash configuration")
+	}
+	hash := sha256.Sum256(config)
+	return hex.EncodeToString(hash[:]), nil
+}
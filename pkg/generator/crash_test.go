@@ -0,0 +1,86 @@
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TestCrashReport checks that panics of batch inserts and of generation are
+// recovered into crash reports and stop other workers.
+func TestCrashReport(t *testing.T) {
+	cfg, dir := testConfig(t, 1000)
+	cfg.GeneratorCFG.Workers, cfg.GeneratorCFG.InIter = 2, 10
+	cfg.GeneratorCFG.CrashReportPath = filepath.Join(dir, "crash.txt")
+	g := testReplayGeneration(t, cfg, nil)
+	panicking := g.newID("control_object", 505)
+	written := int64(0)
+	g.writeControlObjects = func(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+		for _, cob := range cobs {
+			if cob.id == panicking {
+				panic("boom")
+			}
+		}
+		atomic.AddInt64(&written, int64(len(cobs)))
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+	_, _, err := g.runWorkers(context.Background(), splitRows(2, 1000))
+	for _, line := range []string{
+		"worker 2: unable to insert generated control objects: panic in worker 2 inserting control objects of rows " +
+			"[500, 510): boom, crash report written to " + cfg.GeneratorCFG.CrashReportPath,
+		"worker 1: generation stopped: " + context.Canceled.Error(),
+	} {
+		if (err == nil) || !strings.Contains(err.Error(), line) {
+			t.Errorf("panicking run returns %v, expected %q", err, line)
+		}
+	}
+	// The first worker stops long before its 500 rows.
+	if n := atomic.LoadInt64(&written); n >= 500 {
+		t.Errorf("%d control objects are written after the panic", n)
+	}
+
+	// Panics of generation are reported to the same file.
+	g = testReplayGeneration(t, cfg, nil)
+	g.vectors = nil
+	_, _, err = g.runWorkers(context.Background(), splitRows(1, 10))
+	perr, ok := errors.Cause(err).(*panicError)
+	if !ok {
+		t.Fatalf("panicking generation returns %v", err)
+	}
+	if (perr.where != "worker 1 generating row 0 of rows [0, 10)") || (perr.report != cfg.GeneratorCFG.CrashReportPath) {
+		t.Errorf("panic is %+v", perr)
+	}
+
+	data, err := ioutil.ReadFile(cfg.GeneratorCFG.CrashReportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := configHash(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(data)
+	for _, line := range []string{
+		"where: worker 2 inserting control objects of rows [500, 510)\npanic: boom\nseed: 1\nconfig sha256: " + hash + "\n",
+		"where: worker 1 generating row 0 of rows [0, 10)\npanic: runtime error: invalid memory address",
+		"TestCrashReport",
+	} {
+		if !strings.Contains(report, line) {
+			t.Errorf("crash report has no %q:\n%s", line, report)
+		}
+	}
+	if n := strings.Count(report, "\ntime: ") + 1; n != 2 {
+		t.Errorf("crash report has %d reports, expected 2", n)
+	}
+
+	if message := (&panicError{value: "boom", where: "worker 1"}).Error(); message != "panic in worker 1: boom" {
+		t.Errorf("panic without a crash report is %q", message)
+	}
+}
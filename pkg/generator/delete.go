@@ -0,0 +1,119 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// runDelete simulates erasure requests: it picks a keyed fraction of
+// generated subjects and removes them together with their facial features
+// via ALTER TABLE ... DELETE mutations at a limited rate.
+func runDelete(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file")
+	fraction := flags.Float64("fraction", 0.01, "fraction of control objects to delete")
+	key := flags.String("key", "", "selection key, different keys select different subjects")
+	rate := flags.Float64("rate", 100, "max subjects deleted per second, 0 for unlimited")
+	batch := flags.Int("batch", 100, "subjects deleted per mutation")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+
+	if (*fraction <= 0) || (*fraction > 1) {
+		return fmt.Errorf("fraction must be in (0, 1], got %v", *fraction)
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("batch must be positive, got %d", *batch)
+	}
+
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	opts, err := mappedOptions(cfg)
+	if err != nil {
+		return err
+	}
+	cob, ffv := opts.cobTable, opts.ffvTable
+	cobID, err := cob.required("id")
+	if err != nil {
+		return err
+	}
+	ffvCOBID, err := ffv.required("cob_id")
+	if err != nil {
+		return err
+	}
+	db, err := connectClickHouse(cfg.StorageCFG, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ids, err := selectSubjects(ctx, db, cob, keyedFractionFilter(cobID, *key, *fraction))
+	if err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+	mutations := 0
+	for from := 0; from < len(ids); from += *batch {
+		to := from + *batch
+		if to > len(ids) {
+			to = len(ids)
+		}
+		batchStart := time.Now()
+		list := "'" + strings.Join(ids[from:to], "', '") + "'"
+		query := fmt.Sprintf("ALTER TABLE %s DELETE WHERE %s IN (%s)", ffv.name, ffvCOBID, list)
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return errors.Wrap(err, "unable to delete facial features vectors")
+		}
+		query = fmt.Sprintf("ALTER TABLE %s DELETE WHERE %s IN (%s)", cob.name, cobID, list)
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return errors.Wrap(err, "unable to delete control objects")
+		}
+		mutations += 2
+		if *rate > 0 {
+			budget := time.Duration(float64(to-from) / *rate * float64(time.Second))
+			if err := sleepContext(ctx, budget-time.Now().Sub(batchStart)); err != nil {
+				return errors.Wrapf(err, "stopped after deleting %d subjects", to)
+			}
+		}
+	}
+
+	fmt.Printf("deleted %d subjects with %d mutations in %v\n", len(ids), mutations, time.Now().Sub(startTime))
+	return nil
+}
+
+// selectSubjects returns IDs of control objects matching filter, cob names
+// the table and its columns.
+func selectSubjects(ctx context.Context, db *sql.DB, cob *tableMapping, filter string) ([]string, error) {
+	id, err := cob.required("id")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT toString(%s) FROM %s WHERE %s", id, cob.name, filter))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to select subjects")
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		id := ""
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "unable to scan subject")
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to read subjects")
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDelete checks that selected subjects are deleted in batches of
+// mutations, facial features before their control objects, at the rate.
+func TestDelete(t *testing.T) {
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	ids := [][]interface{}{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}}
+	mu := sync.Mutex{}
+	var mutations []string
+	server.answer = func(query string) (nativeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasPrefix(query, "SELECT") {
+			if query != "SELECT toString(id) FROM control_objects WHERE "+keyedFractionFilter("id", "gdpr", 0.5) {
+				return nativeResult{}, fmt.Errorf("unexpected query %s", query)
+			}
+			return nativeResult{names: []string{"id"}, types: []string{"String"}, rows: ids}, nil
+		}
+		mutations = append(mutations, query)
+		return nativeResult{}, nil
+	}
+	startTime := time.Now()
+	err := runDelete(context.Background(), []string{"-config", "../../config.yaml",
+		"-storage.port", fmt.Sprint(server.port()), "-storage.max_pings", "1",
+		"-fraction", "0.5", "-key", "gdpr", "-batch", "2", "-rate", "200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Now().Sub(startTime); elapsed < 20*time.Millisecond {
+		t.Errorf("5 subjects are deleted at 200 per second in %v", elapsed)
+	}
+	expected := []string{}
+	for _, list := range []string{"'a', 'b'", "'c', 'd'", "'e'"} {
+		expected = append(expected,
+			"ALTER TABLE facial_features DELETE WHERE cob_id IN ("+list+")",
+			"ALTER TABLE control_objects DELETE WHERE id IN ("+list+")")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(mutations, expected) {
+		t.Errorf("deleted with %q, expected %q", mutations, expected)
+	}
+}
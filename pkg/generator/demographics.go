@@ -0,0 +1,89 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// DemographicsCFG correlates sex and age band of persons with the cluster of
+// their FFVs, for bias analysis of matching. Requires clusters.
+type DemographicsCFG struct {
+	// Probability that a person gets a cluster of their demographic group
+	// rather than any cluster, 0 disables correlation.
+	Strength float64 `yaml:"strength"`
+	// Ascending upper bounds of age bands in years, [30, 50] by default for
+	// bands under 30, 30-49 and 50 and older.
+	AgeBands []int `yaml:"age_bands"`
+}
+
+func (cfg DemographicsCFG) validate(clusters int) error {
+	if cfg.Strength == 0 {
+		return nil
+	}
+	if (cfg.Strength < 0) || (cfg.Strength > 1) {
+		return fmt.Errorf("strength must be in [0, 1], got %v", cfg.Strength)
+	}
+	for i := 1; i < len(cfg.AgeBands); i++ {
+		if cfg.AgeBands[i] <= cfg.AgeBands[i-1] {
+			return fmt.Errorf("age bands must be ascending, got %v", cfg.AgeBands)
+		}
+	}
+	if groups := 2 * (len(cfg.ageBands()) + 1); clusters < groups {
+		return fmt.Errorf("%d demographic groups need at least as many clusters, got %d", groups, clusters)
+	}
+	return nil
+}
+
+func (cfg DemographicsCFG) ageBands() []int {
+	if len(cfg.AgeBands) == 0 {
+		return []int{30, 50}
+	}
+	return cfg.AgeBands
+}
+
+// demographicGroup returns the index of the sex and age band of a person at
+// now, or -1 if sex or birth date are not generated.
+func (cfg DemographicsCFG) demographicGroup(cob controlObject, now time.Time) int {
+	sex := 0
+	switch cob.sex {
+	case "M":
+	case "F":
+		sex = 1
+	default:
+		return -1
+	}
+	birthDate, err := time.Parse("2006-01-02", cob.birthDate)
+	if err != nil {
+		return -1
+	}
+	age := now.Year() - birthDate.Year()
+	if (now.Month() < birthDate.Month()) || ((now.Month() == birthDate.Month()) && (now.Day() < birthDate.Day())) {
+		age--
+	}
+	bands := cfg.ageBands()
+	band := len(bands)
+	for i, bound := range bands {
+		if age < bound {
+			band = i
+			break
+		}
+	}
+	return sex*(len(bands)+1) + band
+}
+
+// demographicIdentity picks the centroid of a new person. Clusters are dealt
+// to demographic groups in turn, and with probability strength the person
+// gets one of clusters of their group.
+func (g *ffvGenerator) demographicIdentity(rnd *rand.Rand, cob controlObject, now time.Time) []float64 {
+	if g.demographics.Strength == 0 {
+		return g.identity(rnd)
+	}
+	group := g.demographics.demographicGroup(cob, now)
+	if (group < 0) || (rnd.Float64() >= g.demographics.Strength) {
+		return g.identity(rnd)
+	}
+	groups := 2 * (len(g.demographics.ageBands()) + 1)
+	own := (len(g.centroids) - group + groups - 1) / groups
+	return g.centroids[group+groups*rnd.Intn(own)]
+}
@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDemographicGroup(t *testing.T) {
+	now := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		sex, birthDate string
+		bands          []int
+		group          int
+	}{
+		{"M", "2000-01-01", nil, 0},
+		// Days of year of birthdays after February shift in leap years.
+		{"M", "1990-06-16", nil, 0},
+		{"M", "1990-06-15", nil, 1},
+		{"M", "1970-06-16", nil, 1},
+		{"M", "1970-06-14", nil, 2},
+		{"F", "2000-01-01", nil, 3},
+		{"F", "1950-01-01", nil, 5},
+		{"F", "1950-01-01", []int{18, 40, 65, 80}, 3 + 5},
+		{"F", "2010-01-01", []int{18, 40, 65, 80}, 0 + 5},
+		{"", "2000-01-01", nil, -1},
+		{"M", "", nil, -1},
+	}
+	for _, c := range cases {
+		cfg := DemographicsCFG{Strength: 1, AgeBands: c.bands}
+		cob := controlObject{sex: c.sex, birthDate: c.birthDate}
+		if group := cfg.demographicGroup(cob, now); group != c.group {
+			t.Errorf("sex %q born %q with age bands %v is in group %d, expected %d",
+				c.sex, c.birthDate, c.bands, group, c.group)
+		}
+	}
+}
+
+// TestDemographicIdentity checks that with strength s about s of persons
+// plus chance get clusters of their own group.
+func TestDemographicIdentity(t *testing.T) {
+	now := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+	cob := controlObject{sex: "F", birthDate: "1980-01-01"}
+	for _, c := range []struct {
+		strength float64
+		min, max int
+	}{
+		{0, 100, 250},
+		{0.5, 500, 670},
+		{1, 1000, 1000},
+	} {
+		rnd := rand.New(rand.NewSource(1))
+		g, err := newFFVGenerator(FFVCFG{Clusters: 14, Demographics: DemographicsCFG{Strength: c.strength}},
+			FFVStructureCFG{}, rnd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		group := g.demographics.demographicGroup(cob, now)
+		own := 0
+		for i := 0; i < 1000; i++ {
+			identity := g.demographicIdentity(rnd, cob, now)
+			if g.cluster(identity)%6 == group {
+				own++
+			}
+		}
+		if (own < c.min) || (own > c.max) {
+			t.Errorf("%d of 1000 persons get clusters of their group with strength %v, expected %d to %d",
+				own, c.strength, c.min, c.max)
+		}
+	}
+
+	// Persons without sex fall back to any cluster.
+	rnd := rand.New(rand.NewSource(1))
+	g, err := newFFVGenerator(FFVCFG{Clusters: 6, Demographics: DemographicsCFG{Strength: 1}}, FFVStructureCFG{}, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := map[int]bool{}
+	for i := 0; i < 100; i++ {
+		groups[g.cluster(g.demographicIdentity(rnd, controlObject{birthDate: "1980-01-01"}, now))] = true
+	}
+	if len(groups) != 6 {
+		t.Errorf("persons without sex get %d of 6 clusters", len(groups))
+	}
+}
+
+func TestDemographicsInvalid(t *testing.T) {
+	for _, c := range []struct {
+		cfg      DemographicsCFG
+		clusters int
+	}{
+		{DemographicsCFG{Strength: -0.1}, 6},
+		{DemographicsCFG{Strength: 1.5}, 6},
+		{DemographicsCFG{Strength: 0.5, AgeBands: []int{50, 30}}, 6},
+		{DemographicsCFG{Strength: 0.5}, 5},
+		{DemographicsCFG{Strength: 0.5, AgeBands: []int{40}}, 3},
+	} {
+		if err := c.cfg.validate(c.clusters); err == nil {
+			t.Errorf("demographics %+v with %d clusters are valid", c.cfg, c.clusters)
+		}
+	}
+	if err := (DemographicsCFG{}).validate(0); err != nil {
+		t.Errorf("disabled demographics are invalid: %v", err)
+	}
+	if err := (DemographicsCFG{Strength: 0.5, AgeBands: []int{40}}).validate(4); err != nil {
+		t.Errorf("4 groups with 4 clusters are invalid: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+
+	"github.com/nofacedb/generator/pkg/datagen"
+	"github.com/pkg/errors"
+)
+
+// Dictionary contents do not depend on seed offsets.
+const streamDictionaries = "dictionaries"
+
+// Default rows of dictionaries without cities or cameras.
+const (
+	defaultRegions         = 20
+	defaultCameraLocations = 16
+)
+
+// DictionariesCFG configures reference dictionaries nofacedb joins against,
+// created as ClickHouse tables with dictionaries reading them, e.g.
+// dictGet('camera_locations_dict', 'region_id', toUInt64(camera_id)).
+type DictionariesCFG struct {
+	Enabled bool `yaml:"enabled"`
+	// Cities of the personal data locale by default.
+	Regions int `yaml:"regions"`
+	// Cameras of event_time.cameras by default, so camera_id of facial
+	// features refers to them.
+	CameraLocations int `yaml:"camera_locations"`
+	// Seconds between reloads of dictionaries, 300 by default.
+	Lifetime int `yaml:"lifetime"`
+	// File with XML definitions of dictionaries for dictionaries_config of
+	// the server, written instead of creating DDL dictionaries.
+	XMLPath string `yaml:"xml_path"`
+}
+
+func (cfg DictionariesCFG) validate() error {
+	if (cfg.Regions < 0) || (cfg.CameraLocations < 0) || (cfg.Lifetime < 0) {
+		return fmt.Errorf("invalid dictionaries %+v", cfg)
+	}
+	return nil
+}
+
+func (cfg DictionariesCFG) lifetime() int {
+	if cfg.Lifetime == 0 {
+		return 300
+	}
+	return cfg.Lifetime
+}
+
+// dictionaryAttribute is a non-key column of a dictionary.
+type dictionaryAttribute struct {
+	name, columnType string
+}
+
+// dictionary is a source table with id UInt64 keys and its rows.
+type dictionary struct {
+	table      string
+	attributes []dictionaryAttribute
+	rows       [][]interface{}
+}
+
+func (d *dictionary) name() string {
+	return d.table + "_dict"
+}
+
+func (d *dictionary) columns() []string {
+	columns := []string{"id"}
+	for _, a := range d.attributes {
+		columns = append(columns, a.name)
+	}
+	return columns
+}
+
+// documentTypes are identity documents, passports of control objects are of
+// type 1.
+var documentTypes = [][2]string{
+	{"passport", "Passport"},
+	{"international_passport", "International passport"},
+	{"driver_license", "Driver license"},
+	{"residence_permit", "Residence permit"},
+	{"birth_certificate", "Birth certificate"},
+}
+
+// generateDictionaries returns regions, camera_locations and document_types.
+// Regions are cities of personal data, placed within their bounding boxes, or
+// numbered ones, and every camera is placed near the center of a random
+// region.
+func generateDictionaries(cfg *Config, personal *datagen.Generator, rnd *rand.Rand) []*dictionary {
+	dcfg := cfg.GeneratorCFG.Dictionaries
+	cities := []string{}
+	if personal != nil {
+		cities = personal.Cities()
+	}
+	regionsN := dcfg.Regions
+	if regionsN == 0 {
+		regionsN = len(cities)
+	}
+	if regionsN == 0 {
+		regionsN = defaultRegions
+	}
+	regions := &dictionary{
+		table: "regions",
+		attributes: []dictionaryAttribute{
+			{"name", "String"}, {"latitude", "Float64"}, {"longitude", "Float64"},
+		},
+	}
+	for i := 0; i < regionsN; i++ {
+		name := fmt.Sprintf("Region %d", i+1)
+		latitude, longitude := -60+rnd.Float64()*130, -180+rnd.Float64()*360
+		// Cities are where coordinates of their addresses are.
+		if i < len(cities) {
+			name = cities[i]
+			latitude, longitude = personal.Coordinates(name)
+		}
+		regions.rows = append(regions.rows, []interface{}{uint64(i + 1), name, latitude, longitude})
+	}
+
+	camerasN := dcfg.CameraLocations
+	if camerasN == 0 {
+		camerasN = cfg.GeneratorCFG.EventTime.Cameras.N
+	}
+	if camerasN == 0 {
+		camerasN = defaultCameraLocations
+	}
+	cameras := &dictionary{
+		table: "camera_locations",
+		attributes: []dictionaryAttribute{
+			{"region_id", "UInt64"}, {"name", "String"}, {"latitude", "Float64"}, {"longitude", "Float64"},
+		},
+	}
+	// IDs start at 0 like camera_id.
+	for i := 0; i < camerasN; i++ {
+		region := regions.rows[rnd.Intn(len(regions.rows))]
+		cameras.rows = append(cameras.rows, []interface{}{uint64(i), region[0], fmt.Sprintf("Camera %d", i+1),
+			region[2].(float64) + rnd.NormFloat64()*0.05, region[3].(float64) + rnd.NormFloat64()*0.05})
+	}
+
+	documents := &dictionary{
+		table:      "document_types",
+		attributes: []dictionaryAttribute{{"code", "String"}, {"name", "String"}},
+	}
+	for i, d := range documentTypes {
+		documents.rows = append(documents.rows, []interface{}{uint64(i + 1), d[0], d[1]})
+	}
+	return []*dictionary{regions, cameras, documents}
+}
+
+func (d *dictionary) createTableQuery() string {
+	definitions := []string{"id UInt64"}
+	for _, a := range d.attributes {
+		definitions = append(definitions, a.name+" "+a.columnType)
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n    %s\n) ENGINE = MergeTree\nORDER BY id",
+		d.table, strings.Join(definitions, ",\n    "))
+}
+
+func (d *dictionary) createDictionaryQuery(storage StorageCFG, lifetime int) string {
+	definitions := []string{"id UInt64"}
+	for _, a := range d.attributes {
+		definitions = append(definitions, a.name+" "+a.columnType)
+	}
+	return fmt.Sprintf("CREATE DICTIONARY IF NOT EXISTS %s (\n    %s\n) PRIMARY KEY id\n"+
+		"SOURCE(CLICKHOUSE(TABLE '%s' DB '%s' USER '%s' PASSWORD '%s'))\nLIFETIME(MIN 0 MAX %d)\nLAYOUT(HASHED())",
+		d.name(), strings.Join(definitions, ",\n    "), d.table, storage.DefaultDB, storage.User,
+		strings.Replace(storage.Passwd, "'", "\\'", -1), lifetime)
+}
+
+// tsv returns rows in TabSeparated format.
+func (d *dictionary) tsv() string {
+	b := strings.Builder{}
+	for _, row := range d.rows {
+		for i, value := range row {
+			if i > 0 {
+				b.WriteByte('\t')
+			}
+			b.WriteString(tsvEscaper.Replace(fmt.Sprint(value)))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// xmlDefinitions returns definitions of dictionaries reading tables of the
+// configured storage, like DDL dictionaries do.
+func xmlDefinitions(dicts []*dictionary, storage StorageCFG, lifetime int) ([]byte, error) {
+	type attribute struct {
+		Name      string `xml:"name"`
+		Type      string `xml:"type"`
+		NullValue string `xml:"null_value"`
+	}
+	type definition struct {
+		Name   string `xml:"name"`
+		Source struct {
+			Host     string `xml:"host"`
+			Port     int    `xml:"port"`
+			User     string `xml:"user"`
+			Password string `xml:"password"`
+			DB       string `xml:"db"`
+			Table    string `xml:"table"`
+		} `xml:"source>clickhouse"`
+		Lifetime struct {
+			Min int `xml:"min"`
+			Max int `xml:"max"`
+		} `xml:"lifetime"`
+		Layout struct {
+			Hashed struct{} `xml:"hashed"`
+		} `xml:"layout"`
+		ID         string      `xml:"structure>id>name"`
+		Attributes []attribute `xml:"structure>attribute"`
+	}
+	root := struct {
+		XMLName      xml.Name     `xml:"clickhouse"`
+		Dictionaries []definition `xml:"dictionary"`
+	}{}
+	for _, d := range dicts {
+		def := definition{Name: d.name(), ID: "id"}
+		def.Source.Host, def.Source.Port = storage.Addr, storage.Port
+		def.Source.User, def.Source.Password = storage.User, storage.Passwd
+		def.Source.DB, def.Source.Table = storage.DefaultDB, d.table
+		def.Lifetime.Max = lifetime
+		for _, a := range d.attributes {
+			null := ""
+			if a.columnType != "String" {
+				null = "0"
+			}
+			def.Attributes = append(def.Attributes, attribute{Name: a.name, Type: a.columnType, NullValue: null})
+		}
+		root.Dictionaries = append(root.Dictionaries, def)
+	}
+	data, err := xml.MarshalIndent(root, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// createDictionaries replaces contents of dictionary tables, creating them
+// when missing, and defines dictionaries reading them. exec runs DDL and
+// insert writes rows of a table.
+func createDictionaries(ctx context.Context, cfg *Config, g *generation,
+	exec func(ctx context.Context, query string) error,
+	insert func(ctx context.Context, d *dictionary) error) error {
+	dcfg := cfg.GeneratorCFG.Dictionaries
+	dicts := generateDictionaries(cfg, g.personal, seededRand(g.seed, -1, streamDictionaries, 0))
+	for _, d := range dicts {
+		if err := exec(ctx, d.createTableQuery()); err != nil {
+			return errors.Wrapf(err, "unable to create table %s", d.table)
+		}
+		if err := exec(ctx, "TRUNCATE TABLE "+d.table); err != nil {
+			return errors.Wrapf(err, "unable to truncate %s", d.table)
+		}
+		if err := insert(ctx, d); err != nil {
+			return errors.Wrapf(err, "unable to insert rows of %s", d.table)
+		}
+	}
+	if dcfg.XMLPath != "" {
+		data, err := xmlDefinitions(dicts, cfg.StorageCFG, dcfg.lifetime())
+		if err != nil {
+			return errors.Wrap(err, "unable to encode dictionary definitions")
+		}
+		return errors.Wrap(ioutil.WriteFile(dcfg.XMLPath, data, 0644), "unable to write dictionary definitions")
+	}
+	for _, d := range dicts {
+		if err := exec(ctx, d.createDictionaryQuery(cfg.StorageCFG, dcfg.lifetime())); err != nil {
+			return errors.Wrapf(err, "unable to create dictionary %s", d.name())
+		}
+		// Existing dictionaries pick up new rows now rather than after
+		// their lifetime.
+		if err := exec(ctx, "SYSTEM RELOAD DICTIONARY "+d.name()); err != nil {
+			return errors.Wrapf(err, "unable to reload dictionary %s", d.name())
+		}
+	}
+	return nil
+}
+
+func nativeDictionaryInsert(db *sql.DB) func(ctx context.Context, d *dictionary) error {
+	return func(ctx context.Context, d *dictionary) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.PrepareContext(ctx, insertQuery(d.table, d.columns()))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, row := range d.rows {
+			if _, err := stmt.ExecContext(ctx, row...); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+}
+
+func (c *clickHouseHTTP) insertDictionary(ctx context.Context, d *dictionary) error {
+	_, err := c.Query(ctx, fmt.Sprintf("INSERT INTO %s (%s) FORMAT TabSeparated\n%s",
+		d.table, strings.Join(d.columns(), ", "), d.tsv()))
+	return err
+}
@@ -0,0 +1,214 @@
+package generator
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/datagen"
+)
+
+func TestGenerateDictionaries(t *testing.T) {
+	cfg, _ := testConfig(t, 10)
+	dicts := generateDictionaries(cfg, nil, rand.New(rand.NewSource(1)))
+	if len(dicts) != 3 {
+		t.Fatalf("%d dictionaries are generated, expected 3", len(dicts))
+	}
+	regions, cameras, documents := dicts[0], dicts[1], dicts[2]
+	if (len(regions.rows) != defaultRegions) || (regions.rows[0][1] != "Region 1") {
+		t.Errorf("regions without cities are %v", regions.rows)
+	}
+	if len(cameras.rows) != defaultCameraLocations {
+		t.Errorf("%d camera locations, expected %d", len(cameras.rows), defaultCameraLocations)
+	}
+	for i, row := range cameras.rows {
+		if (row[0] != uint64(i)) || (row[1].(uint64) < 1) || (row[1].(uint64) > defaultRegions) {
+			t.Errorf("camera location %v is not camera %d of a region", row, i)
+		}
+	}
+	if (len(documents.rows) != len(documentTypes)) ||
+		!reflect.DeepEqual(documents.rows[0], []interface{}{uint64(1), "passport", "Passport"}) {
+		t.Errorf("document types are %v", documents.rows)
+	}
+	if columns := cameras.columns(); !reflect.DeepEqual(columns, []string{"id", "region_id", "name", "latitude", "longitude"}) {
+		t.Errorf("camera locations have columns %q", columns)
+	}
+
+	// Regions are cities of the locale and cameras are of event_time.
+	personal, err := datagen.New(datagen.Config{Locale: "ru_RU", Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.GeneratorCFG.EventTime.Cameras.N = 4
+	dicts = generateDictionaries(cfg, personal, rand.New(rand.NewSource(1)))
+	regions, cameras = dicts[0], dicts[1]
+	cities := personal.Cities()
+	if len(regions.rows) != len(cities) {
+		t.Fatalf("%d regions of %d cities", len(regions.rows), len(cities))
+	}
+	for i, row := range regions.rows {
+		latitude, longitude := personal.Coordinates(cities[i])
+		if (row[1] != cities[i]) || (row[2] != latitude) || (row[3] != longitude) {
+			t.Errorf("region %v is not city %s at (%f, %f)", row, cities[i], latitude, longitude)
+		}
+	}
+	if len(cameras.rows) != 4 {
+		t.Errorf("%d camera locations of 4 cameras", len(cameras.rows))
+	}
+	for _, row := range cameras.rows {
+		region := regions.rows[row[1].(uint64)-1]
+		if l2Distance([]float64{row[3].(float64), row[4].(float64)},
+			[]float64{region[2].(float64), region[3].(float64)}) > 0.5 {
+			t.Errorf("camera %v is far from region %v", row, region)
+		}
+	}
+
+	cfg.GeneratorCFG.Dictionaries = DictionariesCFG{Regions: 3, CameraLocations: 5}
+	dicts = generateDictionaries(cfg, personal, rand.New(rand.NewSource(1)))
+	if (len(dicts[0].rows) != 3) || (dicts[0].rows[2][1] != cities[2]) || (len(dicts[1].rows) != 5) {
+		t.Errorf("3 regions and 5 camera locations are %v and %v", dicts[0].rows, dicts[1].rows)
+	}
+}
+
+// TestCreateDictionaries checks that dictionary tables are refilled and
+// dictionaries defined with DDL or written as XML.
+func TestCreateDictionaries(t *testing.T) {
+	cfg, dir := testConfig(t, 10)
+	cfg.StorageCFG.DefaultDB, cfg.StorageCFG.User, cfg.StorageCFG.Passwd = "nofacedb", "default", "it's"
+	var queries []string
+	inserted := map[string]string{}
+	exec := func(ctx context.Context, query string) error {
+		queries = append(queries, query)
+		return nil
+	}
+	insert := func(ctx context.Context, d *dictionary) error {
+		inserted[d.table] = d.tsv()
+		return nil
+	}
+	g := &generation{seed: 1}
+	if err := createDictionaries(context.Background(), cfg, g, exec, insert); err != nil {
+		t.Fatal(err)
+	}
+	statements := []string{}
+	for _, query := range queries {
+		statements = append(statements, strings.Join(strings.Fields(query)[:3], " "))
+	}
+	expected := []string{
+		"CREATE TABLE IF", "TRUNCATE TABLE regions",
+		"CREATE TABLE IF", "TRUNCATE TABLE camera_locations",
+		"CREATE TABLE IF", "TRUNCATE TABLE document_types",
+		"CREATE DICTIONARY IF", "SYSTEM RELOAD DICTIONARY",
+		"CREATE DICTIONARY IF", "SYSTEM RELOAD DICTIONARY",
+		"CREATE DICTIONARY IF", "SYSTEM RELOAD DICTIONARY",
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Fatalf("dictionaries are created with %q, expected %q", statements, expected)
+	}
+	if table := "CREATE TABLE IF NOT EXISTS document_types (\n    id UInt64,\n    code String,\n    name String\n) " +
+		"ENGINE = MergeTree\nORDER BY id"; queries[4] != table {
+		t.Errorf("document types are created with %s, expected %s", queries[4], table)
+	}
+	for _, part := range []string{
+		"CREATE DICTIONARY IF NOT EXISTS regions_dict (\n    id UInt64,\n    name String,",
+		"SOURCE(CLICKHOUSE(TABLE 'regions' DB 'nofacedb' USER 'default' PASSWORD 'it\\'s'))",
+		"LIFETIME(MIN 0 MAX 300)",
+	} {
+		if !strings.Contains(queries[6], part) {
+			t.Errorf("regions dictionary is created with %s, expected %s", queries[6], part)
+		}
+	}
+	if queries[7] != "SYSTEM RELOAD DICTIONARY regions_dict" {
+		t.Errorf("regions dictionary is reloaded with %s", queries[7])
+	}
+	if documents := inserted["document_types"]; !strings.HasPrefix(documents, "1\tpassport\tPassport\n2\t") {
+		t.Errorf("document types are inserted as %q", documents)
+	}
+
+	// Dictionaries do not depend on runs.
+	regions := inserted["regions"]
+	if err := createDictionaries(context.Background(), cfg, &generation{seed: 1}, exec, insert); err != nil {
+		t.Fatal(err)
+	}
+	if inserted["regions"] != regions {
+		t.Error("regions of the same seed differ")
+	}
+
+	queries = nil
+	cfg.GeneratorCFG.Dictionaries = DictionariesCFG{Lifetime: 60, XMLPath: filepath.Join(dir, "dictionaries.xml")}
+	if err := createDictionaries(context.Background(), cfg, g, exec, insert); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range queries {
+		if strings.Contains(query, "DICTIONARY") {
+			t.Errorf("dictionaries with XML definitions run %s", query)
+		}
+	}
+	data, err := ioutil.ReadFile(cfg.GeneratorCFG.Dictionaries.XMLPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definitions := struct {
+		Dictionaries []struct {
+			Name       string `xml:"name"`
+			Table      string `xml:"source>clickhouse>table"`
+			DB         string `xml:"source>clickhouse>db"`
+			Password   string `xml:"source>clickhouse>password"`
+			Max        int    `xml:"lifetime>max"`
+			Attributes []struct {
+				Name      string `xml:"name"`
+				NullValue string `xml:"null_value"`
+			} `xml:"structure>attribute"`
+		} `xml:"dictionary"`
+	}{}
+	if err := xml.Unmarshal(data, &definitions); err != nil {
+		t.Fatal(err)
+	}
+	if len(definitions.Dictionaries) != 3 {
+		t.Fatalf("XML defines %d dictionaries:\n%s", len(definitions.Dictionaries), data)
+	}
+	cameras := definitions.Dictionaries[1]
+	if (cameras.Name != "camera_locations_dict") || (cameras.Table != "camera_locations") || (cameras.DB != "nofacedb") ||
+		(cameras.Password != "it's") || (cameras.Max != 60) || (len(cameras.Attributes) != 4) ||
+		(cameras.Attributes[0].NullValue != "0") || (cameras.Attributes[1].NullValue != "") {
+		t.Errorf("camera locations are defined as %+v", cameras)
+	}
+
+	failing := func(ctx context.Context, query string) error {
+		if strings.HasPrefix(query, "TRUNCATE") {
+			return fmt.Errorf("read only")
+		}
+		return nil
+	}
+	if err := createDictionaries(context.Background(), cfg, g, failing, insert); (err == nil) ||
+		(err.Error() != "unable to truncate regions: read only") {
+		t.Errorf("failing truncate returns %v", err)
+	}
+}
+
+func TestDictionaryTSV(t *testing.T) {
+	d := &dictionary{table: "regions", rows: [][]interface{}{{uint64(1), "Tab\tand\\", 55.75}}}
+	if tsv := d.tsv(); tsv != "1\tTab\\tand\\\\\t55.75\n" {
+		t.Errorf("dictionary rows are %q", tsv)
+	}
+}
+
+func TestDictionariesInvalid(t *testing.T) {
+	for _, cfg := range []DictionariesCFG{{Regions: -1}, {CameraLocations: -1}, {Lifetime: -1}} {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("dictionaries %+v are valid", cfg)
+		}
+	}
+	cfg, _ := testConfig(t, 10)
+	cfg.GeneratorCFG.Dictionaries.Enabled = true
+	_, err := run(context.Background(), cfg, Options{}, cfg.GeneratorCFG.Seed, nil, time.Now(), &logger{quiet: true})
+	if (err == nil) || (err.Error() != "dictionaries need ClickHouse storage") {
+		t.Errorf("dictionaries of a run into files return %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Control objects printed by dry runs by default.
+const defaultDryRunRows = 10
+
+// dryRunSample is one generated control object with its FFVs.
+type dryRunSample struct {
+	ControlObject  map[string]interface{}   `json:"control_object"`
+	FacialFeatures []map[string]interface{} `json:"facial_features"`
+}
+
+// runDryRun generates rows control objects with one worker and writes them
+// with their FFVs as JSON lines to path, or to stdout when path is empty.
+func runDryRun(ctx context.Context, cfg *Config, seed int64, rows int, path string, log *logger) (int64, error) {
+	g, err := newGeneration(cfg, seed)
+	if err != nil {
+		return 0, err
+	}
+	if g.metrics, err = newStageMetrics(""); err != nil {
+		return 0, err
+	}
+	if g.idOffsets, err = resolveIDOffsets(ctx, nil, cfg.GeneratorCFG.IDs, g.opts); err != nil {
+		return 0, err
+	}
+
+	samples := []*dryRunSample{}
+	byID := map[string]*dryRunSample{}
+	mu := sync.Mutex{}
+	g.writeControlObjects = func(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, cob := range cobs {
+			sample := &dryRunSample{
+				ControlObject:  jsonRow(g.opts.controlObjectsColumns(), g.opts.controlObjectRow(cob)),
+				FacialFeatures: []map[string]interface{}{},
+			}
+			samples = append(samples, sample)
+			byID[cob.id] = sample
+		}
+		return nil
+	}
+	pending := []ffv{}
+	g.writeFFVs = func(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+		mu.Lock()
+		defer mu.Unlock()
+		pending = append(pending, ffvs...)
+		return nil
+	}
+	if _, _, err := g.runWorkers(ctx, splitRows(1, rows)); err != nil {
+		return 0, errors.Wrap(err, "unable to generate sample rows")
+	}
+	for _, fv := range pending {
+		if sample, ok := byID[fv.cobID]; ok {
+			sample.FacialFeatures = append(sample.FacialFeatures, jsonRow(g.opts.ffvsColumns(), g.opts.ffvRow(fv)))
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return 0, errors.Wrap(err, "unable to create dry run output file")
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	for _, sample := range samples {
+		if err := enc.Encode(sample); err != nil {
+			return 0, errors.Wrap(err, "unable to write sample rows")
+		}
+	}
+	if path != "" {
+		log.logf("wrote %d sample control objects to %s\n", len(samples), path)
+	}
+	return int64(len(samples)), nil
+}
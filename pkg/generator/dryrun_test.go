@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readDryRun returns samples of dry run output.
+func readDryRun(t *testing.T, data string) []dryRunSample {
+	samples := []dryRunSample{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		sample := dryRunSample{}
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			t.Fatalf("invalid sample %s: %v", scanner.Text(), err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// TestDryRun checks that dry runs write control objects with their FFVs as
+// JSON lines, the same rows as runs with the same seed write.
+func TestDryRun(t *testing.T) {
+	cfg, dir := testConfig(t, 5)
+	cfg.GeneratorCFG.FFVPerCOB = CountCFG{Min: 2, Max: 2}
+	testRun(t, cfg)
+	cobs := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+
+	path := filepath.Join(dir, "sample.json")
+	cfg.File.Dir = filepath.Join(dir, "missing")
+	samples, err := runDryRun(context.Background(), cfg, cfg.GeneratorCFG.Seed, 5, path, &logger{quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples != 5 {
+		t.Errorf("dry run returns %d samples, expected 5", samples)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := readDryRun(t, string(data))
+	if len(written) != 5 {
+		t.Fatalf("dry run writes %d samples, expected 5", len(written))
+	}
+	for i, sample := range written {
+		for _, column := range controlObjectsColumns {
+			if _, ok := sample.ControlObject[column]; !ok {
+				t.Errorf("sample %d has no column %s", i, column)
+			}
+		}
+		id, _ := sample.ControlObject["id"].(string)
+		if id != cobs[i][0] {
+			t.Errorf("sample %d has id %s, run with the same seed %s", i, id, cobs[i][0])
+		}
+		if ts, _ := sample.ControlObject["ts"].(string); ts != cobs[i][1] {
+			t.Errorf("sample %d has ts %q, run with the same seed %q", i, ts, cobs[i][1])
+		}
+		if len(sample.FacialFeatures) != 2 {
+			t.Errorf("sample %d has %d FFVs, expected 2", i, len(sample.FacialFeatures))
+		}
+		for _, fv := range sample.FacialFeatures {
+			if fv["cob_id"] != id {
+				t.Errorf("FFV of sample %d has cob_id %v, expected %s", i, fv["cob_id"], id)
+			}
+		}
+	}
+
+	// Without a path samples go to stdout.
+	var stdoutErr error
+	output := captureStdout(t, func() {
+		_, stdoutErr = runDryRun(context.Background(), cfg, cfg.GeneratorCFG.Seed, 3, "", &logger{quiet: true})
+	})
+	if stdoutErr != nil {
+		t.Fatal(stdoutErr)
+	}
+	if printed := readDryRun(t, output); len(printed) != 3 {
+		t.Errorf("dry run prints %d samples, expected 3", len(printed))
+	}
+}
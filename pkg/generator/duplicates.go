@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Kinds of duplicates.
+const (
+	duplicateExact = "exact"
+	duplicateNear  = "near"
+)
+
+// Stddev per component of noise of FFVs of duplicates by default.
+const defaultDuplicateNoise = 0.01
+
+func validateDuplicates(cfg GeneratorCFG) error {
+	if (cfg.DuplicateRate < 0) || (cfg.NearDuplicateRate < 0) || (cfg.DuplicateNoise < 0) {
+		return fmt.Errorf("rates and noise of duplicates must be non-negative")
+	}
+	if cfg.DuplicateRate+cfg.NearDuplicateRate > 1 {
+		return fmt.Errorf("rates of duplicates must sum up to at most 1")
+	}
+	return nil
+}
+
+func pickDuplicate(cfg GeneratorCFG, rnd *rand.Rand) string {
+	if cfg.DuplicateRate+cfg.NearDuplicateRate == 0 {
+		return ""
+	}
+	p := rnd.Float64()
+	switch {
+	case p < cfg.DuplicateRate:
+		return duplicateExact
+	case p < cfg.DuplicateRate+cfg.NearDuplicateRate:
+		return duplicateNear
+	}
+	return ""
+}
+
+func duplicateNoise(cfg GeneratorCFG) float64 {
+	if cfg.DuplicateNoise == 0 {
+		return defaultDuplicateNoise
+	}
+	return cfg.DuplicateNoise
+}
+
+// applyDuplicate copies passport and personal data of original to cob and
+// makes a typo in the name or surname of near duplicates. It returns the
+// field with the typo.
+func applyDuplicate(rnd *rand.Rand, kind string, original controlObject, cob *controlObject) string {
+	cob.passport, cob.surname, cob.name, cob.patronymic = original.passport, original.surname, original.name, original.patronymic
+	cob.sex, cob.birthDate = original.sex, original.birthDate
+	cob.phoneNum, cob.email, cob.address = original.phoneNum, original.email, original.address
+	if kind == duplicateExact {
+		return ""
+	}
+	field, value := "surname", &cob.surname
+	if rnd.Intn(2) == 1 {
+		field, value = "name", &cob.name
+	}
+	*value = typo(rnd, *value)
+	return field
+}
+
+// perturb returns an FFV of v plus gaussian noise with stddev per
+// component.
+func (g *ffvGenerator) perturb(rnd *rand.Rand, v []float64, stddev float64) []float64 {
+	ffv := make([]float64, len(v))
+	for i := range ffv {
+		ffv[i] = v[i] + rnd.NormFloat64()*stddev
+	}
+	return g.finish(ffv)
+}
@@ -0,0 +1,164 @@
+package generator
+
+import (
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestDuplicateIDs(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		namespace string
+	}{
+		{"random", ""},
+		{"namespace", uuid.NamespaceOID.String()},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, dir := testConfig(t, 200)
+			cfg.GeneratorCFG.UUIDNamespace = test.namespace
+			cfg.GeneratorCFG.DuplicateRate, cfg.GeneratorCFG.NearDuplicateRate = 0.3, 0.3
+			cfg.GeneratorCFG.DuplicatesLabelsPath = filepath.Join(dir, "duplicates.tsv")
+			testRun(t, cfg)
+
+			ids := map[string]bool{}
+			for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+				if ids[row[0]] {
+					t.Fatalf("control object ID %s is repeated", row[0])
+				}
+				ids[row[0]] = true
+			}
+			labels := readLabels(t, cfg.GeneratorCFG.DuplicatesLabelsPath)
+			if len(labels) == 0 {
+				t.Fatal("no duplicates are labelled")
+			}
+			for _, label := range labels {
+				if label[0] == label[1] {
+					t.Errorf("%s duplicate has the ID of its original %s", label[2], label[1])
+				}
+				if !ids[label[0]] || !ids[label[1]] {
+					t.Errorf("labels %q refer to missing control objects", label)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDuplicate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	original := controlObject{id: "a", passport: "1234 567890", surname: "Ivanov", name: "Ivan", patronymic: "Ivanovich",
+		sex: "M", phoneNum: "1", email: "ivanov@example.com", address: "Moscow"}
+	cob := controlObject{id: "b", passport: "4321 098765", surname: "Petrov", name: "Petr", sex: "M"}
+	if field := applyDuplicate(rnd, duplicateExact, original, &cob); field != "" {
+		t.Errorf("exact duplicate has a typo in %s", field)
+	}
+	expected := original
+	expected.id = "b"
+	if !reflect.DeepEqual(cob, expected) {
+		t.Errorf("exact duplicate is %+v, expected %+v", cob, expected)
+	}
+
+	fields := map[string]int{}
+	for i := 0; i < 100; i++ {
+		cob := controlObject{id: "b"}
+		field := applyDuplicate(rnd, duplicateNear, original, &cob)
+		fields[field]++
+		typo := expected
+		switch field {
+		case "surname":
+			typo.surname = cob.surname
+		case "name":
+			typo.name = cob.name
+		default:
+			t.Fatalf("near duplicate has a typo in %q", field)
+		}
+		if !reflect.DeepEqual(cob, typo) {
+			t.Errorf("near duplicate %+v differs from %+v in more than %s", cob, original, field)
+		}
+	}
+	if (fields["surname"] < 30) || (fields["name"] < 30) {
+		t.Errorf("typos of 100 near duplicates are in %v", fields)
+	}
+}
+
+func TestPickDuplicate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	if kind := pickDuplicate(GeneratorCFG{}, rnd); kind != "" {
+		t.Errorf("duplicate %s without rates", kind)
+	}
+	kinds := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		kinds[pickDuplicate(GeneratorCFG{DuplicateRate: 0.1, NearDuplicateRate: 0.3}, rnd)]++
+	}
+	for kind, expected := range map[string]int{duplicateExact: 1000, duplicateNear: 3000, "": 6000} {
+		if (kinds[kind] < expected*9/10) || (kinds[kind] > expected*11/10) {
+			t.Errorf("%d of 10000 rows are duplicates %q, expected about %d", kinds[kind], kind, expected)
+		}
+	}
+	if noise := duplicateNoise(GeneratorCFG{}); noise != defaultDuplicateNoise {
+		t.Errorf("default noise of duplicates is %f", noise)
+	}
+}
+
+func TestDuplicatesInvalid(t *testing.T) {
+	for _, cfg := range []GeneratorCFG{
+		{DuplicateRate: -0.1},
+		{NearDuplicateRate: -0.1},
+		{DuplicateNoise: -1},
+		{DuplicateRate: 0.6, NearDuplicateRate: 0.5},
+	} {
+		if err := validateDuplicates(cfg); err == nil {
+			t.Errorf("duplicates of rates %f, %f and noise %f are valid",
+				cfg.DuplicateRate, cfg.NearDuplicateRate, cfg.DuplicateNoise)
+		}
+	}
+}
+
+// TestDuplicatesRun checks that duplicates copy personal data of their
+// originals and have FFVs near the first FFV of them.
+func TestDuplicatesRun(t *testing.T) {
+	cfg, dir := testConfig(t, 300)
+	cfg.GeneratorCFG.DuplicateRate, cfg.GeneratorCFG.NearDuplicateRate = 0.1, 0.1
+	cfg.GeneratorCFG.DuplicatesLabelsPath = filepath.Join(dir, "duplicates.tsv")
+	testRun(t, cfg)
+	cobs := map[string][]string{}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		cobs[row[0]] = row
+	}
+	ffvs := map[string][]float64{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		if _, ok := ffvs[row[1]]; !ok {
+			ffvs[row[1]] = parseTSVVector(t, row[4])
+		}
+	}
+	kinds := map[string]int{}
+	for _, label := range readLabels(t, cfg.GeneratorCFG.DuplicatesLabelsPath) {
+		kinds[label[2]]++
+		duplicate, original := cobs[label[0]], cobs[label[1]]
+		// Passport and personal data after id and ts.
+		differences := []string{}
+		for i := 2; i < len(controlObjectsColumns); i++ {
+			if duplicate[i] != original[i] {
+				differences = append(differences, controlObjectsColumns[i])
+			}
+		}
+		switch {
+		case (label[2] == duplicateExact) && (len(differences) == 0) && (label[3] == ""):
+		case (label[2] == duplicateNear) && (len(differences) <= 1) && (label[3] != ""):
+			if (len(differences) == 1) && (differences[0] != label[3]) {
+				t.Errorf("near duplicate %s has a typo in %s, labelled %s", label[0], differences[0], label[3])
+			}
+		default:
+			t.Errorf("duplicate %q differs from its original in %q", label, differences)
+		}
+		if d := l2Distance(ffvs[label[0]], ffvs[label[1]]); d > 0.3 {
+			t.Errorf("FFV of duplicate %s is %f from its original", label[0], d)
+		}
+	}
+	if (kinds[duplicateExact] < 15) || (kinds[duplicateNear] < 15) {
+		t.Errorf("300 rows have %v duplicates, expected about 30 of each kind", kinds)
+	}
+}
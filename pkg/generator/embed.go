@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Options are settings of runs given as command line flags rather than in
+// the configuration. Zero values are the defaults of flags.
+type Options struct {
+	// Write into tables locked by another run, -allow-concurrent.
+	AllowConcurrent bool
+	// Connect to nothing and print DryRunRows sample rows, 10 by default,
+	// as JSON to DryRunPath, or to stdout when empty, -dry-run.
+	DryRun     bool
+	DryRunRows int
+	DryRunPath string
+	// Read back inserted rows after the run and fail on mismatches,
+	// -verify.
+	Verify bool
+	// Checkpoint to continue an interrupted run from, -resume.
+	Resume string
+	// Record of a failed batch to regenerate and insert alone,
+	// -replay-batch.
+	ReplayBatch string
+	// Insert rate of pairs to hold, 0 for no limit, -target-rows-per-sec.
+	TargetRowsPerSec float64
+	// Wall time limit of the run, 0 for no limit, -max-duration.
+	MaxDuration time.Duration
+	// Write results of verification and SLOs as JUnit XML to this file when
+	// not empty, -junit.
+	JUnitPath string
+	// Print no informational output, -machine.
+	Machine bool
+	// Serve GET /config with effective configuration on this address when
+	// not empty, -listen.
+	Listen string
+}
+
+// Generator runs generation for programs embedding the generator.
+type Generator struct {
+	cfg *Config
+	// Options of runs, defaults of flags unless set.
+	Options Options
+}
+
+// LoadConfig reads the configuration file, if any, and applies GENERATOR_
+// environment variables.
+func LoadConfig(path string) (*Config, error) {
+	return loadCFG(path, nil)
+}
+
+// New returns a generator of runs with configuration c.
+func New(c *Config) *Generator {
+	return &Generator{cfg: c}
+}
+
+// Run generates and writes rows to the configured output until done or ctx
+// is cancelled, and returns the number of inserted control objects. Runs
+// without generator.seed are seeded with the current time.
+func (g *Generator) Run(ctx context.Context) (int64, error) {
+	inserted, _, err := g.run(ctx, time.Now())
+	return inserted, err
+}
+
+// run resolves the seed, from a checkpoint of a resumed run if any, and
+// runs generation or a dry run. It returns the number of inserted control
+// objects and the seed.
+func (g *Generator) run(ctx context.Context, startTime time.Time) (int64, int64, error) {
+	seed := g.cfg.GeneratorCFG.Seed
+	if seed == 0 {
+		seed = startTime.Unix()
+	}
+	var resume *checkpoint
+	if (g.Options.Resume != "") && (g.Options.ReplayBatch != "") {
+		return 0, seed, fmt.Errorf("-resume and -replay-batch exclude each other")
+	}
+	if g.Options.Resume != "" {
+		var err error
+		if resume, err = loadCheckpoint(g.Options.Resume); err != nil {
+			return 0, seed, err
+		}
+		seed = resume.Seed
+	}
+	log := &logger{quiet: g.Options.Machine}
+	if g.Options.Listen != "" {
+		if err := startConfigServer(g.Options.Listen, g.cfg, seed, log); err != nil {
+			return 0, seed, err
+		}
+	}
+	if g.Options.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Options.MaxDuration)
+		defer cancel()
+	}
+	if g.Options.DryRun {
+		rows := g.Options.DryRunRows
+		if rows <= 0 {
+			rows = defaultDryRunRows
+		}
+		inserted, err := runDryRun(ctx, g.cfg, seed, rows, g.Options.DryRunPath, log)
+		return inserted, seed, err
+	}
+	inserted, err := run(ctx, g.cfg, g.Options, seed, resume, startTime, log)
+	return inserted, seed, err
+}
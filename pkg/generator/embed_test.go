@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEmbeddedRun checks that programs embedding the generator load
+// configuration with environment overrides and run it with options.
+func TestEmbeddedRun(t *testing.T) {
+	os.Setenv("GENERATOR_GENERATOR_N", "7")
+	defer os.Unsetenv("GENERATOR_GENERATOR_N")
+	cfg, err := LoadConfig("../../config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GeneratorCFG.N != 7 {
+		t.Fatalf("GENERATOR_GENERATOR_N=7 loads n %d", cfg.GeneratorCFG.N)
+	}
+	_, dir := testConfig(t, 0)
+	cfg.Output = outputFile
+	cfg.File.Dir, cfg.File.Format = dir, fileFormatTSV
+	cfg.GeneratorCFG.InIter, cfg.GeneratorCFG.Workers, cfg.GeneratorCFG.Seed = 7, 1, 1
+	cfg.GeneratorCFG.Probes.Path = ""
+
+	g := New(cfg)
+	g.Options.Machine = true
+	inserted, err := g.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")); (inserted != 7) || (len(rows) != 7) {
+		t.Errorf("run inserts %d pairs and writes %d control objects, expected 7", inserted, len(rows))
+	}
+
+	// Options select dry runs, which write no output files.
+	g = New(cfg)
+	g.Options.Machine, g.Options.DryRun = true, true
+	g.Options.DryRunRows, g.Options.DryRunPath = 3, filepath.Join(dir, "sample.json")
+	cfg.File.Dir = filepath.Join(dir, "missing")
+	if inserted, err = g.Run(context.Background()); (err != nil) || (inserted != 3) {
+		t.Errorf("dry run of 3 rows returns %d, %v", inserted, err)
+	}
+	if _, err := os.Stat(cfg.File.Dir); !os.IsNotExist(err) {
+		t.Errorf("dry run writes output files: %v", err)
+	}
+
+	g = New(cfg)
+	g.Options.Resume, g.Options.ReplayBatch = "checkpoint.yaml", "batch.yaml"
+	if _, err := g.Run(context.Background()); (err == nil) || !strings.Contains(err.Error(), "exclude each other") {
+		t.Errorf("run with -resume and -replay-batch returns %v", err)
+	}
+}
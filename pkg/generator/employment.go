@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+var employmentColumns = []string{"organization", "occupation"}
+
+// EmploymentCFG configures weights of organizations and occupations.
+type EmploymentCFG struct {
+	Enabled      bool               `yaml:"enabled"`
+	Organization map[string]float64 `yaml:"organization"`
+	Occupation   map[string]float64 `yaml:"occupation"`
+}
+
+type employmentGenerator struct {
+	organization *weightedPool
+	occupation   *weightedPool
+}
+
+func newEmploymentGenerator(cfg EmploymentCFG) (*employmentGenerator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	g := &employmentGenerator{}
+	var err error
+	if g.organization, err = newWeightedPool(cfg.Organization); err != nil {
+		return nil, errors.Wrap(err, "invalid organization distribution")
+	}
+	if g.occupation, err = newWeightedPool(cfg.Occupation); err != nil {
+		return nil, errors.Wrap(err, "invalid occupation distribution")
+	}
+	return g, nil
+}
+
+func (g *employmentGenerator) fill(rnd *rand.Rand, cob *controlObject) {
+	if g == nil {
+		return
+	}
+	cob.organization = g.organization.pick(rnd)
+	cob.occupation = g.occupation.pick(rnd)
+}
@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestWeightedPool(t *testing.T) {
+	pool, err := newWeightedPool(map[string]float64{"a": 3, "b": 1, "c": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	picked := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		picked[pool.pick(rnd)]++
+	}
+	if (picked["c"] != 0) || (math.Abs(float64(picked["a"])/4000-0.75) > 0.03) {
+		t.Errorf("values weighted 3, 1 and 0 are picked %v", picked)
+	}
+	for _, weights := range []map[string]float64{{"a": -1, "b": 2}, {"a": 0}, {}} {
+		if _, err := newWeightedPool(weights); err == nil {
+			t.Errorf("weights %v are accepted", weights)
+		}
+	}
+}
+
+// TestEmployment checks that organizations and occupations follow their
+// weights.
+func TestEmployment(t *testing.T) {
+	cfg, dir := testConfig(t, 1000)
+	cfg.GeneratorCFG.Employment = EmploymentCFG{
+		Enabled:      true,
+		Organization: map[string]float64{"Rostelecom": 0.8, "Sberbank": 0.2},
+		Occupation:   map[string]float64{"engineer": 0.5, "operator": 0.5},
+	}
+	testRun(t, cfg)
+	organizations, occupations := map[string]int{}, map[string]int{}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		if len(row) != len(controlObjectsColumns)+len(employmentColumns) {
+			t.Fatalf("control object has %d columns, expected %d with employment", len(row),
+				len(controlObjectsColumns)+len(employmentColumns))
+		}
+		organizations[row[len(controlObjectsColumns)]]++
+		occupations[row[len(controlObjectsColumns)+1]]++
+	}
+	if (len(organizations) != 2) || (organizations["Rostelecom"] < 750) || (organizations["Rostelecom"] > 850) {
+		t.Errorf("organizations weighted 0.8 and 0.2 are %v", organizations)
+	}
+	if (len(occupations) != 2) || (occupations["engineer"] < 450) || (occupations["engineer"] > 550) {
+		t.Errorf("occupations weighted 0.5 and 0.5 are %v", occupations)
+	}
+
+	if _, err := newEmploymentGenerator(EmploymentCFG{Enabled: true, Organization: map[string]float64{"a": 1}}); err == nil {
+		t.Error("employment without occupations is accepted")
+	}
+	if g, err := newEmploymentGenerator(EmploymentCFG{}); (g != nil) || (err != nil) {
+		t.Errorf("disabled employment returns %v, %v", g, err)
+	}
+}
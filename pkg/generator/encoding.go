@@ -0,0 +1,101 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// Text encodings and line endings of CSV output files.
+const (
+	encodingUTF8   = "utf-8"
+	encodingCP1251 = "windows-1251"
+	lineEndingLF   = "lf"
+	lineEndingCRLF = "crlf"
+)
+
+const (
+	cp1251Unmapped  = '?'
+	cp1251FirstHigh = 0x80
+)
+
+// cp1251High maps bytes 0x80-0xBF of Windows-1251 to runes, 0x98 is unused.
+// Bytes 0xC0-0xFF are А-я in order.
+var cp1251High = [64]rune{
+	0x0402, 0x0403, 0x201a, 0x0453, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x20ac, 0x2030, 0x0409, 0x2039, 0x040a, 0x040c, 0x040b, 0x040f,
+	0x0452, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0xfffd, 0x2122, 0x0459, 0x203a, 0x045a, 0x045c, 0x045b, 0x045f,
+	0x00a0, 0x040e, 0x045e, 0x0408, 0x00a4, 0x0490, 0x00a6, 0x00a7,
+	0x0401, 0x00a9, 0x0404, 0x00ab, 0x00ac, 0x00ad, 0x00ae, 0x0407,
+	0x00b0, 0x00b1, 0x0406, 0x0456, 0x0491, 0x00b5, 0x00b6, 0x00b7,
+	0x0451, 0x2116, 0x0454, 0x00bb, 0x0458, 0x0405, 0x0455, 0x0457,
+}
+
+var cp1251Bytes = func() map[rune]byte {
+	m := make(map[rune]byte, len(cp1251High))
+	for i, r := range cp1251High {
+		if r != utf8.RuneError {
+			m[r] = byte(cp1251FirstHigh + i)
+		}
+	}
+	return m
+}()
+
+func validateEncoding(encoding string) error {
+	switch encoding {
+	case "", encodingUTF8, encodingCP1251:
+		return nil
+	}
+	return fmt.Errorf("unknown encoding \"%s\", supported are %s, %s", encoding, encodingUTF8, encodingCP1251)
+}
+
+// newEncodingWriter returns w if encoding is UTF-8 and a writer transcoding
+// UTF-8 text into w otherwise.
+func newEncodingWriter(w io.Writer, encoding string) io.Writer {
+	if encoding == encodingCP1251 {
+		return &cp1251Writer{w: w}
+	}
+	return w
+}
+
+// cp1251Writer transcodes UTF-8 into Windows-1251, runes missing there are
+// written as "?". Runes split between writes are kept until completed.
+type cp1251Writer struct {
+	w       io.Writer
+	pending []byte
+	out     []byte
+}
+
+func (w *cp1251Writer) Write(p []byte) (int, error) {
+	data := p
+	if len(w.pending) != 0 {
+		data = append(w.pending, p...)
+		w.pending = nil
+	}
+	w.out = w.out[:0]
+	for len(data) > 0 {
+		if !utf8.FullRune(data) {
+			w.pending = append([]byte{}, data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		switch {
+		case r < cp1251FirstHigh:
+			w.out = append(w.out, byte(r))
+		case (r >= 'А') && (r <= 'я'):
+			w.out = append(w.out, byte(0xC0+r-'А'))
+		default:
+			b, ok := cp1251Bytes[r]
+			if !ok {
+				b = cp1251Unmapped
+			}
+			w.out = append(w.out, b)
+		}
+	}
+	if _, err := w.w.Write(w.out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,69 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCP1251Writer(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		text     string
+		expected string
+		// Bytes per write, all at once when 0.
+		chunk int
+	}{
+		{"ascii", "id,name\r\n", hex.EncodeToString([]byte("id,name\r\n")), 0},
+		{"cyrillic", "Привет, мир", "cff0e8e2e5f22c20ece8f0", 0},
+		{"yo", "Ёлка ёж", "a8ebeae020b8e6", 0},
+		{"symbols", "№ 5 €", "b920352088", 0},
+		{"serbian", "Ђурђевић", "80f3f090e5e2e89e", 0},
+		{"punctuation", "—«»", "97abbb", 0},
+		{"unmapped", "a日b😀", "613f623f", 0},
+		{"split runes", "Ёлка ёж", "a8ebeae020b8e6", 1},
+		{"split runes of 3 bytes", "№ 5 €", "b920352088", 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := newEncodingWriter(buf, encodingCP1251)
+			data := []byte(test.text)
+			chunk := test.chunk
+			if chunk == 0 {
+				chunk = len(data)
+			}
+			for from := 0; from < len(data); from += chunk {
+				to := from + chunk
+				if to > len(data) {
+					to = len(data)
+				}
+				n, err := w.Write(data[from:to])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != to-from {
+					t.Fatalf("%d of %d bytes are written", n, to-from)
+				}
+			}
+			if got := hex.EncodeToString(buf.Bytes()); got != test.expected {
+				t.Errorf("%q is encoded as %s, expected %s", test.text, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestValidateEncoding(t *testing.T) {
+	for _, test := range []struct {
+		encoding string
+		valid    bool
+	}{
+		{"", true},
+		{encodingUTF8, true},
+		{encodingCP1251, true},
+		{"koi8-r", false},
+	} {
+		if err := validateEncoding(test.encoding); (err == nil) != test.valid {
+			t.Errorf("validateEncoding(%q) = %v", test.encoding, err)
+		}
+	}
+}
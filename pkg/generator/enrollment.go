@@ -0,0 +1,200 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var enrollmentColumns = []string{"cob_id", "ffv_id"}
+
+// EnrollmentCFG configures enrolling a subset of generated persons through
+// the enrollment API of the nofacedb facerecognition service, so that its
+// in-memory index holds the same synthetic subjects as the database and
+// search can be tested end to end.
+type EnrollmentCFG struct {
+	// Fraction of control objects enrolled, 0 disables enrollment. Control
+	// objects are picked by a hash of their ID, so runs with the same seed
+	// enroll the same subjects.
+	Rate float64 `yaml:"rate"`
+	// Enrollment endpoint subjects are posted to.
+	URL string `yaml:"url"`
+	// Header sent with every request, e.g. Authorization: Bearer <token>.
+	AuthHeader string `yaml:"auth_header"`
+	AuthValue  string `yaml:"auth_value"`
+	// Subjects per request, 100 by default.
+	BatchSize int `yaml:"batch_size"`
+	// Requests in flight, 4 by default.
+	Concurrency int `yaml:"concurrency"`
+	TimeoutMS   int `yaml:"timeout_ms"`
+	// TSV of enrolled cob_id and ffv_id, none when empty.
+	LabelsPath string `yaml:"labels_path"`
+}
+
+func (cfg EnrollmentCFG) validate() error {
+	if cfg.Rate == 0 {
+		return nil
+	}
+	if (cfg.Rate < 0) || (cfg.Rate > 1) {
+		return fmt.Errorf("rate must be in [0, 1], got %v", cfg.Rate)
+	}
+	if cfg.URL == "" {
+		return fmt.Errorf("no enrollment URL")
+	}
+	if (cfg.BatchSize < 0) || (cfg.Concurrency < 0) {
+		return fmt.Errorf("batch size and concurrency must not be negative")
+	}
+	return nil
+}
+
+// enrollmentSubject is a subject of enrollment requests, posted as
+// {"subjects": [...]}.
+type enrollmentSubject struct {
+	ID                   string    `json:"id"`
+	FFVID                string    `json:"ffv_id"`
+	Passport             string    `json:"passport"`
+	FacialFeaturesVector []float64 `json:"facial_features_vector"`
+}
+
+// enroller posts subjects in batches while rows are generated. Methods are
+// no-ops on nil enroller. The first failed request stops enrollment and
+// is returned by close.
+type enroller struct {
+	cfg      EnrollmentCFG
+	client   *http.Client
+	labels   *labelsFile
+	mu       sync.Mutex
+	pending  []enrollmentSubject
+	requests chan []enrollmentSubject
+	wg       sync.WaitGroup
+	errOnce  sync.Once
+	err      error
+	failed   int32
+	enrolled int64
+}
+
+// newEnroller returns nil when enrollment is disabled.
+func newEnroller(cfg EnrollmentCFG, labels *labelsFile) *enroller {
+	if cfg.Rate == 0 {
+		return nil
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 100
+	}
+	concurrency := cfg.Concurrency
+	if concurrency == 0 {
+		concurrency = 4
+	}
+	e := &enroller{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: time.Duration(cfg.TimeoutMS) * time.Millisecond},
+		labels:   labels,
+		requests: make(chan []enrollmentSubject, concurrency),
+	}
+	for i := 0; i < concurrency; i++ {
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			for subjects := range e.requests {
+				if atomic.LoadInt32(&e.failed) != 0 {
+					continue
+				}
+				if err := e.post(subjects); err != nil {
+					e.errOnce.Do(func() { e.err = err })
+					atomic.StoreInt32(&e.failed, 1)
+					continue
+				}
+				atomic.AddInt64(&e.enrolled, int64(len(subjects)))
+				for _, subject := range subjects {
+					e.labels.write(subject.ID, subject.FFVID)
+				}
+			}
+		}()
+	}
+	return e
+}
+
+// selects reports whether the control object with id is enrolled.
+func (e *enroller) selects(id string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return float64(h.Sum64())/math.MaxUint64 < e.cfg.Rate
+}
+
+// add enrolls the person of cob with its first FFV if selected.
+func (e *enroller) add(ctx context.Context, cob controlObject, fv ffv) {
+	if (e == nil) || !e.selects(cob.id) {
+		return
+	}
+	e.mu.Lock()
+	e.pending = append(e.pending, enrollmentSubject{
+		ID:                   cob.id,
+		FFVID:                fv.id,
+		Passport:             cob.passport,
+		FacialFeaturesVector: fv.facialFeaturesVector,
+	})
+	var subjects []enrollmentSubject
+	if len(e.pending) >= e.cfg.BatchSize {
+		subjects, e.pending = e.pending, nil
+	}
+	e.mu.Unlock()
+	if subjects != nil {
+		select {
+		case e.requests <- subjects:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// close posts pending subjects, waits for requests in flight and returns
+// the number of enrolled subjects.
+func (e *enroller) close() (int64, error) {
+	if e == nil {
+		return 0, nil
+	}
+	e.mu.Lock()
+	if len(e.pending) > 0 {
+		e.requests <- e.pending
+		e.pending = nil
+	}
+	e.mu.Unlock()
+	close(e.requests)
+	e.wg.Wait()
+	return atomic.LoadInt64(&e.enrolled), e.err
+}
+
+func (e *enroller) post(subjects []enrollmentSubject) error {
+	body, err := json.Marshal(map[string]interface{}{"subjects": subjects})
+	if err != nil {
+		return errors.Wrap(err, "unable to encode subjects")
+	}
+	req, err := http.NewRequest(http.MethodPost, e.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to create enrollment request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.cfg.AuthHeader != "" {
+		req.Header.Set(e.cfg.AuthHeader, e.cfg.AuthValue)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "unable to send enrollment request")
+	}
+	defer resp.Body.Close()
+	if (resp.StatusCode < 200) || (resp.StatusCode >= 300) {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return &apiStatusError{url: e.cfg.URL, status: resp.StatusCode, message: strings.TrimSpace(string(message))}
+	}
+	return nil
+}
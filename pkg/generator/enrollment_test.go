@@ -0,0 +1,86 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnrollment(t *testing.T) {
+	mu := sync.Mutex{}
+	enrolled := map[string]enrollmentSubject{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body := struct {
+			Subjects []enrollmentSubject `json:"subjects"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		for _, subject := range body.Subjects {
+			enrolled[subject.ID] = subject
+		}
+	}))
+	defer server.Close()
+
+	cfg, dir := testConfig(t, 60)
+	cfg.GeneratorCFG.Enrollment = EnrollmentCFG{
+		Rate:       0.5,
+		URL:        server.URL + "/api/v1/enroll",
+		AuthHeader: "Authorization",
+		AuthValue:  "Bearer token",
+		BatchSize:  4,
+		LabelsPath: filepath.Join(dir, "enrolled.tsv"),
+	}
+	testRun(t, cfg)
+
+	e := &enroller{cfg: cfg.GeneratorCFG.Enrollment}
+	selected := 0
+	ffvIDs := map[string]bool{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		ffvIDs[row[0]] = true
+	}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		subject, ok := enrolled[row[0]]
+		if ok != e.selects(row[0]) {
+			t.Fatalf("control object %s is enrolled %v, selected %v", row[0], ok, !ok)
+		}
+		if !ok {
+			continue
+		}
+		selected++
+		if (subject.Passport != row[2]) || !ffvIDs[subject.FFVID] || (len(subject.FacialFeaturesVector) != cfg.GeneratorCFG.FFV.Dim) {
+			t.Fatalf("subject %+v of control object %v", subject, row[:3])
+		}
+	}
+	if (selected == 0) || (selected == 60) || (selected != len(enrolled)) {
+		t.Fatalf("%d of 60 control objects enrolled, server has %d", selected, len(enrolled))
+	}
+	if expected := (selected + 3) / 4; requests != expected {
+		t.Errorf("%d subjects enrolled in %d requests, expected %d", selected, requests, expected)
+	}
+	if labels := readLabels(t, cfg.GeneratorCFG.Enrollment.LabelsPath); len(labels) != selected {
+		t.Errorf("%d enrolled subjects labelled, expected %d", len(labels), selected)
+	}
+
+	cfg, _ = testConfig(t, 20)
+	cfg.GeneratorCFG.Enrollment = EnrollmentCFG{Rate: 1, URL: server.URL}
+	_, err := run(context.Background(), cfg, Options{}, 1, nil, time.Now(), &logger{quiet: true})
+	if (err == nil) || !strings.Contains(err.Error(), "unable to enroll subjects") || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("enrollment without authorization returned %v", err)
+	}
+}
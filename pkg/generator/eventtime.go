@@ -0,0 +1,121 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	lagExponential = "exponential"
+	lagUniform     = "uniform"
+)
+
+var eventTimeColumns = []string{"event_ts", "ingest_ts"}
+
+// EventTimeCFG configures lag between capture time (event_ts) and insert
+// time (ingest_ts) of facial features.
+type EventTimeCFG struct {
+	Enabled      bool   `yaml:"enabled"`
+	Distribution string `yaml:"distribution"`
+	MeanLagMS    int    `yaml:"mean_lag_ms"`
+	MinLagMS     int    `yaml:"min_lag_ms"`
+	MaxLagMS     int    `yaml:"max_lag_ms"`
+	// Cameras with skewed clocks capturing facial features.
+	Cameras CameraClocksCFG `yaml:"cameras"`
+}
+
+// CameraClocksCFG simulates clocks of a camera fleet. Every camera gets a
+// constant offset and a drift from normal distributions, so event_ts of
+// different cameras are skewed and may go out of order.
+type CameraClocksCFG struct {
+	// Zero disables camera clocks and the camera_id column.
+	N              int     `yaml:"n"`
+	OffsetStddevMS int     `yaml:"offset_stddev_ms"`
+	DriftStddevPPM float64 `yaml:"drift_stddev_ppm"`
+}
+
+const cameraIDColumn = "camera_id"
+
+type cameraClock struct {
+	offset time.Duration
+	// Seconds the clock gains per second.
+	drift float64
+}
+
+// cameraClocks are clocks of cameras synchronized with true time at sync.
+type cameraClocks struct {
+	sync   time.Time
+	clocks []cameraClock
+}
+
+func newCameraClocks(cfg CameraClocksCFG, rnd *rand.Rand, sync time.Time) *cameraClocks {
+	if cfg.N == 0 {
+		return nil
+	}
+	c := &cameraClocks{sync: sync, clocks: make([]cameraClock, cfg.N)}
+	for i := range c.clocks {
+		c.clocks[i] = cameraClock{
+			offset: time.Duration(rnd.NormFloat64() * float64(cfg.OffsetStddevMS) * float64(time.Millisecond)),
+			drift:  rnd.NormFloat64() * cfg.DriftStddevPPM / 1e6,
+		}
+	}
+	return c
+}
+
+// skew picks a camera for the FFV and shifts its event_ts to the camera
+// clock.
+func (c *cameraClocks) skew(rnd *rand.Rand, fv *ffv) {
+	if c == nil {
+		return
+	}
+	fv.cameraID = uint32(rnd.Intn(len(c.clocks)))
+	clock := c.clocks[fv.cameraID]
+	elapsed := fv.eventTS.Sub(c.sync)
+	fv.eventTS = fv.eventTS.Add(clock.offset + time.Duration(clock.drift*float64(elapsed)))
+}
+
+func (cfg EventTimeCFG) validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	switch cfg.Distribution {
+	case lagExponential, lagUniform:
+	default:
+		return fmt.Errorf("unknown lag distribution \"%s\"", cfg.Distribution)
+	}
+	if (cfg.MinLagMS < 0) || (cfg.MaxLagMS < 0) || ((cfg.MaxLagMS > 0) && (cfg.MaxLagMS < cfg.MinLagMS)) {
+		return fmt.Errorf("invalid lag range [%d, %d]", cfg.MinLagMS, cfg.MaxLagMS)
+	}
+	// Uniform lags need an upper bound, exponential ones are capped by it.
+	if (cfg.Distribution == lagUniform) && (cfg.MaxLagMS < cfg.MinLagMS) {
+		return fmt.Errorf("uniform lag needs max_lag_ms >= min_lag_ms, got [%d, %d]", cfg.MinLagMS, cfg.MaxLagMS)
+	}
+	if (cfg.Cameras.N < 0) || (cfg.Cameras.OffsetStddevMS < 0) || (cfg.Cameras.DriftStddevPPM < 0) {
+		return fmt.Errorf("invalid camera clocks %+v", cfg.Cameras)
+	}
+	return nil
+}
+
+func (cfg EventTimeCFG) sampleLag(rnd *rand.Rand) time.Duration {
+	lagMS := float64(cfg.MinLagMS)
+	switch cfg.Distribution {
+	case lagExponential:
+		lagMS += rnd.ExpFloat64() * float64(cfg.MeanLagMS)
+	case lagUniform:
+		lagMS += rnd.Float64() * float64(cfg.MaxLagMS-cfg.MinLagMS)
+	}
+	if (cfg.MaxLagMS > 0) && (lagMS > float64(cfg.MaxLagMS)) {
+		lagMS = float64(cfg.MaxLagMS)
+	}
+	return time.Duration(lagMS * float64(time.Millisecond))
+}
+
+func (cfg EventTimeCFG) fill(rnd *rand.Rand, fv *ffv, now time.Time, cameras *cameraClocks) {
+	if !cfg.Enabled {
+		return
+	}
+	fv.ingestTS = now
+	fv.eventTS = fv.ingestTS.Add(-cfg.sampleLag(rnd))
+	cameras.skew(rnd, fv)
+}
@@ -0,0 +1,138 @@
+package generator
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventTime(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	cfg.GeneratorCFG.EventTime = EventTimeCFG{Enabled: true, Distribution: lagUniform, MinLagMS: 60000, MaxLagMS: 120000}
+	testRun(t, cfg)
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		if len(row) != len(ffvsColumns)+len(eventTimeColumns) {
+			t.Fatalf("FFV has %d columns, expected %d with event time", len(row), len(ffvsColumns)+len(eventTimeColumns))
+		}
+		eventTS, err := time.Parse("2006-01-02 15:04:05", row[len(ffvsColumns)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ingestTS, err := time.Parse("2006-01-02 15:04:05", row[len(ffvsColumns)+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Timestamps are truncated to seconds.
+		if lag := ingestTS.Sub(eventTS); (lag < 59*time.Second) || (lag > 121*time.Second) {
+			t.Errorf("FFV %s is ingested %v after its capture, expected 1 to 2 minutes", row[0], lag)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	exponential := EventTimeCFG{Enabled: true, Distribution: lagExponential, MeanLagMS: 100, MinLagMS: 10, MaxLagMS: 300}
+	total, capped := time.Duration(0), 0
+	n := 10000
+	for i := 0; i < n; i++ {
+		lag := exponential.sampleLag(rnd)
+		if (lag < 10*time.Millisecond) || (lag > 300*time.Millisecond) {
+			t.Fatalf("exponential lag %v is out of [10ms, 300ms]", lag)
+		}
+		if lag == 300*time.Millisecond {
+			capped++
+		}
+		total += lag
+	}
+	// Lags over 290ms, e^-2.9 of them, are capped.
+	if (capped < n/30) || (capped > n/15) {
+		t.Errorf("%d of %d exponential lags are capped, expected about %d", capped, n, n*55/1000)
+	}
+	// 10ms + 100ms * (1 - e^-2.9) with the cap.
+	if mean := total / time.Duration(n); (mean < 100*time.Millisecond) || (mean > 109*time.Millisecond) {
+		t.Errorf("mean exponential lag is %v, expected about 104.5ms", mean)
+	}
+
+	for _, cfg := range []EventTimeCFG{
+		{Enabled: true, Distribution: "normal"},
+		{Enabled: true, Distribution: lagExponential, MinLagMS: 100, MaxLagMS: 50},
+		{Enabled: true, Distribution: lagUniform, MinLagMS: 100},
+	} {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("event time %+v is accepted", cfg)
+		}
+	}
+}
+
+func TestCameraClocks(t *testing.T) {
+	sync := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rnd := rand.New(rand.NewSource(1))
+	c := newCameraClocks(CameraClocksCFG{N: 2000, OffsetStddevMS: 1000, DriftStddevPPM: 100}, rnd, sync)
+	offsets, drifts := 0.0, 0.0
+	for _, clock := range c.clocks {
+		offsets += clock.offset.Seconds() * clock.offset.Seconds()
+		drifts += clock.drift * clock.drift * 1e12
+	}
+	if stddev := math.Sqrt(offsets / 2000); (stddev < 0.9) || (stddev > 1.1) {
+		t.Errorf("stddev of camera offsets is %vs, expected 1s", stddev)
+	}
+	if stddev := math.Sqrt(drifts / 2000); (stddev < 90) || (stddev > 110) {
+		t.Errorf("stddev of camera drifts is %v ppm, expected 100", stddev)
+	}
+
+	// Clocks drift away from true time since they were synchronized.
+	captured := sync.Add(time.Hour)
+	fv := ffv{eventTS: captured}
+	c.skew(rnd, &fv)
+	clock := c.clocks[fv.cameraID]
+	expected := captured.Add(clock.offset + time.Duration(clock.drift*float64(time.Hour)))
+	if !fv.eventTS.Equal(expected) {
+		t.Errorf("camera %d captures at %v, expected %v", fv.cameraID, fv.eventTS, expected)
+	}
+
+	if c := newCameraClocks(CameraClocksCFG{}, rnd, sync); c != nil {
+		t.Error("camera clocks are simulated without cameras")
+	}
+	fv = ffv{eventTS: captured}
+	(*cameraClocks)(nil).skew(rnd, &fv)
+	if !fv.eventTS.Equal(captured) || (fv.cameraID != 0) {
+		t.Error("FFVs are skewed without cameras")
+	}
+}
+
+// TestCameraClocksRun checks that event_ts of every camera is skewed by its
+// own offset.
+func TestCameraClocksRun(t *testing.T) {
+	cfg, dir := testConfig(t, 200)
+	cfg.GeneratorCFG.EventTime = EventTimeCFG{Enabled: true, Distribution: lagUniform,
+		Cameras: CameraClocksCFG{N: 4, OffsetStddevMS: 60000}}
+	testRun(t, cfg)
+	skews := map[string]map[time.Duration]bool{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		if len(row) != len(ffvsColumns)+len(eventTimeColumns)+1 {
+			t.Fatalf("FFV has %d columns, expected %d with camera_id", len(row), len(ffvsColumns)+len(eventTimeColumns)+1)
+		}
+		eventTS, err := time.Parse("2006-01-02 15:04:05", row[len(ffvsColumns)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ingestTS, err := time.Parse("2006-01-02 15:04:05", row[len(ffvsColumns)+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		camera := row[len(ffvsColumns)+2]
+		if skews[camera] == nil {
+			skews[camera] = map[time.Duration]bool{}
+		}
+		skews[camera][eventTS.Sub(ingestTS)] = true
+	}
+	if len(skews) != 4 {
+		t.Errorf("FFVs are captured by cameras %v, expected 4", skews)
+	}
+	// Timestamps are truncated to seconds.
+	for camera, skew := range skews {
+		if len(skew) > 2 {
+			t.Errorf("camera %s has skews %v, expected a constant offset without drift", camera, skew)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// FaceBoxCFG places face boxes [left, top, right, bottom] in a frame of
+// a fixed camera. Every identity gets a stable anchor box and each capture
+// of it is jittered around the anchor by up to JitterPX. Face boxes are
+// random numbers when FrameWidth is 0.
+type FaceBoxCFG struct {
+	FrameWidth  int `yaml:"frame_width"`
+	FrameHeight int `yaml:"frame_height"`
+	MinSize     int `yaml:"min_size"`
+	MaxSize     int `yaml:"max_size"`
+	JitterPX    int `yaml:"jitter_px"`
+}
+
+type faceBoxGenerator struct {
+	cfg FaceBoxCFG
+}
+
+func newFaceBoxGenerator(cfg FaceBoxCFG) (*faceBoxGenerator, error) {
+	if cfg.FrameWidth == 0 {
+		return nil, nil
+	}
+	if (cfg.MinSize <= 0) || (cfg.MaxSize < cfg.MinSize) ||
+		(cfg.MaxSize > cfg.FrameWidth) || (cfg.MaxSize > cfg.FrameHeight) {
+		return nil, fmt.Errorf("face size range [%d, %d] does not fit %dx%d frame",
+			cfg.MinSize, cfg.MaxSize, cfg.FrameWidth, cfg.FrameHeight)
+	}
+	if cfg.JitterPX < 0 {
+		return nil, fmt.Errorf("negative jitter %d", cfg.JitterPX)
+	}
+	return &faceBoxGenerator{cfg: cfg}, nil
+}
+
+// anchor returns a stable face box of a new identity.
+func (g *faceBoxGenerator) anchor(rnd *rand.Rand) []uint64 {
+	if g == nil {
+		return nil
+	}
+	size := g.cfg.MinSize + rnd.Intn(g.cfg.MaxSize-g.cfg.MinSize+1)
+	left := rnd.Intn(g.cfg.FrameWidth - size + 1)
+	top := rnd.Intn(g.cfg.FrameHeight - size + 1)
+	return []uint64{uint64(left), uint64(top), uint64(left + size), uint64(top + size)}
+}
+
+// capture returns anchor shifted by up to JitterPX on each axis, kept
+// inside the frame.
+func (g *faceBoxGenerator) capture(rnd *rand.Rand, anchor []uint64) []uint64 {
+	if g == nil {
+		return generateFaceBox(rnd)
+	}
+	left, top := int(anchor[0]), int(anchor[1])
+	width, height := int(anchor[2])-left, int(anchor[3])-top
+	left = clamp(left+rnd.Intn(2*g.cfg.JitterPX+1)-g.cfg.JitterPX, 0, g.cfg.FrameWidth-width)
+	top = clamp(top+rnd.Intn(2*g.cfg.JitterPX+1)-g.cfg.JitterPX, 0, g.cfg.FrameHeight-height)
+	return []uint64{uint64(left), uint64(top), uint64(left + width), uint64(top + height)}
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestFaceBoxes(t *testing.T) {
+	cfg := FaceBoxCFG{FrameWidth: 640, FrameHeight: 480, MinSize: 80, MaxSize: 320, JitterPX: 12}
+	g, err := newFaceBoxGenerator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		anchor := g.anchor(rnd)
+		size := anchor[2] - anchor[0]
+		if (size < 80) || (size > 320) || (anchor[3]-anchor[1] != size) ||
+			(anchor[2] > 640) || (anchor[3] > 480) {
+			t.Fatalf("anchor %v is out of the frame or the size range", anchor)
+		}
+		box := g.capture(rnd, anchor)
+		if (box[2]-box[0] != size) || (box[3]-box[1] != size) || (box[2] > 640) || (box[3] > 480) {
+			t.Fatalf("capture %v of anchor %v changes size or leaves the frame", box, anchor)
+		}
+		if (math.Abs(float64(box[0])-float64(anchor[0])) > 12) || (math.Abs(float64(box[1])-float64(anchor[1])) > 12) {
+			t.Fatalf("capture %v is more than 12px away from anchor %v", box, anchor)
+		}
+	}
+
+	if g, err := newFaceBoxGenerator(FaceBoxCFG{}); (g != nil) || (err != nil) {
+		t.Errorf("face boxes without a frame return %v, %v", g, err)
+	}
+	for _, cfg := range []FaceBoxCFG{
+		{FrameWidth: 640, FrameHeight: 480, MinSize: 80, MaxSize: 500},
+		{FrameWidth: 640, FrameHeight: 480, MinSize: 0, MaxSize: 320},
+		{FrameWidth: 640, FrameHeight: 480, MinSize: 80, MaxSize: 320, JitterPX: -1},
+	} {
+		if _, err := newFaceBoxGenerator(cfg); err == nil {
+			t.Errorf("face boxes %+v are accepted", cfg)
+		}
+	}
+}
+
+// TestFaceBoxesRun checks that captures of a control object stay around one
+// position while control objects are spread over the frame.
+func TestFaceBoxesRun(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	cfg.GeneratorCFG.FFVPerCOB = CountCFG{Min: 3, Max: 3}
+	cfg.GeneratorCFG.FaceBoxes = FaceBoxCFG{FrameWidth: 1920, FrameHeight: 1080, MinSize: 80, MaxSize: 320, JitterPX: 12}
+	testRun(t, cfg)
+
+	boxes := map[string][][]float64{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		boxes[row[1]] = append(boxes[row[1]], parseTSVVector(t, row[3]))
+	}
+	lefts := map[float64]bool{}
+	for cobID, captures := range boxes {
+		if len(captures) != 3 {
+			t.Fatalf("control object %s has %d captures", cobID, len(captures))
+		}
+		lefts[captures[0][0]] = true
+		for _, box := range captures[1:] {
+			if (math.Abs(box[0]-captures[0][0]) > 24) || (math.Abs(box[1]-captures[0][1]) > 24) ||
+				(box[2]-box[0] != captures[0][2]-captures[0][0]) {
+				t.Errorf("captures %v of control object %s are not around one position", captures, cobID)
+			}
+		}
+	}
+	if len(lefts) < 50 {
+		t.Errorf("100 control objects have %d distinct positions", len(lefts))
+	}
+}
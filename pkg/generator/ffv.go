@@ -0,0 +1,155 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ffvUniform  = "uniform"
+	ffvGaussian = "gaussian"
+)
+
+const defaultFFVDim = 128
+
+// FFVCFG describes generated vectors like output of an embedding model.
+type FFVCFG struct {
+	// 128 by default.
+	Dim int `yaml:"dim"`
+	// uniform in [-1, 1] (default) or standard gaussian components. Low-rank
+	// structure, when configured, is gaussian regardless.
+	Distribution string `yaml:"distribution"`
+	// Scale vectors to unit L2 norm.
+	Normalize bool `yaml:"normalize"`
+	// Number of centroids persons are assigned to, 0 for independent
+	// vectors. Every FFV of a person is its centroid plus gaussian noise
+	// with cluster_spread stddev per component.
+	Clusters      int     `yaml:"clusters"`
+	ClusterSpread float64 `yaml:"cluster_spread"`
+	// Correlation of clusters with sex and age.
+	Demographics DemographicsCFG `yaml:"demographics"`
+}
+
+// ffvGenerator generates FFVs of configured shape, with low-rank structure
+// if configured.
+type ffvGenerator struct {
+	dim          int
+	distribution string
+	normalize    bool
+	lowRank      *lowRankGenerator
+	centroids    [][]float64
+	spread       float64
+	demographics DemographicsCFG
+}
+
+func newFFVGenerator(cfg FFVCFG, structure FFVStructureCFG, rnd *rand.Rand) (*ffvGenerator, error) {
+	g := &ffvGenerator{
+		dim:          cfg.Dim,
+		distribution: cfg.Distribution,
+		normalize:    cfg.Normalize,
+		demographics: cfg.Demographics,
+	}
+	if g.dim == 0 {
+		g.dim = defaultFFVDim
+	}
+	if g.dim < 0 {
+		return nil, fmt.Errorf("dimensionality must be positive, got %d", cfg.Dim)
+	}
+	switch g.distribution {
+	case "":
+		g.distribution = ffvUniform
+	case ffvUniform, ffvGaussian:
+	default:
+		return nil, fmt.Errorf("unknown distribution \"%s\"", cfg.Distribution)
+	}
+	var err error
+	if g.lowRank, err = newLowRankGenerator(structure, g.dim, rnd); err != nil {
+		return nil, err
+	}
+	if cfg.Clusters < 0 {
+		return nil, fmt.Errorf("number of clusters must not be negative, got %d", cfg.Clusters)
+	}
+	if err := cfg.Demographics.validate(cfg.Clusters); err != nil {
+		return nil, errors.Wrap(err, "invalid demographics")
+	}
+	g.centroids = make([][]float64, cfg.Clusters)
+	for i := range g.centroids {
+		g.centroids[i] = g.sample(rnd)
+	}
+	g.spread = cfg.ClusterSpread
+	if g.spread <= 0 {
+		g.spread = 0.05
+	}
+	return g, nil
+}
+
+// generate returns an FFV of a new person.
+func (g *ffvGenerator) generate(rnd *rand.Rand) []float64 {
+	return g.sighting(rnd, g.identity(rnd))
+}
+
+// identity picks the centroid of a new person, nil without clusters.
+func (g *ffvGenerator) identity(rnd *rand.Rand) []float64 {
+	if len(g.centroids) == 0 {
+		return nil
+	}
+	return g.centroids[rnd.Intn(len(g.centroids))]
+}
+
+// cluster returns the index of centroid identity, -1 without clusters.
+func (g *ffvGenerator) cluster(identity []float64) int {
+	for i, centroid := range g.centroids {
+		if (len(identity) != 0) && (&centroid[0] == &identity[0]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sighting returns an FFV of the person with identity, independent vectors
+// without clusters.
+func (g *ffvGenerator) sighting(rnd *rand.Rand, identity []float64) []float64 {
+	if identity == nil {
+		return g.finish(g.sample(rnd))
+	}
+	ffv := make([]float64, len(identity))
+	for i := range ffv {
+		ffv[i] = identity[i] + rnd.NormFloat64()*g.spread
+	}
+	return g.finish(ffv)
+}
+
+func (g *ffvGenerator) sample(rnd *rand.Rand) []float64 {
+	var ffv []float64
+	if g.lowRank != nil {
+		ffv = g.lowRank.generate(rnd)
+	} else {
+		ffv = make([]float64, g.dim)
+		for i := range ffv {
+			if g.distribution == ffvGaussian {
+				ffv[i] = rnd.NormFloat64()
+			} else {
+				ffv[i] = rnd.Float64()*2.0 - 1.0
+			}
+		}
+	}
+	return ffv
+}
+
+func (g *ffvGenerator) finish(ffv []float64) []float64 {
+	if g.normalize {
+		if n := norm(ffv); n > 0 {
+			for i := range ffv {
+				ffv[i] /= n
+			}
+		}
+	}
+	return ffv
+}
+
+// outlier generates a malformed FFV, never normalized.
+func (g *ffvGenerator) outlier(rnd *rand.Rand, kind string) []float64 {
+	return generateOutlierFFV(rnd, kind, g.dim)
+}
@@ -0,0 +1,99 @@
+package generator
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func BenchmarkFFVGenerate(b *testing.B) {
+	for _, bench := range []struct {
+		name      string
+		cfg       FFVCFG
+		structure FFVStructureCFG
+	}{
+		{"uniform", FFVCFG{}, FFVStructureCFG{}},
+		{"gaussian_normalized", FFVCFG{Distribution: ffvGaussian, Normalize: true}, FFVStructureCFG{}},
+		{"clusters", FFVCFG{Clusters: 64}, FFVStructureCFG{}},
+		{"low_rank", FFVCFG{}, FFVStructureCFG{Components: 16, Decay: 0.8, Noise: 0.01}},
+		{"dim_512", FFVCFG{Dim: 512}, FFVStructureCFG{}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			rnd := rand.New(rand.NewSource(1))
+			g, err := newFFVGenerator(bench.cfg, bench.structure, rnd)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				g.generate(rnd)
+			}
+		})
+	}
+}
+
+func TestFFVGenerator(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		cfg      FFVCFG
+		dim      int
+		variance float64
+	}{
+		// Variance of uniform components in [-1, 1] is 1/3.
+		{"uniform", FFVCFG{}, 128, 1.0 / 3},
+		{"gaussian", FFVCFG{Dim: 512, Distribution: ffvGaussian}, 512, 1},
+		// Unit vectors have components of variance 1/dim.
+		{"gaussian normalized", FFVCFG{Dim: 256, Distribution: ffvGaussian, Normalize: true}, 256, 1.0 / 256},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			g, err := newFFVGenerator(test.cfg, FFVStructureCFG{}, rnd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum, squares, count, outside := 0.0, 0.0, 0, 0
+			for i := 0; i < 100; i++ {
+				ffv := g.generate(rnd)
+				if len(ffv) != test.dim {
+					t.Fatalf("FFV has %d components, expected %d", len(ffv), test.dim)
+				}
+				if test.cfg.Normalize && (math.Abs(norm(ffv)-1) > 1e-9) {
+					t.Fatalf("normalized FFV has norm %v", norm(ffv))
+				}
+				for _, x := range ffv {
+					sum, squares, count = sum+x, squares+x*x, count+1
+					if math.Abs(x) > 1 {
+						outside++
+					}
+				}
+			}
+			mean := sum / float64(count)
+			variance := squares/float64(count) - mean*mean
+			if (math.Abs(mean) > 0.05*math.Sqrt(test.variance)) || (math.Abs(variance/test.variance-1) > 0.05) {
+				t.Errorf("components have mean %v and variance %v, expected 0 and %v", mean, variance, test.variance)
+			}
+			if ((test.cfg.Distribution == ffvGaussian) && !test.cfg.Normalize) != (outside > 0) {
+				t.Errorf("%d components are outside of [-1, 1]", outside)
+			}
+		})
+	}
+
+	for _, cfg := range []FFVCFG{{Dim: -1}, {Distribution: "laplace"}, {Clusters: -1}} {
+		if _, err := newFFVGenerator(cfg, FFVStructureCFG{}, rand.New(rand.NewSource(1))); err == nil {
+			t.Errorf("FFVs %+v are accepted", cfg)
+		}
+	}
+
+	// Generated rows hold FFVs of the configured shape.
+	cfg, dir := testConfig(t, 10)
+	cfg.GeneratorCFG.FFV = FFVCFG{Dim: 512, Distribution: ffvGaussian, Normalize: true}
+	testRun(t, cfg)
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		ffv := parseTSVVector(t, row[4])
+		if (len(ffv) != 512) || (math.Abs(norm(ffv)-1) > 1e-9) {
+			t.Errorf("written FFV has %d components and norm %v", len(ffv), norm(ffv))
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/nofacedb/generator/pkg/fieldgen"
+)
+
+// fieldExpressions fills control object columns from generator.fields
+// expressions, overriding generated values or adding String columns. Extra
+// columns of identity lists are added columns too, which expressions may
+// refer to.
+type fieldExpressions struct {
+	engine *fieldgen.Engine
+	// Added columns, in the order of their values in control objects, extra
+	// columns of identities first.
+	custom   []string
+	extra    int
+	passport bool
+}
+
+func newFieldExpressions(exprs map[string]string, extra []string) (*fieldExpressions, error) {
+	if (len(exprs) == 0) && (len(extra) == 0) {
+		return nil, nil
+	}
+	overridable := map[string]bool{}
+	for _, column := range controlObjectsColumns {
+		overridable[column] = true
+	}
+	delete(overridable, "id")
+	delete(overridable, "ts")
+	// ts may be read, e.g. for ages, but not overridden.
+	known := []string{"ts"}
+	for column := range overridable {
+		known = append(known, column)
+	}
+	known = append(known, extra...)
+	engine, err := fieldgen.New(exprs, known)
+	if err != nil {
+		return nil, err
+	}
+	f := &fieldExpressions{engine: engine, custom: append([]string{}, extra...), extra: len(extra)}
+	isExtra := map[string]bool{}
+	for _, name := range extra {
+		isExtra[name] = true
+	}
+	for _, name := range engine.Names() {
+		if isExtra[name] {
+			continue
+		}
+		if overridable[name] {
+			f.passport = f.passport || (name == "passport")
+			continue
+		}
+		if _, ok := columnTypes[name]; ok {
+			return nil, fmt.Errorf("column %s can not be generated by an expression", name)
+		}
+		f.custom = append(f.custom, name)
+	}
+	return f, nil
+}
+
+// fill applies expressions to cob, with values of extra columns of its
+// identity, if any.
+func (f *fieldExpressions) fill(rnd *rand.Rand, cob *controlObject, extra []string) {
+	if f == nil {
+		return
+	}
+	row := map[string]string{
+		"ts":         cob.ts.Format("2006-01-02 15:04:05"),
+		"passport":   cob.passport,
+		"surname":    cob.surname,
+		"name":       cob.name,
+		"patronymic": cob.patronymic,
+		"sex":        cob.sex,
+		"birthdate":  cob.birthDate,
+		"phone_num":  cob.phoneNum,
+		"email":      cob.email,
+		"address":    cob.address,
+	}
+	for i := 0; i < f.extra; i++ {
+		row[f.custom[i]] = ""
+		if i < len(extra) {
+			row[f.custom[i]] = extra[i]
+		}
+	}
+	f.engine.Fill(rnd, row)
+	cob.passport, cob.surname, cob.name, cob.patronymic = row["passport"], row["surname"], row["name"], row["patronymic"]
+	cob.sex, cob.birthDate, cob.phoneNum, cob.email, cob.address = row["sex"], row["birthdate"], row["phone_num"], row["email"], row["address"]
+	cob.custom = make([]string, len(f.custom))
+	for i, column := range f.custom {
+		cob.custom[i] = row[column]
+	}
+}
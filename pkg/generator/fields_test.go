@@ -0,0 +1,45 @@
+package generator
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/datagen"
+)
+
+func TestComputedColumns(t *testing.T) {
+	cfg, dir := testConfig(t, 50)
+	cfg.GeneratorCFG.Fields = map[string]string{
+		"age":       "expr:yearsBetween(birthdate, ts)",
+		"name_norm": "expr:upper(translit(name))",
+	}
+	g, err := newGeneration(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := map[string]int{}
+	for i, column := range g.opts.controlObjectsColumns() {
+		index[column] = i
+	}
+	testRun(t, cfg)
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		birthDate, err := time.Parse("2006-01-02", row[index["birthdate"]])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts, err := time.Parse("2006-01-02 15:04:05", row[index["ts"]])
+		if err != nil {
+			t.Fatal(err)
+		}
+		age, err := strconv.Atoi(row[index["age"]])
+		if (err != nil) || birthDate.AddDate(age, 0, 0).After(ts) || !birthDate.AddDate(age+1, 0, 0).After(ts) {
+			t.Errorf("age of %s at %s is %s", row[index["birthdate"]], row[index["ts"]], row[index["age"]])
+		}
+		if expected := datagen.Translit(row[index["name"]]); row[index["name_norm"]] != strings.ToUpper(expected) {
+			t.Errorf("normalized name of %s is %s", row[index["name"]], row[index["name_norm"]])
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func makeFIFO(path string) error {
+	return fmt.Errorf("named pipes are not supported on %s", runtime.GOOS)
+}
+
+func openFIFO(ctx context.Context, path string) (*os.File, error) {
+	return nil, fmt.Errorf("named pipes are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,87 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFIFOOutput(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	cfg.File.FIFO, cfg.File.RotateRows, cfg.File.CompactBytes = true, 0, 0
+	if err := cfg.File.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers load both pipes while rows are generated, like clickhouse-client.
+	lines := map[string]chan int{}
+	for _, table := range generatedTables {
+		path := filepath.Join(dir, table+".tsv")
+		if err := makeFIFO(path); err != nil {
+			t.Fatal(err)
+		}
+		read := make(chan int, 1)
+		lines[table] = read
+		go func() {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Error(err)
+			}
+			read <- strings.Count(string(data), "\n")
+		}()
+	}
+	testRun(t, cfg)
+	if n := <-lines["control_objects"]; n != 100 {
+		t.Errorf("%d control objects are read from the pipe, expected 100", n)
+	}
+	if n := <-lines["facial_features"]; n == 0 {
+		t.Error("no facial features are read from the pipe")
+	}
+	info, err := os.Stat(filepath.Join(dir, "control_objects.tsv"))
+	if (err != nil) || (info.Mode()&os.ModeNamedPipe == 0) {
+		t.Errorf("output is not a named pipe: %v", err)
+	}
+	parts, err := readManifest(filepath.Join(dir, "control_objects.manifest.tsv"))
+	if (err != nil) || (len(parts) != 1) || (parts[0].rows != 100) || (parts[0].bytes == 0) {
+		t.Errorf("manifest lists %+v: %v", parts, err)
+	}
+}
+
+func TestFIFOWithoutReaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fifo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "control_objects.csv")
+	if err := makeFIFO(path); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*fifoPollInterval)
+	defer cancel()
+	if _, err := openFIFO(ctx, path); err != context.DeadlineExceeded {
+		t.Errorf("pipe without readers is opened with error %v", err)
+	}
+
+	// Regular files are not replaced by pipes.
+	file := filepath.Join(dir, "facial_features.csv")
+	ioutil.WriteFile(file, nil, 0644)
+	if err := makeFIFO(file); err == nil {
+		t.Error("regular file is taken for a named pipe")
+	}
+	for _, cfg := range []FileOutputCFG{
+		{Format: fileFormatCSV, FIFO: true, RotateRows: 10},
+		{Format: fileFormatCSV, FIFO: true, CompactBytes: 1 << 20},
+		{Format: fileFormatParquet, FIFO: true},
+	} {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("named pipes are accepted with %+v", cfg)
+		}
+	}
+}
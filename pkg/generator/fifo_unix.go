@@ -0,0 +1,44 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// fifoPollInterval is the interval of attempts to open a named pipe without
+// readers.
+const fifoPollInterval = 100 * time.Millisecond
+
+// makeFIFO creates a named pipe at path unless there is one.
+func makeFIFO(path string) error {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s exists and is not a named pipe", path)
+		}
+		return nil
+	}
+	return syscall.Mkfifo(path, 0644)
+}
+
+// openFIFO opens a named pipe for writing once a reader opens it. Opening
+// does not block, so that waiting for readers stops when ctx is done.
+func openFIFO(ctx context.Context, path string) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			return file, nil
+		}
+		if pathErr, ok := err.(*os.PathError); !ok || (pathErr.Err != syscall.ENXIO) {
+			return nil, err
+		}
+		if err := sleepContext(ctx, fifoPollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
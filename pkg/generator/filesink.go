@@ -0,0 +1,562 @@
+package generator
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	outputClickHouse = "clickhouse"
+	outputFile       = "file"
+	outputKafka      = "kafka"
+	outputAPI        = "api"
+)
+
+const (
+	fileFormatCSV     = "csv"
+	fileFormatTSV     = "tsv"
+	fileFormatParquet = "parquet"
+	fileFormatMsgPack = "msgpack"
+)
+
+// FileOutputCFG configures writing generated rows to CSV, TSV, Parquet or
+// MessagePack files that clickhouse-client can load with INSERT ... FORMAT
+// CSV/TabSeparated/Parquet/MsgPack.
+type FileOutputCFG struct {
+	Dir    string `yaml:"dir"`
+	Format string `yaml:"format"`
+	// CSV only, "," by default.
+	Delimiter string `yaml:"delimiter"`
+	// CSV only, utf-8 by default or windows-1251 for legacy import tools.
+	Encoding string `yaml:"encoding"`
+	// CSV only, lf by default or crlf.
+	LineEnding string `yaml:"line_ending"`
+	// Rows per file, a new file is started when reached. 0 writes one file
+	// per table.
+	RotateRows  int            `yaml:"rotate_rows"`
+	Compression CompressionCFG `yaml:"compression"`
+	// Concatenate consecutive files smaller than this size after the run. 0
+	// keeps files as written.
+	CompactBytes int64 `yaml:"compact_bytes"`
+	// Parquet only, rows per row group, 10000 by default.
+	RowGroupRows int `yaml:"row_group_rows"`
+	// Write into named pipes in dir, which clickhouse-client loads while
+	// rows are generated, instead of files. CSV or TSV without rotation.
+	FIFO bool `yaml:"fifo"`
+}
+
+func (cfg FileOutputCFG) validate() error {
+	switch cfg.Format {
+	case fileFormatCSV:
+		if len([]rune(cfg.Delimiter)) > 1 {
+			return fmt.Errorf("CSV delimiter must be a single character, got \"%s\"", cfg.Delimiter)
+		}
+		if err := validateEncoding(cfg.Encoding); err != nil {
+			return err
+		}
+		switch cfg.LineEnding {
+		case "", lineEndingLF, lineEndingCRLF:
+		default:
+			return fmt.Errorf("unknown line ending \"%s\", supported are %s, %s", cfg.LineEnding, lineEndingLF, lineEndingCRLF)
+		}
+	case fileFormatParquet:
+		if cfg.CompactBytes > 0 {
+			return fmt.Errorf("Parquet files can not be compacted")
+		}
+		if (cfg.Encoding != "") && (cfg.Encoding != encodingUTF8) {
+			return fmt.Errorf("encoding %s is supported only by CSV files", cfg.Encoding)
+		}
+	case fileFormatTSV, fileFormatMsgPack:
+		if (cfg.Encoding != "") && (cfg.Encoding != encodingUTF8) {
+			return fmt.Errorf("encoding %s is supported only by CSV files", cfg.Encoding)
+		}
+		if (cfg.LineEnding != "") && (cfg.LineEnding != lineEndingLF) {
+			return fmt.Errorf("line ending %s is supported only by CSV files", cfg.LineEnding)
+		}
+	default:
+		return fmt.Errorf("unknown file format \"%s\"", cfg.Format)
+	}
+	if cfg.FIFO {
+		if cfg.Format == fileFormatParquet {
+			return fmt.Errorf("Parquet files can not be written into named pipes")
+		}
+		if (cfg.RotateRows > 0) || (cfg.CompactBytes > 0) {
+			return fmt.Errorf("named pipes can not be rotated or compacted, unset rotate_rows and compact_bytes")
+		}
+	}
+	return cfg.Compression.validate(compressionGzip, compressionZstd)
+}
+
+func (cfg FileOutputCFG) clickhouseFormat() string {
+	switch cfg.Format {
+	case fileFormatTSV:
+		return "TabSeparated"
+	case fileFormatParquet:
+		return "Parquet"
+	case fileFormatMsgPack:
+		return "MsgPack"
+	}
+	return "CSV"
+}
+
+// tableFile writes rows of one table to a sequence of rotated files. It is
+// safe for concurrent use, every batch is written as a whole.
+type tableFile struct {
+	mu      sync.Mutex
+	cfg     FileOutputCFG
+	log     *logger
+	table   string
+	columns []string
+	types   map[string]string
+	part    int
+	rows    int
+	file    *os.File
+	zw      io.WriteCloser
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	parquet *parquetWriter
+	parts   []filePart
+	// Compresses files or Parquet pages, nil without compression.
+	compression *compressor
+	// Bytes before and after compression.
+	raw, written *countingWriter
+}
+
+// newTableFile starts writing files of a table with generated columns of
+// types, overriding default column types. Files, their columns and the load
+// command are named by m, which leaves omitted columns out of written rows.
+// Resumed runs continue numbering after existing files instead of
+// overwriting them.
+func newTableFile(cfg FileOutputCFG, m *tableMapping, columns []string, types map[string]string, resume bool,
+	log *logger) (*tableFile, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "unable to create output directory %s", cfg.Dir)
+	}
+	table := m.name
+	f := &tableFile{
+		cfg:     cfg,
+		log:     log,
+		table:   table,
+		columns: m.columns,
+		types:   make(map[string]string),
+		raw:     &countingWriter{},
+		written: &countingWriter{},
+	}
+	var err error
+	if f.compression, err = newCompressor(cfg.Compression); err != nil {
+		return nil, errors.Wrap(err, "invalid file compression")
+	}
+	for _, column := range columns {
+		columnType, ok := types[column]
+		if !ok {
+			columnType = columnTypes[column]
+		}
+		if name := m.column(column); name != "" {
+			f.types[name] = columnType
+		}
+	}
+	if resume {
+		existing, err := filepath.Glob(filepath.Join(cfg.Dir, table+".*"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list output files of %s", table)
+		}
+		for _, path := range existing {
+			part := 0
+			if _, err := fmt.Sscanf(filepath.Base(path), table+".%d.", &part); (err == nil) && (part > f.part) {
+				f.part = part
+			}
+			if (filepath.Base(path) == table+".parquet") && (f.part == 0) {
+				f.part = 1
+			}
+		}
+		if f.parts, err = readManifest(f.manifestPath()); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.FIFO {
+		if err := makeFIFO(f.fifoPath()); err != nil {
+			return nil, errors.Wrapf(err, "unable to create named pipe of %s", table)
+		}
+		// Rows are written once the pipe is read.
+		f.log.logf("load %s while generating with:\n%s\n", table, f.loadCommand([]string{f.fifoPath()}))
+	}
+	return f, nil
+}
+
+// fifoPath returns the path of the named pipe of the table.
+func (f *tableFile) fifoPath() string {
+	path := filepath.Join(f.cfg.Dir, f.table+"."+f.cfg.Format)
+	if f.cfg.Compression.enabled() {
+		path += f.cfg.Compression.extension()
+	}
+	return path
+}
+
+// rotate starts the next file, or opens the named pipe once a reader opens
+// it or ctx is done.
+func (f *tableFile) rotate(ctx context.Context) error {
+	if err := f.closeFile(); err != nil {
+		return err
+	}
+	f.part++
+	path := filepath.Join(f.cfg.Dir, fmt.Sprintf("%s.%04d.%s", f.table, f.part, f.cfg.Format))
+	// Parquet pages are compressed instead of whole files.
+	compressFile := f.cfg.Compression.enabled() && (f.cfg.Format != fileFormatParquet)
+	if compressFile {
+		path += f.cfg.Compression.extension()
+	}
+	if (f.cfg.Format == fileFormatParquet) && (f.part == 1) {
+		path = filepath.Join(f.cfg.Dir, f.table+".parquet")
+	}
+	var file *os.File
+	var err error
+	if f.cfg.FIFO {
+		path = f.fifoPath()
+		if file, err = openFIFO(ctx, path); err != nil {
+			return errors.Wrapf(err, "unable to open named pipe %s", path)
+		}
+	} else if file, err = os.Create(path); err != nil {
+		return errors.Wrapf(err, "unable to create output file %s", path)
+	}
+	f.file, f.rows = file, 0
+	f.written.w = file
+	f.raw.w = f.written
+	if compressFile {
+		if f.zw, err = f.compression.newWriter(f.written); err != nil {
+			file.Close()
+			return err
+		}
+		f.raw.w = f.zw
+	}
+	f.buf = bufio.NewWriter(newEncodingWriter(f.raw, f.cfg.Encoding))
+	if f.cfg.Format == fileFormatCSV {
+		f.csv = csv.NewWriter(f.buf)
+		if f.cfg.Delimiter != "" {
+			f.csv.Comma = []rune(f.cfg.Delimiter)[0]
+		}
+		f.csv.UseCRLF = f.cfg.LineEnding == lineEndingCRLF
+	}
+	if f.cfg.Format == fileFormatParquet {
+		if f.parquet, err = newParquetWriter(f.buf, f.columns, f.types, f.cfg.RowGroupRows, f.compression); err != nil {
+			file.Close()
+			return errors.Wrapf(err, "unable to start Parquet file %s", path)
+		}
+	}
+	f.parts = append(f.parts, filePart{path: path})
+	return nil
+}
+
+func (f *tableFile) closeFile() error {
+	if f.file == nil {
+		return nil
+	}
+	if f.csv != nil {
+		f.csv.Flush()
+	}
+	if f.parquet != nil {
+		if err := f.parquet.close(); err != nil {
+			f.file.Close()
+			return errors.Wrapf(err, "unable to write output file %s", f.file.Name())
+		}
+		// Compression of Parquet pages is reported like compression of files.
+		f.raw.n += f.parquet.uncompressed - f.parquet.w.n
+		f.parquet = nil
+	}
+	if err := f.buf.Flush(); err != nil {
+		f.file.Close()
+		return errors.Wrapf(err, "unable to write output file %s", f.file.Name())
+	}
+	if f.zw != nil {
+		if err := f.zw.Close(); err != nil {
+			f.file.Close()
+			return errors.Wrapf(err, "unable to compress output file %s", f.file.Name())
+		}
+		f.zw = nil
+	}
+	part := &f.parts[len(f.parts)-1]
+	part.rows = f.rows
+	if f.cfg.FIFO {
+		part.bytes = f.written.n
+	} else if info, err := f.file.Stat(); err == nil {
+		part.bytes = info.Size()
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *tableFile) write(ctx context.Context, rows [][]interface{}, times *batchTimes) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	serializationStart := time.Now()
+	fields := make([]string, len(f.columns))
+	var packed []byte
+	for _, row := range rows {
+		if (f.file == nil) || ((f.cfg.RotateRows > 0) && (f.rows == f.cfg.RotateRows)) {
+			if err := f.rotate(ctx); err != nil {
+				return err
+			}
+		}
+		if f.parquet != nil {
+			if err := f.parquet.write(row); err != nil {
+				return errors.Wrapf(err, "unable to write %s row", f.table)
+			}
+			f.rows++
+			continue
+		}
+		if f.cfg.Format == fileFormatMsgPack {
+			var err error
+			if packed, err = appendMsgPackRow(packed[:0], row); err != nil {
+				return errors.Wrapf(err, "unable to encode %s row", f.table)
+			}
+			if _, err := f.buf.Write(packed); err != nil {
+				return errors.Wrapf(err, "unable to write %s row", f.table)
+			}
+			f.rows++
+			continue
+		}
+		for i, value := range row {
+			fields[i] = formatFileValue(value, f.csv != nil)
+		}
+		if f.csv != nil {
+			if err := f.csv.Write(fields); err != nil {
+				return errors.Wrapf(err, "unable to write %s row", f.table)
+			}
+		} else if _, err := fmt.Fprintln(f.buf, strings.Join(fields, "\t")); err != nil {
+			return errors.Wrapf(err, "unable to write %s row", f.table)
+		}
+		f.rows++
+	}
+	// Batches are flushed, so that write errors are returned by the batch
+	// hitting them. The CSV writer reports errors of its writes on flush.
+	if f.csv != nil {
+		if f.csv.Flush(); f.csv.Error() != nil {
+			return errors.Wrapf(f.csv.Error(), "unable to write %s rows", f.table)
+		}
+	}
+	if f.buf != nil {
+		if err := f.buf.Flush(); err != nil {
+			return errors.Wrapf(err, "unable to write %s rows", f.table)
+		}
+	}
+	times.serialization += time.Now().Sub(serializationStart)
+	return nil
+}
+
+// fileDriver writes batches of generated rows to output files of their
+// tables. Failed writes leave files broken, so batches are not retried.
+type fileDriver struct {
+	cobFile, ffvFile *tableFile
+	opts             insertOptions
+}
+
+func (d fileDriver) InsertControlObjects(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rows := make([][]interface{}, len(cobs))
+	for i, cob := range cobs {
+		rows[i] = d.opts.cobTable.row(d.opts.controlObjectRow(cob))
+	}
+	return d.cobFile.write(ctx, rows, times)
+}
+
+func (d fileDriver) InsertFFVs(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rows := make([][]interface{}, len(ffvs))
+	for i, fv := range ffvs {
+		rows[i] = d.opts.ffvTable.row(d.opts.ffvRow(fv))
+	}
+	return d.ffvFile.write(ctx, rows, times)
+}
+
+// formatFileValue formats values as TSV, except that CSV strings are left
+// as is for the CSV writer to quote.
+func formatFileValue(value interface{}, csv bool) string {
+	if s, ok := value.(string); ok && csv {
+		return s
+	}
+	return formatTSVValue(value)
+}
+
+// compressionReport reports bytes written before and after compression and
+// the time compression took.
+func (f *tableFile) compressionReport() string {
+	ratio := 1.0
+	if f.written.n != 0 {
+		ratio = float64(f.raw.n) / float64(f.written.n)
+	}
+	report := fmt.Sprintf("%s: %d bytes, %d written with %v (ratio %.2f)",
+		f.table, f.raw.n, f.written.n, f.cfg.Compression, ratio)
+	if f.compression != nil {
+		report += ", " + f.compression.report()
+	}
+	return report
+}
+
+// close closes the current file and returns the command loading all files.
+func (f *tableFile) close() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.closeFile(); err != nil {
+		return "", err
+	}
+	if f.cfg.CompactBytes > 0 {
+		if err := f.compact(); err != nil {
+			return "", err
+		}
+	}
+	if err := f.writeManifest(); err != nil {
+		return "", err
+	}
+	paths := make([]string, len(f.parts))
+	for i, part := range f.parts {
+		paths[i] = part.path
+	}
+	return f.loadCommand(paths), nil
+}
+
+// loadCommand returns the command loading files at paths.
+func (f *tableFile) loadCommand(paths []string) string {
+	settings := ""
+	if (f.cfg.Format == fileFormatCSV) && (f.cfg.Delimiter != "") && (f.cfg.Delimiter != ",") {
+		settings = fmt.Sprintf(" --format_csv_delimiter='%s'", f.cfg.Delimiter)
+	}
+	cat := "cat"
+	if f.cfg.Compression.enabled() && (f.cfg.Format != fileFormatParquet) {
+		cat = f.cfg.Compression.decompressCommand()
+	}
+	decode := ""
+	if f.cfg.Encoding == encodingCP1251 {
+		decode = " | iconv -f WINDOWS-1251 -t UTF-8"
+	}
+	return fmt.Sprintf("%s %s%s | clickhouse-client%s --query=\"INSERT INTO %s (%s) FORMAT %s\"",
+		cat, strings.Join(paths, " "), decode, settings, f.table, strings.Join(f.columns, ", "), f.cfg.clickhouseFormat())
+}
+
+// filePart is an output file listed in the manifest of its table.
+type filePart struct {
+	path  string
+	rows  int
+	bytes int64
+}
+
+func (f *tableFile) manifestPath() string {
+	return filepath.Join(f.cfg.Dir, f.table+".manifest.tsv")
+}
+
+// writeManifest lists files of the table in load order with their rows and
+// sizes.
+func (f *tableFile) writeManifest() error {
+	lines := []string{"path\trows\tbytes"}
+	for _, part := range f.parts {
+		lines = append(lines, fmt.Sprintf("%s\t%d\t%d", part.path, part.rows, part.bytes))
+	}
+	if err := ioutil.WriteFile(f.manifestPath(), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return errors.Wrapf(err, "unable to write manifest of %s", f.table)
+	}
+	return nil
+}
+
+func readManifest(path string) ([]filePart, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "unable to read manifest")
+	}
+	parts := []filePart{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n")[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid line of manifest %s: %q", path, line)
+		}
+		part := filePart{path: fields[0]}
+		if _, err := fmt.Sscan(fields[1], &part.rows); err != nil {
+			return nil, errors.Wrapf(err, "unable to parse manifest %s", path)
+		}
+		if _, err := fmt.Sscan(fields[2], &part.bytes); err != nil {
+			return nil, errors.Wrapf(err, "unable to parse manifest %s", path)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// compact concatenates runs of consecutive files into files of at most
+// CompactBytes, keeping row order. Concatenated gzip members or zstd frames
+// form a valid file, so compressed files are compacted the same way.
+func (f *tableFile) compact() error {
+	compacted := []filePart{}
+	for from := 0; from < len(f.parts); {
+		group := f.parts[from]
+		to := from + 1
+		for (to < len(f.parts)) && (group.bytes+f.parts[to].bytes <= f.cfg.CompactBytes) {
+			group.rows += f.parts[to].rows
+			group.bytes += f.parts[to].bytes
+			to++
+		}
+		if to-from > 1 {
+			if err := concatFiles(group.path, f.parts[from:to]); err != nil {
+				return errors.Wrapf(err, "unable to compact files of %s", f.table)
+			}
+		}
+		compacted = append(compacted, group)
+		from = to
+	}
+	if len(compacted) < len(f.parts) {
+		f.log.logf("compacted %d files of %s into %d\n", len(f.parts), f.table, len(compacted))
+	}
+	f.parts = compacted
+	return nil
+}
+
+// concatFiles replaces path with concatenation of parts and removes the
+// other parts.
+func concatFiles(path string, parts []filePart) error {
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		src, err := os.Open(part.path)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		_, err = io.Copy(tmp, src)
+		src.Close()
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if part.path != path {
+			if err := os.Remove(part.path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
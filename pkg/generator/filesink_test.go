@@ -0,0 +1,186 @@
+package generator
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/storage/sinktest"
+)
+
+func TestTableFileMapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := testInsertOptions(t, SchemaCFG{ControlObjects: TableSchemaCFG{
+		Name:    "persons",
+		Columns: map[string]string{"passport": "document", "email": omittedColumn},
+	}})
+	f, err := newTableFile(FileOutputCFG{Dir: dir, Format: fileFormatTSV}, opts.cobTable,
+		opts.controlObjectsColumns(), nil, false, &logger{quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cob := controlObject{
+		id: "1", ts: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), passport: "12 34 567890", surname: "Ivanov",
+		email: "i@example.com",
+	}
+	row := [][]interface{}{opts.cobTable.row(opts.controlObjectRow(cob))}
+	if err := f.write(context.Background(), row, &batchTimes{}); err != nil {
+		t.Fatal(err)
+	}
+	load, err := f.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "persons.0001.tsv")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(strings.TrimSuffix(string(data), "\n"), "\t")
+	if (len(fields) != len(controlObjectsColumns)-1) || (fields[2] != cob.passport) {
+		t.Errorf("row is written as %q", fields)
+	}
+	if strings.Contains(string(data), cob.email) {
+		t.Errorf("omitted email is written: %q", data)
+	}
+	columns := "id, ts, document, surname, name, patronymic, sex, birthdate, phone_num, address"
+	if expected := "INSERT INTO persons (" + columns + ") FORMAT TabSeparated"; !strings.Contains(load, expected) {
+		t.Errorf("load command %q does not contain %q", load, expected)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "persons.manifest.tsv")); err != nil {
+		t.Errorf("manifest is not named after the mapped table: %v", err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("no space left on device")
+}
+
+func TestTableFileWriteErrors(t *testing.T) {
+	for _, format := range []string{fileFormatCSV, fileFormatTSV} {
+		t.Run(format, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "filesink")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			opts := testInsertOptions(t, SchemaCFG{})
+			f, err := newTableFile(FileOutputCFG{Dir: dir, Format: format}, opts.cobTable,
+				opts.controlObjectsColumns(), nil, false, &logger{quiet: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.close()
+			row := [][]interface{}{opts.cobTable.row(opts.controlObjectRow(controlObject{id: "1"}))}
+			if err := f.write(context.Background(), row, &batchTimes{}); err != nil {
+				t.Fatal(err)
+			}
+			// A full disk fails writes once the buffer is flushed.
+			f.buf = bufio.NewWriterSize(failingWriter{}, 16)
+			if f.csv != nil {
+				f.csv = csv.NewWriter(f.buf)
+			}
+			if err := f.write(context.Background(), row, &batchTimes{}); err == nil {
+				t.Error("write to a full disk succeeded")
+			}
+		})
+	}
+}
+
+// fileBackend stores rows in output files of tables, and fails writes of
+// the files after accepting a number of them like a full disk does.
+type fileBackend struct {
+	mu     sync.Mutex
+	files  map[string]*tableFile
+	accept int
+}
+
+func (b *fileBackend) Reject(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.accept = n
+}
+
+func (b *fileBackend) Stored(table string) ([]string, error) {
+	data, err := ioutil.ReadFile(b.files[table].parts[0].path)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line != "" {
+			ids = append(ids, strings.Split(line, "\t")[0])
+		}
+	}
+	return ids, nil
+}
+
+// fileBackendWriter writes to a file of a fileBackend.
+type fileBackendWriter struct {
+	b *fileBackend
+	w io.Writer
+}
+
+func (w fileBackendWriter) Write(p []byte) (int, error) {
+	w.b.mu.Lock()
+	defer w.b.mu.Unlock()
+	if w.b.accept == 0 {
+		return 0, fmt.Errorf("no space left on device")
+	}
+	if w.b.accept > 0 {
+		w.b.accept--
+	}
+	return w.w.Write(p)
+}
+
+func TestFileDriverConformance(t *testing.T) {
+	opts := testInsertOptions(t, SchemaCFG{})
+	sink := driverSink{cobTable: opts.cobTable.name, ffvTable: opts.ffvTable.name}
+	sinktest.Run(t, func(t *testing.T) (sinktest.Sink, sinktest.Backend) {
+		dir, err := ioutil.TempDir("", "filesink")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		b := &fileBackend{files: map[string]*tableFile{}, accept: -1}
+		for _, table := range []struct {
+			m       *tableMapping
+			columns []string
+		}{
+			{opts.cobTable, opts.controlObjectsColumns()},
+			{opts.ffvTable, opts.ffvsColumns()},
+		} {
+			f, err := newTableFile(FileOutputCFG{Dir: dir, Format: fileFormatTSV}, table.m, table.columns, nil, false,
+				&logger{quiet: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Batches of the suite fit the write buffer, so that every
+			// batch is a write of the file.
+			if err := f.rotate(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			f.written.w = fileBackendWriter{b: b, w: f.file}
+			t.Cleanup(func() { f.close() })
+			b.files[table.m.name] = f
+		}
+		sink.d = fileDriver{cobFile: b.files[sink.cobTable], ffvFile: b.files[sink.ffvTable], opts: opts}
+		return sink, b
+	}, sinktest.Contract{Tables: []string{sink.cobTable, sink.ffvTable}})
+}
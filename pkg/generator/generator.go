@@ -0,0 +1,1475 @@
+// Package generator fills nofacedb tables with synthetic control objects
+// and facial features vectors. cmd/generator is its command line, other
+// programs embed it with New and Generator.Run.
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kshvakov/clickhouse"
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/nofacedb/generator/pkg/datagen"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// StorageCFG configures the database rows are inserted into.
+type StorageCFG struct {
+	// clickhouse (default) or postgres.
+	Type string `yaml:"type"`
+	Addr string `yaml:"addr"`
+	Port int    `yaml:"port"`
+	// native (default) or http, ClickHouse protocol of inserts.
+	Protocol string `yaml:"protocol"`
+	// HTTP interface port, used by the http protocol and the bench
+	// subcommand. 8123 by default.
+	HTTPPort       int    `yaml:"http_port"`
+	User           string `yaml:"user"`
+	Passwd         string `yaml:"passwd"`
+	MaxPings       int    `yaml:"max_pings"`
+	DefaultDB      string `yaml:"default_db"`
+	WriteTimeoutMS int    `yaml:"write_timeout_ms"`
+	ReadTimeoutMS  int    `yaml:"read_timeout_ms"`
+	Debug          bool   `json:"debug"`
+	// Replication-aware writes.
+	InsertQuorum          int `yaml:"insert_quorum"`
+	InsertQuorumTimeoutMS int `yaml:"insert_quorum_timeout_ms"`
+	// Server-side buffered inserts.
+	AsyncInsert AsyncInsertCFG `yaml:"async_insert"`
+	// Retry policies per class of insert errors.
+	Retries RetriesCFG `yaml:"retries"`
+	// Deprecated, retries.transient.max_retries.
+	InsertRetries int `yaml:"insert_retries"`
+	// Compression of inserts, lz4 or none over the native protocol, gzip,
+	// zstd or none over HTTP.
+	Compression CompressionCFG `yaml:"compression"`
+	// Tunnel connections through HTTP CONNECT or SOCKS5 proxy.
+	Proxy ProxyCFG `yaml:"proxy"`
+	// TLS of native and HTTP connections.
+	TLS TLSCFG `yaml:"tls"`
+	// Create missing generated tables before inserting.
+	AutoCreate bool      `yaml:"auto_create"`
+	Schema     SchemaCFG `yaml:"schema"`
+	// Advisory lock against concurrent runs.
+	Lock LockCFG `yaml:"lock"`
+	// PostgreSQL connection settings of storage type postgres.
+	Postgres PostgresCFG `yaml:"postgres"`
+}
+
+// GeneratorCFG configures generated rows and runs.
+type GeneratorCFG struct {
+	N         int          `yaml:"n"`
+	InIter    int          `yaml:"in_iter"`
+	ThinkTime ThinkTimeCFG `yaml:"think_time"`
+	// Goroutines generating and inserting disjoint shares of n rows.
+	Workers int `yaml:"workers"`
+	// Namespace for deterministic UUIDv5 control object IDs derived from
+	// passports. Random UUIDv4 IDs are used when empty.
+	UUIDNamespace string `yaml:"uuid_namespace"`
+	// Bounds and distribution of ts of control objects, generation times
+	// when empty.
+	TSRange        TSRangeCFG `yaml:"ts_range"`
+	TSDistribution string     `yaml:"ts_distribution"`
+	// Periods of ts with exact numbers of control objects, instead of
+	// ts_range. n defaults to their total.
+	Partitions []PartitionCFG `yaml:"partitions"`
+	// Seed of all random values. Non-zero seed also makes IDs and
+	// timestamps deterministic, so runs with the same configuration produce
+	// identical datasets. 0 seeds from the clock.
+	Seed int64 `yaml:"seed"`
+	// Per-field offsets of the seed, changing one field group while others
+	// stay identical.
+	SeedOffsets map[string]int64 `yaml:"seed_offsets"`
+	Outliers    OutliersCFG      `yaml:"outliers"`
+	// Locale-aware personal data, "-" in every field when locale is empty.
+	PersonalData datagen.Config `yaml:"personal_data"`
+	// Optional latitude and longitude columns within the city of the
+	// address, needs a locale of personal data.
+	Coordinates bool `yaml:"coordinates"`
+	// FFVs of every control object, a number or a {min, max} range. 1 by
+	// default. Several FFVs of a person get distinct img_id.
+	FFVPerCOB CountCFG `yaml:"ffv_per_cob"`
+	// Dimensionality, distribution, normalization and clusters of FFVs.
+	FFV FFVCFG `yaml:"ffv"`
+	// Low-rank covariance of FFVs instead of independent components.
+	FFVStructure FFVStructureCFG `yaml:"ffv_structure"`
+	// Optional ff_pca and ff_hash columns with reduced FFVs.
+	FFVVariants FFVVariantsCFG `yaml:"ffv_variants"`
+	// Stable per-identity face box positions in a fixed camera frame.
+	FaceBoxes FaceBoxCFG `yaml:"face_boxes"`
+	// FFV pairs at exact distances for threshold tuning.
+	PlantedPairs PlantedPairsCFG `yaml:"planted_pairs"`
+	// Per-table overrides of in_iter and insert parallelism.
+	ControlObjects TableCFG `yaml:"control_objects"`
+	FFVs           TableCFG `yaml:"facial_features"`
+	// Post-generation OPTIMIZE or merge settling.
+	Optimize OptimizeCFG `yaml:"optimize"`
+	// Optional consent, legal basis and retention class columns.
+	Compliance ComplianceCFG `yaml:"compliance"`
+	// Optional organization and occupation columns.
+	Employment EmploymentCFG `yaml:"employment"`
+	// Optional natural_key column, a hash of passport and birth date.
+	NaturalKey bool `yaml:"natural_key"`
+	// UUID or numeric IDs per table.
+	IDs IDsCFG `yaml:"ids"`
+	// Optional Nested key-value attributes.
+	Attributes AttributesCFG `yaml:"attributes"`
+	// Expressions of control object columns, see package fieldgen. Columns
+	// that are not generated are added as String.
+	Fields map[string]string `yaml:"fields"`
+	// Rules of control object columns, checked after field expressions.
+	Constraints ConstraintsCFG `yaml:"constraints"`
+	// Partial identities completed by generated fields and FFVs.
+	Identities IdentitiesCFG `yaml:"identities"`
+	// Passport series and issuing offices of regions.
+	Passports PassportsCFG `yaml:"passports"`
+	// Reference tables and dictionaries of regions, cameras and documents.
+	Dictionaries DictionariesCFG `yaml:"dictionaries"`
+	// Labelled identity merge and split scenarios.
+	IdentityEvents IdentityEventsCFG `yaml:"identity_events"`
+	// Optional version column and upserts of earlier persons.
+	Upsert UpsertCFG `yaml:"upsert"`
+	// Labelled duplicates of persons with typos and variants of names.
+	NameVariants NameVariantsCFG `yaml:"name_variants"`
+	// Shares of control objects duplicating the last canonical person
+	// exactly or with a typo in a name, with FFVs of duplicate_noise stddev
+	// around its FFV.
+	DuplicateRate        float64 `yaml:"duplicate_rate"`
+	NearDuplicateRate    float64 `yaml:"near_duplicate_rate"`
+	DuplicateNoise       float64 `yaml:"duplicate_noise"`
+	DuplicatesLabelsPath string  `yaml:"duplicates_labels_path"`
+	// Labelled probe queries for search evaluation.
+	Probes ProbesCFG `yaml:"probes"`
+	// Encrypted dictionary of generated persons for unmasking.
+	Pseudonyms PseudonymsCFG `yaml:"pseudonyms"`
+	// Subjects enrolled into the facerecognition service.
+	Enrollment EnrollmentCFG `yaml:"enrollment"`
+	// Optional event_ts and ingest_ts columns of facial features with a lag
+	// between capture and ingestion.
+	EventTime EventTimeCFG `yaml:"event_time"`
+	// Concurrent readers checking monotonicity of row counts.
+	ConsistencyCheck ConsistencyCFG `yaml:"consistency_check"`
+	// Report parts and merges from system.part_log after the run.
+	PartsReport bool `yaml:"parts_report"`
+	// Per-column profile of generated tables after the run.
+	Profile ProfileCFG `yaml:"profile"`
+	// Check of sampled stored FFVs after the run.
+	VectorCheck VectorCheckCFG `yaml:"vector_check"`
+	// Progress of interrupted runs for -resume.
+	Checkpoint CheckpointCFG `yaml:"checkpoint"`
+	// Controller holding -target-rows-per-sec.
+	Throughput ThroughputCFG `yaml:"throughput"`
+	// Cap of inserted control objects per second, 0 for no cap. It paces
+	// inserts like -target-rows-per-sec, so they exclude each other.
+	RateLimitRowsPerSec float64 `yaml:"rate_limit_rows_per_sec"`
+	// Control objects inserted at once after idle time under the cap, a
+	// control objects batch by default.
+	RateLimitBurst int `yaml:"rate_limit_burst"`
+	// Batch inserts in flight across workers and tables, 0 for no limit.
+	MaxInflightBatches int `yaml:"max_inflight_batches"`
+	// Disk spool of batches the sink is not ready for.
+	Spool SpoolCFG `yaml:"spool"`
+	// Optional TSV file with per-batch stage timings.
+	StageMetricsPath string `yaml:"stage_metrics_path"`
+	// Optional YAML summary of the run, written when it ends.
+	SummaryPath string `yaml:"summary_path"`
+	// Reports of panics recovered in workers are appended to this file,
+	// generator-crash-<time>.txt by default.
+	CrashReportPath string `yaml:"crash_report_path"`
+	// Records of batches failing to insert for -replay-batch.
+	Replay ReplayCFG `yaml:"replay"`
+	// Objectives checked at the end of the run, violations exit with code 3.
+	SLOs []SLOCFG `yaml:"slos"`
+}
+
+// Config is the YAML configuration of the generator, see config.yaml.
+type Config struct {
+	StorageCFG   StorageCFG   `yaml:"storage"`
+	GeneratorCFG GeneratorCFG `yaml:"generator"`
+	// clickhouse (default), file, kafka or api.
+	Output string        `yaml:"output"`
+	File   FileOutputCFG `yaml:"file"`
+	Kafka  KafkaCFG      `yaml:"kafka"`
+	API    APICFG        `yaml:"api"`
+	// Masking of exported samples.
+	Masking MaskingCFG `yaml:"masking"`
+}
+
+func readCFG() (*Config, Options, error) {
+	configPath := ""
+	options := Options{}
+	flag.StringVar(&configPath, "config", "", "path to YAML configuration file")
+	flag.BoolVar(&options.Machine, "machine", false, "print exactly one summary line per run")
+	flag.DurationVar(&options.MaxDuration, "max-duration", 0, "stop generation after this duration, 0 for no limit")
+	seed := flag.Int64("seed", 0, "override generator.seed")
+	initSchema := flag.Bool("init-schema", false, "create missing tables before inserting, like storage.auto_create")
+	flag.BoolVar(&options.Verify, "verify", false, "read back inserted rows after the run and fail on mismatches")
+	upsert := flag.Bool("upsert", false, "re-emit earlier persons with bumped versions, like generator.upsert.mode: upsert")
+	flag.StringVar(&options.Resume, "resume", "", "continue an interrupted run from this checkpoint")
+	flag.StringVar(&options.ReplayBatch, "replay-batch", "", "regenerate and insert only the failed batch of this record")
+	flag.StringVar(&options.JUnitPath, "junit", "", "write verification and SLO results as JUnit XML to this file")
+	flag.StringVar(&options.Listen, "listen", "", "serve GET /config with effective configuration on this address")
+	flag.BoolVar(&options.AllowConcurrent, "allow-concurrent", false, "write into tables locked by another run")
+	flag.BoolVar(&options.DryRun, "dry-run", false, "connect to nothing and print sample rows as JSON")
+	flag.IntVar(&options.DryRunRows, "dry-run-rows", defaultDryRunRows, "number of control objects printed by -dry-run")
+	flag.StringVar(&options.DryRunPath, "dry-run-out", "", "write -dry-run rows to this file instead of stdout")
+	flag.Float64Var(&options.TargetRowsPerSec, "target-rows-per-sec", 0, "hold this rate of inserted pairs, 0 for no limit")
+	overrides := config.RegisterFlags(flag.CommandLine, Config{})
+	flag.Parse()
+
+	cfg, err := loadCFG(configPath, overrides)
+	if err != nil {
+		return nil, options, err
+	}
+	if *seed != 0 {
+		cfg.GeneratorCFG.Seed = *seed
+	}
+	if *initSchema {
+		cfg.StorageCFG.AutoCreate = true
+	}
+	if *upsert {
+		cfg.GeneratorCFG.Upsert.Mode = writeModeUpsert
+	}
+	return cfg, options, nil
+}
+
+// loadCFG reads the configuration file, if any, and applies overrides from
+// environment variables and then flags.
+func loadCFG(configPath string, overrides *config.Overrides) (*Config, error) {
+	cfg := &Config{}
+	if err := config.Load(configPath, cfg, overrides); err != nil {
+		return nil, err
+	}
+	if err := migrateInsertRetries(&cfg.StorageCFG); err != nil {
+		return nil, errors.Wrap(err, "invalid retries")
+	}
+	return cfg, nil
+}
+
+type controlObject struct {
+	// Special DB fields.
+	id   string
+	dbts *time.Time
+	ts   time.Time
+	// Business-Logic fields.
+	passport   string
+	surname    string
+	name       string
+	patronymic string
+	sex        string
+	birthDate  string
+	phoneNum   string
+	email      string
+	address    string
+	// Optional natural key.
+	naturalKey string
+	// Version of the person, 0 without versions.
+	version uint64
+	// Optional compliance fields.
+	consentStatus  string
+	legalBasis     string
+	retentionClass string
+	// Optional employment fields.
+	organization string
+	occupation   string
+	// Optional Nested attributes.
+	attrKeys   []string
+	attrValues []string
+	// Values of columns added by field expressions.
+	custom []string
+}
+
+var controlObjectsColumns = []string{
+	"id", "ts", "passport",
+	"surname", "name", "patronymic",
+	"sex", "birthdate",
+	"phone_num", "email", "address",
+}
+
+// coordinateColumns locate addresses of control objects.
+var coordinateColumns = []string{"latitude", "longitude"}
+
+func insertQuery(table string, columns []string) string {
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
+		table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+}
+
+type insertOptions struct {
+	settings      []string
+	numericCOBIDs bool
+	numericFFVIDs bool
+	compliance    bool
+	employment    bool
+	naturalKey    bool
+	versioned     bool
+	attributes    *attributesGenerator
+	eventTime     bool
+	cameras       bool
+	variants      *ffvVariants
+	fields        *fieldExpressions
+	// Database names of generated tables and columns.
+	cobTable *tableMapping
+	ffvTable *tableMapping
+	// Locates addresses for coordinate columns, nil without them.
+	geo *datagen.Generator
+	// Issuers of passports for passport columns, nil without them.
+	passports *passportSeries
+}
+
+func (opts insertOptions) controlObjectsColumns() []string {
+	columns := controlObjectsColumns
+	if opts.naturalKey {
+		columns = append(append([]string{}, columns...), naturalKeyColumn)
+	}
+	if opts.versioned {
+		columns = append(append([]string{}, columns...), versionColumn)
+	}
+	if opts.compliance {
+		columns = append(append([]string{}, columns...), complianceColumns...)
+	}
+	if opts.employment {
+		columns = append(append([]string{}, columns...), employmentColumns...)
+	}
+	if opts.geo != nil {
+		columns = append(append([]string{}, columns...), coordinateColumns...)
+	}
+	if opts.passports != nil {
+		columns = append(append([]string{}, columns...), passportColumns...)
+	}
+	if opts.attributes != nil {
+		columns = append(append([]string{}, columns...), opts.attributes.columns()...)
+	}
+	if opts.fields != nil {
+		columns = append(append([]string{}, columns...), opts.fields.custom...)
+	}
+	return columns
+}
+
+func (opts insertOptions) controlObjectRow(cob controlObject) []interface{} {
+	row := []interface{}{
+		idValue(cob.id, opts.numericCOBIDs),
+		cob.ts,
+		cob.passport,
+		cob.surname,
+		cob.name,
+		cob.patronymic,
+		cob.sex,
+		cob.birthDate,
+		cob.phoneNum,
+		cob.email,
+		cob.address,
+	}
+	if opts.naturalKey {
+		row = append(row, cob.naturalKey)
+	}
+	if opts.versioned {
+		row = append(row, cob.version)
+	}
+	if opts.compliance {
+		row = append(row, cob.consentStatus, cob.legalBasis, cob.retentionClass)
+	}
+	if opts.employment {
+		row = append(row, cob.organization, cob.occupation)
+	}
+	// Coordinates follow the final address, e.g. of upserts and
+	// duplicates.
+	if opts.geo != nil {
+		latitude, longitude := opts.geo.Coordinates(cob.address)
+		row = append(row, latitude, longitude)
+	}
+	if opts.passports != nil {
+		issuer := opts.passports.issuer(cob.passport)
+		row = append(row, issuer.region, issuer.office, issuer.officeCode)
+	}
+	if opts.attributes != nil {
+		row = append(row, clickhouse.Array(cob.attrKeys), clickhouse.Array(cob.attrValues))
+	}
+	for _, value := range cob.custom {
+		row = append(row, value)
+	}
+	return row
+}
+
+func (opts insertOptions) ffvsColumns() []string {
+	columns := ffvsColumns
+	if opts.eventTime {
+		columns = append(append([]string{}, columns...), eventTimeColumns...)
+	}
+	if opts.cameras {
+		columns = append(append([]string{}, columns...), cameraIDColumn)
+	}
+	if opts.variants != nil {
+		columns = append(append([]string{}, columns...), opts.variants.columns()...)
+	}
+	return columns
+}
+
+func (opts insertOptions) ffvRow(ffv ffv) []interface{} {
+	row := []interface{}{
+		idValue(ffv.id, opts.numericFFVIDs),
+		idValue(ffv.cobID, opts.numericCOBIDs),
+		clickhouse.UUID(ffv.imgID),
+		clickhouse.Array(ffv.faceBox),
+		clickhouse.Array(ffv.facialFeaturesVector),
+	}
+	if opts.eventTime {
+		row = append(row, ffv.eventTS, ffv.ingestTS)
+	}
+	if opts.cameras {
+		row = append(row, ffv.cameraID)
+	}
+	if opts.variants != nil {
+		row = append(row, opts.variants.values(ffv.facialFeaturesVector)...)
+	}
+	return row
+}
+
+func insertSettingsQueries(cfg StorageCFG) []string {
+	queries := cfg.AsyncInsert.settings()
+	if cfg.InsertQuorum <= 0 {
+		return queries
+	}
+	queries = append(queries, fmt.Sprintf("SET insert_quorum = %d", cfg.InsertQuorum))
+	if cfg.InsertQuorumTimeoutMS > 0 {
+		queries = append(queries, fmt.Sprintf("SET insert_quorum_timeout = %d", cfg.InsertQuorumTimeoutMS))
+	}
+	return queries
+}
+
+func applyInsertSettings(tx *sql.Tx, settings []string) error {
+	for _, setting := range settings {
+		if _, err := tx.Exec(setting); err != nil {
+			return errors.Wrapf(err, "unable to apply \"%s\"", setting)
+		}
+	}
+	return nil
+}
+
+func insertControlObjects(ctx context.Context, db *sql.DB, cobs []controlObject, opts insertOptions, times *batchTimes) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to begin bulk insert")
+	}
+	// No-op after Commit, releases the connection of failed and retried
+	// batches.
+	defer tx.Rollback()
+	if err := applyInsertSettings(tx, opts.settings); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, insertQuery(opts.cobTable.name, opts.cobTable.columns))
+	if err != nil {
+		return errors.Wrap(err, "unable to prepare SQL-statement")
+	}
+	defer stmt.Close()
+
+	serializationStart := time.Now()
+	for i, cob := range cobs {
+		if _, err := stmt.ExecContext(ctx, opts.cobTable.row(opts.controlObjectRow(cob))...); err != nil {
+			return errors.Wrapf(err, "unable to execute %d-th part of bulk insert", i+1)
+		}
+	}
+	times.serialization += time.Now().Sub(serializationStart)
+
+	commitStart := time.Now()
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(&commitError{err}, "unable to commit bulk insert")
+	}
+	times.commit += time.Now().Sub(commitStart)
+
+	return nil
+}
+
+type ffv struct {
+	id                   string
+	cobID                string
+	imgID                string
+	faceBox              []uint64
+	facialFeaturesVector []float64
+	eventTS              time.Time
+	ingestTS             time.Time
+	cameraID             uint32
+}
+
+var ffvsColumns = []string{"id", "cob_id", "img_id", "fb", "ff"}
+
+func insertFFVs(ctx context.Context, db *sql.DB, ffvs []ffv, opts insertOptions, times *batchTimes) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to begin bulk write transaction")
+	}
+	defer tx.Rollback()
+	if err := applyInsertSettings(tx, opts.settings); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, insertQuery(opts.ffvTable.name, opts.ffvTable.columns))
+	if err != nil {
+		return errors.Wrap(err, "unable to prepare InsertFFQuery statemet")
+	}
+	defer stmt.Close()
+	serializationStart := time.Now()
+	for _, ffv := range ffvs {
+		if _, err := stmt.ExecContext(ctx, opts.ffvTable.row(opts.ffvRow(ffv))...); err != nil {
+			return errors.Wrap(err, "unable to execute part of bulk write transaction. Rollbacking")
+		}
+	}
+	times.serialization += time.Now().Sub(serializationStart)
+
+	commitStart := time.Now()
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(&commitError{err}, "unable to commit bulk write transaction. Rollbacking")
+	}
+	times.commit += time.Now().Sub(commitStart)
+
+	return nil
+}
+
+func generatePassport(rnd *rand.Rand) string {
+	passport := ""
+	for i := 0; i < 12; i++ {
+		if (i == 2) || (i == 5) {
+			passport += " "
+		} else {
+			passport += strconv.Itoa(rnd.Int() % 10)
+		}
+	}
+	return passport
+}
+
+// fillPersonalData completes known personal data of cob. Without a
+// generator only known fields are set.
+func fillPersonalData(rnd *rand.Rand, cob *controlObject, g *datagen.Generator, now time.Time, known datagen.Person) {
+	p := known
+	if g != nil {
+		p = g.Complete(rnd, now, known)
+	}
+	for _, field := range []struct {
+		value *string
+		p     string
+	}{
+		{&cob.surname, p.Surname},
+		{&cob.name, p.Name},
+		{&cob.patronymic, p.Patronymic},
+		{&cob.sex, p.Sex},
+		{&cob.birthDate, p.BirthDate},
+		{&cob.phoneNum, p.PhoneNum},
+		{&cob.email, p.Email},
+		{&cob.address, p.Address},
+	} {
+		if field.p != "" {
+			*field.value = field.p
+		}
+	}
+}
+
+func generateFaceBox(rnd *rand.Rand) []uint64 {
+	faceBox := make([]uint64, 4)
+	for i := 0; i < len(faceBox); i++ {
+		faceBox[i] = rnd.Uint64()
+	}
+	return faceBox
+}
+
+func connectClickHouse(cfg StorageCFG, log *logger) (*sql.DB, error) {
+	addr := fmt.Sprintf("%s:%d", cfg.Addr, cfg.Port)
+	if cfg.Proxy.Type != "" {
+		var err error
+		if addr, err = startProxyForwarder(cfg.Proxy, addr, log); err != nil {
+			return nil, errors.Wrap(err, "unable to set up proxy")
+		}
+	}
+
+	if err := cfg.Compression.validate(compressionLZ4); err != nil {
+		return nil, err
+	}
+	if cfg.Compression.enabled() && (cfg.Compression.Level != 0) {
+		return nil, fmt.Errorf("lz4 of the native protocol driver has no levels, unset compression level")
+	}
+	tlsParams, err := registerTLSConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid TLS configuration")
+	}
+	connStr := fmt.Sprintf("tcp://%s?username=%s&password=%s&database=%s&read_timeout=%d&write_timeout=%d&debug=%v&compress=%v",
+		addr,
+		cfg.User,
+		cfg.Passwd,
+		cfg.DefaultDB,
+		cfg.ReadTimeoutMS/1000,
+		cfg.WriteTimeoutMS/1000,
+		cfg.Debug,
+		cfg.Compression.enabled()) + tlsParams
+	db, err := sql.Open("clickhouse", connStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to ClickHouse")
+	}
+	pingTimes := 0
+	for pingTimes = 0; pingTimes < cfg.MaxPings; pingTimes++ {
+		err := db.Ping()
+		if err == nil {
+			break
+		}
+		if exception, ok := err.(*clickhouse.Exception); ok {
+			log.logf("ClickHouse DB exception: [%d] %s \n%s\n", exception.Code, exception.Message, exception.StackTrace)
+		} else {
+			log.logln(errors.Wrapf(err, "unable to ping ClickHouse DB for %d time", pingTimes+1))
+		}
+	}
+	if pingTimes == cfg.MaxPings {
+		db.Close()
+		return nil, fmt.Errorf("unable to ping ClickHouse DB for %d times", cfg.MaxPings)
+	}
+
+	return db, nil
+}
+
+// Main runs the command line of the generator with os.Args.
+func Main() {
+	ctx, cancel := rootContext()
+	defer cancel()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "sample":
+			if err := runSample(ctx, os.Args[2:]); err != nil {
+				fmt.Println(errors.Wrap(err, "unable to sample generated data"))
+				os.Exit(1)
+			}
+			return
+		case "delete":
+			if err := runDelete(ctx, os.Args[2:]); err != nil {
+				fmt.Println(errors.Wrap(err, "unable to run delete workload"))
+				os.Exit(1)
+			}
+			return
+		case "bench":
+			if err := runBench(ctx, os.Args[2:]); err != nil {
+				if _, ok := err.(*sloViolationError); ok {
+					fmt.Println(err)
+					os.Exit(exitSLOViolation)
+				}
+				fmt.Println(errors.Wrap(err, "unable to run ingestion benchmark"))
+				os.Exit(1)
+			}
+			return
+		case "profile":
+			if err := runProfile(ctx, os.Args[2:]); err != nil {
+				fmt.Println(errors.Wrap(err, "unable to profile generated data"))
+				os.Exit(1)
+			}
+			return
+		case "tombstone":
+			if err := runTombstone(ctx, os.Args[2:]); err != nil {
+				fmt.Println(errors.Wrap(err, "unable to run tombstone workload"))
+				os.Exit(1)
+			}
+			return
+		case "bundle":
+			if err := runBundle(ctx, os.Args[2:]); err != nil {
+				fmt.Println(errors.Wrap(err, "unable to bundle run artifacts"))
+				os.Exit(1)
+			}
+			return
+		case "clean":
+			if err := runClean(ctx, os.Args[2:]); err != nil {
+				fmt.Println(errors.Wrap(err, "unable to clean generated tables"))
+				os.Exit(1)
+			}
+			return
+		case "unmask":
+			if err := runUnmask(ctx, os.Args[2:]); err != nil {
+				fmt.Println(errors.Wrap(err, "unable to unmask synthetic identities"))
+				os.Exit(1)
+			}
+			return
+		case "plan":
+			if err := runPlan(ctx, os.Args[2:]); err != nil {
+				fmt.Println(errors.Wrap(err, "unable to run plan"))
+				os.Exit(1)
+			}
+			return
+		case "check-vectors":
+			if err := runCheckVectors(ctx, os.Args[2:]); err != nil {
+				fmt.Println(errors.Wrap(err, "unable to check stored vectors"))
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	startTime := time.Now()
+
+	cfg, options, err := readCFG()
+	if err != nil {
+		fmt.Println(errors.Wrap(err, "unable to read configuration file"))
+		os.Exit(1)
+	}
+	log := &logger{quiet: options.Machine}
+	g := New(cfg)
+	g.Options = options
+	inserted, seed, err := g.run(ctx, startTime)
+	// Signals after the run stop the process.
+	cancel()
+	if path := cfg.GeneratorCFG.SummaryPath; path != "" {
+		summary := runSummary{
+			Status:   "ok",
+			Rows:     inserted,
+			Started:  startTime,
+			Duration: time.Now().Sub(startTime).String(),
+			Seed:     seed,
+		}
+		if violation, ok := err.(*sloViolationError); ok {
+			summary.Status, summary.SLOViolations = "slo_violated", violation.violations
+		} else if _, ok := err.(*verifyError); ok {
+			summary.Status, summary.Error = "verify_failed", err.Error()
+		} else if err != nil {
+			summary.Status, summary.Error = "error", err.Error()
+		}
+		if err := summary.save(path); err != nil {
+			log.logln(err)
+		}
+	}
+	if options.Machine {
+		fmt.Println(machineSummary(err, inserted, time.Now().Sub(startTime), seed))
+	} else if err != nil {
+		fmt.Println(err)
+	}
+	if _, ok := err.(*sloViolationError); ok {
+		os.Exit(exitSLOViolation)
+	}
+	if _, ok := err.(*verifyError); ok {
+		os.Exit(exitVerifyFailed)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// newGeneration validates generator configuration and sets up generators of
+// a run. Labels files and stage metrics are left to the caller. The
+// configuration of the run, g.cfg, is a copy of cfg with n resolved.
+func newGeneration(cfg *Config, seed int64) (*generation, error) {
+	resolved := *cfg
+	cfg = &resolved
+	namespace := uuid.Nil
+	if cfg.GeneratorCFG.UUIDNamespace != "" {
+		var err error
+		if namespace, err = uuid.FromString(cfg.GeneratorCFG.UUIDNamespace); err != nil {
+			return nil, errors.Wrap(err, "unable to parse UUID namespace")
+		}
+	}
+	if err := cfg.GeneratorCFG.IDs.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid IDs configuration")
+	}
+	if (namespace != uuid.Nil) && cfg.GeneratorCFG.IDs.ControlObjects.numeric() {
+		return nil, fmt.Errorf("numeric control object IDs can not be derived from UUID namespace")
+	}
+
+	compliance, err := newComplianceGenerator(cfg.GeneratorCFG.Compliance)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to set up compliance fields")
+	}
+
+	employment, err := newEmploymentGenerator(cfg.GeneratorCFG.Employment)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to set up employment fields")
+	}
+
+	attributes, err := newAttributesGenerator(cfg.GeneratorCFG.Attributes)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to set up attributes")
+	}
+
+	var personal *datagen.Generator
+	if cfg.GeneratorCFG.PersonalData.Locale != "" {
+		personalData := cfg.GeneratorCFG.PersonalData
+		personalData.Seed = seed
+		if personal, err = datagen.New(personalData); err != nil {
+			return nil, errors.Wrap(err, "unable to set up personal data")
+		}
+	}
+	var geo *datagen.Generator
+	if cfg.GeneratorCFG.Coordinates {
+		if personal == nil {
+			return nil, errors.New("coordinates need a locale of personal data")
+		}
+		geo = personal
+	}
+
+	if err := validateSeedOffsets(cfg.GeneratorCFG.SeedOffsets); err != nil {
+		return nil, errors.Wrap(err, "invalid seed offsets")
+	}
+
+	vectors, err := newFFVGenerator(cfg.GeneratorCFG.FFV, cfg.GeneratorCFG.FFVStructure,
+		seededRand(seed, -1, streamFFVs, cfg.GeneratorCFG.SeedOffsets[streamFFVs]))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid FFV configuration")
+	}
+	partitioned, partitionedRows, err := newPartitions(cfg.GeneratorCFG.Partitions)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid partitions")
+	}
+	if len(partitioned) > 0 {
+		if cfg.GeneratorCFG.N == 0 {
+			cfg.GeneratorCFG.N = partitionedRows
+		}
+		switch {
+		case cfg.GeneratorCFG.N != partitionedRows:
+			return nil, fmt.Errorf("partitions hold %d rows, n is %d", partitionedRows, cfg.GeneratorCFG.N)
+		case (cfg.GeneratorCFG.TSRange != TSRangeCFG{}) || (cfg.GeneratorCFG.TSDistribution != ""):
+			return nil, fmt.Errorf("partitions replace ts_range and ts_distribution, set one of them")
+		case cfg.GeneratorCFG.Upsert.upsert():
+			return nil, fmt.Errorf("partitions count rows exactly, upserts would add versions to them")
+		}
+	}
+	identities, err := loadIdentities(cfg.GeneratorCFG.Identities)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid identities")
+	}
+	extra := []string{}
+	if identities != nil {
+		extra = identities.extra
+		if cfg.GeneratorCFG.N == 0 {
+			cfg.GeneratorCFG.N = len(identities.identities)
+		}
+		// Repeated passports would repeat control objects and their IDs.
+		if identities.passports && (cfg.GeneratorCFG.N > len(identities.identities)) {
+			return nil, fmt.Errorf("n %d exceeds %d identities with passports, which can not repeat",
+				cfg.GeneratorCFG.N, len(identities.identities))
+		}
+	}
+	passports, err := loadPassportSeries(cfg.GeneratorCFG.Passports)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid passport series")
+	}
+	fields, err := newFieldExpressions(cfg.GeneratorCFG.Fields, extra)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid field expressions")
+	}
+	rules, err := newConstraints(cfg.GeneratorCFG.Constraints, fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid constraints")
+	}
+	variants, err := newFFVVariants(cfg.GeneratorCFG.FFVVariants, vectors,
+		seededRand(seed, -1, streamFFVVariants, cfg.GeneratorCFG.SeedOffsets[streamFFVs]))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid FFV variants configuration")
+	}
+
+	faceBoxes, err := newFaceBoxGenerator(cfg.GeneratorCFG.FaceBoxes)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid face box configuration")
+	}
+
+	if err := cfg.GeneratorCFG.EventTime.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid event time configuration")
+	}
+	var cameras *cameraClocks
+	if cfg.GeneratorCFG.EventTime.Enabled {
+		sync := time.Now()
+		if cfg.GeneratorCFG.Seed != 0 {
+			sync = deterministicEpoch
+		}
+		cameras = newCameraClocks(cfg.GeneratorCFG.EventTime.Cameras,
+			seededRand(seed, -1, streamEventTime, cfg.GeneratorCFG.SeedOffsets[streamEventTime]), sync)
+	}
+	ts, err := newTimestamps(cfg.GeneratorCFG.TSRange, cfg.GeneratorCFG.TSDistribution, cfg.GeneratorCFG.N,
+		seededRand(seed, -1, streamTS, cfg.GeneratorCFG.SeedOffsets[streamTS]))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ts range")
+	}
+	if err := cfg.GeneratorCFG.Dictionaries.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid dictionaries configuration")
+	}
+	if err := cfg.GeneratorCFG.PlantedPairs.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid planted pairs configuration")
+	}
+	if err := cfg.GeneratorCFG.IdentityEvents.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid identity events configuration")
+	}
+	if err := cfg.GeneratorCFG.Upsert.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid upsert configuration")
+	}
+	if err := cfg.GeneratorCFG.NameVariants.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid name variants configuration")
+	}
+	if err := validateDuplicates(cfg.GeneratorCFG); err != nil {
+		return nil, errors.Wrap(err, "invalid duplicates configuration")
+	}
+	probes, err := newProbeGenerator(cfg.GeneratorCFG.Probes)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid probes configuration")
+	}
+	if err := cfg.GeneratorCFG.FFVPerCOB.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid FFVs per control object")
+	}
+	if err := validateRateLimits(cfg.GeneratorCFG); err != nil {
+		return nil, errors.Wrap(err, "invalid rate limits")
+	}
+	for _, slo := range cfg.GeneratorCFG.SLOs {
+		if err := slo.validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid SLOs")
+		}
+	}
+	if err := cfg.GeneratorCFG.Pseudonyms.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid pseudonyms configuration")
+	}
+	if err := cfg.GeneratorCFG.Enrollment.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid enrollment configuration")
+	}
+	if err := cfg.GeneratorCFG.Replay.validate(cfg.GeneratorCFG.Seed); err != nil {
+		return nil, errors.Wrap(err, "invalid replay configuration")
+	}
+
+	g := &generation{
+		cfg:           cfg,
+		namespace:     namespace,
+		seed:          seed,
+		deterministic: cfg.GeneratorCFG.Seed != 0,
+		opts: insertOptions{
+			settings:      insertSettingsQueries(cfg.StorageCFG),
+			numericCOBIDs: cfg.GeneratorCFG.IDs.ControlObjects.numeric(),
+			numericFFVIDs: cfg.GeneratorCFG.IDs.FFVs.numeric(),
+			compliance:    compliance != nil,
+			employment:    employment != nil,
+			naturalKey:    cfg.GeneratorCFG.NaturalKey,
+			versioned:     cfg.GeneratorCFG.Upsert.versioned(),
+			attributes:    attributes,
+			geo:           geo,
+			passports:     passports,
+			eventTime:     cfg.GeneratorCFG.EventTime.Enabled,
+			cameras:       cameras != nil,
+			variants:      variants,
+			fields:        fields,
+		},
+		personal:     personal,
+		compliance:   compliance,
+		employment:   employment,
+		attributes:   attributes,
+		vectors:      vectors,
+		faceBoxes:    faceBoxes,
+		cameras:      cameras,
+		timestamps:   ts,
+		partitions:   partitioned,
+		probes:       probes,
+		identities:   identities,
+		rules:        rules,
+		slo:          &sloStats{},
+		crashes:      newCrashReports(cfg.GeneratorCFG.CrashReportPath),
+		cobBatchSize: cfg.GeneratorCFG.ControlObjects.batchSize(cfg.GeneratorCFG.InIter),
+		ffvBatchSize: cfg.GeneratorCFG.FFVs.batchSize(cfg.GeneratorCFG.InIter),
+	}
+	burst := cfg.GeneratorCFG.RateLimitBurst
+	if burst == 0 {
+		burst = g.cobBatchSize
+	}
+	g.rateLimit = newRateLimiter(cfg.GeneratorCFG.RateLimitRowsPerSec, burst)
+	if cfg.GeneratorCFG.MaxInflightBatches > 0 {
+		g.inflight = make(chan struct{}, cfg.GeneratorCFG.MaxInflightBatches)
+	}
+	if g.opts.cobTable, err = newTableMapping("control_objects", cfg.StorageCFG.Schema.ControlObjects, g.opts.controlObjectsColumns()); err != nil {
+		return nil, errors.Wrap(err, "invalid schema mapping")
+	}
+	if g.opts.ffvTable, err = newTableMapping("facial_features", cfg.StorageCFG.Schema.FFVs, g.opts.ffvsColumns()); err != nil {
+		return nil, errors.Wrap(err, "invalid schema mapping")
+	}
+	return g, nil
+}
+
+// run runs generation and writes checks of the run as JUnit XML to
+// options.JUnitPath, if any.
+func run(ctx context.Context, cfg *Config, options Options, seed int64, resume *checkpoint, startTime time.Time,
+	log *logger) (int64, error) {
+	junit := newJUnitReport(options.JUnitPath, "generator")
+	inserted, err := runGeneration(ctx, cfg, options, seed, resume, startTime, log, junit)
+	failure := ""
+	switch err.(type) {
+	case nil, *verifyError, *sloViolationError:
+		// Failed checks are cases of their own suites.
+	default:
+		failure = err.Error()
+	}
+	junit.suite("run").add("generation", time.Now().Sub(startTime), fmt.Sprintf("inserted %d pairs", inserted), failure)
+	if saveErr := junit.save(options.JUnitPath); saveErr != nil {
+		log.logln(saveErr)
+	}
+	return inserted, err
+}
+
+func runGeneration(ctx context.Context, cfg *Config, options Options, seed int64, resume *checkpoint,
+	startTime time.Time, log *logger, junit *junitReport) (int64, error) {
+	if cfg.StorageCFG.InsertRetries != 0 {
+		log.logln("storage.insert_retries is deprecated, use storage.retries.transient.max_retries")
+	}
+	if (cfg.GeneratorCFG.RateLimitRowsPerSec > 0) && (options.TargetRowsPerSec > 0) {
+		return 0, fmt.Errorf("generator.rate_limit_rows_per_sec and -target-rows-per-sec both pace inserts, set one of them")
+	}
+	// ClickHouse or PostgreSQL connection, at most one of them.
+	var db, pg *sql.DB
+	var ch *clickHouseHTTP
+	var err error
+	switch cfg.Output {
+	case "", outputClickHouse:
+		switch cfg.StorageCFG.Type {
+		case "", storageClickHouse:
+			switch cfg.StorageCFG.Protocol {
+			case "", protocolNative:
+				if db, err = connectClickHouse(cfg.StorageCFG, log); err != nil {
+					return 0, err
+				}
+				defer db.Close()
+			case protocolHTTP:
+				if checks := nativeOnlyChecks(cfg); len(checks) > 0 {
+					return 0, fmt.Errorf("%s need the native protocol", strings.Join(checks, ", "))
+				}
+				if ch, err = connectClickHouseHTTP(cfg.StorageCFG, log); err != nil {
+					return 0, err
+				}
+			default:
+				return 0, fmt.Errorf("unknown ClickHouse protocol \"%s\"", cfg.StorageCFG.Protocol)
+			}
+		case storagePostgres:
+			if pg, err = connectPostgres(cfg.StorageCFG, log); err != nil {
+				return 0, err
+			}
+			defer pg.Close()
+		default:
+			return 0, fmt.Errorf("unknown storage type \"%s\"", cfg.StorageCFG.Type)
+		}
+	case outputFile:
+		if err := cfg.File.validate(); err != nil {
+			return 0, errors.Wrap(err, "invalid file output configuration")
+		}
+	case outputKafka:
+		if err := cfg.Kafka.validate(); err != nil {
+			return 0, errors.Wrap(err, "invalid Kafka output configuration")
+		}
+	case outputAPI:
+		if err := cfg.API.validate(); err != nil {
+			return 0, errors.Wrap(err, "invalid API output configuration")
+		}
+	default:
+		return 0, fmt.Errorf("unknown output \"%s\"", cfg.Output)
+	}
+
+	g, err := newGeneration(cfg, seed)
+	if err != nil {
+		return 0, err
+	}
+	// n may be taken from identities.
+	cfg = g.cfg
+	var replay *batchRecord
+	if options.ReplayBatch != "" {
+		if replay, err = loadBatchRecord(options.ReplayBatch, g); err != nil {
+			return 0, err
+		}
+		cfg = replay.config(cfg)
+	}
+	// Runs writing the same tables must not change their schema either.
+	if (db != nil) || (ch != nil) {
+		lock, err := acquireRunLock(ctx, db, ch, cfg.StorageCFG, g.opts.tableNames(), options.AllowConcurrent, log)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			if err := lock.release(); err != nil {
+				log.logln(errors.Wrap(err, "unable to release run lock"))
+			}
+		}()
+	}
+	if (db != nil) && cfg.StorageCFG.AutoCreate {
+		if err := createTables(ctx, db, cfg.StorageCFG.Schema, g.opts); err != nil {
+			return 0, err
+		}
+	}
+	if (ch != nil) && cfg.StorageCFG.AutoCreate {
+		if err := ch.createTables(ctx, cfg.StorageCFG.Schema, g.opts); err != nil {
+			return 0, err
+		}
+	}
+	if (pg != nil) && cfg.StorageCFG.AutoCreate {
+		if err := createPostgresTables(ctx, pg, g.opts); err != nil {
+			return 0, err
+		}
+	}
+	if cfg.GeneratorCFG.Dictionaries.Enabled {
+		switch {
+		case db != nil:
+			err = createDictionaries(ctx, cfg, g, func(ctx context.Context, query string) error {
+				_, err := db.ExecContext(ctx, query)
+				return err
+			}, nativeDictionaryInsert(db))
+		case ch != nil:
+			err = createDictionaries(ctx, cfg, g, func(ctx context.Context, query string) error {
+				_, err := ch.Query(ctx, query)
+				return err
+			}, ch.insertDictionary)
+		default:
+			err = fmt.Errorf("dictionaries need ClickHouse storage")
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	// Resumed runs and replays keep offsets of the interrupted run.
+	if (resume == nil) && (replay == nil) {
+		target := db
+		if pg != nil {
+			target = pg
+		}
+		if g.idOffsets, err = resolveIDOffsets(ctx, target, cfg.GeneratorCFG.IDs, g.opts); err != nil {
+			return 0, err
+		}
+		if ch != nil {
+			if err := ch.resolveIDOffsets(ctx, cfg.GeneratorCFG.IDs, g.opts, g.idOffsets); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	var labels *labelsFile
+	if cfg.GeneratorCFG.Outliers.LabelsPath != "" {
+		if labels, err = newLabelsFile(cfg.GeneratorCFG.Outliers.LabelsPath, resume != nil, "ffv_id", "cob_id", "kind"); err != nil {
+			return 0, err
+		}
+	}
+	var pairLabels *labelsFile
+	if cfg.GeneratorCFG.PlantedPairs.LabelsPath != "" {
+		if pairLabels, err = newLabelsFile(cfg.GeneratorCFG.PlantedPairs.LabelsPath, resume != nil,
+			"ffv_id", "partner_ffv_id", "metric", "distance"); err != nil {
+			return 0, err
+		}
+	}
+	var identityEvents *labelsFile
+	if cfg.GeneratorCFG.IdentityEvents.EventsPath != "" {
+		if identityEvents, err = newLabelsFile(cfg.GeneratorCFG.IdentityEvents.EventsPath, resume != nil,
+			"event", "cob_id", "other_id"); err != nil {
+			return 0, err
+		}
+	}
+	var nameVariants *labelsFile
+	if cfg.GeneratorCFG.NameVariants.LabelsPath != "" {
+		if nameVariants, err = newLabelsFile(cfg.GeneratorCFG.NameVariants.LabelsPath, resume != nil,
+			"cob_id", "canonical_cob_id", "kind", "fields"); err != nil {
+			return 0, err
+		}
+	}
+	var duplicates *labelsFile
+	if cfg.GeneratorCFG.DuplicatesLabelsPath != "" {
+		if duplicates, err = newLabelsFile(cfg.GeneratorCFG.DuplicatesLabelsPath, resume != nil,
+			"cob_id", "original_cob_id", "kind", "fields"); err != nil {
+			return 0, err
+		}
+	}
+	var upserts *labelsFile
+	if cfg.GeneratorCFG.Upsert.upsert() && (cfg.GeneratorCFG.Upsert.LabelsPath != "") {
+		if upserts, err = newLabelsFile(cfg.GeneratorCFG.Upsert.LabelsPath, resume != nil,
+			"cob_id", "version", "fields"); err != nil {
+			return 0, err
+		}
+	}
+	var probeLabels *labelsFile
+	if (g.probes != nil) && (cfg.GeneratorCFG.Probes.Path != "") {
+		if probeLabels, err = newLabelsFile(cfg.GeneratorCFG.Probes.Path, resume != nil, probesColumns...); err != nil {
+			return 0, err
+		}
+	}
+	if g.pseudonyms, err = newPseudonymsFile(cfg.GeneratorCFG.Pseudonyms, resume != nil, seed, g.vectors); err != nil {
+		return 0, err
+	}
+	metrics, err := newStageMetrics(cfg.GeneratorCFG.StageMetricsPath)
+	if err != nil {
+		return 0, err
+	}
+	g.labels, g.pairLabels, g.identityEvents, g.probeLabels, g.metrics = labels, pairLabels, identityEvents, probeLabels, metrics
+	if g.spool, err = newSpool(cfg.GeneratorCFG.Spool, log); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := g.spool.remove(); err != nil {
+			log.logln(err)
+		}
+	}()
+	g.log = log
+	g.nameVariants, g.duplicates, g.upserts = nameVariants, duplicates, upserts
+
+	var cobFile, ffvFile *tableFile
+	var producer *kafkaDriver
+	switch {
+	case db != nil:
+		g.useClickHouse(db)
+	case ch != nil:
+		g.useDriver(newClickHouseHTTPDriver(ch, g.opts))
+	case pg != nil:
+		g.useDriver(postgresDriver{db: pg, opts: g.opts})
+	case cfg.Output == outputKafka:
+		if producer, err = newKafkaDriver(cfg.Kafka, g.opts); err != nil {
+			return 0, err
+		}
+		defer func() {
+			if err := producer.close(); err != nil {
+				log.logln(err)
+			}
+		}()
+		g.useDriver(producer)
+	case cfg.Output == outputAPI:
+		g.useDriver(newAPIDriver(cfg.API, g.opts))
+	default:
+		cobTypes, ffvTypes := idColumnTypes(g.opts)
+		// Replays number their files after existing ones like resumed runs.
+		appended := (resume != nil) || (replay != nil)
+		if cobFile, err = newTableFile(cfg.File, g.opts.cobTable, g.opts.controlObjectsColumns(), cobTypes, appended, log); err != nil {
+			return 0, err
+		}
+		if ffvFile, err = newTableFile(cfg.File, g.opts.ffvTable, g.opts.ffvsColumns(), ffvTypes, appended, log); err != nil {
+			return 0, err
+		}
+		g.useFiles(cobFile, ffvFile)
+	}
+
+	var verified *verification
+	if options.Verify {
+		query := uint64Query(nil)
+		switch {
+		case db != nil:
+			query = nativeUint64Query(db)
+		case ch != nil:
+			query = ch.QueryUint64
+		default:
+			return 0, fmt.Errorf("-verify needs ClickHouse storage")
+		}
+		if verified, err = newVerification(ctx, query, g.opts); err != nil {
+			return 0, err
+		}
+	}
+
+	var countsBefore map[string]uint64
+	if (db != nil) && cfg.StorageCFG.AsyncInsert.Enabled && cfg.StorageCFG.AsyncInsert.ConfirmFlush {
+		if countsBefore, err = countGeneratedRows(ctx, db, g.opts); err != nil {
+			return 0, err
+		}
+	}
+
+	var checker *consistencyChecker
+	if db != nil {
+		checker = startConsistencyChecker(ctx, db, cfg.GeneratorCFG.ConsistencyCheck, g.opts.tableNames())
+	}
+
+	ranges := splitRows(cfg.GeneratorCFG.Workers, cfg.GeneratorCFG.N)
+	if resume != nil {
+		ranges = resume.Ranges
+		g.idOffsets = resume.IDOffsets
+		log.logf("resuming from %d inserted pairs\n", resume.Inserted)
+	}
+	if replay != nil {
+		replay.use(g)
+		ranges = replay.ranges()
+		log.logf("replaying %s batch of rows [%d, %d) of worker %d\n", replay.Table, replay.From, replay.Through,
+			replay.Worker+1)
+	}
+	g.throughput = newThroughputController(options.TargetRowsPerSec, cfg.GeneratorCFG.Throughput, &g.inserted, len(ranges))
+	if g.throughput != nil {
+		controlCtx, stopControl := context.WithCancel(ctx)
+		go g.throughput.run(controlCtx)
+		defer func() {
+			stopControl()
+			log.logf("throughput: %v\n", g.throughput)
+		}()
+	}
+	// Enrollment starts with generation, so that its requests never outlive
+	// the run.
+	var enrolled *labelsFile
+	if (cfg.GeneratorCFG.Enrollment.Rate > 0) && (cfg.GeneratorCFG.Enrollment.LabelsPath != "") {
+		if enrolled, err = newLabelsFile(cfg.GeneratorCFG.Enrollment.LabelsPath, resume != nil, enrollmentColumns...); err != nil {
+			return 0, err
+		}
+	}
+	g.enrollment = newEnroller(cfg.GeneratorCFG.Enrollment, enrolled)
+	bytesSent, ranges, err := g.runWorkers(ctx, ranges)
+	if g.spool != nil {
+		log.logf("spool: %v\n", g.spool)
+	}
+	if path := cfg.GeneratorCFG.Checkpoint.Path; path != "" {
+		c := newCheckpoint(seed, ranges, g.idOffsets)
+		if err := c.save(path); err != nil {
+			log.logln(err)
+		} else if !c.done() {
+			log.logf("checkpoint of %d inserted pairs written to %s, continue with -resume %s\n", c.Inserted, path, path)
+		}
+	}
+	if err != nil {
+		if checker != nil {
+			checker.stop()
+		}
+		labels.close()
+		pairLabels.close()
+		identityEvents.close()
+		nameVariants.close()
+		duplicates.close()
+		upserts.close()
+		probeLabels.close()
+		g.pseudonyms.close()
+		g.enrollment.close()
+		enrolled.close()
+		metrics.close()
+		if cobFile != nil {
+			cobFile.close()
+			ffvFile.close()
+		}
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if cobFile != nil {
+		for _, f := range []*tableFile{cobFile, ffvFile} {
+			load, err := f.close()
+			if err != nil {
+				return atomic.LoadInt64(&g.inserted), err
+			}
+			// Named pipes are loaded while rows are written.
+			if !cfg.File.FIFO {
+				log.logf("load %s with:\n%s\n", f.table, load)
+			}
+			log.logf("compression of %s\n", f.compressionReport())
+		}
+	} else if db != nil {
+		log.logf("native protocol compression: %v, in the driver and not measured apart from CPU time of the run\n",
+			cfg.StorageCFG.Compression)
+	} else if (ch != nil) && (ch.compression != nil) {
+		log.logf("HTTP compression: %v\n", ch.compression)
+	}
+	if countsBefore != nil {
+		flushTime, err := confirmAsyncFlush(ctx, db, cfg.StorageCFG.AsyncInsert, g.opts, countsBefore, atomic.LoadInt64(&g.inserted))
+		if err != nil {
+			return atomic.LoadInt64(&g.inserted), errors.Wrap(err, "unable to confirm async inserts flush")
+		}
+		log.logf("async inserts flushed in %v\n", flushTime)
+	}
+	consistencyReport := ""
+	if checker != nil {
+		consistencyReport = checker.stop()
+	}
+
+	if err := labels.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if err := pairLabels.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if err := identityEvents.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if err := nameVariants.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if err := duplicates.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if err := upserts.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if err := probeLabels.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if err := g.pseudonyms.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if g.enrollment != nil {
+		subjects, err := g.enrollment.close()
+		if err != nil {
+			enrolled.close()
+			return atomic.LoadInt64(&g.inserted), errors.Wrap(err, "unable to enroll subjects")
+		}
+		log.logf("enrolled %d subjects into facerecognition\n", subjects)
+	}
+	if err := enrolled.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+	if err := metrics.close(); err != nil {
+		return atomic.LoadInt64(&g.inserted), err
+	}
+
+	destination := "ClickHouse DB"
+	if ch != nil {
+		destination = "ClickHouse DB via HTTP"
+	} else if pg != nil {
+		destination = "PostgreSQL DB"
+	} else if producer != nil {
+		destination = producer.destination()
+	} else if cfg.Output == outputAPI {
+		destination = "nofacedb API at " + cfg.API.BaseURL
+	} else if db == nil {
+		destination = "files in " + cfg.File.Dir
+	}
+	log.logf("inserted %d (%d/%d in req) pairs (ControlObject x FacialFeaturesVector) to %s in %v\n",
+		atomic.LoadInt64(&g.inserted), g.cobBatchSize, g.ffvBatchSize, destination, time.Now().Sub(startTime))
+	if (db != nil) && (cfg.GeneratorCFG.Optimize.Mode != "") {
+		mergeTime, err := optimizeTables(ctx, db, cfg.GeneratorCFG.Optimize, g.opts)
+		if err != nil {
+			return atomic.LoadInt64(&g.inserted), errors.Wrap(err, "unable to optimize generated tables")
+		}
+		log.logf("optimized tables (%s) in %v\n", cfg.GeneratorCFG.Optimize.Mode, mergeTime)
+	}
+	if checker != nil {
+		log.logf("read-while-write consistency: %s\n", consistencyReport)
+	}
+	if (db != nil) && cfg.GeneratorCFG.PartsReport {
+		report, err := partsReport(db, startTime, g.opts)
+		if err != nil {
+			log.logln(errors.Wrap(err, "unable to build parts report"))
+		} else {
+			log.logf("parts report:\n%s\n", report)
+		}
+	}
+	if (db != nil) && cfg.GeneratorCFG.Profile.Enabled {
+		report, err := profileReport(ctx, db, cfg.GeneratorCFG.Profile.TopK, g.opts)
+		if err != nil {
+			log.logln(errors.Wrap(err, "unable to build profile report"))
+		} else {
+			log.logf("profile:\n%s\n", report)
+		}
+	}
+	if (db != nil) && cfg.GeneratorCFG.VectorCheck.Enabled {
+		report, err := checkVectors(ctx, db, cfg, g.opts.ffvTable, "")
+		if err != nil {
+			log.logln(errors.Wrap(err, "unable to check stored vectors"))
+		} else {
+			log.logf("vector check: %v\n", report)
+		}
+	}
+	if verified != nil {
+		expectedPairs := int64(cfg.GeneratorCFG.N)
+		if (resume != nil) || (replay != nil) {
+			expectedPairs = -1
+		}
+		report, err := verified.check(ctx, g, expectedPairs, junit.suite("verify"))
+		if report != nil {
+			log.logf("verification:\n%s\n", strings.Join(report, "\n"))
+		}
+		if err != nil {
+			return atomic.LoadInt64(&g.inserted), err
+		}
+	}
+	usage := readResourceUsage()
+	usage.payloadBytes = bytesSent
+	log.logf("resource usage: %v\n", usage)
+	log.logf("stage breakdown:\n%v\n", metrics)
+	if len(cfg.GeneratorCFG.SLOs) > 0 {
+		report, violations := g.slo.evaluate(cfg.GeneratorCFG.SLOs, atomic.LoadInt64(&g.inserted), time.Now().Sub(startTime),
+			junit.suite("slo"))
+		log.logf("SLOs:\n%s\n", strings.Join(report, "\n"))
+		if len(violations) > 0 {
+			return atomic.LoadInt64(&g.inserted), &sloViolationError{violations: violations}
+		}
+	}
+
+	return atomic.LoadInt64(&g.inserted), nil
+}
@@ -0,0 +1,58 @@
+package generator
+
+import (
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/nofacedb/generator/pkg/datagen"
+)
+
+func BenchmarkGeneratePassport(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		generatePassport(rnd)
+	}
+}
+
+func TestCoordinates(t *testing.T) {
+	cfg, dir := testConfig(t, 200)
+	cfg.GeneratorCFG.Coordinates = true
+	cfg.GeneratorCFG.DuplicateRate = 0.2
+	testRun(t, cfg)
+
+	columns := (insertOptions{geo: &datagen.Generator{}}).controlObjectsColumns()
+	places := map[string]string{}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		if len(row) < len(columns) {
+			t.Fatalf("row %q has no coordinates", row)
+		}
+		latitude, err := strconv.ParseFloat(row[len(controlObjectsColumns)], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		longitude, err := strconv.ParseFloat(row[len(controlObjectsColumns)+1], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Cities of ru_RU.
+		if (latitude < 43) || (latitude > 61) || (longitude < 30) || (longitude > 132) {
+			t.Errorf("%s is at %v, %v", row[10], latitude, longitude)
+		}
+		place := row[len(controlObjectsColumns)] + " " + row[len(controlObjectsColumns)+1]
+		if known, ok := places[row[10]]; ok && (known != place) {
+			t.Errorf("%s is at %s and %s", row[10], known, place)
+		}
+		places[row[10]] = place
+	}
+	if len(places) == 0 {
+		t.Fatal("no control objects are generated")
+	}
+
+	cfg.GeneratorCFG.PersonalData.Locale = ""
+	if _, err := newGeneration(cfg, 1); err == nil {
+		t.Error("coordinates without a locale are accepted")
+	}
+}
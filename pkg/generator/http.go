@@ -0,0 +1,183 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/storage/clickhouse"
+	"github.com/pkg/errors"
+)
+
+// Protocols of ClickHouse storage.
+const (
+	protocolNative = "native"
+	protocolHTTP   = "http"
+)
+
+// clickHouseHTTP sends queries to the ClickHouse HTTP interface.
+type clickHouseHTTP struct {
+	*clickhouse.Client
+	cfg StorageCFG
+	// Compresses insert bodies, nil without storage.compression.
+	compression *compressor
+}
+
+func newClickHouseHTTP(cfg StorageCFG) (*clickHouseHTTP, error) {
+	port := cfg.HTTPPort
+	if port == 0 {
+		port = 8123
+	}
+	tlsConfig, err := cfg.TLS.config(cfg.Addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid TLS configuration")
+	}
+	if err := cfg.Compression.validate(compressionGzip, compressionZstd); err != nil {
+		return nil, err
+	}
+	compression, err := newCompressor(cfg.Compression)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid compression")
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment}
+	if cfg.Proxy.Type != "" {
+		switch cfg.Proxy.Type {
+		case proxyHTTP, proxySOCKS5:
+		default:
+			return nil, fmt.Errorf("unknown proxy type \"%s\"", cfg.Proxy.Type)
+		}
+		// storage.proxy tunnels connections like it does for the native
+		// protocol, instead of proxies of the environment.
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialThroughProxy(cfg.Proxy, addr)
+		}
+	}
+	return &clickHouseHTTP{
+		Client: &clickhouse.Client{
+			Endpoint: fmt.Sprintf("%s://%s:%d/", scheme, cfg.Addr, port),
+			Database: cfg.DefaultDB,
+			User:     cfg.User,
+			Password: cfg.Passwd,
+			HTTP: &http.Client{
+				Timeout:   time.Duration(cfg.WriteTimeoutMS) * time.Millisecond,
+				Transport: transport,
+			},
+		},
+		cfg:         cfg,
+		compression: compression,
+	}, nil
+}
+
+// connectClickHouseHTTP pings the HTTP interface like connectClickHouse
+// pings the native one.
+func connectClickHouseHTTP(cfg StorageCFG, log *logger) (*clickHouseHTTP, error) {
+	c, err := newClickHouseHTTP(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for pingTimes := 0; pingTimes < cfg.MaxPings; pingTimes++ {
+		if _, err = c.Query(context.Background(), "SELECT 1"); err == nil {
+			return c, nil
+		}
+		log.logln(errors.Wrapf(err, "unable to ping ClickHouse DB over HTTP for %d time", pingTimes+1))
+	}
+	return nil, fmt.Errorf("unable to ping ClickHouse DB over HTTP for %d times", cfg.MaxPings)
+}
+
+// nativeOnlyChecks returns configured checks that query the native
+// protocol, which runs over HTTP refuse rather than skip.
+func nativeOnlyChecks(cfg *Config) []string {
+	checks := []string{}
+	if cfg.StorageCFG.AsyncInsert.ConfirmFlush {
+		checks = append(checks, "storage.async_insert.confirm_flush")
+	}
+	if cfg.GeneratorCFG.ConsistencyCheck.Readers > 0 {
+		checks = append(checks, "generator.consistency_check")
+	}
+	if cfg.GeneratorCFG.Optimize.Mode != "" {
+		checks = append(checks, "generator.optimize")
+	}
+	if cfg.GeneratorCFG.PartsReport {
+		checks = append(checks, "generator.parts_report")
+	}
+	if cfg.GeneratorCFG.Profile.Enabled {
+		checks = append(checks, "generator.profile")
+	}
+	if cfg.GeneratorCFG.VectorCheck.Enabled {
+		checks = append(checks, "generator.vector_check")
+	}
+	return checks
+}
+
+// createTables creates generated tables missing in the database.
+func (c *clickHouseHTTP) createTables(ctx context.Context, cfg SchemaCFG, opts insertOptions) error {
+	for i, query := range createTablesQueries(cfg, opts) {
+		if _, err := c.Query(ctx, query); err != nil {
+			return errors.Wrapf(err, "unable to create table %s", opts.table(generatedTables[i]).name)
+		}
+	}
+	return nil
+}
+
+// resolveIDOffsets replaces default offsets of tables with numeric IDs with
+// the next ID after existing rows.
+func (c *clickHouseHTTP) resolveIDOffsets(ctx context.Context, cfg IDsCFG, opts insertOptions, offsets map[string]uint64) error {
+	for table := range offsets {
+		if cfg.table(table).Offset != 0 {
+			continue
+		}
+		query, err := maxIDQuery(opts.table(table))
+		if err != nil {
+			return err
+		}
+		max, err := c.QueryUint64(ctx, query)
+		if err != nil {
+			return errors.Wrapf(err, "unable to query max ID of %s", table)
+		}
+		offsets[table] = max + 1
+	}
+	return nil
+}
+
+// clickHouseHTTPDriver inserts batches over the HTTP interface.
+type clickHouseHTTPDriver struct {
+	insert httpInserter
+	opts   insertOptions
+}
+
+func newClickHouseHTTPDriver(c *clickHouseHTTP, opts insertOptions) clickHouseHTTPDriver {
+	return clickHouseHTTPDriver{insert: newHTTPInserter(c, "JSONEachRow", encodeJSONRows), opts: opts}
+}
+
+func (d clickHouseHTTPDriver) InsertControlObjects(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+	serializationStart := time.Now()
+	rows := make([][]interface{}, len(cobs))
+	for i, cob := range cobs {
+		rows[i] = d.opts.cobTable.row(d.opts.controlObjectRow(cob))
+	}
+	times.serialization += time.Now().Sub(serializationStart)
+	commitStart := time.Now()
+	err := d.insert(ctx, d.opts.cobTable.name, d.opts.cobTable.columns, rows)
+	times.commit += time.Now().Sub(commitStart)
+	return err
+}
+
+func (d clickHouseHTTPDriver) InsertFFVs(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+	serializationStart := time.Now()
+	rows := make([][]interface{}, len(ffvs))
+	for i, fv := range ffvs {
+		rows[i] = d.opts.ffvTable.row(d.opts.ffvRow(fv))
+	}
+	times.serialization += time.Now().Sub(serializationStart)
+	commitStart := time.Now()
+	err := d.insert(ctx, d.opts.ffvTable.name, d.opts.ffvTable.columns, rows)
+	times.commit += time.Now().Sub(commitStart)
+	return err
+}
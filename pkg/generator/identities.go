@@ -0,0 +1,252 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/datagen"
+	"github.com/pkg/errors"
+)
+
+// Formats of identity lists.
+const (
+	identitiesCSV  = "csv"
+	identitiesJSON = "json"
+)
+
+// IdentitiesCFG configures a list of partial identities, e.g. surnames and
+// regions provided by a customer. Row i of a run completes identity i,
+// cycling through the list when n is larger, and n defaults to its length.
+type IdentitiesCFG struct {
+	Path string `yaml:"path"`
+	// csv with a header row, or json with an array or lines of objects. By
+	// extension of path when empty.
+	Format string `yaml:"format"`
+}
+
+// Columns of control objects an identity list may provide, other columns
+// are added as String columns.
+var identityColumns = map[string]bool{
+	"passport": true, "surname": true, "name": true, "patronymic": true, "sex": true,
+	"birthdate": true, "phone_num": true, "email": true, "address": true,
+}
+
+// identitySexes maps values of the sex column to datagen sexes.
+var identitySexes = map[string]string{
+	"M": datagen.SexMale, "MALE": datagen.SexMale, "MAN": datagen.SexMale,
+	"М": datagen.SexMale, "МУЖ": datagen.SexMale, "МУЖСКОЙ": datagen.SexMale,
+	"F": datagen.SexFemale, "FEMALE": datagen.SexFemale, "WOMAN": datagen.SexFemale,
+	"Ж": datagen.SexFemale, "ЖЕН": datagen.SexFemale, "ЖЕНСКИЙ": datagen.SexFemale,
+}
+
+// listedIdentity holds known values of one identity, empty when missing.
+type listedIdentity struct {
+	passport string
+	person   datagen.Person
+	// Values of extra columns of the list.
+	extra []string
+}
+
+func (id *listedIdentity) known() datagen.Person {
+	if id == nil {
+		return datagen.Person{}
+	}
+	return id.person
+}
+
+func (id *listedIdentity) extras() []string {
+	if id == nil {
+		return nil
+	}
+	return id.extra
+}
+
+// identityList is a loaded list of identities.
+type identityList struct {
+	// Columns that are not generated, in the order of the list.
+	extra      []string
+	identities []listedIdentity
+	// Whether identities provide passports, which can not repeat.
+	passports bool
+}
+
+func loadIdentities(cfg IdentitiesCFG) (*identityList, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	format := cfg.Format
+	if format == "" {
+		format = identitiesCSV
+		switch strings.ToLower(filepath.Ext(cfg.Path)) {
+		case ".json", ".jsonl", ".ndjson":
+			format = identitiesJSON
+		}
+	}
+	data, err := ioutil.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read identities")
+	}
+	var columns []string
+	var records [][]string
+	switch format {
+	case identitiesCSV:
+		columns, records, err = readIdentitiesCSV(data)
+	case identitiesJSON:
+		columns, records, err = readIdentitiesJSON(data)
+	default:
+		return nil, fmt.Errorf("unknown format \"%s\", supported are %s, %s", format, identitiesCSV, identitiesJSON)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no identities in %s", cfg.Path)
+	}
+
+	l := &identityList{identities: make([]listedIdentity, len(records))}
+	seen := map[string]bool{}
+	for _, column := range columns {
+		if seen[column] {
+			return nil, fmt.Errorf("duplicate column %s", column)
+		}
+		seen[column] = true
+		if identityColumns[column] {
+			continue
+		}
+		if _, ok := columnTypes[column]; ok {
+			return nil, fmt.Errorf("column %s can not be provided by identities", column)
+		}
+		l.extra = append(l.extra, column)
+	}
+	// Rows of passports, which must be unique like IDs derived from them.
+	passports := map[string]int{}
+	for i, record := range records {
+		id := &l.identities[i]
+		for j, column := range columns {
+			value := strings.TrimSpace(record[j])
+			switch column {
+			case "passport":
+				if first, ok := passports[value]; ok && (value != "") {
+					return nil, fmt.Errorf("identities %d and %d share passport %s", first, i+1, value)
+				}
+				passports[value] = i + 1
+				id.passport = value
+				l.passports = l.passports || (value != "")
+			case "surname":
+				id.person.Surname = value
+			case "name":
+				id.person.Name = value
+			case "patronymic":
+				id.person.Patronymic = value
+			case "sex":
+				sex, ok := identitySexes[strings.ToUpper(value)]
+				if !ok && (value != "") {
+					return nil, fmt.Errorf("identity %d has unknown sex \"%s\", expected M or F", i+1, value)
+				}
+				id.person.Sex = sex
+			case "birthdate":
+				if _, err := time.Parse("2006-01-02", value); (err != nil) && (value != "") {
+					return nil, fmt.Errorf("identity %d has invalid birthdate \"%s\", expected YYYY-MM-DD", i+1, value)
+				}
+				id.person.BirthDate = value
+			case "phone_num":
+				id.person.PhoneNum = value
+			case "email":
+				id.person.Email = value
+			case "address":
+				id.person.Address = value
+			default:
+				id.extra = append(id.extra, value)
+			}
+		}
+	}
+	return l, nil
+}
+
+func readIdentitiesCSV(data []byte) ([]string, [][]string, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to parse identities CSV")
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("identities CSV has no header")
+	}
+	columns := records[0]
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	return columns, records[1:], nil
+}
+
+// readIdentitiesJSON reads an array of objects or one object per line.
+// Columns are keys of all objects in the order of their first appearance,
+// missing keys and nulls are empty.
+func readIdentitiesJSON(data []byte) ([]string, [][]string, error) {
+	objects := []map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Numbers keep their text, e.g. long passport numbers.
+	dec.UseNumber()
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := dec.Decode(&objects); err != nil {
+			return nil, nil, errors.Wrap(err, "unable to parse identities JSON")
+		}
+	} else {
+		for {
+			object := map[string]interface{}{}
+			if err := dec.Decode(&object); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, nil, errors.Wrapf(err, "unable to parse identity %d", len(objects)+1)
+			}
+			objects = append(objects, object)
+		}
+	}
+	columns := []string{}
+	index := map[string]int{}
+	for _, object := range objects {
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			if _, ok := index[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		// Keys of one object have no order, new ones are sorted.
+		sort.Strings(keys)
+		for _, key := range keys {
+			index[key] = len(columns)
+			columns = append(columns, key)
+		}
+	}
+	records := make([][]string, len(objects))
+	for i, object := range objects {
+		records[i] = make([]string, len(columns))
+		for key, value := range object {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				records[i][index[key]] = v
+			default:
+				records[i][index[key]] = fmt.Sprint(v)
+			}
+		}
+	}
+	return columns, records, nil
+}
+
+// at returns the identity of row i, nil without a list. Rows cycle through
+// the list, which newGeneration rejects for lists with passports.
+func (l *identityList) at(i int) *listedIdentity {
+	if l == nil {
+		return nil
+	}
+	return &l.identities[i%len(l.identities)]
+}
@@ -0,0 +1,33 @@
+package generator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestIdentitiesSetN(t *testing.T) {
+	cfg, dir := testConfig(t, 0)
+	cfg.GeneratorCFG.InIter = 10
+	cfg.GeneratorCFG.Identities.Path = filepath.Join(dir, "identities.csv")
+	list := "passport,surname\n4501 000001,Ivanov\n4501 000002,Petrova\n4501 000003,Sidorov\n"
+	if err := ioutil.WriteFile(cfg.GeneratorCFG.Identities.Path, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if inserted := testRun(t, cfg); inserted != 3 {
+		t.Errorf("%d control objects are inserted, expected one per identity", inserted)
+	}
+	if cfg.GeneratorCFG.N != 0 {
+		t.Errorf("n of the configuration is changed to %d", cfg.GeneratorCFG.N)
+	}
+	rows := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+	if len(rows) != 3 {
+		t.Fatalf("%d control objects are written, expected 3", len(rows))
+	}
+
+	// Passports can not repeat beyond the list.
+	cfg.GeneratorCFG.N = 4
+	if _, err := newGeneration(cfg, 1); err == nil {
+		t.Error("n exceeding identities with passports is accepted")
+	}
+}
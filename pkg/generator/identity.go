@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	identityMerge = "merge"
+	identitySplit = "split"
+)
+
+// IdentityEventsCFG configures labelled identity-resolution scenarios. A
+// merge gives a control object an FFV of the previous control object's
+// person, so both turn out to be the same subject. A split adds a capture
+// of another person to a control object.
+type IdentityEventsCFG struct {
+	MergeRate float64 `yaml:"merge_rate"`
+	SplitRate float64 `yaml:"split_rate"`
+	// Cosine distance between captures of the same person.
+	SamePersonDistance float64 `yaml:"same_person_distance"`
+	EventsPath         string  `yaml:"events_path"`
+}
+
+func (cfg IdentityEventsCFG) validate() error {
+	if (cfg.MergeRate < 0) || (cfg.SplitRate < 0) || (cfg.MergeRate+cfg.SplitRate > 1) {
+		return fmt.Errorf("merge and split rates must be non-negative and sum up to at most 1")
+	}
+	if (cfg.SamePersonDistance < 0) || (cfg.SamePersonDistance > 2) {
+		return fmt.Errorf("cosine distance %v is out of [0, 2]", cfg.SamePersonDistance)
+	}
+	return nil
+}
+
+func (cfg IdentityEventsCFG) pickEvent(rnd *rand.Rand) string {
+	p := rnd.Float64()
+	switch {
+	case p < cfg.MergeRate:
+		return identityMerge
+	case p < cfg.MergeRate+cfg.SplitRate:
+		return identitySplit
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// TestIdentityEvents checks that merged control objects share a person and
+// split ones hold a capture of another person, as their events label.
+func TestIdentityEvents(t *testing.T) {
+	cfg, dir := testConfig(t, 500)
+	cfg.GeneratorCFG.IdentityEvents = IdentityEventsCFG{
+		MergeRate: 0.1, SplitRate: 0.1, SamePersonDistance: 0.05, EventsPath: filepath.Join(dir, "events.tsv"),
+	}
+	testRun(t, cfg)
+
+	vectors := map[string][][]float64{}
+	cobIDs := map[string]string{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		vectors[row[1]] = append(vectors[row[1]], parseTSVVector(t, row[4]))
+		cobIDs[row[0]] = row[1]
+	}
+	events := map[string]int{}
+	for _, event := range readLabels(t, cfg.GeneratorCFG.IdentityEvents.EventsPath) {
+		events[event[0]]++
+		switch event[0] {
+		case identityMerge:
+			same := false
+			for _, a := range vectors[event[1]] {
+				for _, b := range vectors[event[2]] {
+					same = same || (math.Abs(cosineDistance(a, b)-0.05) < 1e-6)
+				}
+			}
+			if !same {
+				t.Errorf("merged control objects %s and %s have no captures of the same person", event[1], event[2])
+			}
+		case identitySplit:
+			if cobIDs[event[2]] != event[1] {
+				t.Errorf("split capture %s does not belong to control object %s", event[2], event[1])
+			}
+			if len(vectors[event[1]]) != 2 {
+				t.Errorf("split control object %s has %d captures", event[1], len(vectors[event[1]]))
+			}
+		default:
+			t.Errorf("unknown identity event %q", event)
+		}
+	}
+	for _, event := range []string{identityMerge, identitySplit} {
+		if (events[event] < 25) || (events[event] > 75) {
+			t.Errorf("%d %s events in 500 rows, expected about 50", events[event], event)
+		}
+	}
+
+	for _, cfg := range []IdentityEventsCFG{{MergeRate: 0.6, SplitRate: 0.6}, {SamePersonDistance: 3}} {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("identity events %+v are accepted", cfg)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/kshvakov/clickhouse"
+	"github.com/pkg/errors"
+)
+
+const (
+	idUUID    = "uuid"
+	idNumeric = "numeric"
+)
+
+// IDsCFG selects UUID or numeric IDs per table, for legacy schemas with
+// UInt64 keys. cob_id of facial features follows control objects.
+type IDsCFG struct {
+	ControlObjects IDCFG `yaml:"control_objects"`
+	FFVs           IDCFG `yaml:"facial_features"`
+}
+
+// IDCFG configures IDs of a table.
+type IDCFG struct {
+	// uuid (default) or numeric, an offset plus a counter.
+	Type string `yaml:"type"`
+	// First numeric ID of the run, 0 continues after max(id) of the table,
+	// or starts from 1 with file output.
+	Offset uint64 `yaml:"offset"`
+}
+
+func (cfg IDCFG) numeric() bool {
+	return cfg.Type == idNumeric
+}
+
+func (cfg IDsCFG) validate() error {
+	for _, c := range []IDCFG{cfg.ControlObjects, cfg.FFVs} {
+		switch c.Type {
+		case "", idUUID, idNumeric:
+		default:
+			return fmt.Errorf("unknown ID type \"%s\"", c.Type)
+		}
+	}
+	return nil
+}
+
+func (cfg IDsCFG) table(table string) IDCFG {
+	if table == "control_objects" {
+		return cfg.ControlObjects
+	}
+	return cfg.FFVs
+}
+
+// maxIDQuery returns the query of the largest ID of a generated table.
+func maxIDQuery(m *tableMapping) (string, error) {
+	id := m.column("id")
+	if id == "" {
+		return "", fmt.Errorf("offset of numeric IDs of %s must be set when its id column is omitted", m.name)
+	}
+	return fmt.Sprintf("SELECT coalesce(max(%s), 0) FROM %s", id, m.name), nil
+}
+
+// resolveIDOffsets returns first numeric IDs of tables with numeric IDs.
+func resolveIDOffsets(ctx context.Context, db *sql.DB, cfg IDsCFG, opts insertOptions) (map[string]uint64, error) {
+	offsets := map[string]uint64{}
+	for _, table := range generatedTables {
+		c := cfg.table(table)
+		switch {
+		case !c.numeric():
+			continue
+		case c.Offset != 0:
+			offsets[table] = c.Offset
+		case db == nil:
+			offsets[table] = 1
+		default:
+			query, err := maxIDQuery(opts.table(table))
+			if err != nil {
+				return nil, err
+			}
+			var max uint64
+			if err := db.QueryRowContext(ctx, query).Scan(&max); err != nil {
+				return nil, errors.Wrapf(err, "unable to query max ID of %s", table)
+			}
+			offsets[table] = max + 1
+		}
+	}
+	return offsets, nil
+}
+
+// splitSighting is the index of the foreign FFV of identity splits.
+const splitSighting = -1
+
+// ffvID returns the ID of the j-th FFV of the i-th control object. Numeric
+// IDs leave room for every sighting and the split FFV of each control
+// object.
+func (g *generation) ffvID(i, j int) string {
+	if offset, ok := g.idOffsets["facial_features"]; ok {
+		stride := g.cfg.GeneratorCFG.FFVPerCOB.Max + 1
+		if stride < 2 {
+			stride = 2
+		}
+		if j == splitSighting {
+			j = stride - 1
+		}
+		return strconv.FormatUint(offset+uint64(i*stride+j), 10)
+	}
+	switch j {
+	case 0:
+		return g.newID("facial_features", i)
+	case splitSighting:
+		return g.newID("facial_features_split", i)
+	}
+	return g.newID(fmt.Sprintf("facial_features_%d", j), i)
+}
+
+// idValue converts an ID to its column value.
+func idValue(id string, numeric bool) interface{} {
+	if numeric {
+		n, _ := strconv.ParseUint(id, 10, 64)
+		return n
+	}
+	return clickhouse.UUID(id)
+}
@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kshvakov/clickhouse"
+)
+
+// TestNumericIDs checks that tables with numeric IDs get an offset plus a
+// counter, room left for every FFV of a control object.
+func TestNumericIDs(t *testing.T) {
+	cfg, dir := testConfig(t, 50)
+	cfg.GeneratorCFG.FFVPerCOB = CountCFG{Min: 1, Max: 2}
+	cfg.GeneratorCFG.IDs = IDsCFG{
+		ControlObjects: IDCFG{Type: idNumeric, Offset: 1000},
+		FFVs:           IDCFG{Type: idNumeric},
+	}
+	testRun(t, cfg)
+	for i, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		if row[0] != strconv.Itoa(1000+i) {
+			t.Errorf("control object %d has ID %s, expected %d", i, row[0], 1000+i)
+		}
+	}
+	ids := map[string]bool{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		id, err := strconv.ParseUint(row[0], 10, 64)
+		if err != nil {
+			t.Fatalf("FFV ID %s is not numeric", row[0])
+		}
+		cobID, err := strconv.ParseUint(row[1], 10, 64)
+		if err != nil {
+			t.Fatalf("cob_id %s is not numeric", row[1])
+		}
+		// File output starts from 1, every control object takes max + 1 IDs.
+		if (id-1)/3 != cobID-1000 {
+			t.Errorf("FFV %d of control object %d is out of its IDs", id, cobID)
+		}
+		if ids[row[0]] {
+			t.Errorf("FFV ID %s is not unique", row[0])
+		}
+		ids[row[0]] = true
+	}
+
+	if v := idValue("42", true); v != uint64(42) {
+		t.Errorf("numeric ID value is %#v", v)
+	}
+	if v := idValue("00000000-0000-0000-0000-000000000001", false); v != clickhouse.UUID("00000000-0000-0000-0000-000000000001") {
+		t.Errorf("UUID value is %#v", v)
+	}
+	if err := (IDsCFG{FFVs: IDCFG{Type: "serial"}}).validate(); err == nil {
+		t.Error("unknown ID type is accepted")
+	}
+}
+
+func TestResolveIDOffsets(t *testing.T) {
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	server.answer = func(query string) (nativeResult, error) {
+		if query != "SELECT coalesce(max(id), 0) FROM control_objects" {
+			return nativeResult{}, fmt.Errorf("unexpected query %s", query)
+		}
+		return nativeResult{names: []string{"max"}, types: []string{"UInt64"}, rows: [][]interface{}{{uint64(41)}}}, nil
+	}
+	db := server.connect(t)
+	opts := testInsertOptions(t, SchemaCFG{})
+	cfg := IDsCFG{ControlObjects: IDCFG{Type: idNumeric}, FFVs: IDCFG{Type: idNumeric, Offset: 7}}
+	offsets, err := resolveIDOffsets(context.Background(), db, cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(offsets) != 2) || (offsets["control_objects"] != 42) || (offsets["facial_features"] != 7) {
+		t.Errorf("offsets are %v, expected 42 after max(id) and the configured 7", offsets)
+	}
+	if offsets, err = resolveIDOffsets(context.Background(), nil, cfg, opts); (err != nil) ||
+		(offsets["control_objects"] != 1) {
+		t.Errorf("offsets without a database are %v, %v", offsets, err)
+	}
+	if offsets, err = resolveIDOffsets(context.Background(), db, IDsCFG{}, opts); (err != nil) || (len(offsets) != 0) {
+		t.Errorf("offsets of UUIDs are %v, %v", offsets, err)
+	}
+
+	opts = testInsertOptions(t, SchemaCFG{ControlObjects: TableSchemaCFG{Columns: map[string]string{"id": omittedColumn}}})
+	_, err = resolveIDOffsets(context.Background(), db, cfg, opts)
+	if (err == nil) || !strings.Contains(err.Error(), "id column is omitted") {
+		t.Errorf("offset of an omitted id column returns %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// junitReport collects checks of a run or a benchmark as JUnit XML test
+// suites, so that CI systems gate merges on them natively. Methods are
+// no-ops on nil junitReport and junitSuite.
+type junitReport struct {
+	XMLName  xml.Name      `xml:"testsuites"`
+	Name     string        `xml:"name,attr"`
+	Tests    int           `xml:"tests,attr"`
+	Failures int           `xml:"failures,attr"`
+	Suites   []*junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+	elapsed  time.Duration
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	Output    string        `xml:"system-out,omitempty"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// newJUnitReport returns a report named name, nil without path.
+func newJUnitReport(path, name string) *junitReport {
+	if path == "" {
+		return nil
+	}
+	return &junitReport{Name: name}
+}
+
+// suite returns the suite named name, added on first use.
+func (r *junitReport) suite(name string) *junitSuite {
+	if r == nil {
+		return nil
+	}
+	for _, s := range r.Suites {
+		if s.Name == name {
+			return s
+		}
+	}
+	s := &junitSuite{Name: name}
+	r.Suites = append(r.Suites, s)
+	return s
+}
+
+// add adds a check that took elapsed with output, failed when failure is
+// not empty.
+func (s *junitSuite) add(name string, elapsed time.Duration, output, failure string) {
+	if s == nil {
+		return
+	}
+	c := junitCase{Name: name, ClassName: s.Name, Time: junitSeconds(elapsed), Output: output}
+	if failure != "" {
+		c.Failure = &junitFailure{Message: failure, Text: failure}
+		s.Failures++
+	}
+	s.Cases = append(s.Cases, c)
+	s.Tests++
+	s.elapsed += elapsed
+}
+
+// skip adds a check that did not run.
+func (s *junitSuite) skip(name, message string) {
+	if s == nil {
+		return
+	}
+	s.Cases = append(s.Cases, junitCase{Name: name, ClassName: s.Name, Time: junitSeconds(0),
+		Skipped: &junitSkipped{Message: message}})
+	s.Tests++
+	s.Skipped++
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// save writes the report to path.
+func (r *junitReport) save(path string) error {
+	if r == nil {
+		return nil
+	}
+	r.Tests, r.Failures = 0, 0
+	for _, s := range r.Suites {
+		s.Time = junitSeconds(s.elapsed)
+		r.Tests += s.Tests
+		r.Failures += s.Failures
+	}
+	data, err := xml.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to encode JUnit report")
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	return errors.Wrap(ioutil.WriteFile(path, data, 0644), "unable to write JUnit report")
+}
@@ -0,0 +1,69 @@
+package generator
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJUnitReport(t *testing.T) {
+	cfg, dir := testConfig(t, 20)
+	cfg.GeneratorCFG.SLOs = []SLOCFG{
+		{Metric: "batch_insert_p99_ms", Threshold: 60000},
+		{Metric: sloRowsPerSec, Threshold: 1e12},
+	}
+	path := filepath.Join(dir, "junit.xml")
+	_, err := run(context.Background(), cfg, Options{JUnitPath: path}, cfg.GeneratorCFG.Seed, nil, time.Now(),
+		&logger{quiet: true})
+	if _, ok := err.(*sloViolationError); !ok {
+		t.Fatalf("run violating an SLO returned %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := junitReport{}
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if (report.Tests != 3) || (report.Failures != 1) || (len(report.Suites) != 2) {
+		t.Fatalf("report has %d tests, %d failures and %d suites", report.Tests, report.Failures, len(report.Suites))
+	}
+	slo, generation := report.Suites[0], report.Suites[1]
+	if (slo.Name != "slo") || (len(slo.Cases) != 2) || (slo.Cases[0].Failure != nil) || (slo.Cases[1].Failure == nil) ||
+		(slo.Cases[1].Name != sloRowsPerSec) {
+		t.Fatalf("SLO suite %+v", slo)
+	}
+	if (generation.Name != "run") || (len(generation.Cases) != 1) || (generation.Cases[0].Failure != nil) ||
+		(generation.Cases[0].Output != "inserted 20 pairs") {
+		t.Fatalf("run suite %+v", generation)
+	}
+
+	// Runs failing for other reasons fail the generation case.
+	cfg, dir = testConfig(t, 20)
+	cfg.File.Dir = filepath.Join(dir, "missing", "\x00")
+	path = filepath.Join(dir, "junit.xml")
+	if _, err := run(context.Background(), cfg, Options{JUnitPath: path}, cfg.GeneratorCFG.Seed, nil, time.Now(),
+		&logger{quiet: true}); err == nil {
+		t.Fatal("run into an invalid directory succeeded")
+	}
+	if data, err = ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	report = junitReport{}
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if (report.Failures != 1) || (report.Suites[0].Cases[0].Failure == nil) {
+		t.Fatalf("failed run is reported as %+v", report.Suites[0])
+	}
+
+	var none *junitReport
+	none.suite("run").add("generation", time.Second, "", "failed")
+	if err := none.save(""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"fmt"
+)
+
+const (
+	kafkaKeyCOBID = "cob_id"
+	kafkaKeyNone  = "none"
+)
+
+const (
+	kafkaFormatJSON    = "json"
+	kafkaFormatMsgPack = "msgpack"
+)
+
+// KafkaCFG configures producing generated rows as JSON or MessagePack
+// messages, one per row, with mapped column names as keys.
+type KafkaCFG struct {
+	Brokers []string       `yaml:"brokers"`
+	Topics  KafkaTopicsCFG `yaml:"topics"`
+	// cob_id (default) keys messages of both tables by control object, so a
+	// person's rows share a partition. none spreads messages round-robin.
+	Key string `yaml:"key"`
+	// Messages per produce request, 100 by default.
+	BatchSize int `yaml:"batch_size"`
+	// none, leader (default) or all.
+	Acks string `yaml:"acks"`
+	// Compression of batches by the producer, none (default), gzip, snappy,
+	// lz4 or zstd at their default levels.
+	Compression string `yaml:"compression"`
+	// json (default) or msgpack for MessagePack maps, with DateTime
+	// columns as Unix seconds.
+	Format string `yaml:"format"`
+}
+
+// KafkaTopicsCFG are topics messages of tables are produced to.
+type KafkaTopicsCFG struct {
+	// Mapped table names by default.
+	ControlObjects string `yaml:"control_objects"`
+	FFVs           string `yaml:"facial_features"`
+}
+
+func (cfg KafkaCFG) validate() error {
+	if !kafkaSupported {
+		return fmt.Errorf("generator is built without Kafka support, rebuild it with -tags kafka")
+	}
+	if len(cfg.Brokers) == 0 {
+		return fmt.Errorf("no brokers")
+	}
+	switch cfg.Key {
+	case "", kafkaKeyCOBID, kafkaKeyNone:
+	default:
+		return fmt.Errorf("unknown message key \"%s\"", cfg.Key)
+	}
+	switch cfg.Acks {
+	case "", "none", "leader", "all":
+	default:
+		return fmt.Errorf("unknown acks level \"%s\"", cfg.Acks)
+	}
+	switch cfg.Compression {
+	case "", compressionNone, compressionGzip, compressionSnappy, compressionLZ4, compressionZstd:
+	default:
+		return fmt.Errorf("unknown compression \"%s\"", cfg.Compression)
+	}
+	switch cfg.Format {
+	case "", kafkaFormatJSON, kafkaFormatMsgPack:
+	default:
+		return fmt.Errorf("unknown message format \"%s\"", cfg.Format)
+	}
+	return nil
+}
+
+// topic returns the topic of generated table, named name in the schema
+// mapping.
+func (cfg KafkaCFG) topic(table, name string) string {
+	topic := cfg.Topics.ControlObjects
+	if table == "facial_features" {
+		topic = cfg.Topics.FFVs
+	}
+	if topic == "" {
+		return name
+	}
+	return topic
+}
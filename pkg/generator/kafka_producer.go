@@ -0,0 +1,134 @@
+//go:build kafka
+// +build kafka
+
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const kafkaSupported = true
+
+var kafkaAcks = map[string]kafka.RequiredAcks{
+	"":       kafka.RequireOne,
+	"none":   kafka.RequireNone,
+	"leader": kafka.RequireOne,
+	"all":    kafka.RequireAll,
+}
+
+var kafkaCompression = map[string]kafka.Compression{
+	compressionGzip:   kafka.Gzip,
+	compressionSnappy: kafka.Snappy,
+	compressionLZ4:    kafka.Lz4,
+	compressionZstd:   kafka.Zstd,
+}
+
+// kafkaDriver produces batches to Kafka topics.
+type kafkaDriver struct {
+	cfg    KafkaCFG
+	opts   insertOptions
+	writer *kafka.Writer
+}
+
+func newKafkaDriver(cfg KafkaCFG, opts insertOptions) (*kafkaDriver, error) {
+	var balancer kafka.Balancer = &kafka.Hash{}
+	if cfg.Key == kafkaKeyNone {
+		balancer = &kafka.RoundRobin{}
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &kafkaDriver{
+		cfg:  cfg,
+		opts: opts,
+		writer: &kafka.Writer{
+			Addr:      kafka.TCP(cfg.Brokers...),
+			Balancer:  balancer,
+			BatchSize: batchSize,
+			// Writes are synchronous, so a partial batch should not wait
+			// for more messages.
+			BatchTimeout: 10 * time.Millisecond,
+			RequiredAcks: kafkaAcks[cfg.Acks],
+			Compression:  kafkaCompression[cfg.Compression],
+		},
+	}, nil
+}
+
+func (d *kafkaDriver) InsertControlObjects(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+	rows, keys := make([][]interface{}, len(cobs)), make([]string, len(cobs))
+	for i, cob := range cobs {
+		rows[i], keys[i] = d.opts.cobTable.row(d.opts.controlObjectRow(cob)), cob.id
+	}
+	return d.produce(ctx, "control_objects", d.opts.cobTable, rows, keys, times)
+}
+
+func (d *kafkaDriver) InsertFFVs(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+	rows, keys := make([][]interface{}, len(ffvs)), make([]string, len(ffvs))
+	for i, fv := range ffvs {
+		rows[i], keys[i] = d.opts.ffvTable.row(d.opts.ffvRow(fv)), fv.cobID
+	}
+	return d.produce(ctx, "facial_features", d.opts.ffvTable, rows, keys, times)
+}
+
+// messages encodes rows of table, mapped by m, as messages keyed by keys.
+func (d *kafkaDriver) messages(table string, m *tableMapping, rows [][]interface{}, keys []string) ([]kafka.Message, error) {
+	topic := d.cfg.topic(table, m.name)
+	messages := make([]kafka.Message, len(rows))
+	for i, row := range rows {
+		var value []byte
+		var err error
+		if d.cfg.Format == kafkaFormatMsgPack {
+			value, err = appendMsgPackMap(nil, m.columns, row)
+		} else {
+			value, err = json.Marshal(jsonRow(m.columns, row))
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to encode message")
+		}
+		messages[i] = kafka.Message{Topic: topic, Value: value}
+		if d.cfg.Key != kafkaKeyNone {
+			messages[i].Key = []byte(keys[i])
+		}
+	}
+	return messages, nil
+}
+
+func (d *kafkaDriver) produce(ctx context.Context, table string, m *tableMapping, rows [][]interface{}, keys []string,
+	times *batchTimes) error {
+	// Messages of cancelled batches would still be produced in the
+	// background.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	serializationStart := time.Now()
+	messages, err := d.messages(table, m, rows, keys)
+	if err != nil {
+		return err
+	}
+	times.serialization += time.Now().Sub(serializationStart)
+
+	commitStart := time.Now()
+	if err := d.writer.WriteMessages(ctx, messages...); err != nil {
+		return errors.Wrapf(err, "unable to produce messages to %s", d.cfg.topic(table, m.name))
+	}
+	times.commit += time.Now().Sub(commitStart)
+	return nil
+}
+
+func (d *kafkaDriver) close() error {
+	return errors.Wrap(d.writer.Close(), "unable to close Kafka producer")
+}
+
+func (d *kafkaDriver) destination() string {
+	return fmt.Sprintf("Kafka topics %s, %s on %s", d.cfg.topic("control_objects", d.opts.cobTable.name),
+		d.cfg.topic("facial_features", d.opts.ffvTable.name),
+		strings.Join(d.cfg.Brokers, ","))
+}
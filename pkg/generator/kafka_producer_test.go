@@ -0,0 +1,222 @@
+//go:build kafka
+// +build kafka
+
+package generator
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/nofacedb/generator/pkg/storage/sinktest"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+)
+
+func TestKafkaMessagesMapping(t *testing.T) {
+	opts := testInsertOptions(t, SchemaCFG{
+		ControlObjects: TableSchemaCFG{Name: "persons", Columns: map[string]string{"passport": "document", "email": omittedColumn}},
+	})
+	cobs, _ := testBatches(2)
+	rows, keys := make([][]interface{}, len(cobs)), make([]string, len(cobs))
+	for i, cob := range cobs {
+		rows[i], keys[i] = opts.cobTable.row(opts.controlObjectRow(cob)), cob.id
+	}
+	for _, test := range []struct {
+		name  string
+		cfg   KafkaCFG
+		topic string
+		keyed bool
+	}{
+		{"mapped topic", KafkaCFG{}, "persons", true},
+		{"configured topic", KafkaCFG{Topics: KafkaTopicsCFG{ControlObjects: "cobs"}, Key: kafkaKeyNone}, "cobs", false},
+		{"msgpack", KafkaCFG{Format: kafkaFormatMsgPack}, "persons", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := &kafkaDriver{cfg: test.cfg, opts: opts}
+			messages, err := d.messages("control_objects", opts.cobTable, rows, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, message := range messages {
+				if message.Topic != test.topic {
+					t.Errorf("message is produced to %s, expected %s", message.Topic, test.topic)
+				}
+				if keyed := message.Key != nil; (keyed != test.keyed) || (keyed && (string(message.Key) != cobs[i].id)) {
+					t.Errorf("message has key %q", message.Key)
+				}
+				record := map[string]interface{}{}
+				if test.cfg.Format == kafkaFormatMsgPack {
+					value, rest, err := decodeMsgPack(message.Value)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(rest) != 0 {
+						t.Fatalf("%d bytes after the message", len(rest))
+					}
+					record = value.(map[string]interface{})
+				} else if err := json.Unmarshal(message.Value, &record); err != nil {
+					t.Fatal(err)
+				}
+				if record["document"] != cobs[i].passport {
+					t.Errorf("document of %v is not the passport %s", record, cobs[i].passport)
+				}
+				for _, column := range []string{"passport", "email"} {
+					if _, ok := record[column]; ok {
+						t.Errorf("message has column %s: %v", column, record)
+					}
+				}
+			}
+		})
+	}
+}
+
+// fakeKafka is a broker serving the part of the Kafka protocol producers
+// need: API versions, metadata of topics with a single partition led by the
+// broker, and produce requests, whose JSON records are stored by topic.
+type fakeKafka struct {
+	listener net.Listener
+	b        *fakeBackend
+	topics   []string
+}
+
+func newFakeKafka(t *testing.T, b *fakeBackend, topics ...string) *fakeKafka {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeKafka{listener: listener, b: b, topics: topics}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeKafka) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeKafka) close() {
+	s.listener.Close()
+}
+
+func (s *fakeKafka) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		version, correlationID, _, request, err := protocol.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		var response protocol.Message
+		switch request := request.(type) {
+		case *apiversions.Request:
+			keys := []apiversions.ApiKeyResponse{}
+			for _, key := range []protocol.ApiKey{protocol.ApiVersions, protocol.Metadata, protocol.Produce} {
+				keys = append(keys, apiversions.ApiKeyResponse{
+					ApiKey: int16(key), MinVersion: key.MinVersion(), MaxVersion: key.MaxVersion(),
+				})
+			}
+			response = &apiversions.Response{ApiKeys: keys}
+		case *metadata.Request:
+			response = s.metadata(request)
+		case *produce.Request:
+			response = s.produce(request)
+		default:
+			return
+		}
+		if err := protocol.WriteResponse(conn, version, correlationID, response); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeKafka) metadata(request *metadata.Request) *metadata.Response {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	response := &metadata.Response{
+		Brokers: []metadata.ResponseBroker{{NodeID: 0, Host: addr.IP.String(), Port: int32(addr.Port)}},
+	}
+	topics := request.TopicNames
+	// Metadata of the cluster lists all topics.
+	if topics == nil {
+		topics = s.topics
+	}
+	for _, topic := range topics {
+		response.Topics = append(response.Topics, metadata.ResponseTopic{
+			Name:       topic,
+			Partitions: []metadata.ResponsePartition{{ReplicaNodes: []int32{0}, IsrNodes: []int32{0}}},
+		})
+	}
+	return response
+}
+
+func (s *fakeKafka) produce(request *produce.Request) *produce.Response {
+	response := &produce.Response{}
+	for _, topic := range request.Topics {
+		responseTopic := produce.ResponseTopic{Topic: topic.Topic}
+		for _, partition := range topic.Partitions {
+			records, err := readKafkaRecords(partition.RecordSet.Records)
+			code := int16(0)
+			if err != nil {
+				code = int16(kafka.InvalidMessage)
+			} else if !s.b.store(topic.Topic, records) {
+				code = int16(kafka.PolicyViolation)
+			}
+			responseTopic.Partitions = append(responseTopic.Partitions, produce.ResponsePartition{
+				Partition: partition.Partition, ErrorCode: code,
+			})
+		}
+		response.Topics = append(response.Topics, responseTopic)
+	}
+	return response
+}
+
+func readKafkaRecords(reader protocol.RecordReader) ([]map[string]interface{}, error) {
+	records := []map[string]interface{}{}
+	for reader != nil {
+		r, err := reader.ReadRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		value, err := protocol.ReadAll(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		record := map[string]interface{}{}
+		if err := json.Unmarshal(value, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func TestKafkaDriverConformance(t *testing.T) {
+	opts := testInsertOptions(t, SchemaCFG{})
+	sink := driverSink{cobTable: opts.cobTable.name, ffvTable: opts.ffvTable.name}
+	sinktest.Run(t, func(t *testing.T) (sinktest.Sink, sinktest.Backend) {
+		b := newFakeBackend()
+		broker := newFakeKafka(t, b, sink.cobTable, sink.ffvTable)
+		t.Cleanup(broker.close)
+		d, err := newKafkaDriver(KafkaCFG{Brokers: []string{broker.addr()}}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { d.close() })
+		sink.d = d
+		return sink, b
+	}, sink.contract(false))
+}
@@ -0,0 +1,28 @@
+//go:build !kafka
+// +build !kafka
+
+package generator
+
+import (
+	"fmt"
+)
+
+// Builds without the kafka tag leave out github.com/segmentio/kafka-go, and
+// KafkaCFG.validate rejects output: kafka.
+const kafkaSupported = false
+
+type kafkaDriver struct {
+	storageDriver
+}
+
+func newKafkaDriver(cfg KafkaCFG, opts insertOptions) (*kafkaDriver, error) {
+	return nil, fmt.Errorf("generator is built without Kafka support, rebuild it with -tags kafka")
+}
+
+func (d *kafkaDriver) close() error {
+	return nil
+}
+
+func (d *kafkaDriver) destination() string {
+	return ""
+}
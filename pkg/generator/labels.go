@@ -0,0 +1,79 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// labelsFile writes ground-truth labels as TSV with a header line. Methods
+// are no-ops on nil labelsFile, so optional labels need no checks at call
+// sites. Writes are safe for concurrent use.
+type labelsFile struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// newLabelsFile creates a labels file or, for resumed runs, appends to the
+// existing one.
+func newLabelsFile(path string, resume bool, columns ...string) (*labelsFile, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create labels file %s", path)
+	}
+	writer := bufio.NewWriter(file)
+	if info, err := file.Stat(); (err == nil) && (info.Size() == 0) {
+		fmt.Fprintln(writer, strings.Join(columns, "\t"))
+	}
+	return &labelsFile{
+		file:   file,
+		writer: writer,
+	}, nil
+}
+
+func (l *labelsFile) write(fields ...string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.writer, strings.Join(fields, "\t"))
+}
+
+func (l *labelsFile) close() error {
+	if l == nil {
+		return nil
+	}
+	if err := l.writer.Flush(); err != nil {
+		l.file.Close()
+		return errors.Wrapf(err, "unable to write labels file %s", l.file.Name())
+	}
+	return l.file.Close()
+}
+
+// readLabelIDs returns IDs in the first column of a labels file.
+func readLabelIDs(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open labels file %s", path)
+	}
+	defer file.Close()
+	ids := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for header := true; scanner.Scan(); header = false {
+		if header || (scanner.Text() == "") {
+			continue
+		}
+		ids[strings.SplitN(scanner.Text(), "\t", 2)[0]] = true
+	}
+	return ids, errors.Wrapf(scanner.Err(), "unable to read labels file %s", path)
+}
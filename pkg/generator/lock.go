@@ -0,0 +1,303 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// LockCFG configures the advisory lock runs take on target tables.
+type LockCFG struct {
+	// generator_locks by default, created in the default database.
+	Table string `yaml:"table"`
+	// A lock without heartbeats for this long is abandoned, 60s by default.
+	StaleMS int `yaml:"stale_ms"`
+	// Rows of locks are dropped by TTL this many days after their last
+	// heartbeat, 7 by default.
+	RetentionDays int `yaml:"retention_days"`
+}
+
+func (cfg LockCFG) table() string {
+	if cfg.Table != "" {
+		return cfg.Table
+	}
+	return "generator_locks"
+}
+
+func (cfg LockCFG) retentionDays() int {
+	if cfg.RetentionDays > 0 {
+		return cfg.RetentionDays
+	}
+	return 7
+}
+
+func (cfg LockCFG) stale() time.Duration {
+	if cfg.StaleMS > 0 {
+		return time.Duration(cfg.StaleMS) * time.Millisecond
+	}
+	return time.Minute
+}
+
+// runLock is a row of a run per target table in the locks table, refreshed
+// by heartbeats. ClickHouse has no locks, so runs check for each other
+// before and after taking theirs, and the earlier one wins. Runs conflict
+// when they share a target table. The table is accessed over the native
+// protocol with db or over HTTP with ch.
+type runLock struct {
+	db  *sql.DB
+	ch  *clickHouseHTTP
+	cfg LockCFG
+	log *logger
+	// Generated tables as database.table.
+	targets  []string
+	runID    string
+	host     string
+	acquired time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+var lockColumns = []string{"target", "run_id", "host", "pid", "acquired_at", "heartbeat", "released"}
+
+type lockHolder struct {
+	// Locked tables shared with this run.
+	targets   []string
+	runID     string
+	host      string
+	pid       uint32
+	acquired  time.Time
+	heartbeat time.Time
+}
+
+// acquireRunLock takes the lock on tables of the default database. With
+// allowConcurrent, the run writes even if another run holds it.
+func acquireRunLock(ctx context.Context, db *sql.DB, ch *clickHouseHTTP, cfg StorageCFG, tables []string,
+	allowConcurrent bool, log *logger) (*runLock, error) {
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    target String,
+    run_id String,
+    host String,
+    pid UInt32,
+    acquired_at DateTime,
+    heartbeat DateTime,
+    released UInt8
+) ENGINE = ReplacingMergeTree(heartbeat)
+ORDER BY (target, run_id)
+TTL heartbeat + INTERVAL %d DAY`, cfg.Lock.table(), cfg.Lock.retentionDays())
+	targets := make([]string, len(tables))
+	for i, table := range tables {
+		targets[i] = cfg.DefaultDB + "." + table
+	}
+	host, _ := os.Hostname()
+	l := &runLock{
+		db:       db,
+		ch:       ch,
+		log:      log,
+		cfg:      cfg.Lock,
+		targets:  targets,
+		runID:    uuid.Must(uuid.NewV4()).String(),
+		host:     host,
+		acquired: time.Now(),
+		done:     make(chan struct{}),
+	}
+	if err := l.exec(ctx, query); err != nil {
+		return nil, errors.Wrap(err, "unable to create locks table")
+	}
+	if !allowConcurrent {
+		if err := l.checkHolders(ctx, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.write(ctx, time.Now(), false); err != nil {
+		return nil, err
+	}
+	if !allowConcurrent {
+		// Another run may have checked at the same time.
+		if err := l.checkHolders(ctx, true); err != nil {
+			l.write(context.WithoutCancel(ctx), time.Now(), true)
+			return nil, err
+		}
+	}
+
+	heartbeatCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	l.cancel = cancel
+	go l.heartbeat(heartbeatCtx)
+	return l, nil
+}
+
+// checkHolders fails if another run holds the lock, or with earlier only, a
+// run that took it before this one.
+func (l *runLock) checkHolders(ctx context.Context, earlier bool) error {
+	holders, err := l.holders(ctx)
+	if err != nil {
+		return err
+	}
+	for _, h := range holders {
+		if earlier && (h.acquired.After(l.acquired) || (h.acquired.Equal(l.acquired) && (h.runID > l.runID))) {
+			continue
+		}
+		return fmt.Errorf("%s locked by run %s on %s (pid %d) since %v, heartbeat at %v; use -allow-concurrent to write anyway",
+			strings.Join(h.targets, ", "), h.runID, h.host, h.pid, h.acquired, h.heartbeat)
+	}
+	return nil
+}
+
+func (l *runLock) exec(ctx context.Context, query string) error {
+	if l.ch != nil {
+		_, err := l.ch.Query(ctx, query)
+		return err
+	}
+	_, err := l.db.ExecContext(ctx, query)
+	return err
+}
+
+func (l *runLock) holders(ctx context.Context) ([]lockHolder, error) {
+	if l.ch != nil {
+		return l.httpHolders(ctx)
+	}
+	query := fmt.Sprintf(`SELECT groupUniqArray(target), run_id, any(host), any(pid), min(acquired_at), max(heartbeat)
+FROM %s
+WHERE (target IN (?)) AND (run_id != ?)
+GROUP BY run_id
+HAVING (max(released) = 0) AND (max(heartbeat) > ?)`, l.cfg.table())
+	rows, err := l.db.QueryContext(ctx, query, l.targets, l.runID, time.Now().Add(-l.cfg.stale()))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to query locks")
+	}
+	defer rows.Close()
+	holders := []lockHolder{}
+	for rows.Next() {
+		h := lockHolder{}
+		if err := rows.Scan(&h.targets, &h.runID, &h.host, &h.pid, &h.acquired, &h.heartbeat); err != nil {
+			return nil, errors.Wrap(err, "unable to read locks")
+		}
+		holders = append(holders, h)
+	}
+	return holders, errors.Wrap(rows.Err(), "unable to read locks")
+}
+
+// httpHolders queries holders like holders does, with times as Unix
+// timestamps, which do not depend on the time zone of the server.
+func (l *runLock) httpHolders(ctx context.Context) ([]lockHolder, error) {
+	query := fmt.Sprintf(`SELECT arrayStringConcat(arraySort(groupUniqArray(target)), ', '), run_id, any(host), any(pid),
+    toUnixTimestamp(min(acquired_at)), toUnixTimestamp(max(heartbeat))
+FROM %s
+WHERE has({targets:Array(String)}, target) AND (run_id != {run_id:String})
+GROUP BY run_id
+HAVING (max(released) = 0) AND (max(heartbeat) > toDateTime({stale:UInt32}))
+FORMAT TabSeparated`, l.cfg.table())
+	result, err := l.ch.QueryParams(ctx, query, map[string]string{
+		"targets": arrayParam(l.targets),
+		"run_id":  l.runID,
+		"stale":   strconv.FormatInt(time.Now().Add(-l.cfg.stale()).Unix(), 10),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to query locks")
+	}
+	holders := []lockHolder{}
+	for _, line := range strings.Split(strings.TrimSpace(string(result)), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("unable to read locks: unexpected row \"%s\"", line)
+		}
+		h := lockHolder{
+			targets: strings.Split(tsvUnescaper.Replace(fields[0]), ", "),
+			runID:   tsvUnescaper.Replace(fields[1]),
+			host:    tsvUnescaper.Replace(fields[2]),
+		}
+		pid, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read locks")
+		}
+		acquired, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read locks")
+		}
+		heartbeat, err := strconv.ParseInt(fields[5], 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read locks")
+		}
+		h.pid, h.acquired, h.heartbeat = uint32(pid), time.Unix(acquired, 0), time.Unix(heartbeat, 0)
+		holders = append(holders, h)
+	}
+	return holders, nil
+}
+
+func (l *runLock) write(ctx context.Context, heartbeat time.Time, released bool) error {
+	releasedFlag := uint8(0)
+	if released {
+		releasedFlag = 1
+	}
+	if l.ch != nil {
+		rows := &strings.Builder{}
+		for _, target := range l.targets {
+			fmt.Fprintf(rows, "%s\t%s\t%s\t%d\t%d\t%d\t%d\n", tsvEscaper.Replace(target), tsvEscaper.Replace(l.runID),
+				tsvEscaper.Replace(l.host), os.Getpid(), l.acquired.Unix(), heartbeat.Unix(), releasedFlag)
+		}
+		_, err := l.ch.Query(ctx, fmt.Sprintf("INSERT INTO %s (%s) FORMAT TabSeparated\n%s",
+			l.cfg.table(), strings.Join(lockColumns, ", "), rows))
+		return errors.Wrap(err, "unable to insert lock")
+	}
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to begin lock insert")
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, insertQuery(l.cfg.table(), lockColumns))
+	if err != nil {
+		return errors.Wrap(err, "unable to prepare lock insert")
+	}
+	defer stmt.Close()
+	for _, target := range l.targets {
+		if _, err := stmt.ExecContext(ctx, target, l.runID, l.host, uint32(os.Getpid()),
+			l.acquired, heartbeat, releasedFlag); err != nil {
+			return errors.Wrap(err, "unable to insert lock")
+		}
+	}
+	return errors.Wrap(tx.Commit(), "unable to commit lock insert")
+}
+
+func (l *runLock) heartbeat(ctx context.Context) {
+	defer close(l.done)
+	ticker := time.NewTicker(l.cfg.stale() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := l.write(ctx, now, false); (err != nil) && (ctx.Err() == nil) {
+				l.log.logln(errors.Wrap(err, "unable to refresh run lock"))
+			}
+		}
+	}
+}
+
+// release stops heartbeats and marks the lock released.
+func (l *runLock) release() error {
+	if l == nil {
+		return nil
+	}
+	l.cancel()
+	<-l.done
+	return l.write(context.Background(), time.Now(), true)
+}
+
+// arrayParam formats values as an Array(String) query parameter.
+func arrayParam(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+	}
+	return "[" + strings.Join(quoted, ",") + "]"
+}
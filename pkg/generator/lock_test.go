@@ -0,0 +1,151 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLocks serves the locks table over the ClickHouse HTTP interface,
+// evaluating queries of runLock on its rows.
+type fakeLocks struct {
+	mu   sync.Mutex
+	ddl  []string
+	rows [][]string
+}
+
+func (f *fakeLocks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	query := string(body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case strings.HasPrefix(query, "CREATE"):
+		f.ddl = append(f.ddl, query)
+	case strings.HasPrefix(query, "INSERT"):
+		lines := strings.Split(strings.TrimSuffix(query, "\n"), "\n")
+		for _, line := range lines[1:] {
+			f.rows = append(f.rows, strings.Split(line, "\t"))
+		}
+	case strings.HasPrefix(query, "SELECT"):
+		params := r.URL.Query()
+		targets := map[string]bool{}
+		for _, target := range strings.Split(strings.Trim(params.Get("param_targets"), "[]"), ",") {
+			targets[strings.Trim(target, "'")] = true
+		}
+		stale, _ := strconv.ParseInt(params.Get("param_stale"), 10, 64)
+		type holder struct {
+			targets   map[string]bool
+			fields    []string
+			heartbeat int64
+			released  bool
+		}
+		holders := map[string]*holder{}
+		for _, row := range f.rows {
+			if !targets[row[0]] || (row[1] == params.Get("param_run_id")) {
+				continue
+			}
+			h, ok := holders[row[1]]
+			if !ok {
+				h = &holder{targets: map[string]bool{}, fields: row}
+				holders[row[1]] = h
+			}
+			h.targets[row[0]] = true
+			if heartbeat, _ := strconv.ParseInt(row[5], 10, 64); heartbeat > h.heartbeat {
+				h.heartbeat = heartbeat
+			}
+			h.released = h.released || (row[6] == "1")
+		}
+		for runID, h := range holders {
+			if h.released || (h.heartbeat <= stale) {
+				continue
+			}
+			locked := []string{}
+			for target := range h.targets {
+				locked = append(locked, target)
+			}
+			sort.Strings(locked)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", strings.Join(locked, ", "), runID, h.fields[2], h.fields[3],
+				h.fields[4], h.heartbeat)
+		}
+	default:
+		http.Error(w, "Code: 62. DB::Exception: Syntax error", http.StatusBadRequest)
+	}
+}
+
+func TestRunLock(t *testing.T) {
+	locks := &fakeLocks{}
+	ch := newTestClickHouseHTTP(t, locks, StorageCFG{DefaultDB: "facedb"})
+	cfg := StorageCFG{DefaultDB: "facedb", Lock: LockCFG{RetentionDays: 3}}
+	log := &logger{quiet: true}
+	ctx := context.Background()
+
+	first, err := acquireRunLock(ctx, nil, ch, cfg, []string{"control_objects", "facial_features"}, false, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(locks.ddl) != 1) || !strings.Contains(locks.ddl[0], "TTL heartbeat + INTERVAL 3 DAY") {
+		t.Errorf("locks table is created with %q", locks.ddl)
+	}
+	if len(locks.rows) != 2 {
+		t.Errorf("lock is taken with rows %q, expected one per table", locks.rows)
+	}
+
+	// Runs sharing a table conflict, others do not.
+	_, err = acquireRunLock(ctx, nil, ch, cfg, []string{"persons", "facial_features"}, false, log)
+	if (err == nil) || !strings.Contains(err.Error(), "facedb.facial_features locked by run "+first.runID) {
+		t.Errorf("conflicting run got error %v", err)
+	}
+	other, err := acquireRunLock(ctx, nil, ch, cfg, []string{"persons", "faces"}, false, log)
+	if err != nil {
+		t.Fatalf("run of other tables is refused: %v", err)
+	}
+	concurrent, err := acquireRunLock(ctx, nil, ch, cfg, []string{"control_objects"}, true, log)
+	if err != nil {
+		t.Fatalf("-allow-concurrent run is refused: %v", err)
+	}
+	for _, l := range []*runLock{first, other, concurrent} {
+		if err := l.release(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next, err := acquireRunLock(ctx, nil, ch, cfg, []string{"control_objects", "facial_features"}, false, log)
+	if err != nil {
+		t.Fatalf("released lock is held: %v", err)
+	}
+	next.release()
+}
+
+func TestRunLockBeforeDDL(t *testing.T) {
+	locks := &fakeLocks{}
+	ch := newTestClickHouseHTTP(t, locks, StorageCFG{DefaultDB: "facedb"})
+	cfg, _ := testConfig(t, 10)
+	cfg.Output, cfg.StorageCFG.Protocol, cfg.StorageCFG.AutoCreate = outputClickHouse, protocolHTTP, true
+	cfg.StorageCFG.AsyncInsert.ConfirmFlush = false
+	cfg.StorageCFG.Addr, cfg.StorageCFG.HTTPPort, cfg.StorageCFG.MaxPings = ch.cfg.Addr, ch.cfg.HTTPPort, 1
+
+	// Another run holds the lock on the generated tables.
+	held, err := acquireRunLock(context.Background(), nil, ch, cfg.StorageCFG, []string{"control_objects"}, false,
+		&logger{quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.release()
+	locks.ddl = nil
+	_, err = run(context.Background(), cfg, Options{}, 1, nil, time.Now(), &logger{quiet: true})
+	if (err == nil) || !strings.Contains(err.Error(), "locked by run "+held.runID) {
+		t.Fatalf("run of locked tables got error %v", err)
+	}
+	for _, query := range locks.ddl {
+		if !strings.Contains(query, cfg.StorageCFG.Lock.table()) {
+			t.Errorf("run of locked tables sent DDL %q", query)
+		}
+	}
+}
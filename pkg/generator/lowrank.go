@@ -0,0 +1,94 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// FFVStructureCFG describes low-rank covariance of generated FFVs: a few
+// principal components with geometrically decaying variances plus
+// isotropic noise.
+type FFVStructureCFG struct {
+	Components  int     `yaml:"components"`
+	TopVariance float64 `yaml:"top_variance"`
+	Decay       float64 `yaml:"decay"`
+	Noise       float64 `yaml:"noise"`
+}
+
+type lowRankGenerator struct {
+	dim     int
+	basis   [][]float64
+	stddevs []float64
+	noise   float64
+}
+
+func newLowRankGenerator(cfg FFVStructureCFG, dim int, rnd *rand.Rand) (*lowRankGenerator, error) {
+	if cfg.Components == 0 {
+		return nil, nil
+	}
+	if (cfg.Components < 0) || (cfg.Components > dim) {
+		return nil, fmt.Errorf("number of components must be in [1, %d], got %d", dim, cfg.Components)
+	}
+	if (cfg.Decay < 0) || (cfg.Decay > 1) {
+		return nil, fmt.Errorf("decay must be in [0, 1], got %v", cfg.Decay)
+	}
+	topVariance := cfg.TopVariance
+	if topVariance <= 0 {
+		topVariance = 1.0
+	}
+
+	g := &lowRankGenerator{
+		dim:     dim,
+		basis:   make([][]float64, cfg.Components),
+		stddevs: make([]float64, cfg.Components),
+		noise:   cfg.Noise,
+	}
+	variance := topVariance
+	for i := range g.basis {
+		g.basis[i] = randomOrthonormal(rnd, g.basis[:i], dim)
+		g.stddevs[i] = math.Sqrt(variance)
+		variance *= cfg.Decay
+	}
+	return g, nil
+}
+
+// randomOrthonormal returns random unit vector orthogonal to all vectors of
+// orthonormal basis.
+func randomOrthonormal(rnd *rand.Rand, basis [][]float64, dim int) []float64 {
+	for {
+		v := make([]float64, dim)
+		for i := range v {
+			v[i] = rnd.NormFloat64()
+		}
+		for _, b := range basis {
+			dot := 0.0
+			for i := range v {
+				dot += v[i] * b[i]
+			}
+			for i := range v {
+				v[i] -= dot * b[i]
+			}
+		}
+		if n := norm(v); n > 1e-9 {
+			for i := range v {
+				v[i] /= n
+			}
+			return v
+		}
+	}
+}
+
+func (g *lowRankGenerator) generate(rnd *rand.Rand) []float64 {
+	ffv := make([]float64, g.dim)
+	for i := range ffv {
+		ffv[i] = rnd.NormFloat64() * g.noise
+	}
+	for c, b := range g.basis {
+		z := rnd.NormFloat64() * g.stddevs[c]
+		for i := range ffv {
+			ffv[i] += z * b[i]
+		}
+	}
+	return ffv
+}
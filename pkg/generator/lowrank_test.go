@@ -0,0 +1,54 @@
+package generator
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestLowRankGenerator checks that FFVs vary along principal components by
+// their variances and only by the noise elsewhere.
+func TestLowRankGenerator(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	g, err := newLowRankGenerator(FFVStructureCFG{Components: 2, TopVariance: 4, Decay: 0.25, Noise: 0.1}, 16, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range g.basis {
+		for j, b := range g.basis {
+			expected := 0.0
+			if i == j {
+				expected = 1
+			}
+			if math.Abs(dot(a, b)-expected) > 1e-9 {
+				t.Fatalf("components %d and %d have dot product %v", i, j, dot(a, b))
+			}
+		}
+	}
+	// A direction orthogonal to the components holds the noise only.
+	other := randomOrthonormal(rnd, g.basis, 16)
+	directions := [][]float64{g.basis[0], g.basis[1], other}
+	variances := make([]float64, len(directions))
+	n := 20000
+	for k := 0; k < n; k++ {
+		v := g.generate(rnd)
+		for i, d := range directions {
+			p := dot(v, d)
+			variances[i] += p * p / float64(n)
+		}
+	}
+	for i, expected := range []float64{4.01, 1.01, 0.01} {
+		if math.Abs(variances[i]-expected) > 0.1*expected {
+			t.Errorf("variance along direction %d is %v, expected %v", i, variances[i], expected)
+		}
+	}
+
+	if g, err := newLowRankGenerator(FFVStructureCFG{}, 16, rnd); (g != nil) || (err != nil) {
+		t.Errorf("FFVs without components are structured: %v", err)
+	}
+	for _, cfg := range []FFVStructureCFG{{Components: 17}, {Components: -1}, {Components: 2, Decay: 1.5}} {
+		if _, err := newLowRankGenerator(cfg, 16, rnd); err == nil {
+			t.Errorf("structure %+v of 16 dimensions is accepted", cfg)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// omittedColumn as a mapped column name leaves the column out of inserts.
+const omittedColumn = "-"
+
+// tableMapping renames a generated table and its columns in the database
+// and leaves omitted columns out of inserted rows.
+type tableMapping struct {
+	name string
+	// Database names of kept columns and their indices in generated rows.
+	columns []string
+	keep    []int
+	// Database names of generated columns, empty for omitted ones.
+	names map[string]string
+}
+
+// newTableMapping maps columns of table according to cfg. Nested columns are
+// mapped by their name without the .key and .value suffixes.
+func newTableMapping(table string, cfg TableSchemaCFG, columns []string) (*tableMapping, error) {
+	m := &tableMapping{name: table, names: map[string]string{}}
+	if cfg.Name != "" {
+		m.name = cfg.Name
+	}
+	known := map[string]bool{}
+	for column := range columnTypes {
+		known[column] = true
+	}
+	mapped := map[string]bool{}
+	for i, column := range columns {
+		key, suffix := column, ""
+		if strings.HasSuffix(column, ".key") || strings.HasSuffix(column, ".value") {
+			dot := strings.LastIndex(column, ".")
+			key, suffix = column[:dot], column[dot:]
+		}
+		known[key] = true
+		name, ok := cfg.Columns[key]
+		if !ok {
+			name = key
+		}
+		if name == omittedColumn {
+			m.names[column] = ""
+			continue
+		}
+		name += suffix
+		if mapped[name] {
+			return nil, fmt.Errorf("column %s of table %s is mapped more than once", name, table)
+		}
+		mapped[name] = true
+		m.names[column] = name
+		m.columns = append(m.columns, name)
+		m.keep = append(m.keep, i)
+	}
+	unknown := []string{}
+	for column := range cfg.Columns {
+		if !known[column] {
+			unknown = append(unknown, column)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown columns %s of table %s", strings.Join(unknown, ", "), table)
+	}
+	if len(m.columns) == 0 {
+		return nil, fmt.Errorf("all columns of table %s are omitted", table)
+	}
+	// Columns not inserted with these options are still named for queries
+	// of subcommands and checks.
+	for column := range known {
+		if _, ok := m.names[column]; ok {
+			continue
+		}
+		name, ok := cfg.Columns[column]
+		if !ok {
+			name = column
+		}
+		if name == omittedColumn {
+			name = ""
+		}
+		m.names[column] = name
+	}
+	return m, nil
+}
+
+// column returns the database name of a generated column, empty if it is
+// omitted.
+func (m *tableMapping) column(column string) string {
+	return m.names[column]
+}
+
+// required returns the database name of a column a query needs, an error
+// when it is omitted.
+func (m *tableMapping) required(column string) (string, error) {
+	name := m.column(column)
+	if name == "" {
+		return "", fmt.Errorf("column %s of table %s is omitted", column, m.name)
+	}
+	return name, nil
+}
+
+// generated returns the generated column named name in the database, name
+// itself for columns not generated.
+func (m *tableMapping) generated(name string) string {
+	for column, mapped := range m.names {
+		if mapped == name {
+			return column
+		}
+	}
+	return name
+}
+
+// row leaves omitted columns out of a generated row.
+func (m *tableMapping) row(row []interface{}) []interface{} {
+	if len(m.keep) == len(row) {
+		return row
+	}
+	kept := make([]interface{}, len(m.keep))
+	for i, j := range m.keep {
+		kept[i] = row[j]
+	}
+	return kept
+}
+
+// table returns the mapping of a generated table.
+func (opts insertOptions) table(table string) *tableMapping {
+	if table == "facial_features" {
+		return opts.ffvTable
+	}
+	return opts.cobTable
+}
+
+// tableNames returns database names of generated tables in the order of
+// generatedTables.
+func (opts insertOptions) tableNames() []string {
+	names := make([]string, len(generatedTables))
+	for i, table := range generatedTables {
+		names[i] = opts.table(table).name
+	}
+	return names
+}
+
+// tableList returns database names of generated tables as a list of SQL
+// strings.
+func (opts insertOptions) tableList() string {
+	return "'" + strings.Join(opts.tableNames(), "', '") + "'"
+}
+
+// mappedOptions returns insert options of the configured generator, naming
+// generated tables and columns as the schema maps them, for subcommands
+// querying generated tables.
+func mappedOptions(cfg *Config) (insertOptions, error) {
+	g, err := newGeneration(cfg, 1)
+	if err != nil {
+		return insertOptions{}, err
+	}
+	return g.opts, nil
+}
@@ -0,0 +1,152 @@
+package generator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	maskHash    = "hash"
+	maskPartial = "partial"
+	maskToken   = "token"
+)
+
+// MaskingCFG holds masking rules for exported columns keyed by
+// "table.column" of generated names, also when the schema maps them.
+type MaskingCFG struct {
+	// HMAC key of hash masking.
+	Key   string                 `yaml:"key"`
+	Rules map[string]MaskRuleCFG `yaml:"rules"`
+	// HMAC key of IDs remapped by "sample -remap-ids", one per target
+	// environment.
+	RemapKey string `yaml:"remap_key"`
+}
+
+// MaskRuleCFG configures masking of a column.
+type MaskRuleCFG struct {
+	Method string `yaml:"method"`
+	// Characters left as is by partial masking.
+	KeepFirst int `yaml:"keep_first"`
+	KeepLast  int `yaml:"keep_last"`
+	// Columns sharing a token domain map equal values to equal tokens, e.g.
+	// control_objects.id and facial_features.cob_id.
+	TokenDomain string `yaml:"token_domain"`
+}
+
+// masker replaces exported values according to masking rules. Tokens are
+// assigned in order of appearance and stay stable within a single export.
+type masker struct {
+	cfg    MaskingCFG
+	tokens map[string]map[string]string
+}
+
+func newMasker(cfg MaskingCFG) (*masker, error) {
+	for column, rule := range cfg.Rules {
+		switch rule.Method {
+		case maskHash, maskToken:
+		case maskPartial:
+			if (rule.KeepFirst < 0) || (rule.KeepLast < 0) {
+				return nil, fmt.Errorf("negative number of kept characters for %s", column)
+			}
+		default:
+			return nil, fmt.Errorf("unknown masking method \"%s\" for %s", rule.Method, column)
+		}
+	}
+	return &masker{
+		cfg:    cfg,
+		tokens: make(map[string]map[string]string),
+	}, nil
+}
+
+// column returns masking function of the column or nil if it is exported
+// as is. nil masker exports everything as is.
+func (m *masker) column(table, column string) func(string) string {
+	if m == nil {
+		return nil
+	}
+	name := table + "." + column
+	rule, ok := m.cfg.Rules[name]
+	if !ok {
+		return nil
+	}
+
+	switch rule.Method {
+	case maskHash:
+		return func(value string) string {
+			mac := hmac.New(sha256.New, []byte(m.cfg.Key))
+			mac.Write([]byte(value))
+			return hex.EncodeToString(mac.Sum(nil))
+		}
+	case maskPartial:
+		return func(value string) string {
+			runes := []rune(value)
+			for i := rule.KeepFirst; i < len(runes)-rule.KeepLast; i++ {
+				runes[i] = '*'
+			}
+			return string(runes)
+		}
+	case maskToken:
+		domain := rule.TokenDomain
+		if domain == "" {
+			domain = name
+		}
+		if m.tokens[domain] == nil {
+			m.tokens[domain] = make(map[string]string)
+		}
+		tokens := m.tokens[domain]
+		prefix := strings.ToUpper(domain[:1])
+		return func(value string) string {
+			token, ok := tokens[value]
+			if !ok {
+				token = fmt.Sprintf("%s%08d", prefix, len(tokens)+1)
+				tokens[value] = token
+			}
+			return token
+		}
+	}
+	return nil
+}
+
+// idRemapper replaces UUIDs of exported rows with fresh ones derived from
+// HMAC-SHA256 of the key, so that the same key maps an ID to the same UUID
+// in every table and export, and other keys give datasets not colliding
+// with promoted ones.
+type idRemapper struct {
+	key []byte
+}
+
+func newIDRemapper(key string) (*idRemapper, error) {
+	if key == "" {
+		return nil, fmt.Errorf("masking.remap_key is not set")
+	}
+	return &idRemapper{key: []byte(key)}, nil
+}
+
+// field returns a TSV field with a remapped UUID in place of a UUID and
+// other fields as is. nil remapper keeps all fields.
+func (r *idRemapper) field(field string) string {
+	if (r == nil) || (len(field) != 36) {
+		return field
+	}
+	id, err := uuid.FromString(field)
+	if err != nil {
+		return field
+	}
+	return r.remap(id).String()
+}
+
+// remap returns a version 4 UUID of the truncated HMAC of id.
+func (r *idRemapper) remap(id uuid.UUID) uuid.UUID {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write(id.Bytes())
+	remapped := uuid.UUID{}
+	copy(remapped[:], mac.Sum(nil))
+	remapped.SetVersion(uuid.V4)
+	remapped.SetVariant(uuid.VariantRFC4122)
+	return remapped
+}
@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestIDRemapper(t *testing.T) {
+	if _, err := newIDRemapper(""); err == nil {
+		t.Fatal("remapping without a key is accepted")
+	}
+	r, _ := newIDRemapper("staging")
+	other, _ := newIDRemapper("production")
+	ids := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := uuid.Must(uuid.NewV4()).String()
+		remapped := r.field(id)
+		// facial_features.cob_id keeps referring to its control object.
+		if r.field(id) != remapped {
+			t.Fatalf("%s is remapped to %s and %s", id, remapped, r.field(id))
+		}
+		if (remapped == id) || (other.field(id) == remapped) {
+			t.Fatalf("%s is remapped to %s by both keys", id, remapped)
+		}
+		if ids[remapped] {
+			t.Fatalf("remapped ID %s repeats", remapped)
+		}
+		ids[remapped] = true
+		u, err := uuid.FromString(remapped)
+		if (err != nil) || (u.Version() != uuid.V4) || (u.Variant() != uuid.VariantRFC4122) {
+			t.Fatalf("remapped ID %s is not a UUIDv4: %v", remapped, err)
+		}
+	}
+	for _, field := range []string{"4501 123456", "\\N", "42", "2020-01-01 00:00:00", ""} {
+		if r.field(field) != field {
+			t.Errorf("non-UUID field %q is remapped to %q", field, r.field(field))
+		}
+	}
+	var none *idRemapper
+	if id := uuid.Must(uuid.NewV4()).String(); none.field(id) != id {
+		t.Error("nil remapper changes IDs")
+	}
+}
@@ -0,0 +1,136 @@
+package generator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// appendMsgPack appends value in MessagePack encoding like ClickHouse
+// FORMAT MsgPack: strings, UUIDs and dates as str, DateTime as uint32 Unix
+// seconds, numbers in their smallest encoding and slices as arrays.
+func appendMsgPack(b []byte, value interface{}) ([]byte, error) {
+	if value == nil {
+		return append(b, 0xc0), nil
+	}
+	if t, ok := value.(time.Time); ok {
+		return appendMsgPackUint(b, uint64(uint32(t.Unix()))), nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String:
+		return appendMsgPackString(b, rv.String()), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return appendMsgPackUint(b, rv.Uint()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := rv.Int(); n < 0 {
+			return appendMsgPackInt(b, n), nil
+		}
+		return appendMsgPackUint(b, uint64(rv.Int())), nil
+	case reflect.Float32:
+		b = append(b, 0xca)
+		return binary.BigEndian.AppendUint32(b, math.Float32bits(float32(rv.Float()))), nil
+	case reflect.Float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(rv.Float())), nil
+	case reflect.Slice:
+		b = appendMsgPackHeader(b, rv.Len(), 0x90, 0xdc)
+		var err error
+		for i := 0; i < rv.Len(); i++ {
+			if b, err = appendMsgPack(b, rv.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("%T can not be encoded as MessagePack", value)
+}
+
+// appendMsgPackRow appends values of a row one after another, rows of
+// ClickHouse FORMAT MsgPack.
+func appendMsgPackRow(b []byte, row []interface{}) ([]byte, error) {
+	var err error
+	for _, value := range row {
+		if b, err = appendMsgPack(b, value); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendMsgPackMap appends a row as a map of columns to values, messages
+// consumers decode without knowing columns.
+func appendMsgPackMap(b []byte, columns []string, row []interface{}) ([]byte, error) {
+	b = appendMsgPackHeader(b, len(row), 0x80, 0xde)
+	var err error
+	for i, value := range row {
+		b = appendMsgPackString(b, columns[i])
+		if b, err = appendMsgPack(b, value); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendMsgPackHeader appends the header of an array or map of n elements,
+// fix is the fixarray or fixmap prefix and large the array 16 or map 16
+// one.
+func appendMsgPackHeader(b []byte, n int, fix, large byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, large), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, large+1), uint32(n))
+}
+
+func appendMsgPackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgPackUint(b []byte, n uint64) []byte {
+	switch {
+	case n < 128:
+		return append(b, byte(n))
+	case n <= math.MaxUint8:
+		return append(b, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcf), n)
+}
+
+// appendMsgPackInt appends a negative integer.
+func appendMsgPackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= -32:
+		return append(b, byte(n))
+	case n >= math.MinInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+}
@@ -0,0 +1,203 @@
+package generator
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// decodeMsgPack decodes the first MessagePack value of b into strings,
+// uint64, int64, float64, bool, nil, []interface{} and map[string]interface{}
+// and returns the rest of b.
+func decodeMsgPack(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("MessagePack value is truncated")
+	}
+	prefix, b := b[0], b[1:]
+	n := func(size int) (uint64, error) {
+		if len(b) < size {
+			return 0, fmt.Errorf("MessagePack value is truncated")
+		}
+		v := uint64(0)
+		for _, c := range b[:size] {
+			v = v<<8 | uint64(c)
+		}
+		b = b[size:]
+		return v, nil
+	}
+	var length uint64
+	var err error
+	kind := ""
+	switch {
+	case prefix < 0x80:
+		return uint64(prefix), b, nil
+	case prefix >= 0xe0:
+		return int64(int8(prefix)), b, nil
+	case prefix&0xf0 == 0x80:
+		kind, length = "map", uint64(prefix&0x0f)
+	case prefix&0xf0 == 0x90:
+		kind, length = "array", uint64(prefix&0x0f)
+	case prefix&0xe0 == 0xa0:
+		kind, length = "str", uint64(prefix&0x1f)
+	case prefix == 0xc0:
+		return nil, b, nil
+	case (prefix == 0xc2) || (prefix == 0xc3):
+		return prefix == 0xc3, b, nil
+	case (prefix >= 0xcc) && (prefix <= 0xcf):
+		v, err := n(1 << (prefix - 0xcc))
+		return v, b, err
+	case (prefix >= 0xd0) && (prefix <= 0xd3):
+		size := 1 << (prefix - 0xd0)
+		v, err := n(size)
+		shift := uint(64 - 8*size)
+		return int64(v<<shift) >> shift, b, err
+	case prefix == 0xca:
+		v, err := n(4)
+		return float64(math.Float32frombits(uint32(v))), b, err
+	case prefix == 0xcb:
+		v, err := n(8)
+		return math.Float64frombits(v), b, err
+	case (prefix >= 0xd9) && (prefix <= 0xdb):
+		kind = "str"
+		length, err = n(1 << (prefix - 0xd9))
+	case (prefix == 0xdc) || (prefix == 0xdd):
+		kind = "array"
+		length, err = n(2 << (prefix - 0xdc))
+	case (prefix == 0xde) || (prefix == 0xdf):
+		kind = "map"
+		length, err = n(2 << (prefix - 0xde))
+	default:
+		return nil, nil, fmt.Errorf("unexpected MessagePack prefix %#x", prefix)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	switch kind {
+	case "str":
+		if uint64(len(b)) < length {
+			return nil, nil, fmt.Errorf("MessagePack string is truncated")
+		}
+		return string(b[:length]), b[length:], nil
+	case "array":
+		array := []interface{}{}
+		for i := uint64(0); i < length; i++ {
+			var value interface{}
+			if value, b, err = decodeMsgPack(b); err != nil {
+				return nil, nil, err
+			}
+			array = append(array, value)
+		}
+		return array, b, nil
+	}
+	object := map[string]interface{}{}
+	for i := uint64(0); i < length; i++ {
+		var key, value interface{}
+		if key, b, err = decodeMsgPack(b); err != nil {
+			return nil, nil, err
+		}
+		if value, b, err = decodeMsgPack(b); err != nil {
+			return nil, nil, err
+		}
+		object[fmt.Sprint(key)] = value
+	}
+	return object, b, nil
+}
+
+func TestMsgPackEncoding(t *testing.T) {
+	long := string(make([]byte, 40))
+	for _, test := range []struct {
+		value   interface{}
+		encoded string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{"", "a0"},
+		{"abc", "a3616263"},
+		{long, "d928" + hex.EncodeToString([]byte(long))},
+		{uint64(5), "05"},
+		{uint64(200), "ccc8"},
+		{uint32(70000), "ce00011170"},
+		{uint64(1) << 40, "cf0000010000000000"},
+		{-1, "ff"},
+		{-100, "d09c"},
+		{1.5, "cb3ff8000000000000"},
+		{float32(1.5), "ca3fc00000"},
+		{[]float64{}, "90"},
+		{[]uint32{1, 2}, "920102"},
+		{[]string{"a"}, "91a161"},
+		{time.Unix(1577836800, 0), "ce5e0be100"},
+	} {
+		b, err := appendMsgPack(nil, test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoded := hex.EncodeToString(b); encoded != test.encoded {
+			t.Errorf("%v (%T) is encoded as %s, expected %s", test.value, test.value, encoded, test.encoded)
+		}
+	}
+	large := make([]uint64, 70000)
+	b, err := appendMsgPack(nil, large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (b[0] != 0xdd) || (binary.BigEndian.Uint32(b[1:]) != 70000) || (len(b) != 5+70000) {
+		t.Errorf("array of %d elements has header %x", len(large), b[:5])
+	}
+	if _, err := appendMsgPack(nil, struct{}{}); err == nil {
+		t.Error("struct is encoded")
+	}
+
+	b, err = appendMsgPackMap(nil, []string{"id", "fv"}, []interface{}{"x", []float64{0.25}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, rest, err := decodeMsgPack(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]interface{}{"id": "x", "fv": []interface{}{0.25}}; !reflect.DeepEqual(value, expected) || (len(rest) != 0) {
+		t.Errorf("map is decoded as %v with %d bytes left", value, len(rest))
+	}
+}
+
+// TestMsgPackFiles checks that MessagePack files hold the rows of TSV files
+// of the same run, value after value.
+func TestMsgPackFiles(t *testing.T) {
+	cfg, dir := testConfig(t, 20)
+	testRun(t, cfg)
+	tsv := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+
+	cfg, dir = testConfig(t, 20)
+	cfg.File.Format = fileFormatMsgPack
+	testRun(t, cfg)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "control_objects.0001.msgpack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range tsv {
+		for j, field := range row {
+			var value interface{}
+			if value, data, err = decodeMsgPack(data); err != nil {
+				t.Fatal(err)
+			}
+			if seconds, ok := value.(uint64); ok && (j == 1) {
+				value = time.Unix(int64(seconds), 0).UTC()
+			}
+			if formatted := formatTSVValue(value); formatted != field {
+				t.Fatalf("column %d of row %d is %s, TSV has %s", j, i, formatted, field)
+			}
+		}
+	}
+	if len(data) != 0 {
+		t.Fatalf("%d bytes after the last row", len(data))
+	}
+	if err := (FileOutputCFG{Format: fileFormatMsgPack, Encoding: encodingCP1251}).validate(); err == nil {
+		t.Fatal("MessagePack files are written in Windows-1251")
+	}
+}
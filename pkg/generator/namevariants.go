@@ -0,0 +1,192 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"unicode"
+)
+
+// Kinds of name variants.
+const (
+	nameVariantTypo            = "typo"
+	nameVariantTransliteration = "transliteration"
+	nameVariantSwap            = "swap"
+)
+
+// NameVariantsCFG configures control objects duplicating the previous
+// person with varied names, for fuzzy-matching evaluation. Variants keep
+// sex and birth date of the canonical person and get a passport, FFVs and
+// other fields of their own.
+type NameVariantsCFG struct {
+	TypoRate            float64 `yaml:"typo_rate"`
+	TransliterationRate float64 `yaml:"transliteration_rate"`
+	// Swapped name and surname.
+	SwapRate   float64 `yaml:"swap_rate"`
+	LabelsPath string  `yaml:"labels_path"`
+}
+
+func (cfg NameVariantsCFG) validate() error {
+	rates := []float64{cfg.TypoRate, cfg.TransliterationRate, cfg.SwapRate}
+	sum := 0.0
+	for _, rate := range rates {
+		if rate < 0 {
+			return fmt.Errorf("rates of name variants must be non-negative")
+		}
+		sum += rate
+	}
+	if sum > 1 {
+		return fmt.Errorf("rates of name variants must sum up to at most 1")
+	}
+	return nil
+}
+
+func (cfg NameVariantsCFG) enabled() bool {
+	return cfg.TypoRate+cfg.TransliterationRate+cfg.SwapRate > 0
+}
+
+func (cfg NameVariantsCFG) pickKind(rnd *rand.Rand) string {
+	p := rnd.Float64()
+	switch {
+	case p < cfg.TypoRate:
+		return nameVariantTypo
+	case p < cfg.TypoRate+cfg.TransliterationRate:
+		return nameVariantTransliteration
+	case p < cfg.TypoRate+cfg.TransliterationRate+cfg.SwapRate:
+		return nameVariantSwap
+	}
+	return ""
+}
+
+// applyNameVariant copies names, sex and birth date of canonical to cob
+// and varies them. It returns the kind actually applied, since Latin names
+// have no transliteration variants and get typos instead, and the varied
+// fields.
+func applyNameVariant(rnd *rand.Rand, kind string, canonical controlObject, cob *controlObject) (string, string) {
+	cob.surname, cob.name, cob.patronymic = canonical.surname, canonical.name, canonical.patronymic
+	cob.sex, cob.birthDate = canonical.sex, canonical.birthDate
+	if kind == nameVariantSwap {
+		cob.surname, cob.name = cob.name, cob.surname
+		return kind, "surname,name"
+	}
+	field, value := "surname", &cob.surname
+	if rnd.Intn(2) == 1 {
+		field, value = "name", &cob.name
+	}
+	if kind == nameVariantTransliteration {
+		if transliterated, ok := transliterate(rnd, *value); ok {
+			*value = transliterated
+			return kind, field
+		}
+		kind = nameVariantTypo
+	}
+	*value = typo(rnd, *value)
+	return kind, field
+}
+
+// Keyboard rows of typos by adjacent keys.
+var keyboardRows = []string{
+	"qwertyuiop", "asdfghjkl", "zxcvbnm",
+	"йцукенгшщзхъ", "фывапролджэ", "ячсмитьбю",
+}
+
+func keyboardNeighbor(rnd *rand.Rand, r rune) (rune, bool) {
+	lower := unicode.ToLower(r)
+	for _, row := range keyboardRows {
+		keys := []rune(row)
+		for i, key := range keys {
+			if key != lower {
+				continue
+			}
+			neighbors := []rune{}
+			if i > 0 {
+				neighbors = append(neighbors, keys[i-1])
+			}
+			if i < len(keys)-1 {
+				neighbors = append(neighbors, keys[i+1])
+			}
+			neighbor := neighbors[rnd.Intn(len(neighbors))]
+			if unicode.IsUpper(r) {
+				neighbor = unicode.ToUpper(neighbor)
+			}
+			return neighbor, true
+		}
+	}
+	return r, false
+}
+
+// typo deletes, doubles or transposes a letter or hits an adjacent key. The
+// first letter is kept, as in most real typos.
+func typo(rnd *rand.Rand, s string) string {
+	runes := []rune(s)
+	if len(runes) < 3 {
+		return s
+	}
+	i := 1 + rnd.Intn(len(runes)-1)
+	switch rnd.Intn(4) {
+	case 0:
+		return string(append(runes[:i:i], runes[i+1:]...))
+	case 1:
+		return string(append(runes[:i+1:i+1], runes[i:]...))
+	case 2:
+		if i == len(runes)-1 {
+			i--
+		}
+		runes[i], runes[i+1] = runes[i+1], runes[i]
+		return string(runes)
+	}
+	if neighbor, ok := keyboardNeighbor(rnd, runes[i]); ok {
+		runes[i] = neighbor
+		return string(runes)
+	}
+	return string(append(runes[:i:i], runes[i+1:]...))
+}
+
+// Romanizations of Cyrillic letters, differing between systems of
+// passports and common usage.
+var (
+	cyrillic = []rune("абвгдеёжзийклмнопрстуфхцчшщъыьэюя")
+	// ICAO Doc 9303, used in Russian passports since 2013.
+	icaoRomanization = []string{
+		"a", "b", "v", "g", "d", "e", "e", "zh", "z", "i", "i", "k", "l", "m", "n", "o", "p", "r", "s", "t", "u", "f",
+		"kh", "ts", "ch", "sh", "shch", "ie", "y", "", "e", "iu", "ia",
+	}
+	// BGN/PCGN-like common spelling.
+	commonRomanization = []string{
+		"a", "b", "v", "g", "d", "e", "yo", "zh", "z", "i", "y", "k", "l", "m", "n", "o", "p", "r", "s", "t", "u", "f",
+		"kh", "ts", "ch", "sh", "shch", "", "y", "", "e", "yu", "ya",
+	}
+)
+
+// transliterate romanizes a Cyrillic name with a randomly chosen system. It
+// returns false for names without Cyrillic letters.
+func transliterate(rnd *rand.Rand, s string) (string, bool) {
+	system := icaoRomanization
+	if rnd.Intn(2) == 1 {
+		system = commonRomanization
+	}
+	b := strings.Builder{}
+	found := false
+	for _, r := range s {
+		latin, ok := romanize(system, unicode.ToLower(r))
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		found = true
+		if unicode.IsUpper(r) && (latin != "") {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+		b.WriteString(latin)
+	}
+	return b.String(), found
+}
+
+func romanize(system []string, r rune) (string, bool) {
+	for i, c := range cyrillic {
+		if c == r {
+			return system[i], true
+		}
+	}
+	return "", false
+}
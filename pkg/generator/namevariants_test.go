@@ -0,0 +1,148 @@
+package generator
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// editDistance is the Damerau-Levenshtein distance of adjacent
+// transpositions, insertions, deletions and substitutions.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if (i > 1) && (j > 1) && (s[i-1] == t[j-2]) && (s[i-2] == t[j-1]) {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func TestTypo(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// Names shorter than 3 letters are kept.
+		changed bool
+	}{
+		{"Иванов", true},
+		{"Smith", true},
+		{"Ann", true},
+		{"Ли", false},
+		{"", false},
+	} {
+		for seed := int64(0); seed < 200; seed++ {
+			got := typo(rand.New(rand.NewSource(seed)), test.name)
+			if !test.changed {
+				if got != test.name {
+					t.Errorf("typo of %q is %q", test.name, got)
+				}
+				continue
+			}
+			if []rune(got)[0] != []rune(test.name)[0] {
+				t.Errorf("typo %q of %q changes the first letter", got, test.name)
+			}
+			// Transposed or doubled equal letters leave the name as is.
+			if distance := editDistance(got, test.name); distance > 1 {
+				t.Errorf("typo %q of %q is %d edits away", got, test.name, distance)
+			}
+		}
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		// Romanizations of both systems, nil for names without Cyrillic
+		// letters.
+		expected []string
+	}{
+		{"Юлия", []string{"Iuliia", "Yuliya"}},
+		{"Щукин", []string{"Shchukin"}},
+		{"Ёлкин", []string{"Elkin", "Yolkin"}},
+		{"Подъячев", []string{"Podieiachev", "Podyachev"}},
+		{"Андрей", []string{"Andrei", "Andrey"}},
+		{"Анна-Мария", []string{"Anna-Mariia", "Anna-Mariya"}},
+		{"Smith", nil},
+	} {
+		seen := map[string]bool{}
+		for seed := int64(0); seed < 64; seed++ {
+			got, ok := transliterate(rand.New(rand.NewSource(seed)), test.name)
+			if ok != (test.expected != nil) {
+				t.Fatalf("transliterate(%q) found Cyrillic letters: %v", test.name, ok)
+			}
+			seen[got] = true
+		}
+		if test.expected == nil {
+			continue
+		}
+		got := []string{}
+		for name := range seen {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%q is transliterated as %v, expected %v", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestApplyNameVariant(t *testing.T) {
+	canonical := controlObject{surname: "Иванов", name: "Пётр", patronymic: "Сергеевич", sex: "M", birthDate: "1990-01-01"}
+	latin := controlObject{surname: "Smith", name: "John", sex: "M", birthDate: "1990-01-01"}
+	for _, test := range []struct {
+		name      string
+		kind      string
+		canonical controlObject
+		applied   string
+	}{
+		{"swap", nameVariantSwap, canonical, nameVariantSwap},
+		{"typo", nameVariantTypo, canonical, nameVariantTypo},
+		{"transliteration", nameVariantTransliteration, canonical, nameVariantTransliteration},
+		// Latin names have no transliterations and get typos.
+		{"latin transliteration", nameVariantTransliteration, latin, nameVariantTypo},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cob := controlObject{passport: "12 34 567890"}
+			applied, fields := applyNameVariant(rand.New(rand.NewSource(1)), test.kind, test.canonical, &cob)
+			if applied != test.applied {
+				t.Errorf("applied %s, expected %s", applied, test.applied)
+			}
+			if (cob.patronymic != test.canonical.patronymic) || (cob.sex != test.canonical.sex) ||
+				(cob.birthDate != test.canonical.birthDate) || (cob.passport != "12 34 567890") {
+				t.Errorf("variant %+v changes fields other than names", cob)
+			}
+			switch fields {
+			case "surname,name":
+				if (cob.surname != test.canonical.name) || (cob.name != test.canonical.surname) {
+					t.Errorf("names of %+v are not swapped", cob)
+				}
+			case "surname":
+				if cob.name != test.canonical.name {
+					t.Errorf("name of %+v is varied with surname", cob)
+				}
+			case "name":
+				if cob.surname != test.canonical.surname {
+					t.Errorf("surname of %+v is varied with name", cob)
+				}
+			default:
+				t.Errorf("unknown varied fields %q", fields)
+			}
+		})
+	}
+}
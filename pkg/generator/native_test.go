@@ -0,0 +1,321 @@
+package generator
+
+import (
+	"bufio"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kshvakov/clickhouse/lib/binary"
+	"github.com/kshvakov/clickhouse/lib/column"
+	"github.com/kshvakov/clickhouse/lib/data"
+	"github.com/kshvakov/clickhouse/lib/protocol"
+	"github.com/nofacedb/generator/pkg/storage/sinktest"
+)
+
+// fakeNative serves the part of the ClickHouse native protocol inserts of
+// the driver need: hello, pings and INSERT queries with data blocks. Rows
+// are decoded with types of their columns and stored when the last block of
+// an insert is received. Other queries are answered by answer.
+type fakeNative struct {
+	listener net.Listener
+	b        *fakeBackend
+	// ClickHouse types of columns by name.
+	types map[string]string
+	info  data.ServerInfo
+	// Answers queries other than inserts, nil fails them.
+	answer func(query string) (nativeResult, error)
+}
+
+// nativeResult is the result of a query other than inserts: rows of columns
+// with names and ClickHouse types, none for queries without results.
+type nativeResult struct {
+	names, types []string
+	rows         [][]interface{}
+}
+
+var nativeInsertQuery = regexp.MustCompile(`^INSERT INTO (\S+) \((.*)\) VALUES`)
+
+func newFakeNative(t *testing.T, b *fakeBackend, types map[string]string) *fakeNative {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNative{
+		listener: listener,
+		b:        b,
+		types:    types,
+		info:     data.ServerInfo{Name: "ClickHouse", Revision: data.ClickHouseRevision, Timezone: time.UTC},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNative) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeNative) close() {
+	s.listener.Close()
+}
+
+func (s *fakeNative) serve(conn net.Conn) {
+	defer conn.Close()
+	w := bufio.NewWriter(conn)
+	decoder, encoder := binary.NewDecoder(fullReader{bufio.NewReader(conn)}), binary.NewEncoder(w)
+	// Hello of the client: name, version, revision, database, user and
+	// password.
+	if packet, err := decoder.Uvarint(); (err != nil) || (packet != protocol.ClientHello) {
+		return
+	}
+	if _, err := readNativeFields(decoder, "s", "u", "u", "u", "s", "s", "s"); err != nil {
+		return
+	}
+	encoder.Uvarint(protocol.ServerHello)
+	encoder.String(s.info.Name)
+	encoder.Uvarint(1)
+	encoder.Uvarint(1)
+	encoder.Uvarint(s.info.Revision)
+	encoder.String(s.info.Timezone.String())
+	encoder.Flush()
+
+	for {
+		packet, err := decoder.Uvarint()
+		if err != nil {
+			return
+		}
+		switch packet {
+		case protocol.ClientPing:
+			encoder.Uvarint(protocol.ServerPong)
+		case protocol.ClientQuery:
+			if err := s.query(decoder, encoder); err != nil {
+				s.exception(encoder, err)
+				encoder.Flush()
+				return
+			}
+		default:
+			return
+		}
+		if encoder.Flush() != nil {
+			return
+		}
+	}
+}
+
+// fullReader fills buffers of reads, which the decoder of the driver
+// expects like the connection of the driver does.
+type fullReader struct {
+	r io.Reader
+}
+
+func (r fullReader) Read(p []byte) (int, error) {
+	return io.ReadFull(r.r, p)
+}
+
+// readNativeFields reads fields of a packet, strings for "s" and unsigned
+// varints for "u", and returns the strings.
+func readNativeFields(decoder *binary.Decoder, kinds ...string) ([]string, error) {
+	fields := []string{}
+	for _, kind := range kinds {
+		if kind == "u" {
+			if _, err := decoder.Uvarint(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		field, err := decoder.String()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func (s *fakeNative) readBlock(decoder *binary.Decoder) (*data.Block, error) {
+	if packet, err := decoder.Uvarint(); err != nil {
+		return nil, err
+	} else if packet != protocol.ClientData {
+		return nil, fmt.Errorf("unexpected packet %d", packet)
+	}
+	// Name of a temporary table.
+	if _, err := decoder.String(); err != nil {
+		return nil, err
+	}
+	block := &data.Block{}
+	if err := block.Read(&s.info, decoder); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// query reads a query with its empty data block, receives data blocks of
+// inserts and stores their rows.
+func (s *fakeNative) query(decoder *binary.Decoder, encoder *binary.Encoder) error {
+	// Query ID, client info with the quota key, end of settings, state and
+	// compression, then the query.
+	fields, err := readNativeFields(decoder, "s", "u", "s", "s", "s", "u", "s", "s", "s", "u", "u", "u", "s", "s",
+		"u", "u", "s")
+	if err != nil {
+		return err
+	}
+	query := fields[len(fields)-1]
+	if _, err := s.readBlock(decoder); err != nil {
+		return err
+	}
+	match := nativeInsertQuery.FindStringSubmatch(query)
+	if match == nil {
+		if s.answer == nil {
+			return fmt.Errorf("Syntax error: %s", query)
+		}
+		result, err := s.answer(query)
+		if err != nil {
+			return err
+		}
+		return s.result(encoder, result)
+	}
+
+	// The sample block tells the client columns and their types.
+	names := strings.Split(match[2], ", ")
+	sample := &data.Block{NumColumns: uint64(len(names))}
+	for _, name := range names {
+		c, err := column.Factory(name, s.types[name], s.info.Timezone)
+		if err != nil {
+			return err
+		}
+		sample.Columns = append(sample.Columns, c)
+	}
+	encoder.Uvarint(protocol.ServerData)
+	encoder.String("")
+	if err := sample.Write(&s.info, encoder); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	records := []map[string]interface{}{}
+	for {
+		block, err := s.readBlock(decoder)
+		if err != nil {
+			return err
+		}
+		// An empty block ends data of the insert.
+		if (block.NumColumns == 0) && (block.NumRows == 0) {
+			break
+		}
+		for row := 0; row < int(block.NumRows); row++ {
+			record := map[string]interface{}{}
+			for i, c := range block.Columns {
+				record[c.Name()] = block.Values[i][row]
+			}
+			records = append(records, record)
+		}
+	}
+	if !s.b.store(match[1], records) {
+		return fmt.Errorf("Memory limit exceeded")
+	}
+	encoder.Uvarint(protocol.ServerEndOfStream)
+	return nil
+}
+
+// result sends the header block of result and a block of its rows.
+func (s *fakeNative) result(encoder *binary.Encoder, result nativeResult) error {
+	if len(result.names) != 0 {
+		blocks := []*data.Block{{}, {}}
+		for _, block := range blocks {
+			block.NumColumns = uint64(len(result.names))
+			for i, name := range result.names {
+				c, err := column.Factory(name, result.types[i], s.info.Timezone)
+				if err != nil {
+					return err
+				}
+				block.Columns = append(block.Columns, c)
+			}
+		}
+		for _, row := range result.rows {
+			values := make([]driver.Value, len(row))
+			for i, value := range row {
+				values[i] = value
+			}
+			if err := blocks[1].AppendRow(values); err != nil {
+				return err
+			}
+		}
+		for _, block := range blocks {
+			encoder.Uvarint(protocol.ServerData)
+			encoder.String("")
+			if err := block.Write(&s.info, encoder); err != nil {
+				return err
+			}
+		}
+	}
+	encoder.Uvarint(protocol.ServerEndOfStream)
+	return nil
+}
+
+// connect returns a database of the server.
+func (s *fakeNative) connect(t *testing.T) *sql.DB {
+	db, err := connectClickHouse(StorageCFG{Addr: "127.0.0.1", Port: s.port(), MaxPings: 1}, &logger{quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (s *fakeNative) exception(encoder *binary.Encoder, err error) {
+	encoder.Uvarint(protocol.ServerException)
+	encoder.Int32(241)
+	encoder.String("DB::Exception")
+	encoder.String(err.Error())
+	encoder.String("")
+	encoder.Bool(false)
+}
+
+func TestClickHouseDriverConformance(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		schema SchemaCFG
+	}{
+		{"default", SchemaCFG{}},
+		{"mapped", SchemaCFG{
+			ControlObjects: TableSchemaCFG{Name: "persons", Columns: map[string]string{"passport": "document"}},
+			FFVs:           TableSchemaCFG{Name: "faces", Columns: map[string]string{"img_id": omittedColumn}},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := testInsertOptions(t, test.schema)
+			types := map[string]string{}
+			for _, m := range []*tableMapping{opts.cobTable, opts.ffvTable} {
+				for column, columnType := range columnTypes {
+					if name := m.column(column); name != "" {
+						types[name] = columnType
+					}
+				}
+			}
+			sink := driverSink{cobTable: opts.cobTable.name, ffvTable: opts.ffvTable.name}
+			sinktest.Run(t, func(t *testing.T) (sinktest.Sink, sinktest.Backend) {
+				b := newFakeBackend()
+				server := newFakeNative(t, b, types)
+				t.Cleanup(server.close)
+				sink.d = clickHouseDriver{db: server.connect(t), opts: opts}
+				return sink, b
+			}, sink.contract(true))
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const naturalKeyColumn = "natural_key"
+
+// naturalKey identifies a person by passport and birth date, next to the
+// surrogate UUID. It equals lower(hex(SHA256(concat(passport, '|',
+// birthdate)))) in ClickHouse.
+func naturalKey(passport, birthDate string) string {
+	sum := sha256.Sum256([]byte(passport + "|" + birthDate))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,38 @@
+package generator
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNaturalKey(t *testing.T) {
+	// lower(hex(SHA256(concat('12 34 567890', '|', '1990-01-01')))) in ClickHouse.
+	expected := "089d3dc06b545f3f0b1e287964335eac61e182158a2b93da6233083a8a18d175"
+	if key := naturalKey("12 34 567890", "1990-01-01"); key != expected {
+		t.Errorf("natural key is %s, expected %s", key, expected)
+	}
+
+	// Exact duplicates are other control objects of the same person.
+	cfg, dir := testConfig(t, 100)
+	cfg.GeneratorCFG.NaturalKey = true
+	cfg.GeneratorCFG.DuplicateRate = 0.2
+	testRun(t, cfg)
+	ids := map[string]string{}
+	shared := 0
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		if len(row) != len(controlObjectsColumns)+1 {
+			t.Fatalf("control object has %d columns, expected %d with the natural key", len(row), len(controlObjectsColumns)+1)
+		}
+		key := row[len(row)-1]
+		if key != naturalKey(row[2], row[7]) {
+			t.Errorf("natural key of passport %s and birth date %s is %s", row[2], row[7], key)
+		}
+		if id, ok := ids[key]; ok && (id != row[0]) {
+			shared++
+		}
+		ids[key] = row[0]
+	}
+	if (shared < 10) || (shared > 30) {
+		t.Errorf("%d of 100 control objects share natural keys with others, expected about 20 duplicates", shared)
+	}
+}
@@ -0,0 +1,69 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	optimizeFinal      = "final"
+	optimizeWaitMerges = "wait_merges"
+)
+
+var generatedTables = []string{"control_objects", "facial_features"}
+
+// OptimizeCFG configures OPTIMIZE FINAL of tables or waiting for their merges
+// after runs.
+type OptimizeCFG struct {
+	Mode           string `yaml:"mode"`
+	PollIntervalMS int    `yaml:"poll_interval_ms"`
+	TimeoutMS      int    `yaml:"timeout_ms"`
+}
+
+const activeMergesQuery = `
+SELECT
+    count()
+FROM
+    system.merges
+WHERE
+    database = currentDatabase() AND table IN (%s);
+`
+
+func optimizeTables(ctx context.Context, db *sql.DB, cfg OptimizeCFG, opts insertOptions) (time.Duration, error) {
+	startTime := time.Now()
+	switch cfg.Mode {
+	case optimizeFinal:
+		for _, table := range opts.tableNames() {
+			if _, err := db.ExecContext(ctx, fmt.Sprintf("OPTIMIZE TABLE %s FINAL", table)); err != nil {
+				return 0, errors.Wrapf(err, "unable to optimize table %s", table)
+			}
+		}
+	case optimizeWaitMerges:
+		pollInterval := time.Duration(cfg.PollIntervalMS) * time.Millisecond
+		if pollInterval <= 0 {
+			pollInterval = time.Second
+		}
+		for {
+			merges := 0
+			if err := db.QueryRowContext(ctx, fmt.Sprintf(activeMergesQuery, opts.tableList())).Scan(&merges); err != nil {
+				return 0, errors.Wrap(err, "unable to query active merges")
+			}
+			if merges == 0 {
+				break
+			}
+			if (cfg.TimeoutMS > 0) && (time.Now().Sub(startTime) > time.Duration(cfg.TimeoutMS)*time.Millisecond) {
+				return 0, fmt.Errorf("merges did not settle in %dms, %d still running", cfg.TimeoutMS, merges)
+			}
+			if err := sleepContext(ctx, pollInterval); err != nil {
+				return 0, err
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown optimize mode \"%s\"", cfg.Mode)
+	}
+	return time.Now().Sub(startTime), nil
+}
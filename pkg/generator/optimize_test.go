@@ -0,0 +1,67 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOptimizeTables(t *testing.T) {
+	opts := testInsertOptions(t, SchemaCFG{ControlObjects: TableSchemaCFG{Name: "persons"}})
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	mu := sync.Mutex{}
+	queries := []string{}
+	// Merges settle after two polls.
+	merges := []uint64{2, 1, 0}
+	server.answer = func(query string) (nativeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, strings.TrimSpace(query))
+		if !strings.Contains(query, "system.merges") {
+			return nativeResult{}, nil
+		}
+		if !strings.Contains(query, "'persons', 'facial_features'") {
+			return nativeResult{}, fmt.Errorf("merges of other tables are polled: %s", query)
+		}
+		n := merges[0]
+		if len(merges) > 1 {
+			merges = merges[1:]
+		}
+		return nativeResult{names: []string{"count()"}, types: []string{"UInt64"}, rows: [][]interface{}{{n}}}, nil
+	}
+	db := server.connect(t)
+	ctx := context.Background()
+
+	if _, err := optimizeTables(ctx, db, OptimizeCFG{Mode: optimizeFinal}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"OPTIMIZE TABLE persons FINAL", "OPTIMIZE TABLE facial_features FINAL"}; !reflect.DeepEqual(queries, expected) {
+		t.Errorf("final optimizes with %q, expected %q", queries, expected)
+	}
+
+	mu.Lock()
+	queries = nil
+	mu.Unlock()
+	if _, err := optimizeTables(ctx, db, OptimizeCFG{Mode: optimizeWaitMerges, PollIntervalMS: 1}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 3 {
+		t.Errorf("merges are polled %d times, expected 3 until they settle", len(queries))
+	}
+
+	// Merges never settle.
+	mu.Lock()
+	merges = []uint64{1}
+	mu.Unlock()
+	_, err := optimizeTables(ctx, db, OptimizeCFG{Mode: optimizeWaitMerges, PollIntervalMS: 1, TimeoutMS: 10}, opts)
+	if (err == nil) || !strings.Contains(err.Error(), "did not settle") {
+		t.Errorf("merges running after the timeout return %v", err)
+	}
+	if _, err := optimizeTables(ctx, db, OptimizeCFG{Mode: "merge"}, opts); err == nil {
+		t.Error("unknown optimize mode is accepted")
+	}
+}
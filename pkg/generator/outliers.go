@@ -0,0 +1,47 @@
+package generator
+
+import (
+	"math"
+	"math/rand"
+)
+
+const (
+	outlierZeros      = "zeros"
+	outlierExtreme    = "extreme"
+	outlierOutOfRange = "out_of_range"
+)
+
+var outlierKinds = []string{outlierZeros, outlierExtreme, outlierOutOfRange}
+
+// OutliersCFG configures anomalous vectors planted among FFVs.
+type OutliersCFG struct {
+	Rate       float64 `yaml:"rate"`
+	LabelsPath string  `yaml:"labels_path"`
+}
+
+func (cfg OutliersCFG) pickKind(rnd *rand.Rand) string {
+	if (cfg.Rate <= 0) || (rnd.Float64() >= cfg.Rate) {
+		return ""
+	}
+	return outlierKinds[rnd.Intn(len(outlierKinds))]
+}
+
+func generateOutlierFFV(rnd *rand.Rand, kind string, dim int) []float64 {
+	ffv := make([]float64, dim)
+	switch kind {
+	case outlierExtreme:
+		// Stand-ins for NaN/Inf, which ClickHouse Float64 arrays accept but
+		// most distance functions propagate.
+		for i := 0; i < len(ffv); i++ {
+			ffv[i] = math.MaxFloat64
+			if rnd.Intn(2) == 0 {
+				ffv[i] = -math.MaxFloat64
+			}
+		}
+	case outlierOutOfRange:
+		for i := 0; i < len(ffv); i++ {
+			ffv[i] = (rnd.Float64()*2.0 - 1.0) * 1e6
+		}
+	}
+	return ffv
+}
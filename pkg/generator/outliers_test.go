@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// parseTSVVector parses a Float64 array of a TSV file.
+func parseTSVVector(t *testing.T, field string) []float64 {
+	elems := strings.Split(strings.Trim(field, "[]"), ",")
+	v := make([]float64, len(elems))
+	for i, elem := range elems {
+		var err error
+		if v[i], err = strconv.ParseFloat(elem, 64); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return v
+}
+
+// TestOutliers checks that labelled outliers hold vectors of their kinds,
+// which are never normalized, and other FFVs are.
+func TestOutliers(t *testing.T) {
+	cfg, dir := testConfig(t, 300)
+	cfg.GeneratorCFG.Outliers = OutliersCFG{Rate: 0.2, LabelsPath: filepath.Join(dir, "outliers.tsv")}
+	cfg.GeneratorCFG.FFV.Normalize = true
+	testRun(t, cfg)
+
+	vectors := map[string][]float64{}
+	cobIDs := map[string]string{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		vectors[row[0]], cobIDs[row[0]] = parseTSVVector(t, row[4]), row[1]
+	}
+	labels := readLabels(t, cfg.GeneratorCFG.Outliers.LabelsPath)
+	if rate := float64(len(labels)) / float64(len(vectors)); (rate < 0.1) || (rate > 0.3) {
+		t.Errorf("%d of %d FFVs are outliers, expected about 20%%", len(labels), len(vectors))
+	}
+	kinds := map[string]int{}
+	for _, label := range labels {
+		v, ok := vectors[label[0]]
+		if !ok || (cobIDs[label[0]] != label[1]) {
+			t.Fatalf("label %q refers to a missing FFV", label)
+		}
+		kinds[label[2]]++
+		for _, x := range v {
+			var valid bool
+			switch label[2] {
+			case outlierZeros:
+				valid = x == 0
+			case outlierExtreme:
+				valid = math.Abs(x) == math.MaxFloat64
+			case outlierOutOfRange:
+				valid = math.Abs(x) < 1e6
+			}
+			if !valid {
+				t.Fatalf("%s outlier %s has element %v", label[2], label[0], x)
+			}
+		}
+		if (label[2] == outlierOutOfRange) && (norm(v) < 1e3) {
+			t.Errorf("out of range outlier %s has norm %v", label[0], norm(v))
+		}
+		delete(vectors, label[0])
+	}
+	if len(kinds) != len(outlierKinds) {
+		t.Errorf("outliers are only of kinds %v", kinds)
+	}
+	for id, v := range vectors {
+		if math.Abs(norm(v)-1) > 1e-6 {
+			t.Fatalf("FFV %s is not labelled but has norm %v", id, norm(v))
+		}
+	}
+}
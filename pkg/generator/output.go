@@ -0,0 +1,43 @@
+package generator
+
+import (
+	"fmt"
+	"time"
+)
+
+// logger prints informational output of a run. Quiet loggers of runs in
+// machine mode print nothing, so that a run prints exactly one parseable
+// summary line. A nil logger prints.
+type logger struct {
+	quiet bool
+}
+
+func (l *logger) logf(format string, args ...interface{}) {
+	if (l == nil) || !l.quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+func (l *logger) logln(args ...interface{}) {
+	if (l == nil) || !l.quiet {
+		fmt.Println(args...)
+	}
+}
+
+// machineSummary returns the line a run in machine mode prints, with the
+// error of failed runs.
+func machineSummary(err error, inserted int64, elapsed time.Duration, seed int64) string {
+	status := "ok"
+	if _, ok := err.(*sloViolationError); ok {
+		status = "slo_violated"
+	} else if _, ok := err.(*verifyError); ok {
+		status = "verify_failed"
+	} else if err != nil {
+		status = "error"
+	}
+	summary := fmt.Sprintf("status=%s rows=%d duration=%v seed=%d", status, inserted, elapsed, seed)
+	if err != nil {
+		summary += fmt.Sprintf(" error=%q", err.Error())
+	}
+	return summary
+}
@@ -0,0 +1,64 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMachineSummary(t *testing.T) {
+	for _, test := range []struct {
+		err     error
+		summary string
+	}{
+		{nil, "status=ok rows=10 duration=1.5s seed=42"},
+		{&verifyError{failures: []string{"3 pairs missing"}},
+			`status=verify_failed rows=10 duration=1.5s seed=42 error="verification failed: 3 pairs missing"`},
+		{&sloViolationError{violations: []string{"p99"}}, `status=slo_violated rows=10 duration=1.5s seed=42 error="SLOs violated: p99"`},
+		{fmt.Errorf("unable to \"connect\""), `status=error rows=10 duration=1.5s seed=42 error="unable to \"connect\""`},
+	} {
+		if summary := machineSummary(test.err, 10, 1500*time.Millisecond, 42); summary != test.summary {
+			t.Errorf("summary of %v is %s, expected %s", test.err, summary, test.summary)
+		}
+	}
+}
+
+// captureStdout returns what f prints to the standard output.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	output := make(chan []byte)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		output <- data
+	}()
+	f()
+	w.Close()
+	return string(<-output)
+}
+
+// TestMachineModeIsQuiet checks that runs in machine mode print nothing
+// themselves, leaving the summary line alone in the output.
+func TestMachineModeIsQuiet(t *testing.T) {
+	cfg, _ := testConfig(t, 20)
+	if output := captureStdout(t, func() { testRun(t, cfg) }); output != "" {
+		t.Errorf("run in machine mode prints:\n%s", output)
+	}
+	cfg, _ = testConfig(t, 20)
+	output := captureStdout(t, func() {
+		if _, err := run(context.Background(), cfg, Options{}, 1, nil, time.Now(), &logger{}); err != nil {
+			t.Error(err)
+		}
+	})
+	if output == "" {
+		t.Error("run prints nothing outside machine mode")
+	}
+}
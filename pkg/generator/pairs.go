@@ -0,0 +1,86 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	distanceCosine = "cosine"
+	distanceL2     = "l2"
+)
+
+// PlantedPairsCFG configures FFV pairs planted at exact distances. A planted
+// vector's partner becomes the FFV of the next generated control object.
+type PlantedPairsCFG struct {
+	Rate       float64   `yaml:"rate"`
+	Metric     string    `yaml:"metric"`
+	Distances  []float64 `yaml:"distances"`
+	LabelsPath string    `yaml:"labels_path"`
+}
+
+func (cfg PlantedPairsCFG) validate() error {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+	if len(cfg.Distances) == 0 {
+		return fmt.Errorf("no distances to plant pairs at")
+	}
+	for _, distance := range cfg.Distances {
+		switch {
+		case (cfg.Metric == distanceCosine) && ((distance < 0) || (distance > 2)):
+			return fmt.Errorf("cosine distance %v is out of [0, 2]", distance)
+		case (cfg.Metric == distanceL2) && (distance < 0):
+			return fmt.Errorf("L2 distance %v is negative", distance)
+		case (cfg.Metric != distanceCosine) && (cfg.Metric != distanceL2):
+			return fmt.Errorf("unknown distance metric \"%s\"", cfg.Metric)
+		}
+	}
+	return nil
+}
+
+func (cfg PlantedPairsCFG) pickDistance(rnd *rand.Rand) (float64, bool) {
+	if (cfg.Rate <= 0) || (rnd.Float64() >= cfg.Rate) {
+		return 0, false
+	}
+	return cfg.Distances[rnd.Intn(len(cfg.Distances))], true
+}
+
+type plantedPartner struct {
+	ffvID    string
+	distance float64
+	vector   []float64
+}
+
+func norm(v []float64) float64 {
+	sum := 0.0
+	for _, x := range v {
+		sum += x * x
+	}
+	return math.Sqrt(sum)
+}
+
+func plantPartner(rnd *rand.Rand, v []float64, metric string, distance float64) []float64 {
+	n := norm(v)
+	u := make([]float64, len(v))
+	for i := range v {
+		u[i] = v[i] / n
+	}
+	w := randomOrthonormal(rnd, [][]float64{u}, len(v))
+
+	partner := make([]float64, len(v))
+	switch metric {
+	case distanceCosine:
+		// Rotate v by angle with cos = 1 - distance keeping its norm.
+		angle := math.Acos(1 - distance)
+		for i := range partner {
+			partner[i] = n * (math.Cos(angle)*u[i] + math.Sin(angle)*w[i])
+		}
+	case distanceL2:
+		for i := range partner {
+			partner[i] = v[i] + distance*w[i]
+		}
+	}
+	return partner
+}
@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func cosineDistance(a, b []float64) float64 {
+	dot := 0.0
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot/norm(a)/norm(b)
+}
+
+func l2Distance(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return math.Sqrt(sum)
+}
+
+func TestPlantPartner(t *testing.T) {
+	for _, test := range []struct {
+		metric    string
+		distances []float64
+		distance  func(a, b []float64) float64
+	}{
+		{distanceCosine, []float64{0, 0.05, 0.3, 1, 1.7, 2}, cosineDistance},
+		{distanceL2, []float64{0, 0.01, 0.5, 3}, l2Distance},
+	} {
+		for _, dim := range []int{2, 16, 128} {
+			rnd := rand.New(rand.NewSource(int64(dim)))
+			for _, distance := range test.distances {
+				v := make([]float64, dim)
+				for i := range v {
+					v[i] = rnd.Float64()*2 - 1
+				}
+				partner := plantPartner(rnd, v, test.metric, distance)
+				if got := test.distance(v, partner); math.Abs(got-distance) > 1e-9 {
+					t.Errorf("%s distance %v in %d dimensions is planted at %v", test.metric, distance, dim, got)
+				}
+				// Cosine partners keep the norm of the vector.
+				if (test.metric == distanceCosine) && (math.Abs(norm(partner)-norm(v)) > 1e-9) {
+					t.Errorf("cosine partner of norm %v has norm %v", norm(v), norm(partner))
+				}
+			}
+		}
+	}
+}
+
+func TestPlantedPairsValidate(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		cfg   PlantedPairsCFG
+		valid bool
+	}{
+		{"disabled", PlantedPairsCFG{}, true},
+		{"cosine", PlantedPairsCFG{Rate: 0.1, Metric: distanceCosine, Distances: []float64{0, 2}}, true},
+		{"l2", PlantedPairsCFG{Rate: 0.1, Metric: distanceL2, Distances: []float64{10}}, true},
+		{"no distances", PlantedPairsCFG{Rate: 0.1, Metric: distanceL2}, false},
+		{"cosine above 2", PlantedPairsCFG{Rate: 0.1, Metric: distanceCosine, Distances: []float64{2.1}}, false},
+		{"negative l2", PlantedPairsCFG{Rate: 0.1, Metric: distanceL2, Distances: []float64{-1}}, false},
+		{"unknown metric", PlantedPairsCFG{Rate: 0.1, Metric: "dot", Distances: []float64{1}}, false},
+	} {
+		if err := test.cfg.validate(); (err == nil) != test.valid {
+			t.Errorf("%s: validate() = %v", test.name, err)
+		}
+	}
+}
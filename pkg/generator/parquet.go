@@ -0,0 +1,491 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const defaultParquetRowGroupRows = 10000
+
+// Parquet physical and converted types, encodings and codecs used by
+// parquetWriter, numbered as in parquet.thrift.
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetRepeated = 2
+
+	parquetUTF8            = 0
+	parquetList            = 3
+	parquetTimestampMillis = 9
+	parquetUInt32          = 13
+	parquetUInt64          = 14
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetUncompressed = 0
+	parquetGzip         = 2
+	parquetZstd         = 6
+)
+
+// parquetColumn is a required column, or a required list of required
+// elements, buffered for the current row group.
+type parquetColumn struct {
+	name      string
+	physical  int32
+	converted int32
+	list      bool
+	values    bytes.Buffer
+	numValues int
+	defLevels []byte
+	repLevels []byte
+}
+
+// newParquetColumn maps a ClickHouse column type to Parquet.
+func newParquetColumn(name, columnType string) (*parquetColumn, error) {
+	c := &parquetColumn{name: name}
+	if strings.HasPrefix(columnType, "Array(") {
+		c.list = true
+		columnType = strings.TrimSuffix(strings.TrimPrefix(columnType, "Array("), ")")
+	}
+	switch columnType {
+	case "String", "UUID":
+		c.physical, c.converted = parquetByteArray, parquetUTF8
+	case "DateTime":
+		c.physical, c.converted = parquetInt64, parquetTimestampMillis
+	case "UInt32":
+		c.physical, c.converted = parquetInt32, parquetUInt32
+	case "UInt64":
+		c.physical, c.converted = parquetInt64, parquetUInt64
+	case "Float64":
+		c.physical, c.converted = parquetDouble, -1
+	default:
+		return nil, fmt.Errorf("column %s of type %s can not be written to Parquet", name, columnType)
+	}
+	return c, nil
+}
+
+func (c *parquetColumn) add(value interface{}) error {
+	if !c.list {
+		return c.addValue(value)
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("column %s expects an array, got %T", c.name, value)
+	}
+	if rv.Len() == 0 {
+		c.defLevels, c.repLevels = append(c.defLevels, 0), append(c.repLevels, 0)
+		return nil
+	}
+	for i := 0; i < rv.Len(); i++ {
+		rep := byte(1)
+		if i == 0 {
+			rep = 0
+		}
+		c.defLevels, c.repLevels = append(c.defLevels, 1), append(c.repLevels, rep)
+		if err := c.addValue(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addValue appends a value in PLAIN encoding.
+func (c *parquetColumn) addValue(value interface{}) error {
+	c.numValues++
+	rv := reflect.ValueOf(value)
+	switch {
+	case c.physical == parquetByteArray && rv.Kind() == reflect.String:
+		putUint32(&c.values, uint32(rv.Len()))
+		c.values.WriteString(rv.String())
+	case c.converted == parquetTimestampMillis:
+		t, ok := value.(time.Time)
+		if !ok {
+			return fmt.Errorf("column %s expects a timestamp, got %T", c.name, value)
+		}
+		putUint64(&c.values, uint64(t.UnixNano()/int64(time.Millisecond)))
+	case c.physical == parquetInt32 && rv.Kind() == reflect.Uint32:
+		putUint32(&c.values, uint32(rv.Uint()))
+	case c.physical == parquetInt64 && rv.Kind() == reflect.Uint64:
+		putUint64(&c.values, rv.Uint())
+	case c.physical == parquetDouble && rv.Kind() == reflect.Float64:
+		putUint64(&c.values, math.Float64bits(rv.Float()))
+	default:
+		return fmt.Errorf("column %s can not hold %T", c.name, value)
+	}
+	return nil
+}
+
+// levelEntries is the number of values including empty lists.
+func (c *parquetColumn) levelEntries() int {
+	if c.list {
+		return len(c.defLevels)
+	}
+	return c.numValues
+}
+
+func (c *parquetColumn) reset() {
+	c.values.Reset()
+	c.numValues = 0
+	c.defLevels, c.repLevels = c.defLevels[:0], c.repLevels[:0]
+}
+
+// parquetWriter writes rows into one Parquet file with a data page per
+// column chunk of every row group.
+type parquetWriter struct {
+	w         *countingWriter
+	columns   []*parquetColumn
+	groupSize int
+	// Compresses pages, nil for uncompressed pages.
+	compression *compressor
+	rows        int
+	totalRows   int64
+	groups      []parquetRowGroup
+	// Size of the file if pages were not compressed.
+	uncompressed int64
+}
+
+type parquetRowGroup struct {
+	rows   int
+	bytes  int64
+	chunks []parquetChunk
+}
+
+type parquetChunk struct {
+	offset           int64
+	numValues        int
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+// newParquetWriter writes the magic number and returns a writer of the
+// columns with types. Pages are compressed with gzip or zstd of compression
+// when it is not nil.
+func newParquetWriter(w io.Writer, columns []string, types map[string]string, groupSize int,
+	compression *compressor) (*parquetWriter, error) {
+	pw := &parquetWriter{w: &countingWriter{w: w}, groupSize: groupSize, compression: compression}
+	if pw.groupSize <= 0 {
+		pw.groupSize = defaultParquetRowGroupRows
+	}
+	for _, name := range columns {
+		columnType := types[name]
+		// Nested columns are written as a pair of key and value lists.
+		if strings.HasSuffix(name, ".key") || strings.HasSuffix(name, ".value") {
+			columnType = "Array(String)"
+		}
+		c, err := newParquetColumn(name, columnType)
+		if err != nil {
+			return nil, err
+		}
+		pw.columns = append(pw.columns, c)
+	}
+	_, err := io.WriteString(pw.w, "PAR1")
+	return pw, err
+}
+
+func (pw *parquetWriter) write(row []interface{}) error {
+	for i, value := range row {
+		if err := pw.columns[i].add(value); err != nil {
+			return err
+		}
+	}
+	pw.rows++
+	if pw.rows == pw.groupSize {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+func (pw *parquetWriter) flushRowGroup() error {
+	if pw.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: pw.rows}
+	for _, c := range pw.columns {
+		page := &bytes.Buffer{}
+		if c.list {
+			writeParquetLevels(page, c.repLevels)
+			writeParquetLevels(page, c.defLevels)
+		}
+		page.Write(c.values.Bytes())
+		data := page.Bytes()
+		if pw.compression != nil {
+			var err error
+			if data, err = pw.compression.compress(data); err != nil {
+				return err
+			}
+		}
+		header := &thriftWriter{}
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(len(data)))
+		header.beginStruct(5)
+		header.i32(1, int32(c.levelEntries()))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.endStruct()
+		header.stop()
+
+		chunk := parquetChunk{
+			offset:           pw.w.n,
+			numValues:        c.levelEntries(),
+			uncompressedSize: int64(header.buf.Len() + page.Len()),
+			compressedSize:   int64(header.buf.Len() + len(data)),
+		}
+		if _, err := pw.w.Write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if _, err := pw.w.Write(data); err != nil {
+			return err
+		}
+		group.bytes += chunk.uncompressedSize
+		pw.uncompressed += chunk.uncompressedSize
+		group.chunks = append(group.chunks, chunk)
+		c.reset()
+	}
+	pw.groups = append(pw.groups, group)
+	pw.totalRows += int64(pw.rows)
+	pw.rows = 0
+	return nil
+}
+
+// close writes the last row group and the footer.
+func (pw *parquetWriter) close() error {
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+	codec := int32(parquetUncompressed)
+	if pw.compression != nil {
+		codec = parquetGzip
+		if pw.compression.cfg.Algorithm == compressionZstd {
+			codec = parquetZstd
+		}
+	}
+	meta := &thriftWriter{}
+	meta.i32(1, 1)
+	// Schema is flattened depth first, lists as the standard three-level
+	// structure.
+	elements := 1
+	for _, c := range pw.columns {
+		elements++
+		if c.list {
+			elements += 2
+		}
+	}
+	meta.beginList(2, thriftStruct, elements)
+	meta.beginElement()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(pw.columns)))
+	meta.endElement()
+	for _, c := range pw.columns {
+		if c.list {
+			meta.beginElement()
+			meta.i32(3, parquetRequired)
+			meta.binary(4, c.name)
+			meta.i32(5, 1)
+			meta.i32(6, parquetList)
+			meta.endElement()
+			meta.beginElement()
+			meta.i32(3, parquetRepeated)
+			meta.binary(4, "list")
+			meta.i32(5, 1)
+			meta.endElement()
+		}
+		name := c.name
+		if c.list {
+			name = "element"
+		}
+		meta.beginElement()
+		meta.i32(1, c.physical)
+		meta.i32(3, parquetRequired)
+		meta.binary(4, name)
+		if c.converted >= 0 {
+			meta.i32(6, c.converted)
+		}
+		meta.endElement()
+	}
+	meta.i64(3, pw.totalRows)
+	meta.beginList(4, thriftStruct, len(pw.groups))
+	for _, group := range pw.groups {
+		meta.beginElement()
+		meta.beginList(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			c := pw.columns[i]
+			meta.beginElement()
+			meta.i64(2, chunk.offset)
+			meta.beginStruct(3)
+			meta.i32(1, c.physical)
+			meta.beginList(2, thriftI32, 2)
+			meta.listI32(parquetPlain)
+			meta.listI32(parquetRLE)
+			path := []string{c.name}
+			if c.list {
+				path = append(path, "list", "element")
+			}
+			meta.beginList(3, thriftBinary, len(path))
+			for _, p := range path {
+				meta.listBinary(p)
+			}
+			meta.i32(4, codec)
+			meta.i64(5, int64(chunk.numValues))
+			meta.i64(6, chunk.uncompressedSize)
+			meta.i64(7, chunk.compressedSize)
+			meta.i64(9, chunk.offset)
+			meta.endStruct()
+			meta.endElement()
+		}
+		meta.i64(2, group.bytes)
+		meta.i64(3, int64(group.rows))
+		meta.endElement()
+	}
+	meta.binary(6, "nofacedb generator")
+	meta.stop()
+
+	if _, err := pw.w.Write(meta.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := binary.Write(pw.w, binary.LittleEndian, uint32(meta.buf.Len())); err != nil {
+		return err
+	}
+	_, err := io.WriteString(pw.w, "PAR1")
+	// Magic numbers, footer and its length.
+	pw.uncompressed += int64(8 + meta.buf.Len() + 4)
+	return err
+}
+
+// writeParquetLevels writes levels of bit width 1 as length-prefixed RLE
+// runs.
+func writeParquetLevels(w *bytes.Buffer, levels []byte) {
+	runs := &bytes.Buffer{}
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for (j < len(levels)) && (levels[j] == levels[i]) {
+			j++
+		}
+		writeUvarint(runs, uint64(j-i)<<1)
+		runs.WriteByte(levels[i])
+		i = j
+	}
+	putUint32(w, uint32(runs.Len()))
+	w.Write(runs.Bytes())
+}
+
+// putUint32 and putUint64 append little endian integers to in-memory
+// buffers, which never fail writes.
+func putUint32(w *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	w.Write(b[:])
+}
+
+func putUint64(w *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	w.Write(b[:])
+}
+
+func writeUvarint(w *bytes.Buffer, v uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	w.Write(buf[:binary.PutUvarint(buf, v)])
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes Parquet metadata in the Thrift compact protocol.
+// Fields of every struct are written in ascending order of their IDs.
+type thriftWriter struct {
+	buf     bytes.Buffer
+	lastIDs []int16
+	lastID  int16
+}
+
+func (t *thriftWriter) field(id int16, fieldType byte) {
+	if delta := id - t.lastID; (delta > 0) && (delta <= 15) {
+		t.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		t.buf.WriteByte(fieldType)
+		writeUvarint(&t.buf, zigzag(int64(id)))
+	}
+	t.lastID = id
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	writeUvarint(&t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	writeUvarint(&t.buf, zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listBinary(s)
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.beginElement()
+}
+
+func (t *thriftWriter) endStruct() {
+	t.endElement()
+}
+
+func (t *thriftWriter) beginList(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		writeUvarint(&t.buf, uint64(size))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	writeUvarint(&t.buf, zigzag(int64(v)))
+}
+
+func (t *thriftWriter) listBinary(s string) {
+	writeUvarint(&t.buf, uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// beginElement starts a struct in a list or a nested struct.
+func (t *thriftWriter) beginElement() {
+	t.lastIDs = append(t.lastIDs, t.lastID)
+	t.lastID = 0
+}
+
+func (t *thriftWriter) endElement() {
+	t.stop()
+	t.lastID = t.lastIDs[len(t.lastIDs)-1]
+	t.lastIDs = t.lastIDs[:len(t.lastIDs)-1]
+}
+
+func (t *thriftWriter) stop() {
+	t.buf.WriteByte(0)
+}
@@ -0,0 +1,419 @@
+package generator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// thriftReader decodes the Thrift compact protocol into maps of field IDs
+// to int64, []byte, []interface{} and nested maps.
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		panic(fmt.Sprintf("invalid varint at %d", r.pos))
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(fieldType byte) interface{} {
+	switch fieldType {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		b := r.data[r.pos : r.pos+n]
+		r.pos += n
+		return b
+	case thriftList:
+		header := r.byte()
+		size, elemType := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(elemType)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unexpected Thrift type %d at %d", fieldType, r.pos))
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	id := int16(0)
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+}
+
+// parquetLeaf is a column of the decoded schema.
+type parquetLeaf struct {
+	name      string
+	physical  int64
+	converted int64
+	list      bool
+}
+
+// readParquet decodes a file written by parquetWriter into rows of
+// interface{} values, lists as []interface{}, and returns them with the
+// leaf columns and codecs of column chunks.
+func readParquet(t *testing.T, data []byte) ([]parquetLeaf, [][]interface{}, []int64) {
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("missing magic numbers")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{data: data[len(data)-8-footerLen : len(data)-8]}
+	meta := footer.structure()
+	if footer.pos != footerLen {
+		t.Fatalf("footer has %d bytes, decoded %d", footerLen, footer.pos)
+	}
+
+	schema := meta[2].([]interface{})
+	leaves := []parquetLeaf{}
+	for i := 1; i < len(schema); i++ {
+		element := schema[i].(map[int16]interface{})
+		if converted, ok := element[6]; ok && (converted.(int64) == parquetList) {
+			repeated := schema[i+1].(map[int16]interface{})
+			if repeated[3].(int64) != parquetRepeated {
+				t.Fatalf("list %s has no repeated group", element[4])
+			}
+			leaf := schema[i+2].(map[int16]interface{})
+			leaves = append(leaves, parquetLeaf{name: string(element[4].([]byte)), physical: leaf[1].(int64),
+				converted: convertedType(leaf), list: true})
+			i += 2
+			continue
+		}
+		leaves = append(leaves, parquetLeaf{name: string(element[4].([]byte)), physical: element[1].(int64),
+			converted: convertedType(element)})
+	}
+	if int(schema[0].(map[int16]interface{})[5].(int64)) != len(leaves) {
+		t.Fatalf("root has %v children, schema has %d columns", schema[0].(map[int16]interface{})[5], len(leaves))
+	}
+
+	rows := [][]interface{}{}
+	codecs := []int64{}
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(map[int16]interface{})
+		numRows := int(group[3].(int64))
+		groupRows := make([][]interface{}, numRows)
+		for i := range groupRows {
+			groupRows[i] = make([]interface{}, len(leaves))
+		}
+		for col, c := range group[1].([]interface{}) {
+			chunk := c.(map[int16]interface{})[3].(map[int16]interface{})
+			codec := chunk[4].(int64)
+			codecs = append(codecs, codec)
+			pageReader := &thriftReader{data: data, pos: int(chunk[9].(int64))}
+			header := pageReader.structure()
+			page := data[pageReader.pos : pageReader.pos+int(header[3].(int64))]
+			switch codec {
+			case parquetGzip:
+				zr, err := gzip.NewReader(bytes.NewReader(page))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page, err = ioutil.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			case parquetZstd:
+				zr, err := zstd.NewReader(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page, err = zr.DecodeAll(page, nil); err != nil {
+					t.Fatal(err)
+				}
+				zr.Close()
+			}
+			if len(page) != int(header[2].(int64)) {
+				t.Fatalf("page of %s has %d bytes, header says %d", leaves[col].name, len(page), header[2])
+			}
+			if size := int64(pageReader.pos-int(chunk[9].(int64))) + header[3].(int64); size != chunk[7].(int64) {
+				t.Fatalf("chunk of %s has %d bytes, metadata says %d", leaves[col].name, size, chunk[7])
+			}
+			entries := int(header[5].(map[int16]interface{})[1].(int64))
+			values := page
+			var repLevels, defLevels []byte
+			if leaves[col].list {
+				repLevels, values = readParquetLevels(t, values, entries)
+				defLevels, values = readParquetLevels(t, values, entries)
+			}
+			row := -1
+			for i := 0; i < entries; i++ {
+				if !leaves[col].list {
+					row++
+					groupRows[row][col], values = readParquetValue(t, leaves[col], values)
+					continue
+				}
+				if repLevels[i] == 0 {
+					row++
+					groupRows[row][col] = []interface{}{}
+				}
+				if defLevels[i] == 1 {
+					var v interface{}
+					v, values = readParquetValue(t, leaves[col], values)
+					groupRows[row][col] = append(groupRows[row][col].([]interface{}), v)
+				}
+			}
+			if (row != numRows-1) || (len(values) != 0) {
+				t.Fatalf("column %s has %d rows and %d bytes left, expected %d rows", leaves[col].name, row+1,
+					len(values), numRows)
+			}
+		}
+		rows = append(rows, groupRows...)
+	}
+	if int64(len(rows)) != meta[3].(int64) {
+		t.Fatalf("row groups have %d rows, metadata says %d", len(rows), meta[3])
+	}
+	return leaves, rows, codecs
+}
+
+func convertedType(element map[int16]interface{}) int64 {
+	if converted, ok := element[6]; ok {
+		return converted.(int64)
+	}
+	return -1
+}
+
+// readParquetLevels decodes n levels of bit width 1 from length-prefixed
+// RLE runs.
+func readParquetLevels(t *testing.T, data []byte, n int) ([]byte, []byte) {
+	length := int(binary.LittleEndian.Uint32(data))
+	runs, rest := data[4:4+length], data[4+length:]
+	levels := []byte{}
+	for len(runs) > 0 {
+		header, k := binary.Uvarint(runs)
+		if header&1 != 0 {
+			t.Fatalf("unexpected bit-packed run")
+		}
+		for i := uint64(0); i < header>>1; i++ {
+			levels = append(levels, runs[k])
+		}
+		runs = runs[k+1:]
+	}
+	if len(levels) != n {
+		t.Fatalf("decoded %d levels, expected %d", len(levels), n)
+	}
+	return levels, rest
+}
+
+func readParquetValue(t *testing.T, leaf parquetLeaf, data []byte) (interface{}, []byte) {
+	switch {
+	case leaf.physical == parquetByteArray:
+		n := int(binary.LittleEndian.Uint32(data))
+		return string(data[4 : 4+n]), data[4+n:]
+	case leaf.converted == parquetTimestampMillis:
+		return time.Unix(0, int64(binary.LittleEndian.Uint64(data))*int64(time.Millisecond)).UTC(), data[8:]
+	case leaf.physical == parquetInt32:
+		return binary.LittleEndian.Uint32(data), data[4:]
+	case leaf.physical == parquetInt64:
+		return binary.LittleEndian.Uint64(data), data[8:]
+	case leaf.physical == parquetDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), data[8:]
+	}
+	t.Fatalf("unexpected physical type %d of %s", leaf.physical, leaf.name)
+	return nil, nil
+}
+
+// Columns and rows of Parquet tests, covering every supported type, empty
+// lists and strings, and extreme values.
+var (
+	parquetTestColumns = []string{"id", "name", "ts", "age", "ff", "attributes.key", "attributes.value"}
+	parquetTestTypes   = map[string]string{
+		"id":   "UUID",
+		"name": "String",
+		"ts":   "DateTime",
+		"age":  "UInt32",
+		"ff":   "Array(Float64)",
+	}
+	parquetTestTS   = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	parquetTestRows = [][]interface{}{
+		{"b1a1", "Иван", parquetTestTS, uint32(30), []float64{0.5, -0.25, 1}, []string{"eyes"}, []string{"brown"}},
+		{"b1a2", "", parquetTestTS.Add(time.Second), uint32(0), []float64{}, []string{}, []string{}},
+		{"b1a3", "Anna", parquetTestTS.Add(time.Hour), uint32(math.MaxUint32), []float64{math.Pi}, []string{"a", "b"}, []string{"", "c"}},
+		{"b1a4", "tab\tand\nnewline", parquetTestTS, uint32(7), []float64{}, []string{"k"}, []string{"v"}},
+		{"b1a5", "last", parquetTestTS, uint32(1), []float64{2, 3}, []string{}, []string{}},
+	}
+)
+
+// writeParquetTestRows writes parquetTestRows in groups of groupSize rows.
+func writeParquetTestRows(t *testing.T, groupSize int, cfg CompressionCFG) (*parquetWriter, []byte) {
+	compression, err := newCompressor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	pw, err := newParquetWriter(buf, parquetTestColumns, parquetTestTypes, groupSize, compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range parquetTestRows {
+		if err := pw.write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.close(); err != nil {
+		t.Fatal(err)
+	}
+	return pw, buf.Bytes()
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	columns, rows := parquetTestColumns, parquetTestRows
+	expected := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		expected[i] = make([]interface{}, len(row))
+		for j, value := range row {
+			rv := reflect.ValueOf(value)
+			if rv.Kind() != reflect.Slice {
+				expected[i][j] = value
+				continue
+			}
+			list := []interface{}{}
+			for k := 0; k < rv.Len(); k++ {
+				list = append(list, rv.Index(k).Interface())
+			}
+			expected[i][j] = list
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		groupSize   int
+		compression CompressionCFG
+		codec       int64
+	}{
+		{"one group", 0, CompressionCFG{}, parquetUncompressed},
+		{"groups of two", 2, CompressionCFG{Algorithm: compressionNone}, parquetUncompressed},
+		{"gzip", 0, CompressionCFG{Algorithm: compressionGzip}, parquetGzip},
+		{"gzip groups of one", 1, CompressionCFG{Algorithm: compressionGzip, Level: 9}, parquetGzip},
+		{"zstd", 0, CompressionCFG{Algorithm: compressionZstd}, parquetZstd},
+		{"zstd groups of two", 2, CompressionCFG{Algorithm: compressionZstd, Level: 19}, parquetZstd},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			pw, data := writeParquetTestRows(t, test.groupSize, test.compression)
+			if pw.w.n != int64(len(data)) {
+				t.Fatalf("writer counted %d bytes, wrote %d", pw.w.n, len(data))
+			}
+
+			leaves, decoded, codecs := readParquet(t, data)
+			for i, leaf := range leaves {
+				if leaf.name != columns[i] {
+					t.Errorf("column %d is %s, expected %s", i, leaf.name, columns[i])
+				}
+			}
+			for _, list := range []int{4, 5, 6} {
+				if !leaves[list].list {
+					t.Errorf("column %s is not a list", leaves[list].name)
+				}
+			}
+			for _, codec := range codecs {
+				if codec != test.codec {
+					t.Fatalf("chunk has codec %d, expected %d", codec, test.codec)
+				}
+			}
+			if !reflect.DeepEqual(decoded, expected) {
+				t.Fatalf("decoded rows\n%v\ndiffer from written\n%v", decoded, expected)
+			}
+		})
+	}
+}
+
+var updateFixtures = flag.Bool("update", false, "rewrite Parquet fixtures in testdata")
+
+// TestParquetFixtures pins output of the writer to fixtures in testdata,
+// which "make parquet-check" reads with an independent Parquet
+// implementation. Rows it reads must match rows.json, which this test
+// checks against parquetTestRows.
+func TestParquetFixtures(t *testing.T) {
+	for _, test := range []struct {
+		path        string
+		compression CompressionCFG
+	}{
+		{"rows.parquet", CompressionCFG{}},
+		{"rows.zstd.parquet", CompressionCFG{Algorithm: compressionZstd}},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			_, data := writeParquetTestRows(t, 2, test.compression)
+			path := filepath.Join("testdata", test.path)
+			if *updateFixtures {
+				if err := ioutil.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fixture, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, fixture) {
+				t.Errorf("written file differs from %s, check it with make parquet-check and rerun with -update", path)
+			}
+		})
+	}
+
+	// Timestamps are read as milliseconds of TIMESTAMP_MILLIS.
+	expected := &bytes.Buffer{}
+	for _, row := range parquetTestRows {
+		values := append([]interface{}{}, row...)
+		values[2] = values[2].(time.Time).UnixNano() / int64(time.Millisecond)
+		line, err := json.Marshal(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected.Write(append(line, '\n'))
+	}
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "rows.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(golden, expected.Bytes()) {
+		t.Errorf("testdata/rows.json\n%s\ndiffers from written rows\n%s", golden, expected)
+	}
+}
+
+func TestParquetUnsupportedColumn(t *testing.T) {
+	if _, err := newParquetWriter(&bytes.Buffer{}, []string{"x"}, map[string]string{"x": "Int8"}, 0, nil); err == nil {
+		t.Fatal("expected an error for Int8 column")
+	}
+}
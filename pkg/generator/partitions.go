@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Periods generator.partitions are split into.
+const (
+	periodHour  = "hour"
+	periodDay   = "day"
+	periodMonth = "month"
+)
+
+// maxPartitions caps periods of generator.partitions.
+const maxPartitions = 1 << 20
+
+// PartitionCFG makes exactly Rows control objects get ts in every period
+// from Start to End, YYYY-MM-DD or RFC 3339 times, or in the whole range
+// without a period. Periods start at Start, the last one ends at End.
+type PartitionCFG struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	// hour, day or month, empty for one period.
+	Period string `yaml:"period"`
+	Rows   int    `yaml:"rows"`
+}
+
+// tsPartition is a period rows [first, first+rows) of a run get ts in.
+type tsPartition struct {
+	start, end  time.Time
+	first, rows int
+}
+
+// partitions assign ts by row index, so that every period gets its rows
+// whichever worker generates them.
+type partitions []tsPartition
+
+// newPartitions returns periods of cfgs in configured order and their rows
+// in total, nil without cfgs.
+func newPartitions(cfgs []PartitionCFG) (partitions, int, error) {
+	var p partitions
+	total := 0
+	for _, cfg := range cfgs {
+		start, err := parseTS(cfg.Start)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid start \"%s\", expected YYYY-MM-DD or RFC 3339", cfg.Start)
+		}
+		end, err := parseTS(cfg.End)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid end \"%s\", expected YYYY-MM-DD or RFC 3339", cfg.End)
+		}
+		if !end.After(start) {
+			return nil, 0, fmt.Errorf("end %s is not after start %s", cfg.End, cfg.Start)
+		}
+		if cfg.Rows <= 0 {
+			return nil, 0, fmt.Errorf("rows of partitions from %s must be positive, got %d", cfg.Start, cfg.Rows)
+		}
+		next := func(t time.Time) time.Time { return end }
+		switch cfg.Period {
+		case "":
+		case periodHour:
+			next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+		case periodDay:
+			next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+		case periodMonth:
+			next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+		default:
+			return nil, 0, fmt.Errorf("unknown period \"%s\", supported are %s, %s, %s",
+				cfg.Period, periodHour, periodDay, periodMonth)
+		}
+		for from := start; from.Before(end); from = next(from) {
+			to := next(from)
+			if to.After(end) {
+				to = end
+			}
+			if len(p) == maxPartitions {
+				return nil, 0, fmt.Errorf("partitions have more than %d periods", maxPartitions)
+			}
+			p = append(p, tsPartition{start: from, end: to, first: total, rows: cfg.Rows})
+			total += cfg.Rows
+		}
+	}
+	// Overlapping periods would share rows of a partition.
+	sorted := append(partitions(nil), p...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start.Before(sorted[j].start) })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].start.Before(sorted[i-1].end) {
+			return nil, 0, fmt.Errorf("partitions from %s and %s overlap",
+				sorted[i-1].start.Format(time.RFC3339), sorted[i].start.Format(time.RFC3339))
+		}
+	}
+	return p, total, nil
+}
+
+// sample draws ts of row i uniformly within its period.
+func (p partitions) sample(rnd *rand.Rand, i int) time.Time {
+	j := sort.Search(len(p), func(j int) bool { return p[j].first+p[j].rows > i })
+	return p[j].start.Add(time.Duration(rnd.Int63n(int64(p[j].end.Sub(p[j].start)))))
+}
@@ -0,0 +1,68 @@
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartitions(t *testing.T) {
+	cfg, dir := testConfig(t, 0)
+	cfg.GeneratorCFG.Workers = 3
+	cfg.GeneratorCFG.DuplicateRate = 0.2
+	cfg.GeneratorCFG.Partitions = []PartitionCFG{
+		{Start: "2024-03-01", End: "2024-03-04", Period: periodDay, Rows: 7},
+		{Start: "2024-01-01", End: "2024-02-01", Rows: 4},
+	}
+	testRun(t, cfg)
+
+	counts := map[string]int{}
+	rows := 0
+	files, err := filepath.Glob(filepath.Join(dir, "control_objects.0*.tsv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		for _, row := range readTSV(t, file) {
+			counts[row[1][:len("2024-01-01")]]++
+			rows++
+		}
+	}
+	if rows != 25 {
+		t.Fatalf("%d rows generated, partitions hold 25", rows)
+	}
+	for day, expected := range map[string]int{"2024-03-01": 7, "2024-03-02": 7, "2024-03-03": 7} {
+		if counts[day] != expected {
+			t.Errorf("%d rows on %s, expected %d: %v", counts[day], day, expected, counts)
+		}
+	}
+	january := 0
+	for day, n := range counts {
+		if strings.HasPrefix(day, "2024-01-") {
+			january += n
+		}
+	}
+	if january != 4 {
+		t.Errorf("%d rows in January, expected 4: %v", january, counts)
+	}
+
+	for _, test := range []struct {
+		partitions []PartitionCFG
+		n          int
+		err        string
+	}{
+		{[]PartitionCFG{{Start: "2024-03-01", End: "2024-03-02", Period: periodHour, Rows: 1}}, 25, "hold 24 rows"},
+		{[]PartitionCFG{{Start: "2024-03-01", End: "2024-03-02", Period: "week", Rows: 1}}, 0, "unknown period"},
+		{[]PartitionCFG{{Start: "2024-03-01", End: "2024-03-02", Rows: 0}}, 0, "must be positive"},
+		{[]PartitionCFG{
+			{Start: "2024-03-01", End: "2024-04-01", Period: periodMonth, Rows: 1},
+			{Start: "2024-03-10", End: "2024-03-11", Rows: 1},
+		}, 0, "overlap"},
+	} {
+		cfg, _ := testConfig(t, test.n)
+		cfg.GeneratorCFG.Partitions = test.partitions
+		if _, err := newGeneration(cfg, 1); (err == nil) || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("partitions %v: %v, expected %s", test.partitions, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const partLogQuery = `
+SELECT
+    table,
+    countIf(event_type = 'NewPart'),
+    countIf(event_type = 'MergeParts'),
+    sumIf(size_in_bytes, event_type = 'NewPart'),
+    sumIf(size_in_bytes, event_type = 'MergeParts')
+FROM
+    system.part_log
+WHERE
+    database = currentDatabase() AND table IN (%s) AND event_time >= ?
+GROUP BY
+    table
+ORDER BY
+    table;
+`
+
+const activePartsQuery = `
+SELECT
+    count()
+FROM
+    system.parts
+WHERE
+    database = currentDatabase() AND table = ? AND active;
+`
+
+// partsReport queries part_log for parts created and merged since startTime
+// and reports write amplification: bytes written by inserts and merges over
+// bytes written by inserts.
+func partsReport(db *sql.DB, startTime time.Time, opts insertOptions) (string, error) {
+	if _, err := db.Exec("SYSTEM FLUSH LOGS"); err != nil {
+		return "", errors.Wrap(err, "unable to flush system logs")
+	}
+	rows, err := db.Query(fmt.Sprintf(partLogQuery, opts.tableList()), startTime)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to query system.part_log, is part_log enabled?")
+	}
+	defer rows.Close()
+
+	lines := []string{}
+	for rows.Next() {
+		var (
+			table                   string
+			newParts, merges        uint64
+			insertBytes, mergeBytes uint64
+		)
+		if err := rows.Scan(&table, &newParts, &merges, &insertBytes, &mergeBytes); err != nil {
+			return "", errors.Wrap(err, "unable to scan system.part_log")
+		}
+		activeParts := uint64(0)
+		if err := db.QueryRow(activePartsQuery, table).Scan(&activeParts); err != nil {
+			return "", errors.Wrapf(err, "unable to count active parts of %s", table)
+		}
+		amplification := 0.0
+		if insertBytes != 0 {
+			amplification = float64(insertBytes+mergeBytes) / float64(insertBytes)
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d parts created, %d merges, %d active parts, %d bytes inserted, %d bytes merged, write amplification %.2f",
+			table, newParts, merges, activeParts, insertBytes, mergeBytes, amplification))
+	}
+	if err := rows.Err(); err != nil {
+		return "", errors.Wrap(err, "unable to read system.part_log")
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPartsReport(t *testing.T) {
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	mu := sync.Mutex{}
+	flushed := false
+	server.answer = func(query string) (nativeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case query == "SYSTEM FLUSH LOGS":
+			flushed = true
+			return nativeResult{}, nil
+		case strings.Contains(query, "system.part_log") && strings.Contains(query, "'control_objects', 'facial_features'"):
+			return nativeResult{
+				names: []string{"table", "new_parts", "merges", "insert_bytes", "merge_bytes"},
+				types: []string{"String", "UInt64", "UInt64", "UInt64", "UInt64"},
+				rows: [][]interface{}{
+					{"control_objects", uint64(10), uint64(3), uint64(1000), uint64(1500)},
+					{"facial_features", uint64(4), uint64(0), uint64(0), uint64(0)},
+				},
+			}, nil
+		case strings.Contains(query, "system.parts"):
+			active := uint64(2)
+			if strings.Contains(query, "'facial_features'") {
+				active = 4
+			}
+			return nativeResult{names: []string{"count()"}, types: []string{"UInt64"}, rows: [][]interface{}{{active}}}, nil
+		}
+		return nativeResult{}, fmt.Errorf("unexpected query %s", query)
+	}
+
+	report, err := partsReport(server.connect(t), time.Now(), testInsertOptions(t, SchemaCFG{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "control_objects: 10 parts created, 3 merges, 2 active parts, 1000 bytes inserted, 1500 bytes merged, write amplification 2.50\n" +
+		"facial_features: 4 parts created, 0 merges, 4 active parts, 0 bytes inserted, 0 bytes merged, write amplification 0.00"
+	if report != expected {
+		t.Errorf("parts report is\n%s\nexpected\n%s", report, expected)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !flushed {
+		t.Error("part_log is queried without flushing logs")
+	}
+}
@@ -0,0 +1,122 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var passportColumns = []string{"passport_region", "passport_office", "office_code"}
+
+// PassportsCFG configures a mapping of regions to passport series and
+// issuing offices, e.g. the reference of a validation service.
+type PassportsCFG struct {
+	// CSV file with a header of region, series and office columns and an
+	// optional office_code column. series is the first 2 or all 4 digits of
+	// passport series, and a region may have several series and offices.
+	Path string `yaml:"path"`
+}
+
+// passportIssuer is a row of the mapping.
+type passportIssuer struct {
+	region     string
+	series     string
+	office     string
+	officeCode string
+}
+
+// passportSeries generates passports of mapped series and finds issuers of
+// passports by their series.
+type passportSeries struct {
+	issuers []passportIssuer
+	// Issuers by series, 2 or 4 digits.
+	bySeries map[string][]int
+}
+
+func loadPassportSeries(cfg PassportsCFG) (*passportSeries, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read passport series")
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse passport series CSV")
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("no passport series in %s", cfg.Path)
+	}
+	index := map[string]int{}
+	for i, column := range records[0] {
+		index[strings.TrimSpace(column)] = i
+	}
+	for _, column := range []string{"region", "series", "office"} {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("passport series have no %s column", column)
+		}
+	}
+	s := &passportSeries{bySeries: map[string][]int{}}
+	for i, record := range records[1:] {
+		get := func(column string) string {
+			if j, ok := index[column]; ok {
+				return strings.TrimSpace(record[j])
+			}
+			return ""
+		}
+		issuer := passportIssuer{
+			region:     get("region"),
+			series:     strings.Replace(get("series"), " ", "", -1),
+			office:     get("office"),
+			officeCode: get("office_code"),
+		}
+		if (issuer.region == "") || (issuer.office == "") {
+			return nil, fmt.Errorf("row %d has no region or office", i+1)
+		}
+		if ((len(issuer.series) != 2) && (len(issuer.series) != 4)) || (strings.Trim(issuer.series, "0123456789") != "") {
+			return nil, fmt.Errorf("series \"%s\" of row %d is not 2 or 4 digits", get("series"), i+1)
+		}
+		s.bySeries[issuer.series] = append(s.bySeries[issuer.series], len(s.issuers))
+		s.issuers = append(s.issuers, issuer)
+	}
+	return s, nil
+}
+
+// generate returns a passport of a random issuer, or a random passport
+// without a mapping.
+func (s *passportSeries) generate(rnd *rand.Rand) string {
+	if s == nil {
+		return generatePassport(rnd)
+	}
+	digits := []byte(s.issuers[rnd.Intn(len(s.issuers))].series)
+	for len(digits) < 10 {
+		digits = append(digits, byte('0'+rnd.Intn(10)))
+	}
+	return string(digits[:2]) + " " + string(digits[2:4]) + " " + string(digits[4:])
+}
+
+// issuer returns the issuer of passport by its full series, or else by its
+// region digits, empty when none matches, e.g. for listed passports. Issuers
+// sharing series are picked by the passport, so that a passport always has
+// the same issuer.
+func (s *passportSeries) issuer(passport string) passportIssuer {
+	digits := strings.Replace(passport, " ", "", -1)
+	for _, n := range []int{4, 2} {
+		if len(digits) < n {
+			continue
+		}
+		if issuers := s.bySeries[digits[:n]]; len(issuers) != 0 {
+			h := fnv.New32a()
+			h.Write([]byte(passport))
+			return s.issuers[issuers[int(h.Sum32()%uint32(len(issuers)))]]
+		}
+	}
+	return passportIssuer{}
+}
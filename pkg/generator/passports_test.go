@@ -0,0 +1,70 @@
+package generator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPassportSeries(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	cfg.GeneratorCFG.Passports.Path = filepath.Join(dir, "series.csv")
+	series := "region,series,office,office_code\n" +
+		"77,45,ГУ МВД России по г. Москве,770-001\n" +
+		"77,45,ОВД района Арбат г. Москвы,770-002\n" +
+		"78,40 11,ГУ МВД России по г. Санкт-Петербургу,780-001\n"
+	if err := ioutil.WriteFile(cfg.GeneratorCFG.Passports.Path, []byte(series), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := newGeneration(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := map[string]int{}
+	for i, column := range g.opts.controlObjectsColumns() {
+		index[column] = i
+	}
+	testRun(t, cfg)
+
+	issuers := map[string]string{}
+	regions := map[string]bool{}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		passport, region, code := row[index["passport"]], row[index["passport_region"]], row[index["office_code"]]
+		switch {
+		case strings.HasPrefix(passport, "45 "):
+			if (region != "77") || ((code != "770-001") && (code != "770-002")) {
+				t.Errorf("passport %s is issued by %s in %s", passport, code, region)
+			}
+		case strings.HasPrefix(passport, "40 11 "):
+			if (region != "78") || (code != "780-001") || !strings.Contains(row[index["passport_office"]], "Санкт") {
+				t.Errorf("passport %s is issued by %s in %s", passport, code, region)
+			}
+		default:
+			t.Errorf("passport %s is of no mapped series", passport)
+		}
+		if issuer, ok := issuers[passport]; ok && (issuer != code) {
+			t.Errorf("passport %s is issued by %s and %s", passport, issuer, code)
+		}
+		issuers[passport] = code
+		regions[region] = true
+	}
+	if len(regions) != 2 {
+		t.Errorf("passports are issued in regions %v", regions)
+	}
+
+	for _, invalid := range []string{
+		"region,office\n77,ГУ МВД\n",
+		"region,series,office\n77,4,ГУ МВД\n",
+		"region,series,office\n77,45 0A,ГУ МВД\n",
+		"region,series,office\n,45,ГУ МВД\n",
+		"region,series,office\n",
+	} {
+		if err := ioutil.WriteFile(cfg.GeneratorCFG.Passports.Path, []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadPassportSeries(cfg.GeneratorCFG.Passports); err == nil {
+			t.Errorf("passport series %q are accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package generator
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Types of plan phases.
+const (
+	phaseClean      = "clean"
+	phaseSchema     = "schema"
+	phasePopulate   = "populate"
+	phaseOptimize   = "optimize"
+	phaseQueryBench = "query_bench"
+	phaseReport     = "report"
+)
+
+var phaseTypes = []string{phaseClean, phaseSchema, phasePopulate, phaseOptimize, phaseQueryBench, phaseReport}
+
+// Statuses of plan phases.
+const (
+	phaseOK      = "ok"
+	phaseFailed  = "failed"
+	phaseSkipped = "skipped"
+)
+
+// PlanCFG is a plan file run by the plan subcommand: phases run in order
+// against the storage of the configuration, and phases after a failed one
+// are skipped except reports.
+type PlanCFG struct {
+	Phases []PlanPhaseCFG `yaml:"phases"`
+}
+
+// PlanPhaseCFG is a phase of a plan. Fields besides Name and Type apply to
+// phases of some types only.
+type PlanPhaseCFG struct {
+	// Name in statuses, the type by default.
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// truncate or recreate of clean phases, final or wait_merges of
+	// optimize phases.
+	Mode string `yaml:"mode"`
+	// Pairs of populate phases, generator.n when 0, and -verify of them.
+	N      int  `yaml:"n"`
+	Verify bool `yaml:"verify"`
+	// Limit of wait_merges.
+	TimeoutMS int `yaml:"timeout_ms"`
+	// Queries of query_bench phases, run round-robin by Concurrency
+	// clients for DurationMS.
+	Queries     []string `yaml:"queries"`
+	DurationMS  int      `yaml:"duration_ms"`
+	Concurrency int      `yaml:"concurrency"`
+	// File report phases write statuses of phases before them to.
+	Path string `yaml:"path"`
+}
+
+func (cfg PlanPhaseCFG) name() string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return cfg.Type
+}
+
+func (cfg PlanPhaseCFG) validate() error {
+	switch cfg.Type {
+	case phaseClean:
+		if (cfg.Mode != "") && (cfg.Mode != cleanTruncate) && (cfg.Mode != cleanRecreate) {
+			return fmt.Errorf("unknown mode \"%s\", supported are %s, %s", cfg.Mode, cleanTruncate, cleanRecreate)
+		}
+	case phaseSchema:
+	case phasePopulate:
+		if cfg.N < 0 {
+			return fmt.Errorf("n must not be negative, got %d", cfg.N)
+		}
+	case phaseOptimize:
+		if (cfg.Mode != "") && (cfg.Mode != optimizeFinal) && (cfg.Mode != optimizeWaitMerges) {
+			return fmt.Errorf("unknown mode \"%s\", supported are %s, %s", cfg.Mode, optimizeFinal, optimizeWaitMerges)
+		}
+	case phaseQueryBench:
+		if len(cfg.Queries) == 0 {
+			return fmt.Errorf("query_bench needs queries")
+		}
+		if cfg.DurationMS <= 0 {
+			return fmt.Errorf("duration_ms must be positive, got %d", cfg.DurationMS)
+		}
+		if cfg.Concurrency < 0 {
+			return fmt.Errorf("concurrency must not be negative, got %d", cfg.Concurrency)
+		}
+	case phaseReport:
+		if cfg.Path == "" {
+			return fmt.Errorf("report needs a path")
+		}
+	default:
+		return fmt.Errorf("unknown type \"%s\", supported are %s", cfg.Type, strings.Join(phaseTypes, ", "))
+	}
+	return nil
+}
+
+func loadPlan(path string) (*PlanCFG, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read plan")
+	}
+	plan := &PlanCFG{}
+	if err := yaml.Unmarshal(data, plan); err != nil {
+		return nil, errors.Wrap(err, "unable to parse plan")
+	}
+	if len(plan.Phases) == 0 {
+		return nil, fmt.Errorf("plan %s has no phases", path)
+	}
+	for i, phase := range plan.Phases {
+		if err := phase.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid phase %d", i+1)
+		}
+	}
+	return plan, nil
+}
+
+// phaseStatus is the outcome of a phase.
+type phaseStatus struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Status   string `yaml:"status"`
+	Duration string `yaml:"duration,omitempty"`
+	Result   string `yaml:"result,omitempty"`
+	Error    string `yaml:"error,omitempty"`
+}
+
+// planReport is written by report phases.
+type planReport struct {
+	Status  string        `yaml:"status"`
+	Started time.Time     `yaml:"started"`
+	Phases  []phaseStatus `yaml:"phases"`
+}
+
+func (r planReport) save(path string) error {
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode plan report")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, data, 0644), "unable to write plan report")
+}
+
+// runPlan runs phases of a plan file, printing the status of every phase,
+// instead of scripts gluing several invocations together.
+func runPlan(ctx context.Context, args []string) (err error) {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file")
+	planPath := flags.String("plan", "", "path to YAML plan file")
+	junitPath := flags.String("junit", "", "write statuses of phases as JUnit XML to this file")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	if *planPath == "" {
+		return fmt.Errorf("plan needs -plan")
+	}
+	plan, err := loadPlan(*planPath)
+	if err != nil {
+		return err
+	}
+	junit := newJUnitReport(*junitPath, "plan")
+	defer func() {
+		if saveErr := junit.save(*junitPath); (saveErr != nil) && (err == nil) {
+			err = saveErr
+		}
+	}()
+	statuses, err := executePlan(ctx, cfg, plan, junit.suite("plan"), &logger{})
+	fmt.Println("plan:")
+	for _, status := range statuses {
+		fmt.Printf("%-20s %-8s %s\n", status.Name, status.Status, status.Duration)
+	}
+	return err
+}
+
+// executePlan runs phases of plan in order and returns their statuses. A
+// failed phase fails the plan and skips later phases but reports.
+func executePlan(ctx context.Context, cfg *Config, plan *PlanCFG, suite *junitSuite, log *logger) ([]phaseStatus, error) {
+	report := planReport{Status: phaseOK, Started: time.Now()}
+	var failure error
+	for i, phase := range plan.Phases {
+		status := phaseStatus{Name: phase.name(), Type: phase.Type, Status: phaseOK}
+		if (failure != nil) && (phase.Type != phaseReport) {
+			status.Status = phaseSkipped
+			suite.skip(status.Name, "skipped after a failed phase")
+			log.logf("phase %d/%d %s: skipped\n", i+1, len(plan.Phases), status.Name)
+			report.Phases = append(report.Phases, status)
+			continue
+		}
+		startTime := time.Now()
+		result, err := runPhase(ctx, cfg, phase, report, log)
+		elapsed := time.Now().Sub(startTime)
+		status.Duration, status.Result = elapsed.String(), result
+		if err != nil {
+			status.Status, status.Error = phaseFailed, err.Error()
+			report.Status = phaseFailed
+			if failure == nil {
+				failure = errors.Wrapf(err, "phase %s failed", status.Name)
+			}
+			suite.add(status.Name, elapsed, result, err.Error())
+			log.logf("phase %d/%d %s: failed in %v: %v\n", i+1, len(plan.Phases), status.Name, elapsed, err)
+		} else {
+			suite.add(status.Name, elapsed, result, "")
+			log.logf("phase %d/%d %s: ok in %v, %s\n", i+1, len(plan.Phases), status.Name, elapsed, result)
+		}
+		report.Phases = append(report.Phases, status)
+	}
+	return report.Phases, failure
+}
+
+// runPhase runs a phase and returns its result. Report phases write report
+// of phases before them.
+func runPhase(ctx context.Context, cfg *Config, phase PlanPhaseCFG, report planReport, log *logger) (string, error) {
+	switch phase.Type {
+	case phasePopulate:
+		populated := *cfg
+		if phase.N > 0 {
+			populated.GeneratorCFG.N = phase.N
+		}
+		g := New(&populated)
+		g.Options.Verify, g.Options.Machine = phase.Verify, log.quiet
+		inserted, seed, err := g.run(ctx, time.Now())
+		return fmt.Sprintf("inserted %d pairs with seed %d", inserted, seed), err
+	case phaseReport:
+		if err := report.save(phase.Path); err != nil {
+			return "", err
+		}
+		return "wrote " + phase.Path, nil
+	}
+
+	admin, err := newTableAdmin(cfg)
+	if err != nil {
+		return "", err
+	}
+	defer admin.close()
+	tables := strings.Join(admin.opts.tableNames(), ", ")
+	switch phase.Type {
+	case phaseClean:
+		mode := phase.Mode
+		if mode == "" {
+			mode = cleanTruncate
+		}
+		if err := admin.clean(ctx, mode); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s", mode, tables), nil
+	case phaseSchema:
+		if err := admin.create(ctx); err != nil {
+			return "", err
+		}
+		return "created missing tables of " + tables, nil
+	case phaseOptimize:
+		if admin.db == nil {
+			return "", fmt.Errorf("optimize needs ClickHouse over the native protocol")
+		}
+		optimize := OptimizeCFG{Mode: phase.Mode, TimeoutMS: phase.TimeoutMS}
+		if optimize.Mode == "" {
+			optimize.Mode = optimizeFinal
+		}
+		mergeTime, err := optimizeTables(ctx, admin.db, optimize, admin.opts)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("optimized %s (%s) in %v", tables, optimize.Mode, mergeTime), nil
+	}
+	result, err := benchQueries(ctx, admin.query, phase.Queries, time.Duration(phase.DurationMS)*time.Millisecond,
+		phase.Concurrency)
+	return result.String(), err
+}
+
+// queryBenchResult holds latencies of queries of a query_bench phase.
+type queryBenchResult struct {
+	queries  int
+	duration time.Duration
+	latency  *sloStats
+}
+
+func (r queryBenchResult) String() string {
+	seconds := r.duration.Seconds()
+	if seconds == 0 {
+		seconds = 1e-9
+	}
+	return fmt.Sprintf("%d queries in %v: %.1f queries/s, p50 %.1fms, p95 %.1fms, p99 %.1fms",
+		r.queries, r.duration, float64(r.queries)/seconds,
+		r.latency.percentile(50), r.latency.percentile(95), r.latency.percentile(99))
+}
+
+// benchQueries runs queries round-robin by concurrency clients until
+// duration passes, and fails on the first failed query.
+func benchQueries(ctx context.Context, query func(ctx context.Context, query string) error, queries []string,
+	duration time.Duration, concurrency int) (queryBenchResult, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	result := queryBenchResult{latency: &sloStats{}}
+	var failure error
+	once := sync.Once{}
+	wg := sync.WaitGroup{}
+	startTime := time.Now()
+	deadline := startTime.Add(duration)
+	for client := 0; client < concurrency; client++ {
+		wg.Add(1)
+		go func(client int) {
+			defer wg.Done()
+			for i := client; time.Now().Before(deadline) && (ctx.Err() == nil); i++ {
+				q := queries[i%len(queries)]
+				queryStart := time.Now()
+				if err := query(ctx, q); err != nil {
+					once.Do(func() {
+						failure = errors.Wrapf(err, "query \"%s\" failed", q)
+						cancel()
+					})
+					return
+				}
+				result.latency.batch(time.Now().Sub(queryStart))
+			}
+		}(client)
+	}
+	wg.Wait()
+	result.duration = time.Now().Sub(startTime)
+	result.queries = len(result.latency.latencies)
+	if (failure == nil) && (ctx.Err() != nil) {
+		failure = ctx.Err()
+	}
+	return result, failure
+}
@@ -0,0 +1,119 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestPlan(t *testing.T) {
+	cfg, dir := testConfig(t, 40)
+	plan := &PlanCFG{Phases: []PlanPhaseCFG{
+		{Type: phasePopulate, N: 15},
+		{Name: "first report", Type: phaseReport, Path: filepath.Join(dir, "first.yaml")},
+		{Name: "broken report", Type: phaseReport, Path: filepath.Join(dir, "missing", "report.yaml")},
+		{Name: "second populate", Type: phasePopulate},
+		{Name: "last report", Type: phaseReport, Path: filepath.Join(dir, "last.yaml")},
+	}}
+	junit := newJUnitReport("junit.xml", "plan")
+	statuses, err := executePlan(context.Background(), cfg, plan, junit.suite("plan"), &logger{quiet: true})
+	if (err == nil) || !strings.Contains(err.Error(), "phase broken report failed") {
+		t.Fatalf("plan with a failed phase returned %v", err)
+	}
+	expected := []string{phaseOK, phaseOK, phaseFailed, phaseSkipped, phaseOK}
+	for i, status := range statuses {
+		if status.Status != expected[i] {
+			t.Errorf("phase %s is %s, expected %s", status.Name, status.Status, expected[i])
+		}
+	}
+	if rows := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")); len(rows) != 15 {
+		t.Errorf("populate phase generated %d rows instead of 15", len(rows))
+	}
+	if (statuses[0].Name != phasePopulate) || !strings.HasPrefix(statuses[0].Result, "inserted 15 pairs") {
+		t.Errorf("populate phase has status %+v", statuses[0])
+	}
+
+	for path, phases := range map[string]int{"first.yaml": 1, "last.yaml": 4} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := planReport{}
+		if err := yaml.Unmarshal(data, &report); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Phases) != phases {
+			t.Errorf("%s has %d phases, expected %d", path, len(report.Phases), phases)
+		}
+	}
+	suite := junit.Suites[0]
+	if (suite.Tests != 5) || (suite.Failures != 1) || (suite.Skipped != 1) || (suite.Cases[3].Skipped == nil) {
+		t.Errorf("JUnit suite has %d tests, %d failures and %d skipped", suite.Tests, suite.Failures, suite.Skipped)
+	}
+}
+
+func TestLoadPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "plan.yaml")
+	for plan, expected := range map[string]string{
+		"phases:\n- type: clean\n  mode: truncate\n- type: populate\n  n: 10\n": "",
+		"phases: []\n":                                     "no phases",
+		"phases:\n- type: load\n":                          "unknown type",
+		"phases:\n- type: clean\n  mode: drop\n":           "unknown mode",
+		"phases:\n- type: query_bench\n  duration_ms: 1\n": "needs queries",
+		"phases:\n- type: report\n":                        "needs a path",
+	} {
+		if err := ioutil.WriteFile(path, []byte(plan), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadPlan(path)
+		if ((expected == "") && (err != nil)) || ((expected != "") && ((err == nil) || !strings.Contains(err.Error(), expected))) {
+			t.Errorf("plan %q: %v, expected %q", plan, err, expected)
+		}
+	}
+}
+
+func TestBenchQueries(t *testing.T) {
+	mu := sync.Mutex{}
+	counts := map[string]int{}
+	query := func(ctx context.Context, query string) error {
+		mu.Lock()
+		counts[query]++
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+	result, err := benchQueries(context.Background(), query, []string{"a", "b"}, 30*time.Millisecond, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (result.queries != counts["a"]+counts["b"]) || (counts["a"] == 0) || (counts["b"] == 0) {
+		t.Errorf("%d queries measured of %v", result.queries, counts)
+	}
+	if (result.duration < 30*time.Millisecond) || (result.latency.percentile(50) < 1) {
+		t.Errorf("queries ran %v with median %vms", result.duration, result.latency.percentile(50))
+	}
+
+	failing := func(ctx context.Context, query string) error {
+		if query == "b" {
+			return fmt.Errorf("syntax error")
+		}
+		return nil
+	}
+	if _, err := benchQueries(context.Background(), failing, []string{"a", "b"}, time.Minute, 1); (err == nil) ||
+		!strings.Contains(err.Error(), "query \"b\" failed") {
+		t.Errorf("failing query returned %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// weightedPool picks values with probability proportional to their weight.
+type weightedPool struct {
+	values     []string
+	cumulative []float64
+}
+
+func newWeightedPool(weights map[string]float64) (*weightedPool, error) {
+	values := make([]string, 0, len(weights))
+	for value := range weights {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	pool := &weightedPool{
+		values:     values,
+		cumulative: make([]float64, len(values)),
+	}
+	total := 0.0
+	for i, value := range values {
+		if weights[value] < 0 {
+			return nil, fmt.Errorf("negative weight %v for \"%s\"", weights[value], value)
+		}
+		total += weights[value]
+		pool.cumulative[i] = total
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("weights of %v sum up to zero", values)
+	}
+
+	return pool, nil
+}
+
+func (p *weightedPool) pick(rnd *rand.Rand) string {
+	x := rnd.Float64() * p.cumulative[len(p.cumulative)-1]
+	return p.values[sort.SearchFloat64s(p.cumulative, x)]
+}
@@ -0,0 +1,187 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kshvakov/clickhouse"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// PostgresCFG configures connections to PostgreSQL storage.
+type PostgresCFG struct {
+	// disable by default.
+	SSLMode string `yaml:"sslmode"`
+}
+
+func connectPostgres(cfg StorageCFG, log *logger) (*sql.DB, error) {
+	sslMode := cfg.Postgres.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s connect_timeout=%d",
+		cfg.Addr, cfg.Port, quotePostgresParam(cfg.User), quotePostgresParam(cfg.Passwd),
+		quotePostgresParam(cfg.DefaultDB), sslMode, (cfg.ReadTimeoutMS+999)/1000)
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to PostgreSQL")
+	}
+	pingTimes := 0
+	for pingTimes = 0; pingTimes < cfg.MaxPings; pingTimes++ {
+		err := db.Ping()
+		if err == nil {
+			break
+		}
+		log.logln(errors.Wrapf(err, "unable to ping PostgreSQL for %d time", pingTimes+1))
+		time.Sleep(time.Second)
+	}
+	if pingTimes == cfg.MaxPings {
+		db.Close()
+		return nil, fmt.Errorf("unable to ping PostgreSQL for %d times", cfg.MaxPings)
+	}
+	return db, nil
+}
+
+func quotePostgresParam(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// postgresDriver bulk loads batches with COPY.
+type postgresDriver struct {
+	db   *sql.DB
+	opts insertOptions
+}
+
+func (d postgresDriver) InsertControlObjects(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+	rows := make([][]interface{}, len(cobs))
+	for i, cob := range cobs {
+		rows[i] = d.opts.cobTable.row(d.opts.controlObjectRow(cob))
+	}
+	return d.copy(ctx, d.opts.cobTable.name, d.opts.cobTable.columns, rows, times)
+}
+
+func (d postgresDriver) InsertFFVs(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+	rows := make([][]interface{}, len(ffvs))
+	for i, fv := range ffvs {
+		rows[i] = d.opts.ffvTable.row(d.opts.ffvRow(fv))
+	}
+	return d.copy(ctx, d.opts.ffvTable.name, d.opts.ffvTable.columns, rows, times)
+}
+
+func (d postgresDriver) copy(ctx context.Context, table string, columns []string, rows [][]interface{}, times *batchTimes) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to begin bulk copy")
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return errors.Wrap(err, "unable to prepare COPY statement")
+	}
+
+	serializationStart := time.Now()
+	for i, row := range rows {
+		for j, value := range row {
+			row[j] = postgresValue(value)
+		}
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			stmt.Close()
+			return errors.Wrapf(err, "unable to copy %d-th row", i+1)
+		}
+	}
+	times.serialization += time.Now().Sub(serializationStart)
+
+	commitStart := time.Now()
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return errors.Wrap(err, "unable to flush bulk copy")
+	}
+	if err := stmt.Close(); err != nil {
+		return errors.Wrap(err, "unable to finish bulk copy")
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(&commitError{err}, "unable to commit bulk copy")
+	}
+	times.commit += time.Now().Sub(commitStart)
+	return nil
+}
+
+// postgresValue converts a value of a generated row to one COPY accepts:
+// UUIDs of the ClickHouse driver are encoded as 16 raw bytes and become
+// strings, unsigned integers become bigint with their bits kept, and arrays
+// and Nested columns become PostgreSQL arrays.
+func postgresValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case clickhouse.UUID:
+		return string(v)
+	case uint64:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case []uint64:
+		ints := make([]int64, len(v))
+		for i, n := range v {
+			ints[i] = int64(n)
+		}
+		return pq.Array(ints)
+	}
+	if reflect.ValueOf(value).Kind() == reflect.Slice {
+		return pq.Array(value)
+	}
+	return value
+}
+
+// Column types of generated columns in PostgreSQL by ClickHouse type.
+var postgresTypes = map[string]string{
+	"UUID":           "uuid",
+	"UInt32":         "bigint",
+	"UInt64":         "bigint",
+	"String":         "text",
+	"DateTime":       "timestamp",
+	"Float64":        "double precision",
+	"Array(UInt64)":  "bigint[]",
+	"Array(Float64)": "double precision[]",
+}
+
+// createPostgresTables creates generated tables missing in the database.
+// Nested columns become pairs of text arrays.
+func createPostgresTables(ctx context.Context, db *sql.DB, opts insertOptions) error {
+	cobTypes, ffvTypes := idColumnTypes(opts)
+	for _, table := range generatedTables {
+		columns, types := opts.controlObjectsColumns(), cobTypes
+		if table == "facial_features" {
+			columns, types = opts.ffvsColumns(), ffvTypes
+		}
+		m := opts.table(table)
+		definitions := []string{}
+		for _, column := range columns {
+			name := m.column(column)
+			if name == "" {
+				continue
+			}
+			columnType, ok := types[column]
+			if !ok {
+				columnType = columnTypes[column]
+			}
+			pgType := postgresTypes[columnType]
+			if strings.HasSuffix(column, ".key") || strings.HasSuffix(column, ".value") {
+				pgType = "text[]"
+			}
+			definitions = append(definitions, fmt.Sprintf("%s %s", pq.QuoteIdentifier(name), pgType))
+		}
+		if id := m.column("id"); id != "" {
+			definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", pq.QuoteIdentifier(id)))
+		}
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n    %s\n)",
+			m.name, strings.Join(definitions, ",\n    "))
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return errors.Wrapf(err, "unable to create table %s", m.name)
+		}
+	}
+	return nil
+}
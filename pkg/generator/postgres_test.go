@@ -0,0 +1,317 @@
+package generator
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nofacedb/generator/pkg/storage/sinktest"
+	uuid "github.com/satori/go.uuid"
+)
+
+// fakePostgres serves the part of the PostgreSQL protocol COPY needs:
+// startup without authentication, simple queries of transactions and COPY
+// FROM STDIN in text format. Values are checked against PostgreSQL types of
+// columns, as a server parses them, and rows are stored on COMMIT.
+type fakePostgres struct {
+	listener net.Listener
+	b        *fakeBackend
+	// PostgreSQL types of columns by name, text when missing.
+	types map[string]string
+}
+
+func newFakePostgres(t *testing.T, b *fakeBackend, types map[string]string) *fakePostgres {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakePostgres{listener: listener, b: b, types: types}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakePostgres) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakePostgres) close() {
+	s.listener.Close()
+}
+
+type pgConn struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (c *pgConn) send(t byte, payload []byte) {
+	c.w.WriteByte(t)
+	binary.Write(c.w, binary.BigEndian, int32(len(payload)+4))
+	c.w.Write(payload)
+}
+
+func (c *pgConn) ready(status byte) {
+	c.send('Z', []byte{status})
+	c.w.Flush()
+}
+
+func (c *pgConn) complete(tag string) {
+	c.send('C', append([]byte(tag), 0))
+}
+
+func (c *pgConn) fail(code, message string) {
+	payload := []byte("SERROR\x00C" + code + "\x00M" + message + "\x00\x00")
+	c.send('E', payload)
+}
+
+func (c *pgConn) receive() (byte, []byte, error) {
+	t, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var n int32
+	if err := binary.Read(c.r, binary.BigEndian, &n); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n-4)
+	_, err = io.ReadFull(c.r, payload)
+	return t, payload, err
+}
+
+var copyQuery = regexp.MustCompile(`^COPY "?([^" ]+)"? \((.*)\) FROM STDIN$`)
+
+func (s *fakePostgres) serve(conn net.Conn) {
+	defer conn.Close()
+	c := &pgConn{r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	// The startup message has no type byte.
+	var n int32
+	if binary.Read(c.r, binary.BigEndian, &n) != nil {
+		return
+	}
+	if _, err := io.ReadFull(c.r, make([]byte, n-4)); err != nil {
+		return
+	}
+	c.send('R', []byte{0, 0, 0, 0})
+	c.ready('I')
+
+	var pending map[string][]map[string]interface{}
+	for {
+		t, payload, err := c.receive()
+		if (err != nil) || (t == 'X') {
+			return
+		}
+		if t != 'Q' {
+			continue
+		}
+		query := strings.TrimSuffix(string(payload), "\x00")
+		switch {
+		case query == ";":
+			c.send('I', nil)
+			c.ready('I')
+		case strings.HasPrefix(query, "BEGIN"):
+			pending = map[string][]map[string]interface{}{}
+			c.complete("BEGIN")
+			c.ready('T')
+		case query == "COMMIT":
+			stored := true
+			for table, records := range pending {
+				stored = stored && s.b.store(table, records)
+			}
+			if stored {
+				c.complete("COMMIT")
+			} else {
+				c.fail("53200", "out of memory")
+			}
+			c.ready('I')
+		case query == "ROLLBACK":
+			c.complete("ROLLBACK")
+			c.ready('I')
+		default:
+			match := copyQuery.FindStringSubmatch(query)
+			if match == nil {
+				c.fail("42601", "syntax error")
+				c.ready('E')
+				continue
+			}
+			columns := strings.Split(strings.Replace(match[2], `"`, "", -1), ", ")
+			records, err := s.copyIn(c, columns)
+			if err != nil {
+				c.fail("22P02", err.Error())
+				c.ready('E')
+				continue
+			}
+			pending[match[1]] = append(pending[match[1]], records...)
+			c.complete(fmt.Sprintf("COPY %d", len(records)))
+			c.ready('T')
+		}
+	}
+}
+
+// copyIn reads CopyData messages until CopyDone and parses their rows.
+func (s *fakePostgres) copyIn(c *pgConn, columns []string) ([]map[string]interface{}, error) {
+	response := []byte{0}
+	response = append(response, byte(len(columns)>>8), byte(len(columns)))
+	response = append(response, make([]byte, 2*len(columns))...)
+	c.send('G', response)
+	c.w.Flush()
+
+	data := []byte{}
+	for {
+		t, payload, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case 'd':
+			data = append(data, payload...)
+			continue
+		case 'f':
+			return nil, fmt.Errorf("COPY failed: %s", payload)
+		}
+		break
+	}
+	records := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != len(columns) {
+			return nil, fmt.Errorf("extra data after last expected column")
+		}
+		record := map[string]interface{}{}
+		for i, field := range fields {
+			if err := checkPostgresValue(s.types[columns[i]], field); err != nil {
+				return nil, fmt.Errorf("column %s: %v", columns[i], err)
+			}
+			record[columns[i]] = field
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// checkPostgresValue parses a field of COPY text format as a value of
+// typ.
+func checkPostgresValue(typ, field string) error {
+	if field == `\N` {
+		return nil
+	}
+	if strings.HasSuffix(typ, "[]") {
+		if !strings.HasPrefix(field, "{") || !strings.HasSuffix(field, "}") {
+			return fmt.Errorf("malformed array literal: %q", field)
+		}
+		for _, elem := range strings.Split(strings.Trim(field, "{}"), ",") {
+			if err := checkPostgresValue(strings.TrimSuffix(typ, "[]"), elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var err error
+	switch typ {
+	case "uuid":
+		_, err = uuid.FromString(field)
+	case "bigint":
+		_, err = strconv.ParseInt(field, 10, 64)
+	case "double precision":
+		_, err = strconv.ParseFloat(field, 64)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid input syntax for type %s: %q", typ, field)
+	}
+	return nil
+}
+
+func TestPostgresDriverConformance(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		schema SchemaCFG
+	}{
+		{"default", SchemaCFG{}},
+		{"mapped", SchemaCFG{
+			ControlObjects: TableSchemaCFG{Name: "persons", Columns: map[string]string{"passport": "document"}},
+			FFVs:           TableSchemaCFG{Name: "faces", Columns: map[string]string{"img_id": omittedColumn}},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := testInsertOptions(t, test.schema)
+			// Types of created tables, see createPostgresTables.
+			types := map[string]string{}
+			for _, m := range []*tableMapping{opts.cobTable, opts.ffvTable} {
+				for column, columnType := range columnTypes {
+					if name := m.column(column); name != "" {
+						types[name] = postgresTypes[columnType]
+					}
+				}
+			}
+			sink := driverSink{cobTable: opts.cobTable.name, ffvTable: opts.ffvTable.name}
+			sinktest.Run(t, func(t *testing.T) (sinktest.Sink, sinktest.Backend) {
+				b := newFakeBackend()
+				server := newFakePostgres(t, b, types)
+				t.Cleanup(server.close)
+				db, err := connectPostgres(StorageCFG{Addr: "127.0.0.1", Port: server.port(), MaxPings: 1}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { db.Close() })
+				sink.d = postgresDriver{db: db, opts: opts}
+				return sink, b
+			}, sink.contract(true))
+		})
+	}
+}
+
+func TestPostgresValue(t *testing.T) {
+	id := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	for _, test := range []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"uuid", idValue(id, false), id},
+		{"numeric id", idValue("42", true), int64(42)},
+		{"high bit", uint64(1 << 63), int64(-1 << 63)},
+		{"camera", uint32(7), int64(7)},
+		{"string", "Ivanov", "Ivanov"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := postgresValue(test.value); got != test.expected {
+				t.Errorf("%#v is converted to %#v, expected %#v", test.value, got, test.expected)
+			}
+		})
+	}
+	for _, test := range []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{"face box", []uint64{1, 1 << 63}, "{1,-9223372036854775808}"},
+		{"vector", []float64{0.5, -1}, "{0.5,-1}"},
+		{"nested", []string{"a", "b"}, `{"a","b"}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := postgresValue(test.value).(driver.Valuer).Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != test.expected {
+				t.Errorf("%v is encoded as %#v, expected %#v", test.value, value, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+)
+
+// Kinds of probe queries.
+const (
+	probePositive     = "positive"
+	probeHardNegative = "hard_negative"
+	probeNegative     = "negative"
+)
+
+var probesColumns = []string{"probe_id", "kind", "cob_id", "ffv_id", "passport", "metric", "distance", "ff"}
+
+// ProbesCFG configures probe queries for search evaluation drawn from
+// generated rows. Positives are exact copies of an inserted FFV and
+// passport, hard negatives are at near_distance from an inserted FFV with
+// one passport digit changed, negatives are new vectors and passports.
+type ProbesCFG struct {
+	// Probes per control object, 0 disables probes.
+	Rate float64 `yaml:"rate"`
+	// Weights of positive, hard_negative and negative probes.
+	Kinds        map[string]float64 `yaml:"kinds"`
+	Metric       string             `yaml:"metric"`
+	NearDistance float64            `yaml:"near_distance"`
+	Path         string             `yaml:"path"`
+}
+
+type probeGenerator struct {
+	cfg   ProbesCFG
+	kinds *weightedPool
+}
+
+func newProbeGenerator(cfg ProbesCFG) (*probeGenerator, error) {
+	if cfg.Rate <= 0 {
+		return nil, nil
+	}
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("no path to write probes to")
+	}
+	for kind := range cfg.Kinds {
+		switch kind {
+		case probePositive, probeHardNegative, probeNegative:
+		default:
+			return nil, fmt.Errorf("unknown probe kind \"%s\"", kind)
+		}
+	}
+	kinds, err := newWeightedPool(cfg.Kinds)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case (cfg.Metric != distanceCosine) && (cfg.Metric != distanceL2):
+		return nil, fmt.Errorf("unknown distance metric \"%s\"", cfg.Metric)
+	case cfg.NearDistance <= 0:
+		return nil, fmt.Errorf("near distance must be positive, got %v", cfg.NearDistance)
+	}
+	return &probeGenerator{cfg: cfg, kinds: kinds}, nil
+}
+
+// write draws a probe from an inserted control object and its FFV with
+// probability rate.
+func (p *probeGenerator) write(rnd *rand.Rand, labels *labelsFile, g *generation, i int, cob controlObject, fv ffv) {
+	if (p == nil) || (rnd.Float64() >= p.cfg.Rate) {
+		return
+	}
+	id := g.newID("probe", i)
+	distance := 0.0
+	vector := fv.facialFeaturesVector
+	passport := cob.passport
+	switch kind := p.kinds.pick(rnd); kind {
+	case probePositive:
+		labels.write(id, kind, cob.id, fv.id, passport, p.cfg.Metric, "0", formatTSVValue(vector))
+	case probeHardNegative:
+		distance = p.cfg.NearDistance
+		vector = plantPartner(rnd, vector, p.cfg.Metric, distance)
+		passport = nearPassport(rnd, passport)
+		labels.write(id, kind, cob.id, fv.id, passport, p.cfg.Metric,
+			strconv.FormatFloat(distance, 'f', -1, 64), formatTSVValue(vector))
+	case probeNegative:
+		labels.write(id, kind, "", "", generatePassport(rnd), p.cfg.Metric, "", formatTSVValue(g.vectors.generate(rnd)))
+	}
+}
+
+// nearPassport changes one digit of the passport.
+func nearPassport(rnd *rand.Rand, passport string) string {
+	digits := []byte(passport)
+	for {
+		i := rnd.Intn(len(digits))
+		if digits[i] != ' ' {
+			digits[i] = '0' + (digits[i]-'0'+byte(1+rnd.Intn(9)))%10
+			return string(digits)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestProbes checks that positive probes exist in generated rows, hard
+// negatives nearly exist and negatives do not.
+func TestProbes(t *testing.T) {
+	cfg, dir := testConfig(t, 300)
+	cfg.GeneratorCFG.Probes.Rate = 0.5
+	testRun(t, cfg)
+	passports := map[string]string{}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		passports[row[0]] = row[2]
+	}
+	known := map[string]bool{}
+	for _, passport := range passports {
+		known[passport] = true
+	}
+	vectors := map[string][]float64{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		vectors[row[0]] = parseTSVVector(t, row[4])
+	}
+
+	kinds := map[string]int{}
+	for _, probe := range readLabels(t, cfg.GeneratorCFG.Probes.Path) {
+		kind, cobID, ffvID, passport, vector := probe[1], probe[2], probe[3], probe[4], parseTSVVector(t, probe[7])
+		kinds[kind]++
+		switch kind {
+		case probePositive:
+			if (passport != passports[cobID]) || !reflect.DeepEqual(vector, vectors[ffvID]) {
+				t.Errorf("positive probe %s is not control object %s with FFV %s", probe[0], cobID, ffvID)
+			}
+		case probeHardNegative:
+			changed := 0
+			for i := range passport {
+				if passport[i] != passports[cobID][i] {
+					changed++
+				}
+			}
+			if (changed != 1) || known[passport] {
+				t.Errorf("hard negative passport %s is not one digit away from %s", passport, passports[cobID])
+			}
+			if d := cosineDistance(vector, vectors[ffvID]); math.Abs(d-0.1) > 1e-6 {
+				t.Errorf("hard negative probe %s is %v away from FFV %s, expected 0.1", probe[0], d, ffvID)
+			}
+		case probeNegative:
+			if (cobID != "") || (ffvID != "") || known[passport] {
+				t.Errorf("negative probe %s refers to generated rows", probe[0])
+			}
+		default:
+			t.Errorf("unknown probe kind %s", kind)
+		}
+	}
+	// Weights of probe kinds are 0.4, 0.3 and 0.3.
+	total := kinds[probePositive] + kinds[probeHardNegative] + kinds[probeNegative]
+	if (total < 120) || (total > 180) || (kinds[probePositive] < total/4) || (kinds[probeNegative] < total/6) ||
+		(kinds[probeHardNegative] < total/6) {
+		t.Errorf("probes of 300 control objects at rate 0.5 are %v", kinds)
+	}
+
+	for _, probes := range []ProbesCFG{
+		{Rate: 0.1, Kinds: map[string]float64{"positive": 1}, Metric: distanceCosine, NearDistance: 0.1},
+		{Rate: 0.1, Kinds: map[string]float64{"duplicate": 1}, Metric: distanceCosine, NearDistance: 0.1, Path: "p"},
+		{Rate: 0.1, Kinds: map[string]float64{"positive": 1}, Metric: "dot", NearDistance: 0.1, Path: "p"},
+		{Rate: 0.1, Kinds: map[string]float64{"positive": 1}, Metric: distanceL2, Path: "p"},
+	} {
+		if _, err := newProbeGenerator(probes); err == nil {
+			t.Errorf("probes %+v are accepted", probes)
+		}
+	}
+}
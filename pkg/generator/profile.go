@@ -0,0 +1,172 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// ProfileCFG configures profiling of generated data after runs.
+type ProfileCFG struct {
+	Enabled bool `yaml:"enabled"`
+	TopK    int  `yaml:"top_k"`
+}
+
+const tableColumnsQuery = `
+SELECT
+    name,
+    type
+FROM
+    system.columns
+WHERE
+    database = currentDatabase() AND table = ?
+ORDER BY
+    position;
+`
+
+// lengthBucket counts values of String and Array columns with length in
+// [2^bucket-1, 2^(bucket+1)-1).
+type lengthBucket struct {
+	bucket uint32
+	count  uint64
+}
+
+type columnProfile struct {
+	name     string
+	typ      string
+	rows     uint64
+	nulls    uint64
+	distinct uint64
+	min, max string
+	top      []string
+	lengths  []lengthBucket
+}
+
+func hasLength(typ string) bool {
+	typ = strings.TrimPrefix(strings.TrimPrefix(typ, "LowCardinality("), "Nullable(")
+	return strings.HasPrefix(typ, "String") || strings.HasPrefix(typ, "Array(")
+}
+
+func profileColumn(ctx context.Context, db *sql.DB, table string, column *columnProfile, topK int) error {
+	name := "`" + column.name + "`"
+	// Arrays are compared by length, other values as is.
+	minMax := fmt.Sprintf("toString(min(%s)), toString(max(%s))", name, name)
+	if strings.HasPrefix(column.typ, "Array(") {
+		minMax = fmt.Sprintf("toString(min(length(%s))), toString(max(length(%s)))", name, name)
+	}
+	query := fmt.Sprintf("SELECT count(), countIf(isNull(%s)), uniq(%s), %s, topK(%d)(toString(%s)) FROM %s",
+		name, name, minMax, topK, name, table)
+	if err := db.QueryRowContext(ctx, query).Scan(
+		&column.rows, &column.nulls, &column.distinct, &column.min, &column.max, &column.top,
+	); err != nil {
+		return errors.Wrapf(err, "unable to profile %s.%s", table, column.name)
+	}
+
+	if !hasLength(column.typ) {
+		return nil
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT toUInt32(floor(log2(length(%s) + 1))) AS bucket, count() FROM %s GROUP BY bucket ORDER BY bucket",
+		name, table))
+	if err != nil {
+		return errors.Wrapf(err, "unable to build length histogram of %s.%s", table, column.name)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		bucket := lengthBucket{}
+		if err := rows.Scan(&bucket.bucket, &bucket.count); err != nil {
+			return errors.Wrapf(err, "unable to scan length histogram of %s.%s", table, column.name)
+		}
+		column.lengths = append(column.lengths, bucket)
+	}
+	return rows.Err()
+}
+
+func (p columnProfile) String() string {
+	nullRate := 0.0
+	if p.rows != 0 {
+		nullRate = float64(p.nulls) / float64(p.rows)
+	}
+	s := fmt.Sprintf("  %s %s: %d distinct, min %q, max %q, null rate %.4f, top %q",
+		p.name, p.typ, p.distinct, p.min, p.max, nullRate, p.top)
+	if len(p.lengths) != 0 {
+		buckets := make([]string, len(p.lengths))
+		for i, b := range p.lengths {
+			buckets[i] = fmt.Sprintf("[%d, %d): %d", (1<<b.bucket)-1, (1<<(b.bucket+1))-1, b.count)
+		}
+		s += "\n    lengths " + strings.Join(buckets, ", ")
+	}
+	return s
+}
+
+// profileReport profiles every column of generated tables: distinct
+// counts, min/max, null rate, top-K values and length histograms.
+func profileReport(ctx context.Context, db *sql.DB, topK int, opts insertOptions) (string, error) {
+	if topK <= 0 {
+		topK = 5
+	}
+	lines := []string{}
+	for _, table := range opts.tableNames() {
+		rows, err := db.QueryContext(ctx, tableColumnsQuery, table)
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to get %s columns", table)
+		}
+		columns := []columnProfile{}
+		for rows.Next() {
+			column := columnProfile{}
+			if err := rows.Scan(&column.name, &column.typ); err != nil {
+				rows.Close()
+				return "", errors.Wrapf(err, "unable to scan %s columns", table)
+			}
+			columns = append(columns, column)
+		}
+		rows.Close()
+
+		for i := range columns {
+			if err := profileColumn(ctx, db, table, &columns[i], topK); err != nil {
+				return "", err
+			}
+		}
+		if len(columns) != 0 {
+			lines = append(lines, fmt.Sprintf("%s: %d rows", table, columns[0].rows))
+		}
+		for _, column := range columns {
+			lines = append(lines, column.String())
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func runProfile(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file")
+	topK := flags.Int("top", 5, "number of most frequent values reported per column")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	opts, err := mappedOptions(cfg)
+	if err != nil {
+		return err
+	}
+	db, err := connectClickHouse(cfg.StorageCFG, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := profileReport(ctx, db, *topK, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+	return nil
+}
@@ -0,0 +1,55 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestProfileReport(t *testing.T) {
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	server.answer = func(query string) (nativeResult, error) {
+		switch {
+		case strings.Contains(query, "system.columns") && strings.Contains(query, "table = 'control_objects'"):
+			return nativeResult{names: []string{"name", "type"}, types: []string{"String", "String"},
+				rows: [][]interface{}{{"passport", "String"}}}, nil
+		case strings.Contains(query, "system.columns") && strings.Contains(query, "table = 'facial_features'"):
+			return nativeResult{names: []string{"name", "type"}, types: []string{"String", "String"},
+				rows: [][]interface{}{{"ff", "Array(Float64)"}}}, nil
+		case strings.HasPrefix(query, "SELECT count(), countIf(isNull(`passport`)), uniq(`passport`), toString(min(`passport`))"):
+			return nativeResult{
+				names: []string{"rows", "nulls", "distinct", "min", "max", "top"},
+				types: []string{"UInt64", "UInt64", "UInt64", "String", "String", "Array(String)"},
+				rows:  [][]interface{}{{uint64(100), uint64(0), uint64(98), "10 00 000001", "99 99 999999", []string{"12 34 567890"}}},
+			}, nil
+		case strings.HasPrefix(query, "SELECT count(), countIf(isNull(`ff`)), uniq(`ff`), toString(min(length(`ff`)))"):
+			return nativeResult{
+				names: []string{"rows", "nulls", "distinct", "min", "max", "top"},
+				types: []string{"UInt64", "UInt64", "UInt64", "String", "String", "Array(String)"},
+				rows:  [][]interface{}{{uint64(200), uint64(50), uint64(150), "128", "128", []string{}}},
+			}, nil
+		case strings.Contains(query, "log2(length("):
+			return nativeResult{names: []string{"bucket", "count()"}, types: []string{"UInt32", "UInt64"},
+				rows: [][]interface{}{{uint32(3), uint64(20)}, {uint32(7), uint64(80)}}}, nil
+		}
+		return nativeResult{}, fmt.Errorf("unexpected query %s", query)
+	}
+
+	report, err := profileReport(context.Background(), server.connect(t), 1, testInsertOptions(t, SchemaCFG{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"control_objects: 100 rows",
+		`  passport String: 98 distinct, min "10 00 000001", max "99 99 999999", null rate 0.0000, top ["12 34 567890"]`,
+		"    lengths [7, 15): 20, [127, 255): 80",
+		"facial_features: 200 rows",
+		`  ff Array(Float64): 150 distinct, min "128", max "128", null rate 0.2500, top []`,
+		"    lengths [7, 15): 20, [127, 255): 80",
+	}, "\n")
+	if report != expected {
+		t.Errorf("profile is\n%s\nexpected\n%s", report, expected)
+	}
+}
@@ -0,0 +1,231 @@
+package generator
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	proxyHTTP   = "http"
+	proxySOCKS5 = "socks5"
+
+	proxyDialTimeout = 10 * time.Second
+)
+
+// ProxyCFG configures the proxy connections to storage are tunneled through.
+type ProxyCFG struct {
+	Type   string `yaml:"type"`
+	Addr   string `yaml:"addr"`
+	User   string `yaml:"user"`
+	Passwd string `yaml:"passwd"`
+}
+
+func (cfg ProxyCFG) validate() error {
+	switch cfg.Type {
+	case proxyHTTP:
+	case proxySOCKS5:
+		// Credentials are sent with single byte lengths.
+		if len(cfg.User) > 255 {
+			return fmt.Errorf("SOCKS5 user must be at most 255 bytes, got %d", len(cfg.User))
+		}
+		if len(cfg.Passwd) > 255 {
+			return fmt.Errorf("SOCKS5 password must be at most 255 bytes, got %d", len(cfg.Passwd))
+		}
+	default:
+		return fmt.Errorf("unknown proxy type \"%s\"", cfg.Type)
+	}
+	return nil
+}
+
+// startProxyForwarder listens on a local port and tunnels every accepted
+// connection to target through the configured proxy. The ClickHouse driver
+// dials plain TCP only, so it is pointed at the returned local address.
+func startProxyForwarder(cfg ProxyCFG, target string, log *logger) (string, error) {
+	if err := cfg.validate(); err != nil {
+		return "", err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", errors.Wrap(err, "unable to start local proxy listener")
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.logln(errors.Wrap(err, "unable to accept local proxy connection"))
+				return
+			}
+			go forwardThroughProxy(cfg, target, conn, log)
+		}
+	}()
+
+	return listener.Addr().String(), nil
+}
+
+func forwardThroughProxy(cfg ProxyCFG, target string, conn net.Conn, log *logger) {
+	defer conn.Close()
+	upstream, err := dialThroughProxy(cfg, target)
+	if err != nil {
+		log.logln(errors.Wrapf(err, "unable to connect to %s through %s proxy", target, cfg.Type))
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func dialThroughProxy(cfg ProxyCFG, target string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", cfg.Addr, proxyDialTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to dial proxy")
+	}
+	conn.SetDeadline(time.Now().Add(proxyDialTimeout))
+	tunnel := conn
+	switch cfg.Type {
+	case proxyHTTP:
+		tunnel, err = httpConnect(conn, cfg, target)
+	case proxySOCKS5:
+		err = socks5Connect(conn, cfg, target)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tunnel.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func httpConnect(conn net.Conn, cfg ProxyCFG, target string) (net.Conn, error) {
+	connect := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
+	if cfg.User != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(cfg.User + ":" + cfg.Passwd))
+		connect += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	if _, err := io.WriteString(conn, connect+"\r\n"); err != nil {
+		return nil, errors.Wrap(err, "unable to send CONNECT request")
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read CONNECT response")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy refused CONNECT: %s", resp.Status)
+	}
+
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+func socks5Connect(conn net.Conn, cfg ProxyCFG, target string) error {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return errors.Wrap(err, "invalid target address")
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return errors.Wrap(err, "invalid target port")
+	}
+	if len(host) > 255 {
+		return fmt.Errorf("target host \"%s\" is too long for SOCKS5", host)
+	}
+
+	method := byte(0x00)
+	if cfg.User != "" {
+		method = 0x02
+	}
+	if _, err := conn.Write([]byte{0x05, 0x01, method}); err != nil {
+		return errors.Wrap(err, "unable to send SOCKS5 greeting")
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return errors.Wrap(err, "unable to read SOCKS5 greeting reply")
+	}
+	if (reply[0] != 0x05) || (reply[1] != method) {
+		return fmt.Errorf("SOCKS5 proxy rejected authentication method %d", method)
+	}
+
+	if method == 0x02 {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		auth := []byte{0x01, byte(len(cfg.User))}
+		auth = append(auth, cfg.User...)
+		auth = append(auth, byte(len(cfg.Passwd)))
+		auth = append(auth, cfg.Passwd...)
+		if _, err := conn.Write(auth); err != nil {
+			return errors.Wrap(err, "unable to send SOCKS5 credentials")
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return errors.Wrap(err, "unable to read SOCKS5 authentication reply")
+		}
+		if reply[1] != 0x00 {
+			return fmt.Errorf("SOCKS5 authentication failed")
+		}
+	}
+
+	req := []byte{0x05, 0x01, 0x00, 0x03, byte(len(host))}
+	req = append(req, host...)
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return errors.Wrap(err, "unable to send SOCKS5 connect request")
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return errors.Wrap(err, "unable to read SOCKS5 connect reply")
+	}
+	if header[1] != 0x00 {
+		return fmt.Errorf("SOCKS5 proxy refused connection with code %d", header[1])
+	}
+	addrLen := 0
+	switch header[3] {
+	case 0x01:
+		addrLen = net.IPv4len
+	case 0x04:
+		addrLen = net.IPv6len
+	case 0x03:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return errors.Wrap(err, "unable to read SOCKS5 bound address")
+		}
+		addrLen = int(length[0])
+	default:
+		return fmt.Errorf("unknown SOCKS5 address type %d", header[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		return errors.Wrap(err, "unable to read SOCKS5 bound address")
+	}
+
+	return nil
+}
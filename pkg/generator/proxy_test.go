@@ -0,0 +1,155 @@
+package generator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// listen serves every connection of a local listener with serve.
+func listen(t *testing.T, serve func(net.Conn)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func tunnel(conn net.Conn, target string) {
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+// fakeHTTPProxy accepts CONNECT requests with the credentials user:passwd
+// and refuses the others.
+func fakeHTTPProxy(t *testing.T) string {
+	return listen(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		// Credentials of proxies are parsed like those of Authorization.
+		auth := &http.Request{Header: http.Header{"Authorization": {req.Header.Get("Proxy-Authorization")}}}
+		if user, passwd, ok := auth.BasicAuth(); !ok || (user != "user") || (passwd != "passwd") {
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		tunnel(&bufferedConn{Conn: conn, reader: reader}, req.Host)
+	})
+}
+
+// fakeSOCKS5Proxy accepts connections authenticated as user:passwd.
+func fakeSOCKS5Proxy(t *testing.T) string {
+	return listen(t, func(conn net.Conn) {
+		greeting := make([]byte, 3)
+		if _, err := io.ReadFull(conn, greeting); (err != nil) || (greeting[2] != 0x02) {
+			conn.Write([]byte{0x05, 0xff})
+			return
+		}
+		conn.Write([]byte{0x05, 0x02})
+		header := make([]byte, 2)
+		io.ReadFull(conn, header)
+		user := make([]byte, header[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, header[:1])
+		passwd := make([]byte, header[0])
+		io.ReadFull(conn, passwd)
+		if (string(user) != "user") || (string(passwd) != "passwd") {
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+		req := make([]byte, 5)
+		io.ReadFull(conn, req)
+		host := make([]byte, req[4]+2)
+		io.ReadFull(conn, host)
+		port := binary.BigEndian.Uint16(host[len(host)-2:])
+		conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+		tunnel(conn, net.JoinHostPort(string(host[:len(host)-2]), strconv.Itoa(int(port))))
+	})
+}
+
+func TestDialThroughProxy(t *testing.T) {
+	echo := listen(t, func(conn net.Conn) { io.Copy(conn, conn) })
+	proxies := map[string]string{proxyHTTP: fakeHTTPProxy(t), proxySOCKS5: fakeSOCKS5Proxy(t)}
+	for _, test := range []struct {
+		name   string
+		typ    string
+		passwd string
+		err    string
+	}{
+		{"http", proxyHTTP, "passwd", ""},
+		{"http refused", proxyHTTP, "wrong", "proxy refused CONNECT"},
+		{"socks5", proxySOCKS5, "passwd", ""},
+		{"socks5 refused", proxySOCKS5, "wrong", "SOCKS5 authentication failed"},
+		{"socks5 long password", proxySOCKS5, strings.Repeat("p", 256), "at most 255 bytes"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := ProxyCFG{Type: test.typ, Addr: proxies[test.typ], User: "user", Passwd: test.passwd}
+			conn, err := dialThroughProxy(cfg, echo)
+			if test.err != "" {
+				if (err == nil) || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, expected %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, err := io.WriteString(conn, "ping"); err != nil {
+				t.Fatal(err)
+			}
+			reply := make([]byte, 4)
+			if _, err := io.ReadFull(conn, reply); (err != nil) || (string(reply) != "ping") {
+				t.Errorf("got %q, %v through the proxy", reply, err)
+			}
+		})
+	}
+}
+
+func TestProxyValidate(t *testing.T) {
+	long := strings.Repeat("x", 256)
+	for _, test := range []struct {
+		name  string
+		cfg   ProxyCFG
+		valid bool
+	}{
+		{"http", ProxyCFG{Type: proxyHTTP, User: long}, true},
+		{"socks5", ProxyCFG{Type: proxySOCKS5, User: strings.Repeat("x", 255)}, true},
+		{"socks5 long user", ProxyCFG{Type: proxySOCKS5, User: long}, false},
+		{"socks5 long password", ProxyCFG{Type: proxySOCKS5, User: "user", Passwd: long}, false},
+		{"unknown", ProxyCFG{Type: "ftp"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.cfg.validate(); (err == nil) != test.valid {
+				t.Errorf("validate() = %v", err)
+			}
+		})
+	}
+}
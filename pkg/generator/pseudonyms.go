@@ -0,0 +1,222 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// PseudonymsCFG configures an encrypted dictionary of generated persons and
+// parameters they were generated with, so that authorized testers can
+// unmask synthetic identities with "generator unmask".
+type PseudonymsCFG struct {
+	// Empty disables the dictionary.
+	Path string `yaml:"path"`
+	// Lines of the dictionary are encrypted with AES-256-GCM keyed by the
+	// SHA-256 of key.
+	Key string `yaml:"key"`
+}
+
+func (cfg PseudonymsCFG) validate() error {
+	if (cfg.Path != "") && (cfg.Key == "") {
+		return fmt.Errorf("pseudonyms need a key")
+	}
+	return nil
+}
+
+var pseudonymsColumns = []string{"cob_id", "passport", "surname", "name", "patronymic", "seed", "worker", "row", "cluster"}
+
+func newPseudonymsCipher(key string) (cipher.AEAD, error) {
+	hash := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(hash[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create pseudonyms cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+// pseudonymsFile writes the dictionary as CSV lines, each encrypted with a
+// random nonce prepended and encoded as base64, header included. Methods are
+// no-ops on nil pseudonymsFile. Writes are safe for concurrent use.
+type pseudonymsFile struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	aead   cipher.AEAD
+	seed   int64
+	// Finds clusters of identities.
+	vectors *ffvGenerator
+}
+
+// newPseudonymsFile creates the dictionary of a run or, for resumed runs,
+// appends to the existing one. It returns nil without cfg.Path.
+func newPseudonymsFile(cfg PseudonymsCFG, resume bool, seed int64, vectors *ffvGenerator) (*pseudonymsFile, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	aead, err := newPseudonymsCipher(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(cfg.Path, flags, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create pseudonyms file %s", cfg.Path)
+	}
+	f := &pseudonymsFile{file: file, writer: bufio.NewWriter(file), aead: aead, seed: seed, vectors: vectors}
+	if info, err := file.Stat(); (err == nil) && (info.Size() == 0) {
+		if err := f.writeLine(pseudonymsColumns); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *pseudonymsFile) writeLine(fields []string) error {
+	line := &bytes.Buffer{}
+	w := csv.NewWriter(line)
+	w.Write(fields)
+	w.Flush()
+	nonce := make([]byte, f.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrap(err, "unable to generate pseudonyms nonce")
+	}
+	sealed := f.aead.Seal(nonce, nonce, line.Bytes(), nil)
+	f.writer.WriteString(base64.StdEncoding.EncodeToString(sealed))
+	return f.writer.WriteByte('\n')
+}
+
+// write adds cob generated as row of worker from identity, the centroid of
+// the person.
+func (f *pseudonymsFile) write(worker, row int, identity []float64, cob controlObject) {
+	if f == nil {
+		return
+	}
+	cluster := ""
+	if i := f.vectors.cluster(identity); i >= 0 {
+		cluster = strconv.Itoa(i)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writeLine([]string{cob.id, cob.passport, cob.surname, cob.name, cob.patronymic,
+		strconv.FormatInt(f.seed, 10), strconv.Itoa(worker), strconv.Itoa(row), cluster})
+}
+
+func (f *pseudonymsFile) close() error {
+	if f == nil {
+		return nil
+	}
+	if err := f.writer.Flush(); err != nil {
+		f.file.Close()
+		return errors.Wrapf(err, "unable to write pseudonyms file %s", f.file.Name())
+	}
+	return f.file.Close()
+}
+
+// readPseudonyms decrypts the dictionary at path and returns its rows
+// without the header.
+func readPseudonyms(path, key string) ([][]string, error) {
+	aead, err := newPseudonymsCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open pseudonyms file %s", path)
+	}
+	defer file.Close()
+	rows := [][]string{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		sealed, err := base64.StdEncoding.DecodeString(scanner.Text())
+		if (err != nil) || (len(sealed) < aead.NonceSize()) {
+			return nil, fmt.Errorf("line %d of pseudonyms file %s is not encrypted", n, path)
+		}
+		line, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt line %d of pseudonyms file %s, wrong key?", n, path)
+		}
+		row, err := csv.NewReader(bytes.NewReader(line)).Read()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse line %d of pseudonyms file %s", n, path)
+		}
+		// Headers repeat in files of resumed runs.
+		if row[0] != pseudonymsColumns[0] {
+			rows = append(rows, row)
+		}
+	}
+	return rows, errors.Wrapf(scanner.Err(), "unable to read pseudonyms file %s", path)
+}
+
+// unmask returns rows of persons with one of ids or passports, every row
+// without either.
+func unmask(rows [][]string, ids, passports []string) [][]string {
+	if (len(ids) == 0) && (len(passports) == 0) {
+		return rows
+	}
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted["id:"+id] = true
+	}
+	for _, passport := range passports {
+		wanted["passport:"+passport] = true
+	}
+	unmasked := [][]string{}
+	for _, row := range rows {
+		if wanted["id:"+row[0]] || wanted["passport:"+row[1]] {
+			unmasked = append(unmasked, row)
+		}
+	}
+	return unmasked
+}
+
+func runUnmask(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("unmask", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file")
+	ids := flags.String("id", "", "comma-separated control object IDs to unmask")
+	passports := flags.String("passport", "", "comma-separated passports to unmask")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	if cfg.GeneratorCFG.Pseudonyms.Path == "" {
+		return fmt.Errorf("generator.pseudonyms.path is not set")
+	}
+	rows, err := readPseudonyms(cfg.GeneratorCFG.Pseudonyms.Path, cfg.GeneratorCFG.Pseudonyms.Key)
+	if err != nil {
+		return err
+	}
+	split := func(list string) []string {
+		if list == "" {
+			return nil
+		}
+		return strings.Split(list, ",")
+	}
+	w := csv.NewWriter(os.Stdout)
+	w.Write(pseudonymsColumns)
+	w.WriteAll(unmask(rows, split(*ids), split(*passports)))
+	return w.Error()
+}
@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPseudonyms(t *testing.T) {
+	cfg, dir := testConfig(t, 40)
+	cfg.GeneratorCFG.FFV.Clusters = 4
+	cfg.GeneratorCFG.DuplicateRate = 0.2
+	cfg.GeneratorCFG.DuplicatesLabelsPath = filepath.Join(dir, "duplicates.tsv")
+	cfg.GeneratorCFG.Pseudonyms = PseudonymsCFG{Path: filepath.Join(dir, "pseudonyms.csv"), Key: "secret"}
+	testRun(t, cfg)
+
+	rows, err := readPseudonyms(cfg.GeneratorCFG.Pseudonyms.Path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cobs := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+	if len(rows) != len(cobs) {
+		t.Fatalf("%d pseudonyms of %d control objects", len(rows), len(cobs))
+	}
+	clusters := map[string]string{}
+	for i, row := range rows {
+		if (row[0] != cobs[i][0]) || (row[5] != "1") || (row[6] != "0") || (row[7] != strconv.Itoa(i)) {
+			t.Fatalf("pseudonym %v of row %d, control object %v", row, i, cobs[i])
+		}
+		if cluster, err := strconv.Atoi(row[8]); (err != nil) || (cluster < 0) || (cluster >= 4) {
+			t.Fatalf("pseudonym %v has no cluster", row)
+		}
+		clusters[row[0]] = row[8]
+	}
+	// Duplicates are persons of the original's cluster.
+	duplicates := readLabels(t, cfg.GeneratorCFG.DuplicatesLabelsPath)
+	if len(duplicates) == 0 {
+		t.Fatal("no duplicates generated")
+	}
+	for _, duplicate := range duplicates {
+		if clusters[duplicate[0]] != clusters[duplicate[1]] {
+			t.Fatalf("duplicate %s is in cluster %s, the original in %s", duplicate[0], clusters[duplicate[0]],
+				clusters[duplicate[1]])
+		}
+	}
+
+	data, err := ioutil.ReadFile(cfg.GeneratorCFG.Pseudonyms.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), rows[0][1]) || strings.Contains(string(data), rows[0][2]) {
+		t.Fatal("pseudonyms are not encrypted")
+	}
+	if _, err := readPseudonyms(cfg.GeneratorCFG.Pseudonyms.Path, "guess"); (err == nil) || !strings.Contains(err.Error(), "wrong key") {
+		t.Fatalf("pseudonyms decrypted with a wrong key: %v", err)
+	}
+
+	// Duplicates share passports.
+	expected := [][]string{}
+	for _, row := range rows {
+		if (row[0] == rows[3][0]) || (row[1] == rows[7][1]) {
+			expected = append(expected, row)
+		}
+	}
+	if unmasked := unmask(rows, []string{rows[3][0]}, []string{rows[7][1]}); !reflect.DeepEqual(unmasked, expected) {
+		t.Fatalf("unmasked %v instead of %v", unmasked, expected)
+	}
+	if unmasked := unmask(rows, nil, nil); len(unmasked) != len(rows) {
+		t.Fatalf("unmasked %d of %d rows without filters", len(unmasked), len(rows))
+	}
+}
+
+func TestPseudonymsNeedKey(t *testing.T) {
+	cfg, dir := testConfig(t, 10)
+	cfg.GeneratorCFG.Pseudonyms.Path = filepath.Join(dir, "pseudonyms.csv")
+	if _, err := newGeneration(cfg, 1); (err == nil) || !strings.Contains(err.Error(), "need a key") {
+		t.Fatalf("pseudonyms without a key: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimiter paces events at a rate per second, shared by API requests,
+// -target-rows-per-sec and generator.rate_limit_rows_per_sec. Up to burst
+// events pass at once after idle time, a burst of 1 spaces events evenly.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	// Time all events taken so far are paid off at.
+	next time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rate), burst: burst}
+}
+
+func (l *rateLimiter) setRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.interval = time.Duration(float64(time.Second) / rate)
+}
+
+// wait blocks until the next event is allowed. Nil limiter never waits.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	return l.waitN(ctx, 1)
+}
+
+// waitN blocks until n events are allowed, n above the burst waits for the
+// excess. Nil limiter never waits.
+func (l *rateLimiter) waitN(ctx context.Context, n int) error {
+	if (l == nil) || (n == 0) {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * l.interval)
+	wait := l.next.Sub(now) - time.Duration(l.burst)*l.interval
+	l.mu.Unlock()
+	return sleepContext(ctx, wait)
+}
+
+func validateRateLimits(cfg GeneratorCFG) error {
+	if (cfg.RateLimitRowsPerSec < 0) || (cfg.RateLimitBurst < 0) {
+		return fmt.Errorf("rate limit and its burst must not be negative, got %v and %d",
+			cfg.RateLimitRowsPerSec, cfg.RateLimitBurst)
+	}
+	if cfg.MaxInflightBatches < 0 {
+		return fmt.Errorf("max inflight batches must not be negative, got %d", cfg.MaxInflightBatches)
+	}
+	return nil
+}
+
+// limitedWrite runs insert of a batch with rows control objects within the
+// rate limit and the limit of batches in flight across workers and tables.
+// Rates count control objects, like -target-rows-per-sec, so batches of
+// facial features only take a slot in flight.
+func (g *generation) limitedWrite(ctx context.Context, rows int, insert func() error) error {
+	if err := g.rateLimit.waitN(ctx, rows); err != nil {
+		return err
+	}
+	if g.inflight != nil {
+		select {
+		case g.inflight <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-g.inflight }()
+	}
+	return insert()
+}
@@ -0,0 +1,124 @@
+package generator
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if l := newRateLimiter(0, 10); l != nil {
+		t.Error("rate limiter without a rate is not nil")
+	}
+	var none *rateLimiter
+	if err := none.waitN(context.Background(), 100); err != nil {
+		t.Errorf("nil rate limiter waits: %v", err)
+	}
+
+	// A burst of 1 spaces events evenly.
+	l := newRateLimiter(1000, 0)
+	startTime := time.Now()
+	for i := 0; i < 50; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Now().Sub(startTime); elapsed < 45*time.Millisecond {
+		t.Errorf("50 events at 1000 per second took %v", elapsed)
+	}
+
+	// Bursts pass at once after idle time, more events wait for the excess.
+	l = newRateLimiter(1000, 20)
+	startTime = time.Now()
+	if err := l.waitN(context.Background(), 20); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Now().Sub(startTime); elapsed > 10*time.Millisecond {
+		t.Errorf("burst of 20 events took %v", elapsed)
+	}
+	if err := l.waitN(context.Background(), 30); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Now().Sub(startTime); elapsed < 25*time.Millisecond {
+		t.Errorf("50 events with a burst of 20 at 1000 per second took %v", elapsed)
+	}
+
+	l.setRate(0.001)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.waitN(ctx, 100); err != context.DeadlineExceeded {
+		t.Errorf("rate limiter waiting past the deadline returns %v", err)
+	}
+}
+
+// TestLimitedWrite checks that batches in flight across workers are capped.
+func TestLimitedWrite(t *testing.T) {
+	g := &generation{inflight: make(chan struct{}, 2)}
+	mu := sync.Mutex{}
+	inflight, maxInflight := 0, 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := g.limitedWrite(context.Background(), 10, func() error {
+				mu.Lock()
+				inflight++
+				if inflight > maxInflight {
+					maxInflight = inflight
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				inflight--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxInflight != 2 {
+		t.Errorf("%d batches are in flight at most, expected 2", maxInflight)
+	}
+
+	g.inflight <- struct{}{}
+	g.inflight <- struct{}{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.limitedWrite(ctx, 10, func() error { return nil }); err != context.Canceled {
+		t.Errorf("write waiting for a slot in flight returns %v", err)
+	}
+}
+
+// TestRateLimitRun checks that runs insert control objects at the rate
+// limit and refuse other pacing.
+func TestRateLimitRun(t *testing.T) {
+	cfg, _ := testConfig(t, 100)
+	cfg.GeneratorCFG.InIter = 10
+	cfg.GeneratorCFG.RateLimitRowsPerSec, cfg.GeneratorCFG.MaxInflightBatches = 1000, 1
+	startTime := time.Now()
+	if inserted := testRun(t, cfg); inserted != 100 {
+		t.Errorf("rate limited run inserts %d pairs", inserted)
+	}
+	// The first batch is a burst.
+	if elapsed := time.Now().Sub(startTime); elapsed < 80*time.Millisecond {
+		t.Errorf("100 control objects at 1000 per second took %v", elapsed)
+	}
+
+	_, err := run(context.Background(), cfg, Options{TargetRowsPerSec: 1000}, cfg.GeneratorCFG.Seed, nil, time.Now(),
+		&logger{quiet: true})
+	if (err == nil) || !strings.Contains(err.Error(), "both pace inserts") {
+		t.Errorf("run with a rate limit and -target-rows-per-sec returns %v", err)
+	}
+	for _, limits := range []GeneratorCFG{{RateLimitRowsPerSec: -1}, {RateLimitBurst: -1}, {MaxInflightBatches: -1}} {
+		if err := validateRateLimits(limits); err == nil {
+			t.Errorf("rate limits %v, %d, %d are valid", limits.RateLimitRowsPerSec, limits.RateLimitBurst,
+				limits.MaxInflightBatches)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ReplayCFG configures records of batches failing to insert, which
+// -replay-batch regenerates.
+type ReplayCFG struct {
+	// Directory records are written to, empty disables them. Records need
+	// generator.seed, since runs without it draw IDs and timestamps apart
+	// from the seed.
+	Dir string `yaml:"dir"`
+}
+
+func (cfg ReplayCFG) validate(seed int64) error {
+	if (cfg.Dir != "") && (seed == 0) {
+		return fmt.Errorf("records of failed batches need generator.seed")
+	}
+	return nil
+}
+
+// batchRecord is enough state to regenerate a failed batch. A worker draws
+// rows from streams of the seed starting at the first row it generated,
+// and rows depend on earlier ones, e.g. duplicates and upserts, so the
+// batch is regenerated from Start with rows before From dropped.
+type batchRecord struct {
+	Seed         int64  `yaml:"seed"`
+	ConfigSHA256 string `yaml:"config_sha256"`
+	// Worker index from 0 and the first row it generated.
+	Worker int `yaml:"worker"`
+	Start  int `yaml:"start"`
+	// control_objects or facial_features.
+	Table string `yaml:"table"`
+	// Rows [From, Through) of the worker range, and rows of the batch.
+	From    int `yaml:"from"`
+	Through int `yaml:"through"`
+	Rows    int `yaml:"rows"`
+	// First numeric IDs per table.
+	IDOffsets map[string]uint64 `yaml:"id_offsets,omitempty"`
+	Error     string            `yaml:"error"`
+}
+
+// recordBatch writes a record of the batch of rows [from, through) of w
+// when err fails it. It must be deferred before recoverPanic, so that
+// panics are recorded too. Replays and stops of generation record nothing.
+func (g *generation) recordBatch(w *worker, table string, from, through, rows int, err *error) {
+	dir := g.cfg.GeneratorCFG.Replay.Dir
+	if (*err == nil) || (dir == "") || (g.replay != nil) || (w.writeCtx.Err() != nil) {
+		return
+	}
+	hash, hashErr := configHash(g)
+	if hashErr != nil {
+		g.log.logln(errors.Wrap(hashErr, "unable to record failed batch"))
+		return
+	}
+	record := batchRecord{
+		Seed:         g.seed,
+		ConfigSHA256: hash,
+		Worker:       w.index,
+		Start:        w.start,
+		Table:        table,
+		From:         from,
+		Through:      through,
+		Rows:         rows,
+		IDOffsets:    g.idOffsets,
+		Error:        (*err).Error(),
+	}
+	path := filepath.Join(dir, fmt.Sprintf("batch-%d-%s-%d.yaml", w.index+1, table, from))
+	if saveErr := record.save(path); saveErr != nil {
+		g.log.logln(saveErr)
+		return
+	}
+	g.log.logf("failed batch of %s rows [%d, %d) of worker %d recorded, regenerate it with -replay-batch %s\n",
+		table, from, through, w.index+1, path)
+}
+
+func (r batchRecord) save(path string) error {
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode batch record")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "unable to create batch records directory")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, data, 0644), "unable to write batch record")
+}
+
+// loadBatchRecord reads a record of a batch failed in a run with the
+// configuration of g.
+func loadBatchRecord(path string, g *generation) (*batchRecord, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read batch record")
+	}
+	r := &batchRecord{}
+	if err := yaml.Unmarshal(data, r); err != nil {
+		return nil, errors.Wrap(err, "unable to parse batch record")
+	}
+	if (r.Table != "control_objects") && (r.Table != "facial_features") {
+		return nil, fmt.Errorf("batch record %s has unknown table \"%s\"", path, r.Table)
+	}
+	if (r.Start > r.From) || (r.From >= r.Through) || (r.Rows <= 0) {
+		return nil, fmt.Errorf("batch record %s has no rows", path)
+	}
+	hash, err := configHash(g)
+	if err != nil {
+		return nil, err
+	}
+	if (r.Seed != g.seed) || (r.ConfigSHA256 != hash) {
+		return nil, fmt.Errorf("configuration differs from the run of batch record %s", path)
+	}
+	return r, nil
+}
+
+// config returns cfg without labels, pseudonyms, enrollment, metrics,
+// checkpoints, dictionaries and merges, so that a replay writes the batch
+// and nothing else.
+func (r *batchRecord) config(cfg *Config) *Config {
+	replayed := *cfg
+	gen := &replayed.GeneratorCFG
+	gen.Outliers.LabelsPath, gen.PlantedPairs.LabelsPath = "", ""
+	gen.IdentityEvents.EventsPath, gen.NameVariants.LabelsPath = "", ""
+	gen.DuplicatesLabelsPath, gen.Upsert.LabelsPath, gen.Probes.Path = "", "", ""
+	gen.Pseudonyms.Path, gen.Enrollment.Rate = "", 0
+	gen.StageMetricsPath, gen.Checkpoint.Path = "", ""
+	gen.Dictionaries.Enabled = false
+	gen.Optimize.Mode = ""
+	return &replayed
+}
+
+// ranges returns the range of the recorded worker through the batch and
+// empty ones of workers before it.
+func (r *batchRecord) ranges() []workerRange {
+	ranges := make([]workerRange, r.Worker+1)
+	ranges[r.Worker] = workerRange{From: r.Start, Next: r.Start, To: r.Through}
+	return ranges
+}
+
+// use makes batches of the recorded table as large as the recorded one, so
+// that it is written at once, and drops writes of the other table.
+func (r *batchRecord) use(g *generation) {
+	g.replay, g.idOffsets = r, r.IDOffsets
+	g.cobBatchSize, g.ffvBatchSize = r.Rows, r.Rows
+	if r.Table == "control_objects" {
+		g.writeFFVs = func(ctx context.Context, ffvs []ffv, times *batchTimes) error { return nil }
+	} else {
+		g.writeControlObjects = func(ctx context.Context, cobs []controlObject, times *batchTimes) error { return nil }
+	}
+}
+
+// drops reports whether row i of a replay precedes the batch.
+func (r *batchRecord) drops(i int) bool {
+	return (r != nil) && (i < r.From)
+}
@@ -0,0 +1,110 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testReplayGeneration returns a generation of cfg writing control objects
+// with write and dropping FFVs.
+func testReplayGeneration(t *testing.T, cfg *Config,
+	write func(ctx context.Context, cobs []controlObject, times *batchTimes) error) *generation {
+	g, err := newGeneration(cfg, cfg.GeneratorCFG.Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.metrics, err = newStageMetrics(""); err != nil {
+		t.Fatal(err)
+	}
+	g.log = &logger{quiet: true}
+	g.writeControlObjects = write
+	g.writeFFVs = func(ctx context.Context, ffvs []ffv, times *batchTimes) error { return nil }
+	return g
+}
+
+func TestReplayBatch(t *testing.T) {
+	cfg, dir := testConfig(t, 50)
+	cfg.GeneratorCFG.Workers = 2
+	cfg.GeneratorCFG.Replay.Dir = filepath.Join(dir, "replay")
+	// Duplicates refer to persons of earlier batches.
+	cfg.GeneratorCFG.DuplicateRate = 0.3
+
+	// The batch with row 37 of the second worker fails.
+	var failed []controlObject
+	g := testReplayGeneration(t, cfg, nil)
+	failingID := g.newID("control_object", 37)
+	g.writeControlObjects = func(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+		for _, cob := range cobs {
+			if cob.id == failingID {
+				failed = append([]controlObject{}, cobs...)
+				return fmt.Errorf("Cannot parse input")
+			}
+		}
+		return nil
+	}
+	g.cobBatchSize = 10
+	if _, _, err := g.runWorkers(context.Background(), splitRows(2, 50)); err == nil {
+		t.Fatal("failing batch inserted")
+	}
+	path := filepath.Join(cfg.GeneratorCFG.Replay.Dir, "batch-2-control_objects-35.yaml")
+	if len(failed) != 10 {
+		t.Fatalf("failed batch has %d rows", len(failed))
+	}
+
+	var replayed []controlObject
+	g = testReplayGeneration(t, cfg, func(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+		replayed = append(replayed, cobs...)
+		return nil
+	})
+	r, err := loadBatchRecord(path, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (r.Worker != 1) || (r.Start != 25) || (r.From != 35) || (r.Through != 45) || (r.Error != "Cannot parse input") {
+		t.Fatalf("unexpected record %+v", r)
+	}
+	r.use(g)
+	if _, _, err := g.runWorkers(context.Background(), r.ranges()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, failed) {
+		t.Fatalf("replayed batch differs from the failed one:\n%v\n%v", replayed, failed)
+	}
+
+	// Replays through run write the batch alone.
+	inserted, err := run(context.Background(), cfg, Options{ReplayBatch: path}, cfg.GeneratorCFG.Seed, nil, time.Now(),
+		&logger{quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+	if (inserted != 10) || (len(rows) != len(failed)) {
+		t.Fatalf("replay inserted %d pairs in %d rows", inserted, len(rows))
+	}
+	for i, row := range rows {
+		if row[0] != failed[i].id {
+			t.Fatalf("row %d of replay has ID %s instead of %s", i, row[0], failed[i].id)
+		}
+	}
+
+	cfg.GeneratorCFG.N = 60
+	_, err = run(context.Background(), cfg, Options{ReplayBatch: path}, cfg.GeneratorCFG.Seed, nil, time.Now(),
+		&logger{quiet: true})
+	if (err == nil) || !strings.Contains(err.Error(), "configuration differs") {
+		t.Fatalf("replay of another configuration: %v", err)
+	}
+}
+
+func TestReplayNeedsSeed(t *testing.T) {
+	cfg, dir := testConfig(t, 10)
+	cfg.GeneratorCFG.Seed = 0
+	cfg.GeneratorCFG.Replay.Dir = dir
+	if _, err := newGeneration(cfg, 1); (err == nil) || !strings.Contains(err.Error(), "generator.seed") {
+		t.Fatalf("records without a seed: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package generator
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/kshvakov/clickhouse"
+	"github.com/pkg/errors"
+)
+
+const (
+	retryClassTransient = "transient"
+	retryClassOverload  = "overload"
+)
+
+// ClickHouse exception codes the generator knows how to react to.
+const (
+	chErrTimeoutExceeded                   = 159
+	chErrTooManySimultaneousQueries        = 202
+	chErrSocketTimeout                     = 209
+	chErrNetworkError                      = 210
+	chErrTooManyParts                      = 252
+	chErrTooFewLiveReplicas                = 285
+	chErrUnsatisfiedQuorumForPreviousWrite = 286
+	chErrUnknownStatusOfInsert             = 319
+)
+
+var retryClasses = map[int32]string{
+	chErrTimeoutExceeded:                   retryClassTransient,
+	chErrSocketTimeout:                     retryClassTransient,
+	chErrNetworkError:                      retryClassTransient,
+	chErrTooFewLiveReplicas:                retryClassTransient,
+	chErrUnsatisfiedQuorumForPreviousWrite: retryClassTransient,
+	chErrTooManySimultaneousQueries:        retryClassOverload,
+	chErrTooManyParts:                      retryClassOverload,
+}
+
+// RetryPolicyCFG configures retries of a class of failures.
+type RetryPolicyCFG struct {
+	MaxRetries   int `yaml:"max_retries"`
+	BackoffMS    int `yaml:"backoff_ms"`
+	MaxBackoffMS int `yaml:"max_backoff_ms"`
+}
+
+// RetriesCFG configures retries of failed inserts by class of failures.
+type RetriesCFG struct {
+	Transient RetryPolicyCFG `yaml:"transient"`
+	Overload  RetryPolicyCFG `yaml:"overload"`
+}
+
+func (cfg RetriesCFG) policy(class string) RetryPolicyCFG {
+	if class == retryClassOverload {
+		return cfg.Overload
+	}
+	return cfg.Transient
+}
+
+func (p RetryPolicyCFG) backoff(attempt int) time.Duration {
+	backoff := time.Duration(p.BackoffMS) * time.Millisecond
+	maxBackoff := time.Duration(p.MaxBackoffMS) * time.Millisecond
+	if (maxBackoff > 0) && (backoff >= maxBackoff) {
+		return maxBackoff
+	}
+	for i := 0; i < attempt; i++ {
+		backoff *= 2
+		if (maxBackoff > 0) && (backoff >= maxBackoff) {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
+
+// migrateInsertRetries maps insert_retries, replaced by retry policies, to
+// retries of transient errors.
+func migrateInsertRetries(cfg *StorageCFG) error {
+	if cfg.InsertRetries == 0 {
+		return nil
+	}
+	if (cfg.Retries.Transient.MaxRetries != 0) && (cfg.Retries.Transient.MaxRetries != cfg.InsertRetries) {
+		return fmt.Errorf("insert_retries %d conflicts with retries.transient.max_retries %d, set only the latter",
+			cfg.InsertRetries, cfg.Retries.Transient.MaxRetries)
+	}
+	cfg.Retries.Transient.MaxRetries = cfg.InsertRetries
+	return nil
+}
+
+// commitError is an error of committing an insert. Rows may have landed
+// although the connection failed before the server answered.
+type commitError struct {
+	cause error
+}
+
+func (e *commitError) Error() string {
+	return e.cause.Error()
+}
+
+func (e *commitError) Cause() error {
+	return e.cause
+}
+
+// failedCommit reports whether err or one of its causes is a commitError.
+func failedCommit(err error) bool {
+	for err != nil {
+		if _, ok := err.(*commitError); ok {
+			return true
+		}
+		causer, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = causer.Cause()
+	}
+	return false
+}
+
+// connectionError reports whether err is a network error, and whether it
+// happened connecting, before anything was sent.
+func connectionError(err error) (bool, bool) {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		return true, opErr.Op == "dial"
+	}
+	if _, ok := err.(net.Error); ok {
+		return true, false
+	}
+	return (err == io.EOF) || (err == io.ErrUnexpectedEOF) || (err == driver.ErrBadConn), false
+}
+
+// unknownInsertStatus reports whether an insert may have landed despite
+// err: quorum inserts of unknown status and commits losing the connection.
+func unknownInsertStatus(err error) bool {
+	cause := errors.Cause(err)
+	if exception, ok := cause.(*clickhouse.Exception); ok {
+		return exception.Code == chErrUnknownStatusOfInsert
+	}
+	connection, dial := connectionError(cause)
+	return connection && !dial && failedCommit(err)
+}
+
+// classifyInsertError returns retry class of err or empty string if insert
+// must not be retried.
+func classifyInsertError(err error) string {
+	if unknownInsertStatus(err) {
+		return ""
+	}
+	cause := errors.Cause(err)
+	if exception, ok := cause.(*clickhouse.Exception); ok {
+		return retryClasses[exception.Code]
+	}
+	if statusErr, ok := cause.(*apiStatusError); ok && statusErr.transient() {
+		return retryClassTransient
+	}
+	if connection, _ := connectionError(cause); connection {
+		return retryClassTransient
+	}
+	return ""
+}
+
+func insertWithRetries(ctx context.Context, cfg RetriesCFG, log *logger, insert func() error) error {
+	// Every class has its own budget of retries and backoff.
+	attempts := map[string]int{}
+	for {
+		err := insert()
+		if err == nil {
+			return nil
+		}
+		if unknownInsertStatus(err) {
+			return errors.Wrap(err, "insert status is unknown, not retrying to avoid duplicates")
+		}
+		class := classifyInsertError(err)
+		if class == "" {
+			return err
+		}
+		policy, attempt := cfg.policy(class), attempts[class]
+		if attempt >= policy.MaxRetries {
+			return errors.Wrapf(err, "insert failed after %d %s retries", attempt, class)
+		}
+		attempts[class]++
+		backoff := policy.backoff(attempt)
+		log.logln(errors.Wrapf(err, "%s insert error, retrying for %d time in %v", class, attempt+1, backoff))
+		if err := sleepContext(ctx, backoff); err != nil {
+			return errors.Wrap(err, "insert retries stopped")
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package generator
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kshvakov/clickhouse"
+	"github.com/pkg/errors"
+)
+
+func TestClassifyInsertError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: fmt.Errorf("connection reset by peer")}
+	for _, test := range []struct {
+		name  string
+		err   error
+		class string
+	}{
+		{"timeout exceeded", &clickhouse.Exception{Code: chErrTimeoutExceeded}, retryClassTransient},
+		{"too few live replicas", errors.Wrap(&clickhouse.Exception{Code: chErrTooFewLiveReplicas}, "insert"), retryClassTransient},
+		{"unsatisfied quorum", &clickhouse.Exception{Code: chErrUnsatisfiedQuorumForPreviousWrite}, retryClassTransient},
+		{"too many parts", &clickhouse.Exception{Code: chErrTooManyParts}, retryClassOverload},
+		{"too many queries", &clickhouse.Exception{Code: chErrTooManySimultaneousQueries}, retryClassOverload},
+		{"syntax error", &clickhouse.Exception{Code: 62}, ""},
+		{"unknown status of insert", &clickhouse.Exception{Code: chErrUnknownStatusOfInsert}, ""},
+		{"API overload", &apiStatusError{status: 429}, retryClassTransient},
+		{"API server error", &apiStatusError{status: 503}, retryClassTransient},
+		{"API bad request", &apiStatusError{status: 400}, ""},
+		{"EOF", io.EOF, retryClassTransient},
+		{"unexpected EOF", errors.Wrap(io.ErrUnexpectedEOF, "exec"), retryClassTransient},
+		{"bad connection", driver.ErrBadConn, retryClassTransient},
+		{"connection reset", reset, retryClassTransient},
+		{"HTTP connection reset", &url.Error{Op: "Post", URL: "http://ch", Err: reset}, retryClassTransient},
+		{"other error", fmt.Errorf("invalid value"), ""},
+		// Rows of commits losing the connection may have landed.
+		{"commit EOF", errors.Wrap(&commitError{io.EOF}, "commit"), ""},
+		{"commit bad connection", errors.Wrap(&commitError{driver.ErrBadConn}, "commit"), ""},
+		{"commit connection reset", errors.Wrap(&commitError{reset}, "commit"), ""},
+		// Nothing was sent over connections that were not established.
+		{"commit connection refused", errors.Wrap(&commitError{refused}, "commit"), retryClassTransient},
+		{"commit overload", errors.Wrap(&commitError{&clickhouse.Exception{Code: chErrTooManyParts}}, "commit"), retryClassOverload},
+	} {
+		if class := classifyInsertError(test.err); class != test.class {
+			t.Errorf("%s: class %q, expected %q", test.name, class, test.class)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicyCFG{BackoffMS: 100, MaxBackoffMS: 500}
+	for attempt, expected := range []time.Duration{100, 200, 400, 500, 500} {
+		if backoff := policy.backoff(attempt); backoff != expected*time.Millisecond {
+			t.Errorf("backoff of attempt %d is %v, expected %v", attempt, backoff, expected*time.Millisecond)
+		}
+	}
+	// Initial backoffs above the maximum are clamped too.
+	policy = RetryPolicyCFG{BackoffMS: 1000, MaxBackoffMS: 500}
+	if backoff := policy.backoff(0); backoff != 500*time.Millisecond {
+		t.Errorf("backoff of attempt 0 is %v, expected 500ms", backoff)
+	}
+}
+
+func TestMigrateInsertRetries(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		insertRetries int
+		maxRetries    int
+		expected      int
+		valid         bool
+	}{
+		{"unset", 0, 2, 2, true},
+		{"mapped", 3, 0, 3, true},
+		{"equal", 3, 3, 3, true},
+		{"conflict", 3, 5, 5, false},
+	} {
+		cfg := StorageCFG{InsertRetries: test.insertRetries}
+		cfg.Retries.Transient.MaxRetries = test.maxRetries
+		err := migrateInsertRetries(&cfg)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: migrateInsertRetries() = %v", test.name, err)
+		}
+		if cfg.Retries.Transient.MaxRetries != test.expected {
+			t.Errorf("%s: %d retries, expected %d", test.name, cfg.Retries.Transient.MaxRetries, test.expected)
+		}
+	}
+}
+
+func TestInsertWithRetries(t *testing.T) {
+	cfg := RetriesCFG{Transient: RetryPolicyCFG{MaxRetries: 2}, Overload: RetryPolicyCFG{MaxRetries: 1}}
+	for _, test := range []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"transient", io.EOF, 3},
+		{"overload", &clickhouse.Exception{Code: chErrTooManyParts}, 2},
+		{"permanent", fmt.Errorf("invalid value"), 1},
+		{"failed commit", &commitError{io.EOF}, 1},
+	} {
+		attempts := 0
+		err := insertWithRetries(context.Background(), cfg, &logger{quiet: true}, func() error {
+			attempts++
+			return test.err
+		})
+		if err == nil {
+			t.Errorf("%s: insert succeeded", test.name)
+		}
+		if attempts != test.attempts {
+			t.Errorf("%s: %d attempts, expected %d", test.name, attempts, test.attempts)
+		}
+	}
+}
+
+func TestInsertWithRetriesPerClass(t *testing.T) {
+	cfg := RetriesCFG{Transient: RetryPolicyCFG{MaxRetries: 2}, Overload: RetryPolicyCFG{MaxRetries: 2}}
+	overload := &clickhouse.Exception{Code: chErrTooManyParts}
+	for _, test := range []struct {
+		name     string
+		errs     []error
+		attempts int
+		ok       bool
+	}{
+		// Transient errors do not use up retries of overload.
+		{"interleaved", []error{io.EOF, overload, io.EOF, overload, nil}, 5, true},
+		{"overload exhausted", []error{io.EOF, overload, overload, overload}, 4, false},
+		{"transient exhausted", []error{overload, io.EOF, io.EOF, io.EOF}, 4, false},
+	} {
+		attempts := 0
+		err := insertWithRetries(context.Background(), cfg, &logger{quiet: true}, func() error {
+			attempts++
+			return test.errs[attempts-1]
+		})
+		if (err == nil) != test.ok {
+			t.Errorf("%s: insertWithRetries() = %v", test.name, err)
+		}
+		if attempts != test.attempts {
+			t.Errorf("%s: %d attempts, expected %d", test.name, attempts, test.attempts)
+		}
+	}
+}
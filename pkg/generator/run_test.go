@@ -0,0 +1,64 @@
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig returns the example configuration writing n pairs as TSV
+// files to a temporary directory, which is removed after the test.
+func testConfig(t *testing.T, n int) (*Config, string) {
+	dir, err := ioutil.TempDir("", "generator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	cfg, err := loadCFG("../../config.yaml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Output = outputFile
+	cfg.File.Dir, cfg.File.Format = dir, fileFormatTSV
+	cfg.GeneratorCFG.N, cfg.GeneratorCFG.InIter, cfg.GeneratorCFG.Workers = n, n, 1
+	cfg.GeneratorCFG.Seed = 1
+	cfg.GeneratorCFG.Probes.Path = filepath.Join(dir, "probes.tsv")
+	return cfg, dir
+}
+
+// testRun runs generation with cfg and fails the test on errors.
+func testRun(t *testing.T, cfg *Config) int64 {
+	inserted, err := run(context.Background(), cfg, Options{}, cfg.GeneratorCFG.Seed, nil, time.Now(), &logger{quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inserted
+}
+
+// readTSV returns rows of a TSV file, e.g. an output file.
+func readTSV(t *testing.T, path string) [][]string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line != "" {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows
+}
+
+// readLabels returns rows of a labels file without its header.
+func readLabels(t *testing.T, path string) [][]string {
+	rows := readTSV(t, path)
+	if len(rows) == 0 {
+		t.Fatalf("labels file %s has no header", path)
+	}
+	return rows[1:]
+}
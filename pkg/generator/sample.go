@@ -0,0 +1,192 @@
+package generator
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// Samples are selected by hashing control object IDs with a key, so the same
+// fraction and key always select the same subjects, and facial features are
+// sampled together with their control objects.
+const sampleScale = 1000000
+
+func runSample(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("sample", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file")
+	fraction := flags.Float64("fraction", 0.01, "fraction of control objects to sample")
+	where := flags.String("where", "", "additional filter on control objects, with database column names")
+	key := flags.String("key", "", "sampling key, different keys select different subjects")
+	outDir := flags.String("out", ".", "directory to write sampled TSV files to")
+	mask := flags.Bool("mask", false, "mask columns according to masking rules of configuration")
+	remapIDs := flags.Bool("remap-ids", false, "replace UUIDs with ones derived from masking.remap_key")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+
+	if (*fraction <= 0) || (*fraction > 1) {
+		return fmt.Errorf("fraction must be in (0, 1], got %v", *fraction)
+	}
+
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	opts, err := mappedOptions(cfg)
+	if err != nil {
+		return err
+	}
+	cob, ffv := opts.cobTable, opts.ffvTable
+	cobID, err := cob.required("id")
+	if err != nil {
+		return err
+	}
+	ffvCOBID, err := ffv.required("cob_id")
+	if err != nil {
+		return err
+	}
+	db, err := connectClickHouse(cfg.StorageCFG, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var m *masker
+	if *mask {
+		if m, err = newMasker(cfg.Masking); err != nil {
+			return errors.Wrap(err, "invalid masking rules")
+		}
+	}
+
+	var r *idRemapper
+	if *remapIDs {
+		if r, err = newIDRemapper(cfg.Masking.RemapKey); err != nil {
+			return err
+		}
+	}
+
+	cobFilter := keyedFractionFilter(cobID, *key, *fraction)
+	if *where != "" {
+		cobFilter += " AND (" + *where + ")"
+	}
+
+	cobs, err := sampleTable(ctx, db, m, r, *outDir, "control_objects", cob, cobFilter)
+	if err != nil {
+		return err
+	}
+	ffvs, err := sampleTable(ctx, db, m, r, *outDir, "facial_features", ffv,
+		fmt.Sprintf("%s IN (SELECT %s FROM %s WHERE %s)", ffvCOBID, cobID, cob.name, cobFilter))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("sampled %d control objects and %d facial features vectors to %s\n", cobs, ffvs, *outDir)
+	return nil
+}
+
+func keyedFractionFilter(column, key string, fraction float64) string {
+	return fmt.Sprintf("cityHash64(%s, '%s') %% %d < %d",
+		column, strings.Replace(key, "'", "\\'", -1), sampleScale, int(fraction*sampleScale))
+}
+
+// sampleTable writes rows of a generated table matching filter to a TSV
+// file named after the database table, with UUIDs remapped by r. Masking
+// rules name generated tables and columns.
+func sampleTable(ctx context.Context, db *sql.DB, m *masker, r *idRemapper, outDir, generated string,
+	mapping *tableMapping, filter string) (int, error) {
+	table := mapping.name
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE %s", table, filter))
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to query %s", table)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to get %s columns", table)
+	}
+
+	file, err := os.Create(filepath.Join(outDir, table+".tsv"))
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to create %s sample file", table)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	fmt.Fprintln(writer, strings.Join(columns, "\t"))
+
+	masks := make([]func(string) string, len(columns))
+	for i, column := range columns {
+		masks[i] = m.column(generated, mapping.generated(column))
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	fields := make([]string, len(columns))
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return n, errors.Wrapf(err, "unable to scan %s row", table)
+		}
+		for i, value := range values {
+			if s, ok := value.(string); ok && (masks[i] != nil) {
+				fields[i] = tsvEscaper.Replace(masks[i](s))
+			} else if (masks[i] != nil) && (value != nil) {
+				fields[i] = masks[i](formatTSVValue(value))
+			} else {
+				fields[i] = formatTSVValue(value)
+			}
+			fields[i] = r.field(fields[i])
+		}
+		fmt.Fprintln(writer, strings.Join(fields, "\t"))
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, errors.Wrapf(err, "unable to read %s rows", table)
+	}
+	if err := writer.Flush(); err != nil {
+		return n, errors.Wrapf(err, "unable to write %s sample file", table)
+	}
+
+	return n, nil
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n")
+
+var tsvUnescaper = strings.NewReplacer("\\\\", "\\", "\\t", "\t", "\\n", "\n")
+
+func formatTSVValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "\\N"
+	case string:
+		return tsvEscaper.Replace(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	}
+
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice {
+		elems := make([]string, rv.Len())
+		for i := range elems {
+			elem := rv.Index(i).Interface()
+			if s, ok := elem.(string); ok {
+				elems[i] = "'" + strings.Replace(tsvEscaper.Replace(s), "'", "\\'", -1) + "'"
+			} else {
+				elems[i] = formatTSVValue(elem)
+			}
+		}
+		return "[" + strings.Join(elems, ",") + "]"
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,68 @@
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestKeyedFractionFilter(t *testing.T) {
+	if filter := keyedFractionFilter("id", "it's", 0.01); filter != "cityHash64(id, 'it\\'s') % 1000000 < 10000" {
+		t.Errorf("filter is %s", filter)
+	}
+}
+
+// TestSampleTable checks that sampled rows are written as TSV with masked
+// columns of generated names and remapped IDs.
+func TestSampleTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	id := "6ba7b812-9dad-11d1-80b4-00c04fd430c8"
+	var query string
+	server.answer = func(q string) (nativeResult, error) {
+		query = q
+		return nativeResult{
+			names: []string{"id", "document", "surname", "fb"},
+			types: []string{"String", "String", "String", "Array(UInt64)"},
+			rows: [][]interface{}{
+				{id, "12 34 567890", "Ivanov\tII", []uint64{1, 2}},
+				{id, "98 76 543210", "Petrov", []uint64{}},
+			},
+		}, nil
+	}
+	opts := testInsertOptions(t, SchemaCFG{ControlObjects: TableSchemaCFG{
+		Name: "persons", Columns: map[string]string{"passport": "document"},
+	}})
+	m, err := newMasker(MaskingCFG{Rules: map[string]MaskRuleCFG{
+		"control_objects.passport": {Method: maskPartial, KeepLast: 2},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := newIDRemapper("staging")
+	n, err := sampleTable(context.Background(), server.connect(t), m, r, dir, "control_objects", opts.cobTable,
+		keyedFractionFilter("id", "", 0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "SELECT * FROM persons WHERE cityHash64(id, '') % 1000000 < 500000"; query != expected {
+		t.Errorf("sampled with %s, expected %s", query, expected)
+	}
+	remapped := r.field(id)
+	expected := [][]string{
+		{"id", "document", "surname", "fb"},
+		{remapped, "**********90", "Ivanov\\tII", "[1,2]"},
+		{remapped, "**********10", "Petrov", "[]"},
+	}
+	if rows := readTSV(t, filepath.Join(dir, "persons.tsv")); (n != 2) || !reflect.DeepEqual(rows, expected) {
+		t.Errorf("%d sampled rows are written as %q, expected %q", n, rows, expected)
+	}
+}
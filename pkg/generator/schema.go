@@ -0,0 +1,175 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SchemaCFG maps generated tables to database tables and configures
+// MergeTree keys of tables created with storage.auto_create or -init-schema.
+type SchemaCFG struct {
+	ControlObjects TableSchemaCFG `yaml:"control_objects"`
+	FFVs           TableSchemaCFG `yaml:"facial_features"`
+}
+
+// TableSchemaCFG maps a generated table to a database one.
+type TableSchemaCFG struct {
+	// Database table name, the generated one by default.
+	Name string `yaml:"name"`
+	// Database names of generated columns, "-" to leave a column out of
+	// inserts.
+	Columns map[string]string `yaml:"columns"`
+	// MergeTree by default, e.g. ReplacingMergeTree for the tombstone
+	// subcommand.
+	Engine string `yaml:"engine"`
+	// Empty for no partitioning.
+	PartitionBy string `yaml:"partition_by"`
+	OrderBy     string `yaml:"order_by"`
+}
+
+func (cfg TableSchemaCFG) orderBy(fallback string) string {
+	if cfg.OrderBy != "" {
+		return cfg.OrderBy
+	}
+	return fallback
+}
+
+// Column types of generated columns.
+var columnTypes = map[string]string{
+	"id":              "UUID",
+	"ts":              "DateTime",
+	"passport":        "String",
+	"surname":         "String",
+	"name":            "String",
+	"patronymic":      "String",
+	"sex":             "String",
+	"birthdate":       "String",
+	"phone_num":       "String",
+	"email":           "String",
+	"address":         "String",
+	"natural_key":     "String",
+	"version":         "UInt64",
+	"consent_status":  "String",
+	"legal_basis":     "String",
+	"retention_class": "String",
+	"organization":    "String",
+	"occupation":      "String",
+	"latitude":        "Float64",
+	"longitude":       "Float64",
+	"passport_region": "String",
+	"passport_office": "String",
+	"office_code":     "String",
+	"cob_id":          "UUID",
+	"img_id":          "UUID",
+	"fb":              "Array(UInt64)",
+	"ff":              "Array(Float64)",
+	"event_ts":        "DateTime",
+	"ingest_ts":       "DateTime",
+	"camera_id":       "UInt32",
+	"ff_pca":          "Array(Float64)",
+	"ff_hash":         "String",
+	// Set by the tombstone subcommand, not generated.
+	"dbts": "Nullable(DateTime)",
+}
+
+// createTableQuery returns DDL of a table with exactly the columns inserted
+// with opts, including optional ones, named by m. types override default
+// column types, and keys are generated columns ordering the table unless
+// cfg sets order_by.
+func createTableQuery(m *tableMapping, columns []string, types map[string]string, cfg TableSchemaCFG, keys ...string) string {
+	definitions := []string{}
+	for i := 0; i < len(columns); i++ {
+		name := m.column(columns[i])
+		// Nested columns are inserted as a pair of key and value arrays.
+		if strings.HasSuffix(columns[i], ".key") {
+			if name != "" {
+				nested := strings.TrimSuffix(name, ".key")
+				definitions = append(definitions, fmt.Sprintf("%s Nested(key String, value String)", nested))
+			}
+			i++
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		columnType, ok := types[columns[i]]
+		if !ok {
+			columnType = columnTypes[columns[i]]
+		}
+		definitions = append(definitions, fmt.Sprintf("%s %s", name, columnType))
+	}
+	orderBy := []string{}
+	for _, key := range keys {
+		if name := m.column(key); name != "" {
+			orderBy = append(orderBy, name)
+		}
+	}
+	engine := cfg.Engine
+	if engine == "" {
+		engine = "MergeTree"
+		// Versions of a row collapse into the latest one.
+		for _, column := range columns {
+			if name := m.column(column); (column == versionColumn) && (name != "") {
+				engine = "ReplacingMergeTree(" + name + ")"
+			}
+		}
+	}
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n    %s\n) ENGINE = %s",
+		m.name, strings.Join(definitions, ",\n    "), engine)
+	if cfg.PartitionBy != "" {
+		query += "\nPARTITION BY " + cfg.PartitionBy
+	}
+	return query + "\nORDER BY " + cfg.orderBy(orderByKey(orderBy))
+}
+
+func orderByKey(columns []string) string {
+	switch len(columns) {
+	case 0:
+		return "tuple()"
+	case 1:
+		return columns[0]
+	}
+	return "(" + strings.Join(columns, ", ") + ")"
+}
+
+// idColumnTypes returns types of ID columns and columns added by field
+// expressions of both tables overriding default ones.
+func idColumnTypes(opts insertOptions) (map[string]string, map[string]string) {
+	cobTypes, ffvTypes := map[string]string{}, map[string]string{}
+	if opts.numericCOBIDs {
+		cobTypes["id"], ffvTypes["cob_id"] = "UInt64", "UInt64"
+	}
+	if opts.numericFFVIDs {
+		ffvTypes["id"] = "UInt64"
+	}
+	if opts.fields != nil {
+		for _, column := range opts.fields.custom {
+			cobTypes[column] = "String"
+		}
+	}
+	return cobTypes, ffvTypes
+}
+
+// createTablesQueries returns DDL of generated tables in the order of
+// generatedTables.
+func createTablesQueries(cfg SchemaCFG, opts insertOptions) []string {
+	cobTypes, ffvTypes := idColumnTypes(opts)
+	return []string{
+		createTableQuery(opts.cobTable, opts.controlObjectsColumns(), cobTypes, cfg.ControlObjects, "id"),
+		createTableQuery(opts.ffvTable, opts.ffvsColumns(), ffvTypes, cfg.FFVs, "cob_id", "id"),
+	}
+}
+
+// createTables creates generated tables missing in the database.
+func createTables(ctx context.Context, db *sql.DB, cfg SchemaCFG, opts insertOptions) error {
+	for i, query := range createTablesQueries(cfg, opts) {
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return errors.Wrapf(err, "unable to create table %s", opts.table(generatedTables[i]).name)
+		}
+	}
+	return nil
+}
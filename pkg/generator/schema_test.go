@@ -0,0 +1,80 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCreateTablesQueries(t *testing.T) {
+	expected := []string{
+		"CREATE TABLE IF NOT EXISTS control_objects (\n    id UUID,\n    ts DateTime,\n    passport String,\n" +
+			"    surname String,\n    name String,\n    patronymic String,\n    sex String,\n    birthdate String,\n" +
+			"    phone_num String,\n    email String,\n    address String\n) ENGINE = MergeTree\nORDER BY id",
+		"CREATE TABLE IF NOT EXISTS facial_features (\n    id UUID,\n    cob_id UUID,\n    img_id UUID,\n" +
+			"    fb Array(UInt64),\n    ff Array(Float64)\n) ENGINE = MergeTree\nORDER BY (cob_id, id)",
+	}
+	if queries := createTablesQueries(SchemaCFG{}, testInsertOptions(t, SchemaCFG{})); !reflect.DeepEqual(queries, expected) {
+		t.Errorf("DDL of generated tables is\n%s", strings.Join(queries, "\n"))
+	}
+
+	// Mapped names, omitted columns and configured keys.
+	schema := SchemaCFG{
+		ControlObjects: TableSchemaCFG{Name: "persons", Columns: map[string]string{"passport": "document"},
+			PartitionBy: "toYYYYMM(ts)", OrderBy: "(ts, id)"},
+		FFVs: TableSchemaCFG{Name: "faces", Columns: map[string]string{"img_id": omittedColumn, "cob_id": "person_id"},
+			Engine: "ReplacingMergeTree"},
+	}
+	opts := testInsertOptions(t, schema)
+	opts.numericCOBIDs = true
+	queries := createTablesQueries(schema, opts)
+	for _, part := range []string{"CREATE TABLE IF NOT EXISTS persons (", "    id UInt64,", "    document String,",
+		") ENGINE = MergeTree\nPARTITION BY toYYYYMM(ts)\nORDER BY (ts, id)"} {
+		if !strings.Contains(queries[0], part) {
+			t.Errorf("DDL of mapped control objects has no %q:\n%s", part, queries[0])
+		}
+	}
+	for _, part := range []string{"CREATE TABLE IF NOT EXISTS faces (", "    id UUID,", "    person_id UInt64,",
+		") ENGINE = ReplacingMergeTree\nORDER BY (person_id, id)"} {
+		if !strings.Contains(queries[1], part) {
+			t.Errorf("DDL of mapped facial features has no %q:\n%s", part, queries[1])
+		}
+	}
+	if strings.Contains(queries[1], "img_id") {
+		t.Errorf("DDL of mapped facial features has an omitted column:\n%s", queries[1])
+	}
+}
+
+func TestCreateTables(t *testing.T) {
+	server := newFakeNative(t, newFakeBackend(), nil)
+	defer server.close()
+	mu := sync.Mutex{}
+	created := []string{}
+	server.answer = func(query string) (nativeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS facial_features ") && (len(created) > 1) {
+			return nativeResult{}, fmt.Errorf("Not enough space")
+		}
+		created = append(created, query)
+		return nativeResult{}, nil
+	}
+	db := server.connect(t)
+	opts := testInsertOptions(t, SchemaCFG{})
+	if err := createTables(context.Background(), db, SchemaCFG{}, opts); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if !reflect.DeepEqual(created, createTablesQueries(SchemaCFG{}, opts)) {
+		t.Errorf("created tables with\n%s", strings.Join(created, "\n"))
+	}
+	mu.Unlock()
+
+	err := createTables(context.Background(), db, SchemaCFG{}, opts)
+	if (err == nil) || !strings.HasPrefix(err.Error(), "unable to create table facial_features: ") {
+		t.Errorf("failed DDL returns %v", err)
+	}
+}
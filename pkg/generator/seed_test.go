@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestSeed checks that runs with the same seed write identical files and
+// that the seed makes IDs and timestamps deterministic.
+func TestSeed(t *testing.T) {
+	readFiles := func(cfg *Config, dir string) [][]byte {
+		testRun(t, cfg)
+		files := [][]byte{}
+		for _, name := range []string{"control_objects.0001.tsv", "facial_features.0001.tsv"} {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, data)
+		}
+		return files
+	}
+	cfg, dir := testConfig(t, 50)
+	expected := readFiles(cfg, dir)
+	cfg, dir = testConfig(t, 50)
+	if files := readFiles(cfg, dir); !reflect.DeepEqual(files, expected) {
+		t.Error("runs with the same seed write different files")
+	}
+	cfg, dir = testConfig(t, 50)
+	cfg.GeneratorCFG.Seed = 2
+	if files := readFiles(cfg, dir); bytes.Equal(files[0], expected[0]) || bytes.Equal(files[1], expected[1]) {
+		t.Error("runs with different seeds write the same files")
+	}
+
+	g := &generation{seed: 1, deterministic: true}
+	cfg, dir = testConfig(t, 50)
+	testRun(t, cfg)
+	rows := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+	if rows[7][0] != g.newID("control_object", 7) {
+		t.Errorf("ID of row 7 is %s, expected UUIDv5 %s", rows[7][0], g.newID("control_object", 7))
+	}
+	ts, err := time.Parse("2006-01-02 15:04:05", rows[7][1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ts.Equal(deterministicEpoch.Add(7 * time.Second)) {
+		t.Errorf("ts of row 7 is %v", ts)
+	}
+
+	// Rows do not depend on how workers interleave.
+	cfg, dir = testConfig(t, 50)
+	cfg.GeneratorCFG.Workers = 3
+	testRun(t, cfg)
+	sorted := func(rows [][]string) [][]string {
+		sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+		return rows
+	}
+	cfg, dir2 := testConfig(t, 50)
+	cfg.GeneratorCFG.Workers = 3
+	testRun(t, cfg)
+	if !reflect.DeepEqual(sorted(readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))),
+		sorted(readTSV(t, filepath.Join(dir2, "control_objects.0001.tsv")))) {
+		t.Error("runs of 3 workers with the same seed write different rows")
+	}
+
+	// Without a seed IDs are random.
+	cfg, dir = testConfig(t, 5)
+	cfg.GeneratorCFG.Seed = 0
+	testRun(t, cfg)
+	cfg, dir2 = testConfig(t, 5)
+	cfg.GeneratorCFG.Seed = 0
+	testRun(t, cfg)
+	if readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))[0][0] ==
+		readTSV(t, filepath.Join(dir2, "control_objects.0001.tsv"))[0][0] {
+		t.Error("runs without a seed generate the same IDs")
+	}
+}
@@ -0,0 +1,144 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exitSLOViolation is the exit code of runs that succeeded but violated
+// SLOs, so CI can tell performance regressions from failures.
+const exitSLOViolation = 3
+
+// SLO metrics besides batch_insert_p<N>_ms percentiles.
+const (
+	sloBatchInsertMax = "batch_insert_max_ms"
+	sloErrorRate      = "error_rate"
+	sloRowsPerSec     = "rows_per_sec"
+)
+
+var sloPercentile = regexp.MustCompile(`^batch_insert_p([0-9]+(\.[0-9]+)?)_ms$`)
+
+// SLOCFG is an objective evaluated at the end of a run. Threshold is the
+// maximum of batch insert latencies in milliseconds and of error_rate, the
+// fraction of failed insert attempts, and the minimum of rows_per_sec.
+type SLOCFG struct {
+	Metric    string  `yaml:"metric"`
+	Threshold float64 `yaml:"threshold"`
+}
+
+func (cfg SLOCFG) validate() error {
+	switch cfg.Metric {
+	case sloBatchInsertMax, sloErrorRate, sloRowsPerSec:
+	default:
+		match := sloPercentile.FindStringSubmatch(cfg.Metric)
+		if match == nil {
+			return fmt.Errorf("unknown SLO metric \"%s\"", cfg.Metric)
+		}
+		if p, _ := strconv.ParseFloat(match[1], 64); (p <= 0) || (p > 100) {
+			return fmt.Errorf("percentile of SLO metric \"%s\" must be in (0, 100]", cfg.Metric)
+		}
+	}
+	if cfg.Threshold < 0 {
+		return fmt.Errorf("threshold of SLO metric \"%s\" must not be negative", cfg.Metric)
+	}
+	return nil
+}
+
+func (cfg SLOCFG) lowerBound() bool {
+	return cfg.Metric == sloRowsPerSec
+}
+
+// sloStats collects batch insert latencies and insert attempts of a run.
+type sloStats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	attempts  int
+	failures  int
+}
+
+func (s *sloStats) batch(latency time.Duration) {
+	s.mu.Lock()
+	s.latencies = append(s.latencies, latency)
+	s.mu.Unlock()
+}
+
+func (s *sloStats) attempt(err error) {
+	s.mu.Lock()
+	s.attempts++
+	if err != nil {
+		s.failures++
+	}
+	s.mu.Unlock()
+}
+
+// percentile returns the nearest-rank percentile of batch insert latencies
+// in milliseconds.
+func (s *sloStats) percentile(p float64) float64 {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return float64(sorted[rank]) / float64(time.Millisecond)
+}
+
+func (s *sloStats) value(metric string, rows int64, elapsed time.Duration) float64 {
+	switch metric {
+	case sloBatchInsertMax:
+		return s.percentile(100)
+	case sloErrorRate:
+		if s.attempts == 0 {
+			return 0
+		}
+		return float64(s.failures) / float64(s.attempts)
+	case sloRowsPerSec:
+		return float64(rows) / elapsed.Seconds()
+	}
+	p, _ := strconv.ParseFloat(sloPercentile.FindStringSubmatch(metric)[1], 64)
+	return s.percentile(p)
+}
+
+// evaluate returns a line per SLO and violated SLOs, and adds every SLO to
+// suite.
+func (s *sloStats) evaluate(slos []SLOCFG, rows int64, elapsed time.Duration, suite *junitSuite) ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var report, violations []string
+	for _, slo := range slos {
+		value := s.value(slo.Metric, rows, elapsed)
+		op, met := "<=", value <= slo.Threshold
+		if slo.lowerBound() {
+			op, met = ">=", value >= slo.Threshold
+		}
+		line := fmt.Sprintf("%s %.4g (%s %g)", slo.Metric, value, op, slo.Threshold)
+		if !met {
+			violations = append(violations, line)
+			suite.add(slo.Metric, 0, line, "violated "+line)
+			line += " VIOLATED"
+		} else {
+			suite.add(slo.Metric, 0, line, "")
+		}
+		report = append(report, line)
+	}
+	return report, violations
+}
+
+// sloViolationError is returned by runs that inserted every row but
+// violated SLOs.
+type sloViolationError struct {
+	violations []string
+}
+
+func (e *sloViolationError) Error() string {
+	return "SLOs violated: " + strings.Join(e.violations, "; ")
+}
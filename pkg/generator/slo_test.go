@@ -0,0 +1,103 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSLOEvaluate(t *testing.T) {
+	s := &sloStats{}
+	for i := 1; i <= 100; i++ {
+		s.batch(time.Duration(i) * time.Millisecond)
+	}
+	for i := 0; i < 1000; i++ {
+		var err error
+		if i < 2 {
+			err = io.EOF
+		}
+		s.attempt(err)
+	}
+	for metric, expected := range map[string]float64{
+		"batch_insert_p50_ms":   50,
+		"batch_insert_p99_ms":   99,
+		"batch_insert_p99.5_ms": 100,
+		"batch_insert_p1_ms":    1,
+		sloBatchInsertMax:       100,
+		sloErrorRate:            0.002,
+		sloRowsPerSec:           500,
+	} {
+		if value := s.value(metric, 1000, 2*time.Second); value != expected {
+			t.Errorf("%s is %v, expected %v", metric, value, expected)
+		}
+	}
+	if value := (&sloStats{}).value(sloErrorRate, 0, time.Second); value != 0 {
+		t.Errorf("error rate without attempts is %v", value)
+	}
+
+	report, violations := s.evaluate([]SLOCFG{
+		{Metric: "batch_insert_p99_ms", Threshold: 2000},
+		{Metric: sloErrorRate, Threshold: 0.001},
+		{Metric: sloRowsPerSec, Threshold: 400},
+		{Metric: sloRowsPerSec, Threshold: 1000},
+	}, 1000, 2*time.Second, nil)
+	expectedReport := []string{
+		"batch_insert_p99_ms 99 (<= 2000)",
+		"error_rate 0.002 (<= 0.001) VIOLATED",
+		"rows_per_sec 500 (>= 400)",
+		"rows_per_sec 500 (>= 1000) VIOLATED",
+	}
+	if !reflect.DeepEqual(report, expectedReport) {
+		t.Errorf("SLOs are reported as %q, expected %q", report, expectedReport)
+	}
+	expectedViolations := []string{"error_rate 0.002 (<= 0.001)", "rows_per_sec 500 (>= 1000)"}
+	if !reflect.DeepEqual(violations, expectedViolations) {
+		t.Errorf("violated SLOs are %q, expected %q", violations, expectedViolations)
+	}
+	err := &sloViolationError{violations: violations}
+	if message := err.Error(); message != "SLOs violated: error_rate 0.002 (<= 0.001); rows_per_sec 500 (>= 1000)" {
+		t.Errorf("violation error is %q", message)
+	}
+}
+
+func TestSLOInvalid(t *testing.T) {
+	for _, slo := range []SLOCFG{
+		{Metric: "latency"},
+		{Metric: "batch_insert_p0_ms"},
+		{Metric: "batch_insert_p101_ms"},
+		{Metric: "batch_insert_pX_ms"},
+		{Metric: sloErrorRate, Threshold: -1},
+	} {
+		if err := slo.validate(); err == nil {
+			t.Errorf("SLO %+v is valid", slo)
+		}
+	}
+	for _, metric := range []string{"batch_insert_p100_ms", "batch_insert_p99.9_ms", sloBatchInsertMax} {
+		if err := (SLOCFG{Metric: metric, Threshold: 1}).validate(); err != nil {
+			t.Errorf("SLO %s is invalid: %v", metric, err)
+		}
+	}
+
+	cfg, _ := testConfig(t, 10)
+	cfg.GeneratorCFG.SLOs = []SLOCFG{{Metric: "latency"}}
+	if _, err := run(context.Background(), cfg, Options{}, cfg.GeneratorCFG.Seed, nil, time.Now(),
+		&logger{quiet: true}); (err == nil) || (fmt.Sprint(err) != "invalid SLOs: unknown SLO metric \"latency\"") {
+		t.Errorf("run with an unknown SLO metric returns %v", err)
+	}
+}
+
+// TestSLOMet checks that runs meeting their SLOs succeed.
+func TestSLOMet(t *testing.T) {
+	cfg, _ := testConfig(t, 20)
+	cfg.GeneratorCFG.SLOs = []SLOCFG{
+		{Metric: "batch_insert_p99_ms", Threshold: 60000},
+		{Metric: sloErrorRate, Threshold: 0},
+		{Metric: sloRowsPerSec, Threshold: 1},
+	}
+	if inserted := testRun(t, cfg); inserted != 20 {
+		t.Errorf("run meeting SLOs inserts %d pairs", inserted)
+	}
+}
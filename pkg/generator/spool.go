@@ -0,0 +1,286 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Spool size and the share of it warned about by default.
+const (
+	defaultSpoolMaxBytes      = 1 << 30
+	defaultSpoolHighWaterMark = 0.8
+)
+
+// SpoolCFG configures spilling batches to disk while the sink is slower than
+// generation. Spilled batches are inserted in order once writers catch up.
+type SpoolCFG struct {
+	// Directory of spool files, spooling is off when empty. Files are
+	// removed after the run.
+	Dir string `yaml:"dir"`
+	// Size of spooled batches, 1 GiB by default. Producers block while the
+	// spool is full.
+	MaxBytes int64 `yaml:"max_bytes"`
+	// Share of max_bytes that triggers a warning, 0.8 by default.
+	HighWaterMark float64 `yaml:"high_water_mark"`
+}
+
+func (cfg SpoolCFG) validate() error {
+	if cfg.MaxBytes < 0 {
+		return fmt.Errorf("max bytes must not be negative, got %d", cfg.MaxBytes)
+	}
+	if (cfg.HighWaterMark < 0) || (cfg.HighWaterMark > 1) {
+		return fmt.Errorf("high water mark must be in [0, 1], got %v", cfg.HighWaterMark)
+	}
+	return nil
+}
+
+// spool holds gob encoded batches in files of a directory, up to a size
+// shared by all workers and tables.
+type spool struct {
+	dir       string
+	maxBytes  int64
+	highWater int64
+	log       *logger
+
+	mu       sync.Mutex
+	seq      int
+	bytes    int64
+	peak     int64
+	spilled  int
+	total    int64
+	full     int
+	readBack time.Duration
+	// Set while above the high water mark, so that a crossing is warned
+	// about once.
+	warned bool
+}
+
+// newSpool creates a spool in a new directory under cfg.Dir, nil when
+// spooling is off.
+func newSpool(cfg SpoolCFG, log *logger) (*spool, error) {
+	if cfg.Dir == "" {
+		return nil, nil
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid spool configuration")
+	}
+	s := &spool{maxBytes: cfg.MaxBytes, log: log}
+	if s.maxBytes == 0 {
+		s.maxBytes = defaultSpoolMaxBytes
+	}
+	highWaterMark := cfg.HighWaterMark
+	if highWaterMark == 0 {
+		highWaterMark = defaultSpoolHighWaterMark
+	}
+	s.highWater = int64(highWaterMark * float64(s.maxBytes))
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "unable to create spool directory")
+	}
+	var err error
+	if s.dir, err = ioutil.TempDir(cfg.Dir, "generator-spool-"); err != nil {
+		return nil, errors.Wrap(err, "unable to create spool directory")
+	}
+	return s, nil
+}
+
+// spill writes a batch to a file and returns its path, empty when the batch
+// does not fit in the spool.
+func (s *spool) spill(batch interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(batch); err != nil {
+		return "", errors.Wrap(err, "unable to encode spooled batch")
+	}
+	size := int64(buf.Len())
+	s.mu.Lock()
+	if s.bytes+size > s.maxBytes {
+		s.full++
+		s.mu.Unlock()
+		return "", nil
+	}
+	s.bytes += size
+	s.seq++
+	path := filepath.Join(s.dir, fmt.Sprintf("%08d.gob", s.seq))
+	if s.bytes > s.peak {
+		s.peak = s.bytes
+	}
+	s.spilled++
+	s.total += size
+	if !s.warned && (s.bytes >= s.highWater) {
+		s.warned = true
+		s.log.logf("spool passed its high water mark with %d of %d bytes, the sink is slower than generation\n",
+			s.bytes, s.maxBytes)
+	}
+	s.mu.Unlock()
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		s.release(size)
+		return "", errors.Wrap(err, "unable to write spooled batch")
+	}
+	return path, nil
+}
+
+// read decodes a spooled batch into batch and frees its space.
+func (s *spool) read(path string, batch interface{}) error {
+	start := time.Now()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to read spooled batch")
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(batch); err != nil {
+		return errors.Wrap(err, "unable to decode spooled batch")
+	}
+	if err := os.Remove(path); err != nil {
+		return errors.Wrap(err, "unable to remove spooled batch")
+	}
+	s.release(int64(len(data)))
+	s.mu.Lock()
+	s.readBack += time.Now().Sub(start)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *spool) release(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes -= size
+	// Warn again only after the spool drained well below the mark.
+	if s.warned && (s.bytes < s.highWater/2) {
+		s.warned = false
+	}
+}
+
+// remove deletes the spool directory with batches left by failed runs.
+func (s *spool) remove() error {
+	if s == nil {
+		return nil
+	}
+	return errors.Wrap(os.RemoveAll(s.dir), "unable to remove spool directory")
+}
+
+func (s *spool) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%d batches of %d bytes spilled, peak %d of %d bytes, full %d times, reading back took %v",
+		s.spilled, s.total, s.peak, s.maxBytes, s.full, s.readBack)
+}
+
+// spilledControlObject is a controlObject with exported fields for gob.
+// Conversions use unkeyed literals, so that fields added to one of the types
+// and not the other fail to compile.
+type spilledControlObject struct {
+	ID             string
+	DBTS           *time.Time
+	TS             time.Time
+	Passport       string
+	Surname        string
+	Name           string
+	Patronymic     string
+	Sex            string
+	BirthDate      string
+	PhoneNum       string
+	Email          string
+	Address        string
+	NaturalKey     string
+	Version        uint64
+	ConsentStatus  string
+	LegalBasis     string
+	RetentionClass string
+	Organization   string
+	Occupation     string
+	AttrKeys       []string
+	AttrValues     []string
+	Custom         []string
+}
+
+// spilledFFV is an ffv with exported fields for gob.
+type spilledFFV struct {
+	ID                   string
+	COBID                string
+	ImgID                string
+	FaceBox              []uint64
+	FacialFeaturesVector []float64
+	EventTS              time.Time
+	IngestTS             time.Time
+	CameraID             uint32
+}
+
+// spillFunc spills a batch and returns the insert of it reading it back, nil
+// when the spool is full.
+type spillFunc func() (func() error, error)
+
+// controlObjects returns the spill of a batch inserted by insert, nil
+// without a spool.
+func (s *spool) controlObjects(batch []controlObject, insert func([]controlObject) error) spillFunc {
+	if s == nil {
+		return nil
+	}
+	return func() (func() error, error) {
+		spilled := make([]spilledControlObject, len(batch))
+		for i, c := range batch {
+			spilled[i] = spilledControlObject{
+				c.id, c.dbts, c.ts, c.passport, c.surname, c.name, c.patronymic, c.sex, c.birthDate,
+				c.phoneNum, c.email, c.address, c.naturalKey, c.version, c.consentStatus, c.legalBasis,
+				c.retentionClass, c.organization, c.occupation, c.attrKeys, c.attrValues, c.custom,
+			}
+		}
+		path, err := s.spill(spilled)
+		if (err != nil) || (path == "") {
+			return nil, err
+		}
+		return func() error {
+			spilled := []spilledControlObject{}
+			if err := s.read(path, &spilled); err != nil {
+				return err
+			}
+			batch := make([]controlObject, len(spilled))
+			for i, c := range spilled {
+				batch[i] = controlObject{
+					c.ID, c.DBTS, c.TS, c.Passport, c.Surname, c.Name, c.Patronymic, c.Sex, c.BirthDate,
+					c.PhoneNum, c.Email, c.Address, c.NaturalKey, c.Version, c.ConsentStatus, c.LegalBasis,
+					c.RetentionClass, c.Organization, c.Occupation, c.AttrKeys, c.AttrValues, c.Custom,
+				}
+			}
+			return insert(batch)
+		}, nil
+	}
+}
+
+// ffvs returns the spill of a batch inserted by insert, nil without a
+// spool.
+func (s *spool) ffvs(batch []ffv, insert func([]ffv) error) spillFunc {
+	if s == nil {
+		return nil
+	}
+	return func() (func() error, error) {
+		spilled := make([]spilledFFV, len(batch))
+		for i, fv := range batch {
+			spilled[i] = spilledFFV{
+				fv.id, fv.cobID, fv.imgID, fv.faceBox, fv.facialFeaturesVector, fv.eventTS, fv.ingestTS, fv.cameraID,
+			}
+		}
+		path, err := s.spill(spilled)
+		if (err != nil) || (path == "") {
+			return nil, err
+		}
+		return func() error {
+			spilled := []spilledFFV{}
+			if err := s.read(path, &spilled); err != nil {
+				return err
+			}
+			batch := make([]ffv, len(spilled))
+			for i, fv := range spilled {
+				batch[i] = ffv{
+					fv.ID, fv.COBID, fv.ImgID, fv.FaceBox, fv.FacialFeaturesVector, fv.EventTS, fv.IngestTS, fv.CameraID,
+				}
+			}
+			return insert(batch)
+		}, nil
+	}
+}
@@ -0,0 +1,131 @@
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpoolRoundTrip(t *testing.T) {
+	dbts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	cobs := []controlObject{{
+		id: "1", dbts: &dbts, ts: dbts.Add(time.Hour), passport: "12 34 567890", surname: "Ivanov", name: "Ivan",
+		patronymic: "Ivanovich", sex: "M", birthDate: "1990-01-01", phoneNum: "+7", email: "i@example.com",
+		address: "Moscow", naturalKey: "k", version: 2, consentStatus: "granted", legalBasis: "consent",
+		retentionClass: "short", organization: "org", occupation: "engineer",
+		attrKeys: []string{"a"}, attrValues: []string{"b"}, custom: []string{"c"},
+	}, {id: "2", ts: dbts}}
+	ffvs := []ffv{{
+		id: "1", cobID: "2", imgID: "3", faceBox: []uint64{1, 2, 3, 4}, facialFeaturesVector: []float64{0.5, -0.5},
+		eventTS: dbts, ingestTS: dbts.Add(time.Second), cameraID: 7,
+	}}
+
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := newSpool(SpoolCFG{Dir: dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotCOBs []controlObject
+	var gotFFVs []ffv
+	insertCOBs, err := s.controlObjects(cobs, func(batch []controlObject) error {
+		gotCOBs = batch
+		return nil
+	})()
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertFFVs, err := s.ffvs(ffvs, func(batch []ffv) error {
+		gotFFVs = batch
+		return nil
+	})()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (insertCOBs() != nil) || (insertFFVs() != nil) {
+		t.Fatal("unable to insert spilled batches")
+	}
+	if !reflect.DeepEqual(gotCOBs, cobs) {
+		t.Errorf("control objects %+v are read back as %+v", cobs, gotCOBs)
+	}
+	if !reflect.DeepEqual(gotFFVs, ffvs) {
+		t.Errorf("FFVs %+v are read back as %+v", ffvs, gotFFVs)
+	}
+	if s.bytes != 0 {
+		t.Errorf("%d bytes are left in the spool", s.bytes)
+	}
+	if err := s.remove(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTableWriterSpool(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		maxBytes int64
+		spilled  bool
+	}{
+		{"spills", 1 << 20, true},
+		// Batches do not fit, producers block instead.
+		{"full", 1, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "spool")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			s, err := newSpool(SpoolCFG{Dir: dir, MaxBytes: test.maxBytes}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mu := sync.Mutex{}
+			inserted := []string{}
+			release := make(chan struct{})
+			insert := func(batch []controlObject) error {
+				<-release
+				mu.Lock()
+				defer mu.Unlock()
+				inserted = append(inserted, batch[0].id)
+				return nil
+			}
+			w := newTableWriter(1)
+			expected := []string{}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 10; i++ {
+					batch := []controlObject{{id: string(rune('a' + i))}}
+					expected = append(expected, batch[0].id)
+					if err := w.write(func() error { return insert(batch) }, s.controlObjects(batch, insert)); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+			if test.spilled {
+				// The sink is stuck, yet all batches are queued.
+				<-done
+			}
+			close(release)
+			<-done
+			if err := w.close(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(inserted, expected) {
+				t.Errorf("batches %v are inserted as %v", expected, inserted)
+			}
+			if (s.spilled > 0) != test.spilled {
+				t.Errorf("%d batches are spilled", s.spilled)
+			}
+			if s.bytes != 0 {
+				t.Errorf("%d bytes are left in the spool", s.bytes)
+			}
+		})
+	}
+}
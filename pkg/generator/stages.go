@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// batchTimes splits time spent on one batch by pipeline stage. The driver
+// sends buffered rows and waits for the server inside Commit, so network
+// write and commit are reported together.
+type batchTimes struct {
+	generation    time.Duration
+	serialization time.Duration
+	commit        time.Duration
+}
+
+func (t *batchTimes) add(other batchTimes) {
+	t.generation += other.generation
+	t.serialization += other.serialization
+	t.commit += other.commit
+}
+
+type stageMetrics struct {
+	mu      sync.Mutex
+	totals  map[string]*batchTimes
+	batches map[string]int
+	file    *os.File
+	writer  *bufio.Writer
+}
+
+func newStageMetrics(path string) (*stageMetrics, error) {
+	m := &stageMetrics{
+		totals:  make(map[string]*batchTimes),
+		batches: make(map[string]int),
+	}
+	if path == "" {
+		return m, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create stage metrics file")
+	}
+	m.file = file
+	m.writer = bufio.NewWriter(file)
+	fmt.Fprintln(m.writer, "table\tbatch\trows\tgeneration_us\tserialization_us\tcommit_us")
+	return m, nil
+}
+
+func (m *stageMetrics) record(table string, rows int, times batchTimes) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.totals[table]; !ok {
+		m.totals[table] = &batchTimes{}
+	}
+	m.totals[table].add(times)
+	m.batches[table]++
+	if m.writer != nil {
+		fmt.Fprintf(m.writer, "%s\t%d\t%d\t%d\t%d\t%d\n", table, m.batches[table], rows,
+			times.generation/time.Microsecond, times.serialization/time.Microsecond, times.commit/time.Microsecond)
+	}
+}
+
+func (m *stageMetrics) close() error {
+	if m.file == nil {
+		return nil
+	}
+	if err := m.writer.Flush(); err != nil {
+		m.file.Close()
+		return errors.Wrap(err, "unable to write stage metrics")
+	}
+	return m.file.Close()
+}
+
+func (m *stageMetrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tables := make([]string, 0, len(m.totals))
+	for table := range m.totals {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	lines := make([]string, len(tables))
+	for i, table := range tables {
+		times := m.totals[table]
+		lines[i] = fmt.Sprintf("%s: generation %v, serialization %v, write+commit %v in %d batches",
+			table, times.generation, times.serialization, times.commit, m.batches[table])
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,47 @@
+package generator
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStageMetrics(t *testing.T) {
+	cfg, dir := testConfig(t, 30)
+	cfg.GeneratorCFG.InIter = 10
+	cfg.GeneratorCFG.StageMetricsPath = filepath.Join(dir, "stages.tsv")
+	testRun(t, cfg)
+
+	rows := readTSV(t, cfg.GeneratorCFG.StageMetricsPath)
+	if expected := []string{"table", "batch", "rows", "generation_us", "serialization_us", "commit_us"}; !reflect.DeepEqual(rows[0], expected) {
+		t.Fatalf("stage metrics have columns %q, expected %q", rows[0], expected)
+	}
+	batches := map[string][]string{}
+	for _, row := range rows[1:] {
+		if row[2] != "10" {
+			t.Errorf("batch %s of %s has %s rows, expected 10", row[1], row[0], row[2])
+		}
+		for _, field := range row[3:] {
+			if us, err := strconv.Atoi(field); (err != nil) || (us < 0) {
+				t.Errorf("batch %s of %s took %sus", row[1], row[0], field)
+			}
+		}
+		batches[row[0]] = append(batches[row[0]], row[1])
+	}
+	expected := map[string][]string{"control_objects": {"1", "2", "3"}, "facial_features": {"1", "2", "3"}}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Errorf("stage metrics have batches %v, expected %v", batches, expected)
+	}
+
+	m, _ := newStageMetrics("")
+	m.record("facial_features", 10, batchTimes{generation: time.Millisecond, serialization: 2 * time.Millisecond})
+	m.record("facial_features", 10, batchTimes{generation: time.Millisecond, commit: 3 * time.Millisecond})
+	m.record("control_objects", 10, batchTimes{commit: time.Millisecond})
+	report := "control_objects: generation 0s, serialization 0s, write+commit 1ms in 1 batches\n" +
+		"facial_features: generation 2ms, serialization 2ms, write+commit 3ms in 2 batches"
+	if m.String() != report {
+		t.Errorf("stage breakdown is\n%s\nexpected\n%s", m, report)
+	}
+}
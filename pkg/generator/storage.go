@@ -0,0 +1,31 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Databases generated rows are inserted into with output: clickhouse.
+const (
+	storageClickHouse = "clickhouse"
+	storagePostgres   = "postgres"
+)
+
+// storageDriver inserts batches of generated rows into a database.
+type storageDriver interface {
+	InsertControlObjects(ctx context.Context, cobs []controlObject, times *batchTimes) error
+	InsertFFVs(ctx context.Context, ffvs []ffv, times *batchTimes) error
+}
+
+type clickHouseDriver struct {
+	db   *sql.DB
+	opts insertOptions
+}
+
+func (d clickHouseDriver) InsertControlObjects(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+	return insertControlObjects(ctx, d.db, cobs, d.opts, times)
+}
+
+func (d clickHouseDriver) InsertFFVs(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+	return insertFFVs(ctx, d.db, ffvs, d.opts, times)
+}
@@ -0,0 +1,314 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nofacedb/generator/pkg/storage/sinktest"
+	uuid "github.com/satori/go.uuid"
+)
+
+// fakeBackend stores records posted to a fake server by table. It accepts a
+// limited number of requests after reject and fails the others.
+type fakeBackend struct {
+	mu      sync.Mutex
+	records map[string][]map[string]interface{}
+	// Requests accepted before failing, negative for all.
+	accept int
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{records: map[string][]map[string]interface{}{}, accept: -1}
+}
+
+// Reject makes the backend fail requests after accepting n more of them.
+func (b *fakeBackend) Reject(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.accept = n
+}
+
+func (b *fakeBackend) store(table string, records []map[string]interface{}) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.accept == 0 {
+		return false
+	}
+	if b.accept > 0 {
+		b.accept--
+	}
+	b.records[table] = append(b.records[table], records...)
+	return true
+}
+
+// Stored returns IDs of records of a table.
+func (b *fakeBackend) Stored(table string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := []string{}
+	for _, record := range b.records[table] {
+		ids = append(ids, fmt.Sprint(record["id"]))
+	}
+	return ids, nil
+}
+
+// fakeClickHouse serves JSONEachRow inserts of the ClickHouse HTTP interface.
+func fakeClickHouse(b *fakeBackend) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields := strings.Fields(r.URL.Query().Get("query"))
+		if (len(fields) < 3) || (fields[0] != "INSERT") {
+			http.Error(w, "Code: 62. DB::Exception: Syntax error", http.StatusBadRequest)
+			return
+		}
+		body := r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case compressionGzip:
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "Code: 354. DB::Exception: inflate failed", http.StatusBadRequest)
+				return
+			}
+			body = zr
+		case compressionZstd:
+			zr, err := zstd.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "Code: 561. DB::Exception: zstd decoder init failed", http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			body = zr.IOReadCloser()
+		}
+		records := []map[string]interface{}{}
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(nil, 1<<24)
+		for scanner.Scan() {
+			record := map[string]interface{}{}
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				http.Error(w, "Code: 26. DB::Exception: Cannot parse input", http.StatusBadRequest)
+				return
+			}
+			records = append(records, record)
+		}
+		if !b.store(fields[2], records) {
+			http.Error(w, "Code: 241. DB::Exception: Memory limit exceeded", http.StatusInternalServerError)
+		}
+	})
+}
+
+// newTestClickHouseHTTP returns a client of the ClickHouse HTTP interface
+// served by handler, configured by cfg except for the address.
+func newTestClickHouseHTTP(t *testing.T, handler http.Handler, cfg StorageCFG) *clickHouseHTTP {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Addr, cfg.HTTPPort = u.Hostname(), port
+	c, err := newClickHouseHTTP(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// fakeAPI serves records posted to REST endpoints named after tables.
+func fakeAPI(b *fakeBackend) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		records := []map[string]interface{}{}
+		if bytes.HasPrefix(body, []byte("[")) {
+			err = json.Unmarshal(body, &records)
+		} else {
+			record := map[string]interface{}{}
+			err = json.Unmarshal(body, &record)
+			records = append(records, record)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !b.store(strings.TrimPrefix(r.URL.Path, "/"), records) {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+func testBatches(n int) ([]controlObject, []ffv) {
+	cobs, ffvs := make([]controlObject, n), make([]ffv, n)
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range cobs {
+		cobs[i] = controlObject{
+			id: uuid.Must(uuid.NewV4()).String(), ts: ts, passport: fmt.Sprintf("12 34 %06d", i),
+			surname: "Ivanov", name: "Ivan", patronymic: "Ivanovich", sex: "M", birthDate: "1990-01-01",
+		}
+		ffvs[i] = ffv{
+			id: uuid.Must(uuid.NewV4()).String(), cobID: cobs[i].id, imgID: uuid.Must(uuid.NewV4()).String(),
+			faceBox: []uint64{1, 2, 3, 1 << 63}, facialFeaturesVector: []float64{0.1, -0.2, 0.3, -0.4},
+		}
+	}
+	return cobs, ffvs
+}
+
+// driverSink inserts test batches with given IDs through a storageDriver.
+type driverSink struct {
+	d                  storageDriver
+	cobTable, ffvTable string
+}
+
+func newDriverSink(d storageDriver, opts insertOptions) driverSink {
+	return driverSink{d: d, cobTable: opts.cobTable.name, ffvTable: opts.ffvTable.name}
+}
+
+func (s driverSink) Insert(ctx context.Context, table string, ids []string) error {
+	cobs, ffvs := testBatches(len(ids))
+	switch table {
+	case s.cobTable:
+		for i := range cobs {
+			cobs[i].id = ids[i]
+		}
+		return s.d.InsertControlObjects(ctx, cobs, &batchTimes{})
+	case s.ffvTable:
+		for i := range ffvs {
+			ffvs[i].id = ids[i]
+		}
+		return s.d.InsertFFVs(ctx, ffvs, &batchTimes{})
+	}
+	return fmt.Errorf("unknown table %s", table)
+}
+
+// contract returns the conformance contract of storage drivers, which are
+// retried after failures.
+func (s driverSink) contract(atomic bool) sinktest.Contract {
+	return sinktest.Contract{Tables: []string{s.cobTable, s.ffvTable}, Atomic: atomic, Retried: true}
+}
+
+func testInsertOptions(t *testing.T, schema SchemaCFG) insertOptions {
+	opts := insertOptions{}
+	var err error
+	if opts.cobTable, err = newTableMapping("control_objects", schema.ControlObjects, opts.controlObjectsColumns()); err != nil {
+		t.Fatal(err)
+	}
+	if opts.ffvTable, err = newTableMapping("facial_features", schema.FFVs, opts.ffvsColumns()); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+func TestClickHouseHTTPDriverConformance(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		schema      SchemaCFG
+		compression CompressionCFG
+	}{
+		{"default", SchemaCFG{}, CompressionCFG{}},
+		{"mapped", SchemaCFG{
+			ControlObjects: TableSchemaCFG{Name: "persons"},
+			FFVs:           TableSchemaCFG{Name: "faces", Columns: map[string]string{"img_id": omittedColumn}},
+		}, CompressionCFG{}},
+		{"gzip", SchemaCFG{}, CompressionCFG{Algorithm: compressionGzip}},
+		{"zstd level 3", SchemaCFG{}, CompressionCFG{Algorithm: compressionZstd, Level: 3}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := testInsertOptions(t, test.schema)
+			sink := driverSink{cobTable: opts.cobTable.name, ffvTable: opts.ffvTable.name}
+			sinktest.Run(t, func(t *testing.T) (sinktest.Sink, sinktest.Backend) {
+				b := newFakeBackend()
+				c := newTestClickHouseHTTP(t, fakeClickHouse(b), StorageCFG{Compression: test.compression})
+				return newDriverSink(newClickHouseHTTPDriver(c, opts), opts), b
+			}, sink.contract(true))
+		})
+	}
+}
+
+func TestAPIDriverConformance(t *testing.T) {
+	for _, test := range []struct {
+		name              string
+		recordsPerRequest int
+		atomic            bool
+	}{
+		// Batches are posted in one request.
+		{"arrays", 1000, true},
+		// Every record is a request, failures leave parts of batches.
+		{"objects", 1, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			sink := driverSink{cobTable: "control_objects", ffvTable: "facial_features"}
+			sinktest.Run(t, func(t *testing.T) (sinktest.Sink, sinktest.Backend) {
+				b := newFakeBackend()
+				server := httptest.NewServer(fakeAPI(b))
+				t.Cleanup(server.Close)
+				sink.d = newAPIDriver(APICFG{
+					BaseURL:           server.URL,
+					Endpoints:         APIEndpoints{ControlObjects: "/control_objects", FFVs: "/facial_features"},
+					RecordsPerRequest: test.recordsPerRequest,
+					Concurrency:       1,
+				}, insertOptions{})
+				return sink, b
+			}, sink.contract(test.atomic))
+		})
+	}
+}
+
+func TestInsertQuorumSettings(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		cfg      StorageCFG
+		queries  []string
+		settings url.Values
+	}{
+		{"no quorum", StorageCFG{InsertQuorumTimeoutMS: 1000}, nil, url.Values{}},
+		{"quorum", StorageCFG{InsertQuorum: 2}, []string{"SET insert_quorum = 2"},
+			url.Values{"insert_quorum": {"2"}}},
+		{"quorum with timeout", StorageCFG{InsertQuorum: 2, InsertQuorumTimeoutMS: 1000},
+			[]string{"SET insert_quorum = 2", "SET insert_quorum_timeout = 1000"},
+			url.Values{"insert_quorum": {"2"}, "insert_quorum_timeout": {"1000"}}},
+	} {
+		if queries := insertSettingsQueries(test.cfg); !reflect.DeepEqual(queries, test.queries) {
+			t.Errorf("%s: native inserts apply %q, expected %q", test.name, queries, test.queries)
+		}
+
+		b := newFakeBackend()
+		settings := url.Values{}
+		handler := fakeClickHouse(b)
+		c := newTestClickHouseHTTP(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, values := range r.URL.Query() {
+				if strings.HasPrefix(name, "insert_quorum") {
+					settings[name] = values
+				}
+			}
+			handler.ServeHTTP(w, r)
+		}), test.cfg)
+		opts := testInsertOptions(t, SchemaCFG{})
+		cobs, _ := testBatches(2)
+		if err := newClickHouseHTTPDriver(c, opts).InsertControlObjects(context.Background(), cobs, &batchTimes{}); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(settings, test.settings) {
+			t.Errorf("%s: HTTP inserts have settings %v, expected %v", test.name, settings, test.settings)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Field groups drawing from separate random streams. A seed offset of one
+// group changes only its values, e.g. FFVs of a new model version for the
+// same persons and passports.
+const (
+	streamPassport     = "passport"
+	streamPersonalData = "personal_data"
+	streamCompliance   = "compliance"
+	streamEmployment   = "employment"
+	streamAttributes   = "attributes"
+	streamFaceBoxes    = "face_boxes"
+	streamFFVs         = "ffv"
+	streamScenarios    = "scenarios"
+	streamEventTime    = "event_time"
+	streamTS           = "ts"
+	streamProbes       = "probes"
+	streamNameVariants = "name_variants"
+	streamDuplicates   = "duplicates"
+	streamUpserts      = "upserts"
+	streamFields       = "fields"
+	// Projections of reduced FFVs, offset together with FFVs.
+	streamFFVVariants = "ffv_variants"
+	// Think time does not affect data and has no offset.
+	streamThinkTime = "think_time"
+)
+
+var seedOffsetFields = []string{
+	streamPassport, streamPersonalData, streamCompliance, streamEmployment, streamAttributes,
+	streamFaceBoxes, streamFFVs, streamScenarios, streamEventTime, streamTS,
+	streamProbes, streamNameVariants, streamDuplicates, streamFields, streamUpserts,
+}
+
+func validateSeedOffsets(offsets map[string]int64) error {
+	for field := range offsets {
+		known := false
+		for _, f := range seedOffsetFields {
+			known = known || (f == field)
+		}
+		if !known {
+			fields := append([]string{}, seedOffsetFields...)
+			sort.Strings(fields)
+			return fmt.Errorf("unknown seed offset field \"%s\", supported are %s", field, strings.Join(fields, ", "))
+		}
+	}
+	return nil
+}
+
+// seededRand derives an independent source of one stream of one worker from
+// the run seed. Worker -1 is used for setup, like the low-rank basis.
+func seededRand(seed int64, worker int, stream string, offset int64) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%d/%s/%d", seed, worker, stream, offset)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// streams are random sources of one worker.
+type streams struct {
+	passport     *rand.Rand
+	personalData *rand.Rand
+	compliance   *rand.Rand
+	employment   *rand.Rand
+	attributes   *rand.Rand
+	faceBoxes    *rand.Rand
+	ffvs         *rand.Rand
+	scenarios    *rand.Rand
+	eventTime    *rand.Rand
+	ts           *rand.Rand
+	probes       *rand.Rand
+	nameVariants *rand.Rand
+	duplicates   *rand.Rand
+	upserts      *rand.Rand
+	fields       *rand.Rand
+	thinkTime    *rand.Rand
+}
+
+func newStreams(seed int64, worker int, offsets map[string]int64) *streams {
+	stream := func(name string) *rand.Rand {
+		return seededRand(seed, worker, name, offsets[name])
+	}
+	return &streams{
+		passport:     stream(streamPassport),
+		personalData: stream(streamPersonalData),
+		compliance:   stream(streamCompliance),
+		employment:   stream(streamEmployment),
+		attributes:   stream(streamAttributes),
+		faceBoxes:    stream(streamFaceBoxes),
+		ffvs:         stream(streamFFVs),
+		scenarios:    stream(streamScenarios),
+		eventTime:    stream(streamEventTime),
+		ts:           stream(streamTS),
+		probes:       stream(streamProbes),
+		nameVariants: stream(streamNameVariants),
+		duplicates:   stream(streamDuplicates),
+		upserts:      stream(streamUpserts),
+		fields:       stream(streamFields),
+		thinkTime:    stream(streamThinkTime),
+	}
+}
@@ -0,0 +1,59 @@
+package generator
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestSeedOffsets checks that an offset of a field group regenerates its
+// values and keeps the others.
+func TestSeedOffsets(t *testing.T) {
+	generate := func(offsets map[string]int64) ([][]string, [][]string) {
+		cfg, dir := testConfig(t, 30)
+		cfg.GeneratorCFG.SeedOffsets = offsets
+		testRun(t, cfg)
+		return readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")),
+			readTSV(t, filepath.Join(dir, "facial_features.0001.tsv"))
+	}
+	column := func(rows [][]string, i int) []string {
+		values := []string{}
+		for _, row := range rows {
+			values = append(values, row[i])
+		}
+		return values
+	}
+	cobs, ffvs := generate(nil)
+
+	// New FFVs of the same persons.
+	newCOBs, newFFVs := generate(map[string]int64{streamFFVs: 1})
+	if !reflect.DeepEqual(newCOBs, cobs) {
+		t.Error("FFV offset changes control objects")
+	}
+	for i, name := range ffvsColumns {
+		if changed := !reflect.DeepEqual(column(newFFVs, i), column(ffvs, i)); changed != (name == "ff") {
+			t.Errorf("FFV offset changes %s: %v", name, changed)
+		}
+	}
+
+	// New passports of the same persons and FFVs.
+	newCOBs, newFFVs = generate(map[string]int64{streamPassport: 1})
+	if !reflect.DeepEqual(newFFVs, ffvs) {
+		t.Error("passport offset changes FFVs")
+	}
+	for i, name := range controlObjectsColumns {
+		if changed := !reflect.DeepEqual(column(newCOBs, i), column(cobs, i)); changed != (name == "passport") {
+			t.Errorf("passport offset changes %s: %v", name, changed)
+		}
+	}
+
+	// Offsets of 0 are the seed itself.
+	if newCOBs, newFFVs = generate(map[string]int64{streamFFVs: 0}); !reflect.DeepEqual(newCOBs, cobs) ||
+		!reflect.DeepEqual(newFFVs, ffvs) {
+		t.Error("offset 0 changes generated rows")
+	}
+
+	if err := validateSeedOffsets(map[string]int64{streamThinkTime: 1}); err == nil {
+		t.Error("offset of think time is accepted")
+	}
+}
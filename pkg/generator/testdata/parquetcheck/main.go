@@ -0,0 +1,101 @@
+// Command parquetcheck reads Parquet files with an independent
+// implementation, github.com/xitongsys/parquet-go, and prints their rows as
+// JSON arrays, one per line, to check files of the generator's writer.
+// Lists are arrays, UINT_32 columns are unsigned and TIMESTAMP_MILLIS
+// columns are milliseconds.
+//
+//	go run . ../rows.parquet | diff - ../rows.json
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: parquetcheck file.parquet...")
+		os.Exit(2)
+	}
+	for _, path := range os.Args[1:] {
+		if err := check(path); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func check(path string) error {
+	file, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	pr, err := reader.NewParquetColumnReader(file, 1)
+	if err != nil {
+		return err
+	}
+	defer pr.ReadStop()
+	n := pr.GetNumRows()
+	rows := make([][]interface{}, n)
+	for _, column := range pr.SchemaHandler.ValueColumns {
+		element := pr.SchemaHandler.SchemaElements[pr.SchemaHandler.MapIndex[column]]
+		values, rls, dls, err := pr.ReadColumnByPath(column, n)
+		if err != nil {
+			return err
+		}
+		path := common.StrToPath(column)
+		maxRL, err := pr.SchemaHandler.MaxRepetitionLevel(path)
+		if err != nil {
+			return err
+		}
+		maxDL, err := pr.SchemaHandler.MaxDefinitionLevel(path)
+		if err != nil {
+			return err
+		}
+		list := maxRL > 0
+		row := -1
+		for i, value := range values {
+			if rls[i] == 0 {
+				row++
+				if row >= len(rows) {
+					return fmt.Errorf("column %s has more than %d rows", column, n)
+				}
+				if list {
+					rows[row] = append(rows[row], []interface{}{})
+				}
+			}
+			value = convert(element, value)
+			if !list {
+				rows[row] = append(rows[row], value)
+			} else if dls[i] == maxDL {
+				last := len(rows[row]) - 1
+				rows[row][last] = append(rows[row][last].([]interface{}), value)
+			}
+		}
+		if row != len(rows)-1 {
+			return fmt.Errorf("column %s has %d rows, expected %d", column, row+1, n)
+		}
+	}
+	for _, row := range rows {
+		line, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(line))
+	}
+	return nil
+}
+
+func convert(element *parquet.SchemaElement, value interface{}) interface{} {
+	if element.ConvertedType != nil && *element.ConvertedType == parquet.ConvertedType_UINT_32 {
+		return uint32(value.(int32))
+	}
+	return value
+}
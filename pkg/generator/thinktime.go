@@ -0,0 +1,41 @@
+package generator
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	thinkTimePerRow   = "row"
+	thinkTimePerBatch = "batch"
+)
+
+// ThinkTimeCFG describes pauses sampled from a Pareto distribution with
+// scale MinMS and shape Alpha, capped at MaxMS.
+type ThinkTimeCFG struct {
+	Per   string  `yaml:"per"`
+	MinMS float64 `yaml:"min_ms"`
+	MaxMS float64 `yaml:"max_ms"`
+	Alpha float64 `yaml:"alpha"`
+}
+
+func (cfg ThinkTimeCFG) sample(rnd *rand.Rand) time.Duration {
+	alpha := cfg.Alpha
+	if alpha <= 0 {
+		alpha = 1.5
+	}
+	ms := cfg.MinMS / math.Pow(1.0-rnd.Float64(), 1.0/alpha)
+	if (cfg.MaxMS > 0) && (ms > cfg.MaxMS) {
+		ms = cfg.MaxMS
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func (cfg ThinkTimeCFG) wait(ctx context.Context, rnd *rand.Rand, per string) error {
+	if (cfg.Per != per) || (cfg.MinMS <= 0) {
+		return nil
+	}
+	return sleepContext(ctx, cfg.sample(rnd))
+}
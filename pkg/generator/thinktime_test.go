@@ -0,0 +1,67 @@
+package generator
+
+import (
+	"context"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestThinkTimeSample(t *testing.T) {
+	cfg := ThinkTimeCFG{Per: thinkTimePerRow, MinMS: 10, MaxMS: 1000, Alpha: 1.5}
+	rnd := rand.New(rand.NewSource(1))
+	samples := make([]time.Duration, 10000)
+	for i := range samples {
+		samples[i] = cfg.sample(rnd)
+		if (samples[i] < 10*time.Millisecond) || (samples[i] > time.Second) {
+			t.Fatalf("think time %v is out of [10ms, 1s]", samples[i])
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	// The median of Pareto(10ms, 1.5) is 10ms * 2^(1/1.5), about 15.9ms,
+	// its 99th percentile 10ms * 100^(1/1.5), about 215ms.
+	if median := samples[len(samples)/2]; (median < 15*time.Millisecond) || (median > 17*time.Millisecond) {
+		t.Errorf("median think time is %v, expected about 15.9ms", median)
+	}
+	if p99 := samples[len(samples)*99/100]; (p99 < 180*time.Millisecond) || (p99 > 250*time.Millisecond) {
+		t.Errorf("99th percentile of think time is %v, expected about 215ms", p99)
+	}
+	if samples[len(samples)-1] != time.Second {
+		t.Errorf("longest think time is %v, expected the cap of 1s", samples[len(samples)-1])
+	}
+
+	// Pauses of other units and without a scale are skipped.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cfg.wait(ctx, rnd, thinkTimePerBatch); err != nil {
+		t.Errorf("think time per row waits per batch: %v", err)
+	}
+	if err := (ThinkTimeCFG{Per: thinkTimePerRow}).wait(ctx, rnd, thinkTimePerRow); err != nil {
+		t.Errorf("think time without min_ms waits: %v", err)
+	}
+	if err := cfg.wait(ctx, rnd, thinkTimePerRow); err != context.Canceled {
+		t.Errorf("canceled think time returns %v", err)
+	}
+}
+
+// TestThinkTimeRun checks that think time slows down runs without changing
+// generated rows.
+func TestThinkTimeRun(t *testing.T) {
+	cfg, dir := testConfig(t, 10)
+	testRun(t, cfg)
+	expected := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+
+	cfg, dir = testConfig(t, 10)
+	cfg.GeneratorCFG.ThinkTime = ThinkTimeCFG{Per: thinkTimePerRow, MinMS: 3, MaxMS: 5}
+	startTime := time.Now()
+	testRun(t, cfg)
+	if elapsed := time.Now().Sub(startTime); elapsed < 30*time.Millisecond {
+		t.Errorf("10 rows with think time of at least 3ms took %v", elapsed)
+	}
+	if rows := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")); !reflect.DeepEqual(rows, expected) {
+		t.Error("think time changes generated rows")
+	}
+}
@@ -0,0 +1,181 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ThroughputCFG tunes the controller holding -target-rows-per-sec.
+type ThroughputCFG struct {
+	// Allowed relative deviation of the measured rate, 0.05 by default.
+	Tolerance float64 `yaml:"tolerance"`
+	// Measurement and adjustment interval, 1s by default.
+	IntervalMS int `yaml:"interval_ms"`
+}
+
+const batchesPerInterval = 4
+
+// throughputController measures inserted rows every interval and, outside
+// the tolerance band, corrects pacing of generated rows, the number of
+// active workers and batch sizes, so that every active worker flushes its
+// batches several times per interval.
+type throughputController struct {
+	target    float64
+	tolerance float64
+	interval  time.Duration
+	inserted  *int64
+
+	mu       sync.Mutex
+	pace     *rateLimiter
+	rate     float64
+	workers  int
+	active   int
+	finished map[int]bool
+	batch    int64
+
+	intervals int
+	inBand    int
+	measured  float64
+}
+
+func newThroughputController(target float64, cfg ThroughputCFG, inserted *int64, workers int) *throughputController {
+	if target <= 0 {
+		return nil
+	}
+	c := &throughputController{
+		target:    target,
+		tolerance: cfg.Tolerance,
+		interval:  time.Duration(cfg.IntervalMS) * time.Millisecond,
+		inserted:  inserted,
+		rate:      target,
+		workers:   workers,
+		active:    workers,
+		finished:  make(map[int]bool),
+	}
+	if c.tolerance <= 0 {
+		c.tolerance = 0.05
+	}
+	if c.interval <= 0 {
+		c.interval = time.Second
+	}
+	c.pace = newRateLimiter(c.rate, 1)
+	c.updateBatch()
+	return c
+}
+
+// run adjusts the controller every interval until ctx is done.
+func (c *throughputController) run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	last, lastTime := atomic.LoadInt64(c.inserted), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			inserted := atomic.LoadInt64(c.inserted)
+			c.adjust(float64(inserted-last) / now.Sub(lastTime).Seconds())
+			last, lastTime = inserted, now
+		}
+	}
+}
+
+func (c *throughputController) adjust(measured float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.intervals++
+	c.measured += measured
+	deviation := (measured - c.target) / c.target
+	if math.Abs(deviation) <= c.tolerance {
+		c.inBand++
+		return
+	}
+	// Correct pacing halfway in log scale, at most twice per interval, so
+	// that noisy measurements do not make it oscillate.
+	factor := 2.0
+	if measured > 0 {
+		factor = math.Max(0.5, math.Min(2, math.Sqrt(c.target/measured)))
+	}
+	c.rate = math.Max(c.target/16, math.Min(16*c.target, c.rate*factor))
+	// Pacing far above the target without reaching it means workers are
+	// the bottleneck, far below it means fewer workers would do.
+	switch {
+	case (deviation < 0) && (c.rate > 2*c.target) && (c.active < c.workers):
+		c.active++
+	case (deviation > 0) && (c.rate < c.target/2) && (c.active > 1):
+		c.active--
+	}
+	c.pace.setRate(c.rate)
+	c.updateBatch()
+}
+
+// updateBatch sizes batches to be flushed several times per interval.
+func (c *throughputController) updateBatch() {
+	batch := int64(c.rate / float64(c.active) * c.interval.Seconds() / batchesPerInterval)
+	if batch < 1 {
+		batch = 1
+	}
+	atomic.StoreInt64(&c.batch, batch)
+}
+
+// wait paces a row of the worker and parks the worker while it is not among
+// active unfinished ones. Nil controller never waits.
+func (c *throughputController) wait(ctx context.Context, worker int) error {
+	if c == nil {
+		return nil
+	}
+	for !c.isActive(worker) {
+		if err := sleepContext(ctx, c.interval/10); err != nil {
+			return err
+		}
+	}
+	return c.pace.wait(ctx)
+}
+
+func (c *throughputController) isActive(worker int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rank := 0
+	for w := 0; w < worker; w++ {
+		if !c.finished[w] {
+			rank++
+		}
+	}
+	return rank < c.active
+}
+
+// finish frees the slot of a worker done with its range.
+func (c *throughputController) finish(worker int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finished[worker] = true
+}
+
+// batchSize caps a configured batch size. Nil controller keeps it.
+func (c *throughputController) batchSize(configured int) int {
+	if c == nil {
+		return configured
+	}
+	if batch := int(atomic.LoadInt64(&c.batch)); batch < configured {
+		return batch
+	}
+	return configured
+}
+
+func (c *throughputController) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	mean, inBand := 0.0, 0.0
+	if c.intervals > 0 {
+		mean, inBand = c.measured/float64(c.intervals), 100*float64(c.inBand)/float64(c.intervals)
+	}
+	return fmt.Sprintf("target %.0f rows/s, measured %.0f rows/s, %.0f%% of %d intervals within ±%.0f%%, final pacing %.0f rows/s with %d of %d workers",
+		c.target, mean, inBand, c.intervals, 100*c.tolerance, c.rate, c.active, c.workers)
+}
@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThroughputAdjust(t *testing.T) {
+	inserted := int64(0)
+	c := newThroughputController(1000, ThroughputCFG{Tolerance: 0.1, IntervalMS: 100}, &inserted, 4)
+	// Every one of 4 workers flushes 4 batches per 100ms interval.
+	if (c.rate != 1000) || (c.active != 4) || (c.batchSize(100) != 6) {
+		t.Fatalf("controller starts with pacing %v, %d workers and batches of %d", c.rate, c.active, c.batchSize(100))
+	}
+	for _, step := range []struct {
+		measured float64
+		rate     float64
+		active   int
+	}{
+		// Within the band.
+		{1050, 1000, 4},
+		// Corrections are the square root of the deviation, at most 2.
+		{4000, 500, 4},
+		{16000, 250, 3},
+		{250, 500, 3},
+		{0, 1000, 3},
+		{100, 2000, 3},
+		// Pacing far above the target is not reached by too few workers.
+		{100, 4000, 4},
+		{100, 8000, 4},
+		{100, 16000, 4},
+		// Pacing is capped.
+		{100, 16000, 4},
+	} {
+		c.adjust(step.measured)
+		if (c.rate != step.rate) || (c.active != step.active) {
+			t.Fatalf("measured %v rows/s adjusts pacing to %v with %d workers, expected %v with %d",
+				step.measured, c.rate, c.active, step.rate, step.active)
+		}
+	}
+	if batch := c.batchSize(1000); batch != 100 {
+		t.Errorf("batches of 4 workers at 16000 rows/s are %d rows, expected 100", batch)
+	}
+	if report := c.String(); !strings.Contains(report, "10% of 10 intervals within ±10%") {
+		t.Errorf("unexpected report %s", report)
+	}
+
+	// Finished workers free their slots.
+	c.active = 2
+	c.finish(0)
+	if !c.isActive(2) || c.isActive(3) {
+		t.Error("slots of finished workers are not freed")
+	}
+
+	var nilController *throughputController
+	if (nilController.batchSize(10) != 10) || (nilController.wait(context.Background(), 0) != nil) {
+		t.Error("nil controller changes batches or waits")
+	}
+}
+
+// TestThroughputRun checks that runs with a target rate are paced.
+func TestThroughputRun(t *testing.T) {
+	cfg, _ := testConfig(t, 200)
+	cfg.GeneratorCFG.Throughput = ThroughputCFG{IntervalMS: 20}
+	startTime := time.Now()
+	inserted, err := run(context.Background(), cfg, Options{TargetRowsPerSec: 2000}, cfg.GeneratorCFG.Seed, nil,
+		startTime, &logger{quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Now().Sub(startTime); (inserted != 200) || (elapsed < 80*time.Millisecond) {
+		t.Errorf("%d rows at 2000 rows/s are inserted in %v, expected about 100ms", inserted, elapsed)
+	}
+}
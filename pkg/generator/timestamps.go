@@ -0,0 +1,151 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Distributions of ts within generator.ts_range.
+const (
+	tsUniform       = "uniform"
+	tsBusinessHours = "business_hours"
+	tsPoissonBursts = "poisson_bursts"
+)
+
+// Business hours are 9:00 to 18:00 from Monday to Friday in the time zone of
+// the range start.
+const (
+	businessDayStart = 9 * time.Hour
+	businessDayEnd   = 18 * time.Hour
+)
+
+// Bursts hold tsBurstSize rows on average, spread exponentially with mean
+// tsBurstSpread after the burst start. Their number is capped by tsMaxBursts.
+const (
+	tsBurstSize   = 100
+	tsBurstSpread = time.Minute
+	tsMaxBursts   = 1 << 16
+)
+
+// TSRangeCFG bounds ts of generated rows, YYYY-MM-DD or RFC 3339 times.
+// Rows get the time of their generation, or consecutive seconds in
+// deterministic runs, when empty.
+type TSRangeCFG struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+func parseTS(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// tsInterval is a part of the range timestamps are drawn from, at offset
+// from the start of the first one.
+type tsInterval struct {
+	start  time.Time
+	length time.Duration
+	offset time.Duration
+}
+
+// timestamps draws ts of rows from a range.
+type timestamps struct {
+	distribution string
+	start, end   time.Time
+	// Business hours within the range.
+	intervals []tsInterval
+	total     time.Duration
+	// Starts of bursts, a Poisson process over the range.
+	bursts []time.Time
+}
+
+// newTimestamps returns nil without a range, so rows keep generation times.
+// Bursts are drawn once from rnd and shared by all workers.
+func newTimestamps(cfg TSRangeCFG, distribution string, n int, rnd *rand.Rand) (*timestamps, error) {
+	if (cfg.Start == "") && (cfg.End == "") {
+		if distribution != "" {
+			return nil, fmt.Errorf("ts_distribution needs ts_range")
+		}
+		return nil, nil
+	}
+	start, err := parseTS(cfg.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start \"%s\", expected YYYY-MM-DD or RFC 3339", cfg.Start)
+	}
+	end, err := parseTS(cfg.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end \"%s\", expected YYYY-MM-DD or RFC 3339", cfg.End)
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("end %s is not after start %s", cfg.End, cfg.Start)
+	}
+	if distribution == "" {
+		distribution = tsUniform
+	}
+	t := &timestamps{distribution: distribution, start: start, end: end}
+	switch distribution {
+	case tsUniform:
+	case tsBusinessHours:
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+		for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+			if (day.Weekday() == time.Saturday) || (day.Weekday() == time.Sunday) {
+				continue
+			}
+			from, to := day.Add(businessDayStart), day.Add(businessDayEnd)
+			if from.Before(start) {
+				from = start
+			}
+			if to.After(end) {
+				to = end
+			}
+			if to.After(from) {
+				t.intervals = append(t.intervals, tsInterval{start: from, length: to.Sub(from), offset: t.total})
+				t.total += to.Sub(from)
+			}
+		}
+		if len(t.intervals) == 0 {
+			return nil, fmt.Errorf("no business hours between %s and %s", cfg.Start, cfg.End)
+		}
+	case tsPoissonBursts:
+		bursts := n/tsBurstSize + 1
+		if bursts > tsMaxBursts {
+			bursts = tsMaxBursts
+		}
+		span := end.Sub(start)
+		gap := float64(span) / float64(bursts)
+		for at := time.Duration(rnd.ExpFloat64() * gap); at < span; at += time.Duration(rnd.ExpFloat64() * gap) {
+			t.bursts = append(t.bursts, start.Add(at))
+		}
+		if len(t.bursts) == 0 {
+			t.bursts = append(t.bursts, start)
+		}
+	default:
+		return nil, fmt.Errorf("unknown ts_distribution \"%s\", supported are %s, %s, %s",
+			distribution, tsUniform, tsBusinessHours, tsPoissonBursts)
+	}
+	return t, nil
+}
+
+// sample draws ts of one row.
+func (t *timestamps) sample(rnd *rand.Rand) time.Time {
+	switch t.distribution {
+	case tsBusinessHours:
+		at := time.Duration(rnd.Int63n(int64(t.total)))
+		i := sort.Search(len(t.intervals), func(i int) bool {
+			return t.intervals[i].offset+t.intervals[i].length > at
+		})
+		return t.intervals[i].start.Add(at - t.intervals[i].offset)
+	case tsPoissonBursts:
+		ts := t.bursts[rnd.Intn(len(t.bursts))].Add(time.Duration(rnd.ExpFloat64() * float64(tsBurstSpread)))
+		if !ts.Before(t.end) {
+			ts = t.end.Add(-time.Second)
+		}
+		return ts
+	default:
+		return t.start.Add(time.Duration(rnd.Int63n(int64(t.end.Sub(t.start)))))
+	}
+}
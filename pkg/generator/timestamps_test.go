@@ -0,0 +1,115 @@
+package generator
+
+import (
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sampleTimestamps draws n timestamps of a distribution over cfg.
+func sampleTimestamps(t *testing.T, cfg TSRangeCFG, distribution string, n int) (*timestamps, []time.Time) {
+	rnd := rand.New(rand.NewSource(1))
+	ts, err := newTimestamps(cfg, distribution, n, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]time.Time, n)
+	for i := range samples {
+		samples[i] = ts.sample(rnd)
+		if samples[i].Before(ts.start) || !samples[i].Before(ts.end) {
+			t.Fatalf("%s ts %v is out of [%v, %v)", distribution, samples[i], ts.start, ts.end)
+		}
+	}
+	return ts, samples
+}
+
+func TestTimestamps(t *testing.T) {
+	year := TSRangeCFG{Start: "2024-01-01", End: "2025-01-01"}
+	_, samples := sampleTimestamps(t, year, "", 12000)
+	months := map[time.Month]int{}
+	for _, ts := range samples {
+		months[ts.Month()]++
+	}
+	for month := time.January; month <= time.December; month++ {
+		if (months[month] < 800) || (months[month] > 1200) {
+			t.Errorf("%d of 12000 uniform ts are in %v, expected about 1000", months[month], month)
+		}
+	}
+
+	// 2024-03-01 is a Friday.
+	_, samples = sampleTimestamps(t, TSRangeCFG{Start: "2024-03-01T12:00:00Z", End: "2024-03-11T10:00:00Z"},
+		tsBusinessHours, 10000)
+	days := map[int]int{}
+	for _, ts := range samples {
+		if (ts.Weekday() == time.Saturday) || (ts.Weekday() == time.Sunday) || (ts.Hour() < 9) || (ts.Hour() >= 18) {
+			t.Fatalf("business hours ts %v is out of business hours", ts)
+		}
+		days[ts.Day()]++
+	}
+	// 6 hours on the first Friday, 9 hours on 5 weekdays and 1 hour on
+	// the last Monday.
+	for day, hours := range map[int]int{1: 6, 4: 9, 8: 9, 11: 1} {
+		if expected := 10000 * hours / 52; (days[day] < expected*8/10) || (days[day] > expected*12/10) {
+			t.Errorf("%d of 10000 business hours ts are on day %d, expected about %d", days[day], day, expected)
+		}
+	}
+
+	// Bursts start about every 100 rows and last minutes.
+	ts, samples := sampleTimestamps(t, year, tsPoissonBursts, 5000)
+	if (len(ts.bursts) < 30) || (len(ts.bursts) > 80) {
+		t.Errorf("5000 rows have %d bursts, expected about 51", len(ts.bursts))
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Before(samples[j]) })
+	groups := 1
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Sub(samples[i-1]) > time.Hour {
+			groups++
+		}
+	}
+	if groups > len(ts.bursts) {
+		t.Errorf("5000 ts of %d bursts form %d groups an hour apart", len(ts.bursts), groups)
+	}
+}
+
+func TestTimestampsInvalid(t *testing.T) {
+	if ts, err := newTimestamps(TSRangeCFG{}, "", 10, nil); (ts != nil) || (err != nil) {
+		t.Errorf("timestamps without a range are %v, %v", ts, err)
+	}
+	for _, test := range []struct {
+		cfg          TSRangeCFG
+		distribution string
+		err          string
+	}{
+		{TSRangeCFG{}, tsUniform, "needs ts_range"},
+		{TSRangeCFG{Start: "March", End: "2024-04-01"}, "", "invalid start"},
+		{TSRangeCFG{Start: "2024-03-01"}, "", "invalid end"},
+		{TSRangeCFG{Start: "2024-04-01", End: "2024-03-01"}, "", "is not after start"},
+		{TSRangeCFG{Start: "2024-03-01", End: "2024-04-01"}, "normal", "unknown ts_distribution"},
+		{TSRangeCFG{Start: "2024-03-02", End: "2024-03-04"}, tsBusinessHours, "no business hours"},
+	} {
+		_, err := newTimestamps(test.cfg, test.distribution, 10, rand.New(rand.NewSource(1)))
+		if (err == nil) || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ts range %+v of %q: %v, expected %s", test.cfg, test.distribution, err, test.err)
+		}
+	}
+}
+
+// TestTimestampsRun checks that control objects get ts within the range.
+func TestTimestampsRun(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	cfg.GeneratorCFG.TSRange = TSRangeCFG{Start: "2024-01-01", End: "2024-02-01"}
+	testRun(t, cfg)
+	days := map[string]bool{}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		if !strings.HasPrefix(row[1], "2024-01-") {
+			t.Fatalf("ts %s is out of January 2024", row[1])
+		}
+		days[row[1][:len("2024-01-01")]] = true
+	}
+	if len(days) < 20 {
+		t.Errorf("100 control objects have ts on %d days of January", len(days))
+	}
+}
@@ -0,0 +1,73 @@
+package generator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/kshvakov/clickhouse"
+	"github.com/pkg/errors"
+)
+
+// tlsConfigName is the name of the TLS configuration registered with the
+// ClickHouse driver.
+const tlsConfigName = "generator"
+
+// TLSCFG configures TLS of connections to storage.
+type TLSCFG struct {
+	Enabled bool `yaml:"enabled"`
+	// Accept any server certificate, for self-signed test servers.
+	SkipVerify bool `yaml:"skip_verify"`
+	// PEM CA certificates to verify the server with instead of system roots.
+	CACert string `yaml:"ca_cert"`
+	// PEM client certificate and key for mutual TLS.
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+}
+
+// config returns TLS configuration of connections to serverName, nil if TLS
+// is disabled.
+func (cfg TLSCFG) config(serverName string) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	c := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: cfg.SkipVerify,
+	}
+	if cfg.CACert != "" {
+		pem, err := ioutil.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read CA certificate")
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in %s", cfg.CACert)
+		}
+	}
+	if (cfg.ClientCert != "") != (cfg.ClientKey != "") {
+		return nil, fmt.Errorf("client certificate and key must be set together")
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load client certificate")
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// registerTLSConfig registers TLS configuration with the ClickHouse driver
+// and returns connection string parameters selecting it.
+func registerTLSConfig(cfg StorageCFG) (string, error) {
+	c, err := cfg.TLS.config(cfg.Addr)
+	if (err != nil) || (c == nil) {
+		return "", err
+	}
+	if err := clickhouse.RegisterTLSConfig(tlsConfigName, c); err != nil {
+		return "", errors.Wrap(err, "unable to register TLS configuration")
+	}
+	return fmt.Sprintf("&tls_config=%s&skip_verify=%v", tlsConfigName, cfg.TLS.SkipVerify), nil
+}
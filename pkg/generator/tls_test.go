@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeClientCert writes a self-signed client certificate and its key as
+// PEM files to dir.
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "generator"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	if err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestTLSConfig(t *testing.T) {
+	_, dir := testConfig(t, 0)
+	certPath, keyPath := writeClientCert(t, dir)
+	if c, err := (TLSCFG{}).config("clickhouse"); (c != nil) || (err != nil) {
+		t.Errorf("disabled TLS has configuration %v, %v", c, err)
+	}
+	c, err := TLSCFG{Enabled: true, SkipVerify: true, CACert: certPath, ClientCert: certPath, ClientKey: keyPath}.
+		config("clickhouse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (c.ServerName != "clickhouse") || !c.InsecureSkipVerify || (c.RootCAs == nil) || (len(c.Certificates) != 1) {
+		t.Errorf("TLS configuration is %+v", c)
+	}
+	for _, cfg := range []TLSCFG{
+		{Enabled: true, CACert: filepath.Join(dir, "missing.pem")},
+		{Enabled: true, CACert: keyPath},
+		{Enabled: true, ClientCert: certPath},
+		{Enabled: true, ClientKey: keyPath},
+		{Enabled: true, ClientCert: keyPath, ClientKey: certPath},
+	} {
+		if _, err := cfg.config("clickhouse"); err == nil {
+			t.Errorf("TLS %+v is valid", cfg)
+		}
+	}
+
+	if params, err := registerTLSConfig(StorageCFG{}); (params != "") || (err != nil) {
+		t.Errorf("connection string parameters without TLS are %q, %v", params, err)
+	}
+	params, err := registerTLSConfig(StorageCFG{Addr: "clickhouse", TLS: TLSCFG{Enabled: true, SkipVerify: true}})
+	if (err != nil) || (params != "&tls_config=generator&skip_verify=true") {
+		t.Errorf("connection string parameters with TLS are %q, %v", params, err)
+	}
+}
+
+// TestTLSHTTP checks that queries over HTTP verify the server with the CA
+// and present the client certificate.
+func TestTLSHTTP(t *testing.T) {
+	_, dir := testConfig(t, 0)
+	certPath, keyPath := writeClientCert(t, dir)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1\n"))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	caPath := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caPath, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		tls TLSCFG
+		ok  bool
+	}{
+		{TLSCFG{Enabled: true, CACert: caPath, ClientCert: certPath, ClientKey: keyPath}, true},
+		{TLSCFG{Enabled: true, SkipVerify: true, ClientCert: certPath, ClientKey: keyPath}, true},
+		{TLSCFG{Enabled: true, ClientCert: certPath, ClientKey: keyPath}, false},
+		{TLSCFG{Enabled: true, CACert: caPath}, false},
+		{TLSCFG{}, false},
+	} {
+		client, err := newClickHouseHTTP(StorageCFG{Addr: u.Hostname(), HTTPPort: port, WriteTimeoutMS: 5000, TLS: c.tls})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Query(context.Background(), "SELECT 1"); (err == nil) != c.ok {
+			t.Errorf("query with TLS %+v returns %v", c.tls, err)
+		}
+	}
+}
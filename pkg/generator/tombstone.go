@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// Ways tombstones are written by the tombstone subcommand.
+const (
+	tombstoneUpdate  = "update"
+	tombstoneReplace = "replace"
+)
+
+// runTombstone soft-deletes a keyed fraction of generated subjects by
+// setting dbts of their control objects at a limited rate, either with
+// ALTER TABLE ... UPDATE mutations or by inserting copies of the rows with
+// dbts set for ReplacingMergeTree to collapse. It reports the cost of
+// reading live rows with and without FINAL afterwards.
+func runTombstone(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("tombstone", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file")
+	fraction := flags.Float64("fraction", 0.01, "fraction of control objects to tombstone")
+	key := flags.String("key", "", "selection key, different keys select different subjects")
+	rate := flags.Float64("rate", 100, "max subjects tombstoned per second, 0 for unlimited")
+	batch := flags.Int("batch", 100, "subjects tombstoned per statement")
+	mode := flags.String("mode", tombstoneUpdate, "update for mutations, replace for ReplacingMergeTree inserts")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+
+	if (*fraction <= 0) || (*fraction > 1) {
+		return fmt.Errorf("fraction must be in (0, 1], got %v", *fraction)
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("batch must be positive, got %d", *batch)
+	}
+	if (*mode != tombstoneUpdate) && (*mode != tombstoneReplace) {
+		return fmt.Errorf("unknown mode \"%s\", supported are %s, %s", *mode, tombstoneUpdate, tombstoneReplace)
+	}
+
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	opts, err := mappedOptions(cfg)
+	if err != nil {
+		return err
+	}
+	cob := opts.cobTable
+	id, err := cob.required("id")
+	if err != nil {
+		return err
+	}
+	dbts, err := cob.required("dbts")
+	if err != nil {
+		return err
+	}
+	db, err := connectClickHouse(cfg.StorageCFG, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", cob.name, dbts, columnTypes["dbts"])
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return errors.Wrapf(err, "unable to add %s column", dbts)
+	}
+	if *mode == tombstoneReplace {
+		engine := ""
+		query := "SELECT engine FROM system.tables WHERE database = currentDatabase() AND name = ?"
+		if err := db.QueryRowContext(ctx, query, cob.name).Scan(&engine); err != nil {
+			return errors.Wrapf(err, "unable to read engine of %s", cob.name)
+		}
+		if !strings.Contains(engine, "ReplacingMergeTree") {
+			return fmt.Errorf("replace mode needs a ReplacingMergeTree %s table, got %s", cob.name, engine)
+		}
+	}
+
+	ids, err := selectSubjects(ctx, db, cob, keyedFractionFilter(id, *key, *fraction)+" AND "+dbts+" IS NULL")
+	if err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+	for from := 0; from < len(ids); from += *batch {
+		to := from + *batch
+		if to > len(ids) {
+			to = len(ids)
+		}
+		batchStart := time.Now()
+		list := "'" + strings.Join(ids[from:to], "', '") + "'"
+		query := fmt.Sprintf("ALTER TABLE %s UPDATE %s = now() WHERE %s IN (%s)", cob.name, dbts, id, list)
+		if *mode == tombstoneReplace {
+			query = fmt.Sprintf("INSERT INTO %s SELECT * REPLACE (now() AS %s) FROM %s WHERE %s IN (%s)",
+				cob.name, dbts, cob.name, id, list)
+		}
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return errors.Wrap(err, "unable to tombstone control objects")
+		}
+		if *rate > 0 {
+			budget := time.Duration(float64(to-from) / *rate * float64(time.Second))
+			if err := sleepContext(ctx, budget-time.Now().Sub(batchStart)); err != nil {
+				return errors.Wrapf(err, "stopped after tombstoning %d subjects", to)
+			}
+		}
+	}
+	fmt.Printf("tombstoned %d subjects via %s in %v\n", len(ids), *mode, time.Now().Sub(startTime))
+
+	for _, final := range []string{"", " FINAL"} {
+		live, elapsed, err := countLiveSubjects(ctx, db, cob, final)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("live subjects%s: %d, read in %v\n", final, live, elapsed)
+	}
+	return nil
+}
+
+// countLiveSubjects counts control objects without dbts, with final being
+// empty or " FINAL".
+func countLiveSubjects(ctx context.Context, db *sql.DB, cob *tableMapping, final string) (uint64, time.Duration, error) {
+	startTime := time.Now()
+	live := uint64(0)
+	query := fmt.Sprintf("SELECT count() FROM %s%s WHERE %s IS NULL", cob.name, final, cob.column("dbts"))
+	if err := db.QueryRowContext(ctx, query).Scan(&live); err != nil {
+		return 0, 0, errors.Wrap(err, "unable to count live subjects")
+	}
+	return live, time.Now().Sub(startTime), nil
+}
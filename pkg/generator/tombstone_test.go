@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tombstoneServer answers queries of the tombstone subcommand with selected
+// subjects ids and a control_objects table of engine, and records other
+// statements.
+func tombstoneServer(t *testing.T, ids []string, engine string) (*fakeNative, func() []string) {
+	server := newFakeNative(t, newFakeBackend(), nil)
+	mu := sync.Mutex{}
+	var statements []string
+	server.answer = func(query string) (nativeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasPrefix(query, "SELECT engine"):
+			return nativeResult{names: []string{"engine"}, types: []string{"String"},
+				rows: [][]interface{}{{engine}}}, nil
+		case strings.HasPrefix(query, "SELECT toString(id)"):
+			filter := keyedFractionFilter("id", "gdpr", 0.5) + " AND dbts IS NULL"
+			if query != "SELECT toString(id) FROM control_objects WHERE "+filter {
+				return nativeResult{}, fmt.Errorf("unexpected query %s", query)
+			}
+			rows := [][]interface{}{}
+			for _, id := range ids {
+				rows = append(rows, []interface{}{id})
+			}
+			return nativeResult{names: []string{"id"}, types: []string{"String"}, rows: rows}, nil
+		case strings.HasPrefix(query, "SELECT count()"):
+			return nativeResult{names: []string{"count()"}, types: []string{"UInt64"},
+				rows: [][]interface{}{{uint64(7)}}}, nil
+		}
+		statements = append(statements, query)
+		return nativeResult{}, nil
+	}
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), statements...)
+	}
+}
+
+// TestTombstone checks that selected subjects get dbts in batches at the
+// rate, by mutations or by inserts of copies.
+func TestTombstone(t *testing.T) {
+	for _, c := range []struct {
+		mode      string
+		tombstone func(list string) string
+	}{
+		{tombstoneUpdate, func(list string) string {
+			return "ALTER TABLE control_objects UPDATE dbts = now() WHERE id IN (" + list + ")"
+		}},
+		{tombstoneReplace, func(list string) string {
+			return "INSERT INTO control_objects SELECT * REPLACE (now() AS dbts) FROM control_objects WHERE id IN (" +
+				list + ")"
+		}},
+	} {
+		server, statements := tombstoneServer(t, []string{"a", "b", "c", "d", "e"}, "ReplacingMergeTree")
+		startTime := time.Now()
+		var err error
+		output := captureStdout(t, func() {
+			err = runTombstone(context.Background(), []string{"-config", "../../config.yaml",
+				"-storage.port", fmt.Sprint(server.port()), "-storage.max_pings", "1",
+				"-fraction", "0.5", "-key", "gdpr", "-batch", "2", "-rate", "200", "-mode", c.mode})
+		})
+		server.close()
+		if err != nil {
+			t.Fatalf("%s: %v", c.mode, err)
+		}
+		if elapsed := time.Now().Sub(startTime); elapsed < 20*time.Millisecond {
+			t.Errorf("%s: 5 subjects are tombstoned at 200 per second in %v", c.mode, elapsed)
+		}
+		expected := []string{"ALTER TABLE control_objects ADD COLUMN IF NOT EXISTS dbts " + columnTypes["dbts"]}
+		for _, list := range []string{"'a', 'b'", "'c', 'd'", "'e'"} {
+			expected = append(expected, c.tombstone(list))
+		}
+		if got := statements(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: tombstoned with %q, expected %q", c.mode, got, expected)
+		}
+		for _, line := range []string{"tombstoned 5 subjects via " + c.mode, "live subjects: 7", "live subjects FINAL: 7"} {
+			if !strings.Contains(output, line) {
+				t.Errorf("%s: output has no %q:\n%s", c.mode, line, output)
+			}
+		}
+	}
+
+	// Copies of rows collapse in ReplacingMergeTree tables only.
+	server, statements := tombstoneServer(t, []string{"a"}, "MergeTree")
+	defer server.close()
+	err := runTombstone(context.Background(), []string{"-config", "../../config.yaml",
+		"-storage.port", fmt.Sprint(server.port()), "-storage.max_pings", "1",
+		"-fraction", "0.5", "-key", "gdpr", "-mode", tombstoneReplace})
+	if (err == nil) || !strings.Contains(err.Error(), "needs a ReplacingMergeTree control_objects table") {
+		t.Errorf("replace mode of a MergeTree table returns %v", err)
+	}
+	if got := statements(); len(got) != 1 {
+		t.Errorf("replace mode of a MergeTree table runs %q", got)
+	}
+
+	for _, args := range [][]string{{"-fraction", "0"}, {"-fraction", "2"}, {"-batch", "0"}, {"-mode", "delete"}} {
+		if err := runTombstone(context.Background(), args); err == nil {
+			t.Errorf("tombstone with %v succeeds", args)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Write modes of control objects.
+const (
+	writeModeInsert = "insert"
+	writeModeUpsert = "upsert"
+)
+
+const versionColumn = "version"
+
+// Identities of a worker re-emitted by upserts.
+const upsertPoolSize = 1024
+
+// UpsertCFG configures versioned control objects for ReplacingMergeTree.
+// In upsert mode every generated person is followed, at the given rate, by
+// a new version of an earlier person of the same worker with changed
+// fields and the timestamp of the current row.
+type UpsertCFG struct {
+	// Adds the version column, implied by upsert mode.
+	Versioned bool `yaml:"versioned"`
+	// insert or upsert, insert by default.
+	Mode string  `yaml:"mode"`
+	Rate float64 `yaml:"rate"`
+	// Columns taken from the current person, phone_num, email and address
+	// by default.
+	Fields     []string `yaml:"fields"`
+	LabelsPath string   `yaml:"labels_path"`
+}
+
+// upsertFields copy changeable columns between control objects.
+var upsertFields = map[string]func(dst *controlObject, src controlObject){
+	"surname":         func(dst *controlObject, src controlObject) { dst.surname = src.surname },
+	"name":            func(dst *controlObject, src controlObject) { dst.name = src.name },
+	"patronymic":      func(dst *controlObject, src controlObject) { dst.patronymic = src.patronymic },
+	"phone_num":       func(dst *controlObject, src controlObject) { dst.phoneNum = src.phoneNum },
+	"email":           func(dst *controlObject, src controlObject) { dst.email = src.email },
+	"address":         func(dst *controlObject, src controlObject) { dst.address = src.address },
+	"consent_status":  func(dst *controlObject, src controlObject) { dst.consentStatus = src.consentStatus },
+	"legal_basis":     func(dst *controlObject, src controlObject) { dst.legalBasis = src.legalBasis },
+	"retention_class": func(dst *controlObject, src controlObject) { dst.retentionClass = src.retentionClass },
+	"organization":    func(dst *controlObject, src controlObject) { dst.organization = src.organization },
+	"occupation":      func(dst *controlObject, src controlObject) { dst.occupation = src.occupation },
+}
+
+func (cfg UpsertCFG) validate() error {
+	if (cfg.Mode != "") && (cfg.Mode != writeModeInsert) && (cfg.Mode != writeModeUpsert) {
+		return fmt.Errorf("unknown mode \"%s\", supported are %s, %s", cfg.Mode, writeModeInsert, writeModeUpsert)
+	}
+	if (cfg.Rate < 0) || (cfg.Rate > 1) {
+		return fmt.Errorf("rate must be in [0, 1], got %v", cfg.Rate)
+	}
+	if cfg.upsert() && (cfg.Rate == 0) {
+		return fmt.Errorf("upsert mode needs a positive rate")
+	}
+	for _, field := range cfg.Fields {
+		if _, ok := upsertFields[field]; !ok {
+			supported := []string{}
+			for f := range upsertFields {
+				supported = append(supported, f)
+			}
+			sort.Strings(supported)
+			return fmt.Errorf("unknown field \"%s\", supported are %s", field, strings.Join(supported, ", "))
+		}
+	}
+	return nil
+}
+
+func (cfg UpsertCFG) upsert() bool {
+	return cfg.Mode == writeModeUpsert
+}
+
+func (cfg UpsertCFG) versioned() bool {
+	return cfg.Versioned || cfg.upsert()
+}
+
+func (cfg UpsertCFG) fields() []string {
+	if len(cfg.Fields) == 0 {
+		return []string{"phone_num", "email", "address"}
+	}
+	return cfg.Fields
+}
+
+// upsertPool holds the latest versions of recent persons of one worker.
+type upsertPool struct {
+	cfg    UpsertCFG
+	recent []controlObject
+}
+
+func newUpsertPool(cfg UpsertCFG) *upsertPool {
+	if !cfg.upsert() {
+		return nil
+	}
+	return &upsertPool{cfg: cfg}
+}
+
+// add makes a new person a candidate of upserts, replacing a random one
+// when the pool is full.
+func (p *upsertPool) add(rnd *rand.Rand, cob controlObject) {
+	if p == nil {
+		return
+	}
+	if len(p.recent) < upsertPoolSize {
+		p.recent = append(p.recent, cob)
+		return
+	}
+	p.recent[rnd.Intn(len(p.recent))] = cob
+}
+
+// next returns, at the configured rate, the next version of a recent person
+// with fields of current.
+func (p *upsertPool) next(rnd *rand.Rand, current controlObject) (controlObject, bool) {
+	if (p == nil) || (len(p.recent) == 0) || (rnd.Float64() >= p.cfg.Rate) {
+		return controlObject{}, false
+	}
+	i := rnd.Intn(len(p.recent))
+	cob := p.recent[i]
+	for _, field := range p.cfg.fields() {
+		upsertFields[field](&cob, current)
+	}
+	cob.ts = current.ts
+	cob.version++
+	p.recent[i] = cob
+	return cob, true
+}
@@ -0,0 +1,130 @@
+package generator
+
+import (
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestUpsertPool(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	if p := newUpsertPool(UpsertCFG{Versioned: true, Rate: 1}); p != nil {
+		t.Error("insert mode has an upsert pool")
+	}
+	p := newUpsertPool(UpsertCFG{Mode: writeModeUpsert, Rate: 1})
+	if _, ok := p.next(rnd, controlObject{}); ok {
+		t.Error("empty pool upserts")
+	}
+	earlier := controlObject{id: "a", passport: "1234 567890", surname: "Ivanov", phoneNum: "1", email: "a@example.com",
+		address: "Moscow", version: 1, ts: time.Unix(1, 0)}
+	p.add(rnd, earlier)
+	current := controlObject{id: "b", passport: "4321 098765", surname: "Petrov", phoneNum: "2", email: "b@example.com",
+		address: "Kazan", version: 1, ts: time.Unix(2, 0)}
+	for version := uint64(2); version <= 3; version++ {
+		upsert, ok := p.next(rnd, current)
+		if !ok {
+			t.Fatal("pool with rate 1 does not upsert")
+		}
+		expected := earlier
+		expected.phoneNum, expected.email, expected.address = current.phoneNum, current.email, current.address
+		expected.ts, expected.version = current.ts, version
+		if !reflect.DeepEqual(upsert, expected) {
+			t.Errorf("upsert is %+v, expected %+v", upsert, expected)
+		}
+	}
+
+	// Full pools replace candidates.
+	for i := 0; i < 2*upsertPoolSize; i++ {
+		p.add(rnd, controlObject{id: strconv.Itoa(i)})
+	}
+	if len(p.recent) != upsertPoolSize {
+		t.Errorf("pool holds %d persons, expected %d", len(p.recent), upsertPoolSize)
+	}
+
+	p = newUpsertPool(UpsertCFG{Mode: writeModeUpsert, Rate: 0.25, Fields: []string{"surname"}})
+	p.add(rnd, earlier)
+	upserts := 0
+	for i := 0; i < 1000; i++ {
+		if upsert, ok := p.next(rnd, current); ok {
+			upserts++
+			if (upsert.surname != current.surname) || (upsert.phoneNum != earlier.phoneNum) {
+				t.Fatalf("upsert of surname is %+v", upsert)
+			}
+		}
+	}
+	if (upserts < 200) || (upserts > 300) {
+		t.Errorf("%d of 1000 persons are upserted at rate 0.25", upserts)
+	}
+}
+
+func TestUpsertInvalid(t *testing.T) {
+	for _, cfg := range []UpsertCFG{
+		{Mode: "merge"},
+		{Mode: writeModeUpsert},
+		{Mode: writeModeUpsert, Rate: 1.5},
+		{Rate: -1},
+		{Mode: writeModeUpsert, Rate: 0.5, Fields: []string{"passport"}},
+	} {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("upsert %+v is valid", cfg)
+		}
+	}
+	if cfg := (UpsertCFG{Mode: writeModeUpsert}); !cfg.versioned() {
+		t.Error("upsert mode is not versioned")
+	}
+}
+
+// TestUpsertRun checks that upsert runs follow persons with new versions of
+// earlier persons, labelled, without counting them as pairs.
+func TestUpsertRun(t *testing.T) {
+	cfg, dir := testConfig(t, 200)
+	cfg.GeneratorCFG.Upsert = UpsertCFG{Mode: writeModeUpsert, Rate: 0.2, LabelsPath: filepath.Join(dir, "upserts.tsv")}
+	if inserted := testRun(t, cfg); inserted != 200 {
+		t.Errorf("upsert run inserts %d pairs, expected 200", inserted)
+	}
+	rows := readTSV(t, filepath.Join(dir, "control_objects.0001.tsv"))
+	versions := map[string]uint64{}
+	upserted := map[string]bool{}
+	for _, row := range rows {
+		if len(row) != len(controlObjectsColumns)+1 {
+			t.Fatalf("control object has %d columns, expected %d with version", len(row), len(controlObjectsColumns)+1)
+		}
+		version, err := strconv.ParseUint(row[len(row)-1], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := row[0]
+		if version != versions[id]+1 {
+			t.Errorf("control object %s has version %d after %d", id, version, versions[id])
+		}
+		if version > 1 {
+			upserted[id+"/"+row[len(row)-1]] = true
+		}
+		versions[id] = version
+	}
+	if (len(versions) != 200) || (len(upserted) < 20) || (len(upserted) > 60) {
+		t.Errorf("%d persons have %d upserts, expected 200 with about 40", len(versions), len(upserted))
+	}
+	labels := readLabels(t, cfg.GeneratorCFG.Upsert.LabelsPath)
+	if len(labels) != len(upserted) {
+		t.Errorf("%d upserts are labelled, expected %d", len(labels), len(upserted))
+	}
+	for _, label := range labels {
+		if !upserted[label[0]+"/"+label[1]] || (label[2] != "phone_num,email,address") {
+			t.Errorf("label %q is not an upsert", label)
+		}
+	}
+
+	// Versioned inserts start at version 1.
+	cfg, dir = testConfig(t, 10)
+	cfg.GeneratorCFG.Upsert = UpsertCFG{Versioned: true}
+	testRun(t, cfg)
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		if row[len(row)-1] != "1" {
+			t.Errorf("versioned insert has version %s", row[len(row)-1])
+		}
+	}
+}
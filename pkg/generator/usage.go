@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+type resourceUsage struct {
+	userCPU    time.Duration
+	sysCPU     time.Duration
+	maxRSSKB   int64
+	numGC      uint32
+	gcPause    time.Duration
+	totalAlloc uint64
+	// Estimated Native format size of generated rows, not network bytes.
+	payloadBytes int
+}
+
+func readResourceUsage() resourceUsage {
+	usage := resourceUsage{}
+	usage.userCPU, usage.sysCPU, usage.maxRSSKB = readCPUUsage()
+
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+	usage.numGC = memStats.NumGC
+	usage.gcPause = time.Duration(memStats.PauseTotalNs)
+	usage.totalAlloc = memStats.TotalAlloc
+
+	return usage
+}
+
+func (u resourceUsage) String() string {
+	return fmt.Sprintf("cpu %v (user %v, sys %v), peak RSS %d KiB, estimated row payload %d bytes, %d GC cycles (pause %v, allocated %d bytes)",
+		u.userCPU+u.sysCPU, u.userCPU, u.sysCPU, u.maxRSSKB, u.payloadBytes, u.numGC, u.gcPause, u.totalAlloc)
+}
+
+// Sizes below follow ClickHouse Native format: UUID is 16 bytes, DateTime
+// is 4 bytes, String is a varint length prefix plus data and every Array
+// row carries an 8 bytes offset.
+
+func stringPayloadSize(s string) int {
+	size := 1
+	for l := len(s); l >= 0x80; l >>= 7 {
+		size++
+	}
+	return size + len(s)
+}
+
+func controlObjectsPayloadSize(cobs []controlObject) int {
+	size := 0
+	for _, cob := range cobs {
+		size += 16 + 4
+		for _, s := range []string{
+			cob.passport, cob.surname, cob.name, cob.patronymic,
+			cob.sex, cob.birthDate, cob.phoneNum, cob.email, cob.address,
+		} {
+			size += stringPayloadSize(s)
+		}
+		if cob.naturalKey != "" {
+			size += stringPayloadSize(cob.naturalKey)
+		}
+		if cob.consentStatus != "" {
+			size += stringPayloadSize(cob.consentStatus) + stringPayloadSize(cob.legalBasis) + stringPayloadSize(cob.retentionClass)
+		}
+		if cob.organization != "" {
+			size += stringPayloadSize(cob.organization) + stringPayloadSize(cob.occupation)
+		}
+		if cob.version != 0 {
+			size += 8
+		}
+		if cob.attrKeys != nil {
+			size += 2 * 8
+			for i := range cob.attrKeys {
+				size += stringPayloadSize(cob.attrKeys[i]) + stringPayloadSize(cob.attrValues[i])
+			}
+		}
+	}
+	return size
+}
+
+func ffvsPayloadSize(ffvs []ffv) int {
+	size := 0
+	for _, ffv := range ffvs {
+		size += 3*16 + 8 + 8*len(ffv.faceBox) + 8 + 8*len(ffv.facialFeaturesVector)
+		if !ffv.ingestTS.IsZero() {
+			size += 2 * 4
+		}
+	}
+	return size
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package generator
+
+import "time"
+
+// readCPUUsage is not available without getrusage, CPU time and peak RSS
+// are reported as zero.
+func readCPUUsage() (time.Duration, time.Duration, int64) {
+	return 0, 0, 0
+}
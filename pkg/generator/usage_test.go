@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPayloadSize(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		size int
+	}{
+		{"", 1},
+		{"abc", 4},
+		{strings.Repeat("a", 127), 128},
+		{strings.Repeat("a", 128), 130},
+		{strings.Repeat("a", 1<<14), 3 + 1<<14},
+	} {
+		if size := stringPayloadSize(test.s); size != test.size {
+			t.Errorf("string of %d bytes has payload %d, expected %d", len(test.s), size, test.size)
+		}
+	}
+
+	cobs, ffvs := testBatches(1)
+	// UUID and DateTime, then passport, names, sex, birth date and three
+	// empty strings.
+	expected := 16 + 4 + 13 + 7 + 5 + 10 + 2 + 11 + 3
+	if size := controlObjectsPayloadSize(cobs); size != expected {
+		t.Errorf("control object has payload %d, expected %d", size, expected)
+	}
+	cobs[0].version = 1
+	if size := controlObjectsPayloadSize(cobs); size != expected+8 {
+		t.Errorf("versioned control object has payload %d, expected %d", size, expected+8)
+	}
+	// Three UUIDs, face box and vector arrays of 4 elements.
+	if size := ffvsPayloadSize(ffvs); size != 3*16+8+4*8+8+4*8 {
+		t.Errorf("FFV has payload %d", size)
+	}
+}
+
+// TestRunPayload checks that the payload of a run is the payload of rows
+// written.
+func TestRunPayload(t *testing.T) {
+	cfg, _ := testConfig(t, 30)
+	cfg.GeneratorCFG.Workers = 3
+	g, err := newGeneration(cfg, cfg.GeneratorCFG.Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.metrics, err = newStageMetrics(""); err != nil {
+		t.Fatal(err)
+	}
+	g.log = &logger{quiet: true}
+	mu := sync.Mutex{}
+	expected := 0
+	g.writeControlObjects = func(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+		mu.Lock()
+		defer mu.Unlock()
+		expected += controlObjectsPayloadSize(cobs)
+		return nil
+	}
+	g.writeFFVs = func(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+		mu.Lock()
+		defer mu.Unlock()
+		expected += ffvsPayloadSize(ffvs)
+		return nil
+	}
+	bytesSent, _, err := g.runWorkers(context.Background(), splitRows(3, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (bytesSent == 0) || (bytesSent != expected) {
+		t.Errorf("run reported %d payload bytes, rows written have %d", bytesSent, expected)
+	}
+}
+
+func TestResourceUsage(t *testing.T) {
+	before := readResourceUsage()
+	garbage := [][]byte{}
+	for i := 0; i < 1000; i++ {
+		garbage = append(garbage, make([]byte, 1<<10))
+	}
+	runtime.GC()
+	after := readResourceUsage()
+	if (after.totalAlloc-before.totalAlloc < 1000<<10) || (after.numGC <= before.numGC) {
+		t.Errorf("allocated %d bytes in %d GC cycles", after.totalAlloc-before.totalAlloc, after.numGC-before.numGC)
+	}
+	if (runtime.GOOS == "linux") && ((after.maxRSSKB == 0) || (after.userCPU+after.sysCPU == 0)) {
+		t.Errorf("no CPU time or peak RSS on Linux: %v", after)
+	}
+	if s := after.String(); !strings.Contains(s, "estimated row payload") || strings.Contains(s, "bytes sent") {
+		t.Errorf("usage is printed as %s", s)
+	}
+	_ = garbage
+}
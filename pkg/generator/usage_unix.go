@@ -0,0 +1,24 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package generator
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// readCPUUsage returns user and system CPU time and peak RSS of the process.
+func readCPUUsage() (time.Duration, time.Duration, int64) {
+	rusage := syscall.Rusage{}
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage); err != nil {
+		return 0, 0, 0
+	}
+	maxRSSKB := int64(rusage.Maxrss)
+	// Bytes on macOS, kilobytes elsewhere.
+	if runtime.GOOS == "darwin" {
+		maxRSSKB /= 1024
+	}
+	return time.Duration(rusage.Utime.Nano()), time.Duration(rusage.Stime.Nano()), maxRSSKB
+}
@@ -0,0 +1,106 @@
+package generator
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+
+	"github.com/kshvakov/clickhouse"
+)
+
+// Columns of reduced FFV variants.
+const (
+	pcaColumn  = "ff_pca"
+	hashColumn = "ff_hash"
+)
+
+// FFVVariantsCFG adds reduced variants of every FFV to the same row, so
+// multi-resolution search can be compared on identical identities.
+type FFVVariantsCFG struct {
+	// Dimensions of the ff_pca projection, 0 to disable.
+	PCADim int `yaml:"pca_dim"`
+	// Bits of the ff_hash sign random projection hash, a multiple of 8, 0
+	// to disable.
+	HashBits int `yaml:"hash_bits"`
+}
+
+// ffvVariants projects FFVs onto principal components and random
+// hyperplanes.
+type ffvVariants struct {
+	pca        [][]float64
+	hyperplane [][]float64
+}
+
+// newFFVVariants returns nil if no variant is enabled. Principal components
+// are the low-rank basis of vectors, if any, completed with random
+// orthonormal directions, since the remaining variance is isotropic.
+func newFFVVariants(cfg FFVVariantsCFG, vectors *ffvGenerator, rnd *rand.Rand) (*ffvVariants, error) {
+	if (cfg.PCADim == 0) && (cfg.HashBits == 0) {
+		return nil, nil
+	}
+	if (cfg.PCADim < 0) || (cfg.PCADim > vectors.dim) {
+		return nil, fmt.Errorf("PCA dimensions must be in [0, %d], got %d", vectors.dim, cfg.PCADim)
+	}
+	if (cfg.HashBits < 0) || (cfg.HashBits%8 != 0) {
+		return nil, fmt.Errorf("hash bits must be a non-negative multiple of 8, got %d", cfg.HashBits)
+	}
+	v := &ffvVariants{}
+	for i := 0; i < cfg.PCADim; i++ {
+		if (vectors.lowRank != nil) && (i < len(vectors.lowRank.basis)) {
+			v.pca = append(v.pca, vectors.lowRank.basis[i])
+		} else {
+			v.pca = append(v.pca, randomOrthonormal(rnd, v.pca, vectors.dim))
+		}
+	}
+	for i := 0; i < cfg.HashBits; i++ {
+		hyperplane := make([]float64, vectors.dim)
+		for j := range hyperplane {
+			hyperplane[j] = rnd.NormFloat64()
+		}
+		v.hyperplane = append(v.hyperplane, hyperplane)
+	}
+	return v, nil
+}
+
+func (v *ffvVariants) columns() []string {
+	columns := []string{}
+	if len(v.pca) > 0 {
+		columns = append(columns, pcaColumn)
+	}
+	if len(v.hyperplane) > 0 {
+		columns = append(columns, hashColumn)
+	}
+	return columns
+}
+
+// values returns values of variant columns of an FFV. The hash is hex
+// encoded, with bit i set when the FFV is on the positive side of
+// hyperplane i.
+func (v *ffvVariants) values(ffv []float64) []interface{} {
+	values := []interface{}{}
+	if len(v.pca) > 0 {
+		projection := make([]float64, len(v.pca))
+		for i, component := range v.pca {
+			projection[i] = dot(component, ffv)
+		}
+		values = append(values, clickhouse.Array(projection))
+	}
+	if len(v.hyperplane) > 0 {
+		hash := make([]byte, len(v.hyperplane)/8)
+		for i, hyperplane := range v.hyperplane {
+			if dot(hyperplane, ffv) > 0 {
+				hash[i/8] |= 1 << uint(7-i%8)
+			}
+		}
+		values = append(values, hex.EncodeToString(hash))
+	}
+	return values
+}
+
+func dot(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
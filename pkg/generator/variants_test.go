@@ -0,0 +1,141 @@
+package generator
+
+import (
+	"encoding/hex"
+	"math"
+	"math/bits"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// hammingDistance returns the number of differing bits of hex hashes.
+func hammingDistance(t *testing.T, a, b string) int {
+	x, err := hex.DecodeString(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := hex.DecodeString(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := 0
+	for i := range x {
+		d += bits.OnesCount8(x[i] ^ y[i])
+	}
+	return d
+}
+
+func TestFFVVariants(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	vectors, err := newFFVGenerator(FFVCFG{Dim: 16}, FFVStructureCFG{Components: 2, TopVariance: 4, Decay: 0.5, Noise: 0.1}, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := newFFVVariants(FFVVariantsCFG{PCADim: 4, HashBits: 16}, vectors, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns := v.columns(); (len(columns) != 2) || (columns[0] != pcaColumn) || (columns[1] != hashColumn) {
+		t.Fatalf("variant columns are %v", columns)
+	}
+	// Principal components start with the low-rank basis and are
+	// orthonormal.
+	for i := range vectors.lowRank.basis {
+		if &v.pca[i][0] != &vectors.lowRank.basis[i][0] {
+			t.Errorf("principal component %d is not the low-rank basis", i)
+		}
+	}
+	for i := range v.pca {
+		for j := range v.pca {
+			expected := 0.0
+			if i == j {
+				expected = 1
+			}
+			if d := dot(v.pca[i], v.pca[j]); math.Abs(d-expected) > 1e-9 {
+				t.Errorf("principal components %d and %d have dot product %v", i, j, d)
+			}
+		}
+	}
+
+	ffv := vectors.generate(rnd)
+	values := v.values(ffv)
+	projection, ok := values[0].([]float64)
+	if !ok {
+		t.Fatalf("PCA projection is %T", values[0])
+	}
+	if (len(projection) != 4) || (projection[0] != dot(v.pca[0], ffv)) {
+		t.Errorf("PCA projection is %v", projection)
+	}
+	hash := values[1].(string)
+	if len(hash) != 4 {
+		t.Errorf("hash of 16 bits is %q", hash)
+	}
+	opposite := make([]float64, len(ffv))
+	for i := range ffv {
+		opposite[i] = -ffv[i]
+	}
+	if d := hammingDistance(t, hash, v.values(opposite)[1].(string)); d != 16 {
+		t.Errorf("hashes of opposite vectors differ in %d of 16 bits", d)
+	}
+
+	// Hashes of near vectors are closer than hashes of unrelated ones.
+	near, far := 0, 0
+	for i := 0; i < 200; i++ {
+		a, b := vectors.generate(rnd), vectors.generate(rnd)
+		noisy := make([]float64, len(a))
+		for j := range a {
+			noisy[j] = a[j] + rnd.NormFloat64()*0.01
+		}
+		hash := v.values(a)[1].(string)
+		near += hammingDistance(t, hash, v.values(noisy)[1].(string))
+		far += hammingDistance(t, hash, v.values(b)[1].(string))
+	}
+	if (float64(near)/200 > 1) || (float64(far)/200 < 5) {
+		t.Errorf("hashes of near vectors differ in %v bits, of unrelated ones in %v", float64(near)/200, float64(far)/200)
+	}
+}
+
+func TestFFVVariantsInvalid(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	vectors, err := newFFVGenerator(FFVCFG{Dim: 16}, FFVStructureCFG{}, rnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := newFFVVariants(FFVVariantsCFG{}, vectors, rnd); (v != nil) || (err != nil) {
+		t.Errorf("disabled variants are %v, %v", v, err)
+	}
+	for _, cfg := range []FFVVariantsCFG{{PCADim: 17}, {PCADim: -1}, {HashBits: 12}, {HashBits: -8}} {
+		if _, err := newFFVVariants(cfg, vectors, rnd); err == nil {
+			t.Errorf("variants %+v are valid", cfg)
+		}
+	}
+	if v, err := newFFVVariants(FFVVariantsCFG{HashBits: 8}, vectors, rnd); (err != nil) || (len(v.columns()) != 1) ||
+		(v.columns()[0] != hashColumn) {
+		t.Errorf("variants with hashes only have columns %v, %v", v, err)
+	}
+}
+
+// TestFFVVariantsRun checks that rows of FFVs get their variants.
+func TestFFVVariantsRun(t *testing.T) {
+	cfg, dir := testConfig(t, 10)
+	cfg.GeneratorCFG.FFVVariants = FFVVariantsCFG{PCADim: 8, HashBits: 64}
+	testRun(t, cfg)
+	rows := readTSV(t, filepath.Join(dir, "facial_features.0001.tsv"))
+	if len(rows) == 0 {
+		t.Fatal("run writes no FFVs")
+	}
+	for _, row := range rows {
+		if len(row) != len(ffvsColumns)+2 {
+			t.Fatalf("FFV has %d columns, expected %d with variants", len(row), len(ffvsColumns)+2)
+		}
+		ff, projection := parseTSVVector(t, row[4]), parseTSVVector(t, row[5])
+		// Projections onto orthonormal components are not longer than FFVs.
+		if (len(projection) != 8) || (norm(projection) > norm(ff)+1e-9) {
+			t.Errorf("PCA projection of an FFV of norm %v is %v", norm(ff), projection)
+		}
+		if hash := row[6]; len(hash) != 16 {
+			t.Errorf("hash of 64 bits is %q", hash)
+		}
+	}
+}
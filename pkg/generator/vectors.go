@@ -0,0 +1,241 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nofacedb/generator/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// Anomalies of stored FFVs.
+const (
+	vectorDimension = "dimension"
+	vectorNonFinite = "non_finite"
+	vectorZero      = "zero"
+	vectorNorm      = "norm"
+)
+
+var vectorAnomalies = []string{vectorDimension, vectorNonFinite, vectorZero, vectorNorm}
+
+// VectorCheckCFG configures a check of sampled stored FFVs against the
+// configured shape after the run, guarding against float arrays corrupted
+// on the way to the table. Planted outliers are reported as anomalies too.
+type VectorCheckCFG struct {
+	Enabled bool `yaml:"enabled"`
+	// Fraction of FFVs scanned, all by default.
+	Fraction float64 `yaml:"fraction"`
+	// Allowed deviation of norms from 1 with ffv.normalize, 1e-6 by default.
+	Tolerance float64 `yaml:"tolerance"`
+}
+
+type vectorAnomaly struct {
+	id   string
+	kind string
+	dim  uint64
+	norm float64
+}
+
+type vectorReport struct {
+	scanned   int
+	anomalies []vectorAnomaly
+}
+
+func (r vectorReport) String() string {
+	counts := map[string]int{}
+	for _, a := range r.anomalies {
+		counts[a.kind]++
+	}
+	parts := make([]string, len(vectorAnomalies))
+	for i, kind := range vectorAnomalies {
+		parts[i] = fmt.Sprintf("%s %d", kind, counts[kind])
+	}
+	return fmt.Sprintf("scanned %d FFVs, anomalies: %s", r.scanned, strings.Join(parts, ", "))
+}
+
+// checkVectors scans a keyed fraction of stored FFVs for wrong dimension,
+// NaN or infinite components, zero norms and, with normalization, norms
+// other than 1. ffv names the table and its columns.
+func checkVectors(ctx context.Context, db *sql.DB, cfg *Config, ffv *tableMapping, key string) (vectorReport, error) {
+	id, err := ffv.required("id")
+	if err != nil {
+		return vectorReport{}, err
+	}
+	ff, err := ffv.required("ff")
+	if err != nil {
+		return vectorReport{}, err
+	}
+	check := cfg.GeneratorCFG.VectorCheck
+	fraction, tolerance := check.Fraction, check.Tolerance
+	if fraction <= 0 {
+		fraction = 1
+	}
+	if tolerance <= 0 {
+		tolerance = 1e-6
+	}
+	dim := uint64(cfg.GeneratorCFG.FFV.Dim)
+	if dim == 0 {
+		dim = defaultFFVDim
+	}
+
+	query := fmt.Sprintf(`SELECT toString(%[1]s), length(%[2]s), arrayExists(x -> isNaN(x) OR isInfinite(x), %[2]s),
+    sqrt(arraySum(x -> x * x, %[2]s)) FROM %[3]s WHERE %[4]s`, id, ff, ffv.name, keyedFractionFilter(id, key, fraction))
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return vectorReport{}, errors.Wrap(err, "unable to scan facial features vectors")
+	}
+	defer rows.Close()
+	report := vectorReport{}
+	for rows.Next() {
+		a := vectorAnomaly{}
+		var nonFinite uint8
+		if err := rows.Scan(&a.id, &a.dim, &nonFinite, &a.norm); err != nil {
+			return report, errors.Wrap(err, "unable to read facial features vectors")
+		}
+		report.scanned++
+		switch {
+		case a.dim != dim:
+			a.kind = vectorDimension
+		case nonFinite != 0:
+			a.kind = vectorNonFinite
+		case a.norm == 0:
+			a.kind = vectorZero
+		case cfg.GeneratorCFG.FFV.Normalize && (math.Abs(a.norm-1) > tolerance):
+			a.kind = vectorNorm
+		default:
+			continue
+		}
+		report.anomalies = append(report.anomalies, a)
+	}
+	return report, errors.Wrap(rows.Err(), "unable to read facial features vectors")
+}
+
+// plantedOutliers splits anomalies into those to repair and planted
+// outliers, whose IDs are labelled in planted and which stay as generated.
+func plantedOutliers(anomalies []vectorAnomaly, planted map[string]bool) ([]vectorAnomaly, []vectorAnomaly) {
+	repair, kept := []vectorAnomaly{}, []vectorAnomaly{}
+	for _, a := range anomalies {
+		if planted[a.id] {
+			kept = append(kept, a)
+		} else {
+			repair = append(repair, a)
+		}
+	}
+	return repair, kept
+}
+
+// repairVectors renormalizes FFVs with wrong norms and deletes FFVs that
+// can not be repaired. ffv names the table and its columns, checked by
+// checkVectors.
+func repairVectors(ctx context.Context, db *sql.DB, ffv *tableMapping, anomalies []vectorAnomaly, batch int) (int, error) {
+	id, ff := ffv.column("id"), ffv.column("ff")
+	renormalize, remove := []string{}, []string{}
+	for _, a := range anomalies {
+		if a.kind == vectorNorm {
+			renormalize = append(renormalize, a.id)
+		} else {
+			remove = append(remove, a.id)
+		}
+	}
+	mutations := 0
+	for _, m := range []struct {
+		ids    []string
+		action string
+	}{
+		{renormalize, fmt.Sprintf("UPDATE %[1]s = arrayMap(x -> x / sqrt(arraySum(y -> y * y, %[1]s)), %[1]s)", ff)},
+		{remove, "DELETE"},
+	} {
+		for from := 0; from < len(m.ids); from += batch {
+			to := from + batch
+			if to > len(m.ids) {
+				to = len(m.ids)
+			}
+			list := "'" + strings.Join(m.ids[from:to], "', '") + "'"
+			query := fmt.Sprintf("ALTER TABLE %s %s WHERE %s IN (%s)", ffv.name, m.action, id, list)
+			if _, err := db.ExecContext(ctx, query); err != nil {
+				return mutations, errors.Wrap(err, "unable to repair facial features vectors")
+			}
+			mutations++
+		}
+	}
+	return mutations, nil
+}
+
+func runCheckVectors(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("check-vectors", flag.ExitOnError)
+	configPath := flags.String("config", "", "path to YAML configuration file")
+	key := flags.String("key", "", "sampling key, different keys select different FFVs")
+	flagged := flags.String("flagged", "", "write anomalous FFVs to this TSV file")
+	repair := flags.Bool("repair", false, "renormalize FFVs with wrong norms and delete other anomalous FFVs")
+	outliers := flags.String("outliers", "", "labels of planted outliers kept by -repair, generator.outliers.labels_path by default")
+	batch := flags.Int("batch", 1000, "FFVs repaired per mutation")
+	overrides := config.RegisterFlags(flags, Config{})
+	flags.Parse(args)
+
+	if *batch <= 0 {
+		return fmt.Errorf("batch must be positive, got %d", *batch)
+	}
+	cfg, err := loadCFG(*configPath, overrides)
+	if err != nil {
+		return err
+	}
+	opts, err := mappedOptions(cfg)
+	if err != nil {
+		return err
+	}
+	if *outliers == "" {
+		*outliers = cfg.GeneratorCFG.Outliers.LabelsPath
+	}
+	// Repairs would delete planted outliers and invalidate their labels.
+	planted := map[string]bool{}
+	if *repair && (*outliers != "") {
+		if planted, err = readLabelIDs(*outliers); err != nil {
+			return err
+		}
+	} else if *repair && (cfg.GeneratorCFG.Outliers.Rate > 0) {
+		return fmt.Errorf("-repair needs labels of planted outliers, set -outliers or generator.outliers.labels_path")
+	}
+	db, err := connectClickHouse(cfg.StorageCFG, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := checkVectors(ctx, db, cfg, opts.ffvTable, *key)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+	if *flagged != "" {
+		labels, err := newLabelsFile(*flagged, false, "ffv_id", "anomaly", "dim", "norm")
+		if err != nil {
+			return err
+		}
+		for _, a := range report.anomalies {
+			labels.write(a.id, a.kind, strconv.FormatUint(a.dim, 10), strconv.FormatFloat(a.norm, 'g', -1, 64))
+		}
+		if err := labels.close(); err != nil {
+			return err
+		}
+	}
+	if !*repair {
+		return nil
+	}
+	anomalies, kept := plantedOutliers(report.anomalies, planted)
+	if len(anomalies) != 0 {
+		mutations, err := repairVectors(ctx, db, opts.ffvTable, anomalies, *batch)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("repaired %d FFVs with %d mutations\n", len(anomalies), mutations)
+	}
+	if len(kept) != 0 {
+		fmt.Printf("kept %d planted outliers\n", len(kept))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package generator
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPlantedOutliersAreNotRepaired(t *testing.T) {
+	cfg, dir := testConfig(t, 100)
+	cfg.GeneratorCFG.Outliers.Rate = 0.3
+	cfg.GeneratorCFG.Outliers.LabelsPath = filepath.Join(dir, "outliers.tsv")
+	testRun(t, cfg)
+
+	// Every FFV is anomalous, e.g. after a corrupting insert path.
+	anomalies := []vectorAnomaly{}
+	for _, row := range readTSV(t, filepath.Join(dir, "facial_features.0001.tsv")) {
+		anomalies = append(anomalies, vectorAnomaly{id: row[0], kind: vectorNorm})
+	}
+	planted, err := readLabelIDs(cfg.GeneratorCFG.Outliers.LabelsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planted) == 0 {
+		t.Fatal("no outliers are planted")
+	}
+	repair, kept := plantedOutliers(anomalies, planted)
+	if (len(kept) != len(planted)) || (len(repair)+len(kept) != len(anomalies)) {
+		t.Fatalf("%d anomalies are split into %d to repair and %d kept, %d outliers are planted",
+			len(anomalies), len(repair), len(kept), len(planted))
+	}
+	for _, a := range repair {
+		if planted[a.id] {
+			t.Errorf("planted outlier %s is repaired", a.id)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// exitVerifyFailed is the exit code of runs failing -verify.
+const exitVerifyFailed = 4
+
+// Rows of each table sampled by -verify.
+const verifySampleSize = 1000
+
+// uint64Query runs a query returning a single number.
+type uint64Query func(ctx context.Context, query string) (uint64, error)
+
+func nativeUint64Query(db *sql.DB) uint64Query {
+	return func(ctx context.Context, query string) (uint64, error) {
+		n := uint64(0)
+		err := db.QueryRowContext(ctx, query).Scan(&n)
+		return n, err
+	}
+}
+
+// verification holds row counts of generated tables before the run.
+type verification struct {
+	query  uint64Query
+	opts   insertOptions
+	before map[string]uint64
+}
+
+func newVerification(ctx context.Context, query uint64Query, opts insertOptions) (*verification, error) {
+	v := &verification{query: query, opts: opts, before: map[string]uint64{}}
+	for _, table := range generatedTables {
+		name := opts.table(table).name
+		count, err := query(ctx, "SELECT count() FROM "+name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to count rows of %s", name)
+		}
+		v.before[table] = count
+	}
+	return v, nil
+}
+
+// verifyError lists mismatches found by -verify.
+type verifyError struct {
+	failures []string
+}
+
+func (e *verifyError) Error() string {
+	return "verification failed: " + strings.Join(e.failures, "; ")
+}
+
+// check compares growth of row counts with rows written by the run and
+// checks sampled rows: FFVs of the configured dimension referring to
+// existing control objects and control objects having FFVs. Expected pairs
+// are not checked when negative. Every check is added to suite.
+func (v *verification) check(ctx context.Context, g *generation, expectedPairs int64, suite *junitSuite) ([]string, error) {
+	cob, ffv := v.opts.cobTable, v.opts.ffvTable
+	report, failures := []string{}, []string{}
+	inserted := atomic.LoadInt64(&g.inserted)
+	cobRows, ffvRows := atomic.LoadInt64(&g.cobRows), atomic.LoadInt64(&g.ffvRows)
+	if expectedPairs >= 0 {
+		failure := ""
+		if inserted != expectedPairs {
+			failure = fmt.Sprintf("inserted %d of %d pairs", inserted, expectedPairs)
+			failures = append(failures, failure)
+		}
+		suite.add("inserted pairs", 0, fmt.Sprintf("inserted %d pairs", inserted), failure)
+	}
+	for _, table := range generatedTables {
+		name := v.opts.table(table).name
+		checkStart := time.Now()
+		after, err := v.query(ctx, "SELECT count() FROM "+name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to count rows of %s", name)
+		}
+		grown := int64(after) - int64(v.before[table])
+		written, least := ffvRows, ffvRows
+		if table == "control_objects" {
+			// Merges may have collapsed versions of upserted persons already.
+			written, least = cobRows, cobRows
+			if g.cfg.GeneratorCFG.Upsert.upsert() {
+				least = inserted
+			}
+		}
+		line, failure := fmt.Sprintf("%s grew by %d rows, %d written", name, grown, written), ""
+		report = append(report, line)
+		if (grown < least) || (grown > written) {
+			failure = fmt.Sprintf("%s grew by %d rows instead of %d", name, grown, written)
+			failures = append(failures, failure)
+		}
+		suite.add(name+" row count", time.Now().Sub(checkStart), line, failure)
+	}
+
+	sample := func(table *tableMapping, columns string) string {
+		return fmt.Sprintf("(SELECT %s FROM %s ORDER BY rand() LIMIT %d)", columns, table.name, verifySampleSize)
+	}
+	// Checks of omitted columns are skipped.
+	id, cobID, vector := cob.column("id"), ffv.column("cob_id"), ffv.column("ff")
+	checks := map[string]string{}
+	if (id != "") && (cobID != "") {
+		checks["sampled FFVs without control objects"] = fmt.Sprintf("SELECT count() FROM %s WHERE %s NOT IN (SELECT %s FROM %s)",
+			sample(ffv, cobID), cobID, id, cob.name)
+		checks["sampled control objects without FFVs"] = fmt.Sprintf("SELECT count() FROM %s WHERE %s NOT IN (SELECT %s FROM %s)",
+			sample(cob, id), id, cobID, ffv.name)
+	}
+	if vector != "" {
+		checks["sampled FFVs of other dimension"] = fmt.Sprintf("SELECT count() FROM %s WHERE length(%s) != %d",
+			sample(ffv, vector), vector, g.vectors.dim)
+	}
+	names := []string{}
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		checkStart := time.Now()
+		n, err := v.query(ctx, checks[name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to count %s", name)
+		}
+		line, failure := fmt.Sprintf("%s: %d", name, n), ""
+		report = append(report, line)
+		if n != 0 {
+			failure = fmt.Sprintf("%d %s", n, name)
+			failures = append(failures, failure)
+		}
+		suite.add(name, time.Now().Sub(checkStart), line, failure)
+	}
+	if len(failures) > 0 {
+		return report, &verifyError{failures: failures}
+	}
+	return report, nil
+}
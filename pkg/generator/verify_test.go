@@ -0,0 +1,130 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCounts answers count queries of -verify with row counts of tables and
+// counts of sampled checks by the name of the checked column.
+type fakeCounts struct {
+	rows    map[string]uint64
+	sampled map[string]uint64
+	queries []string
+}
+
+func (c *fakeCounts) query(ctx context.Context, query string) (uint64, error) {
+	c.queries = append(c.queries, query)
+	if table := strings.TrimPrefix(query, "SELECT count() FROM "); !strings.Contains(table, " ") {
+		return c.rows[table], nil
+	}
+	for check, n := range c.sampled {
+		if strings.Contains(query, check) {
+			return n, nil
+		}
+	}
+	return 0, nil
+}
+
+func TestVerification(t *testing.T) {
+	cfg, _ := testConfig(t, 10)
+	counts := &fakeCounts{rows: map[string]uint64{"control_objects": 5, "facial_features": 7}}
+	v, err := newVerification(context.Background(), counts.query, testInsertOptions(t, SchemaCFG{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &generation{cfg: cfg, vectors: &ffvGenerator{dim: 128}, inserted: 10, cobRows: 10, ffvRows: 20}
+	counts.rows = map[string]uint64{"control_objects": 15, "facial_features": 27}
+	counts.queries = nil
+	report, err := v.check(context.Background(), g, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"control_objects grew by 10 rows, 10 written",
+		"facial_features grew by 20 rows, 20 written",
+		"sampled FFVs of other dimension: 0",
+		"sampled FFVs without control objects: 0",
+		"sampled control objects without FFVs: 0",
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("verification reports %q, expected %q", report, expected)
+	}
+	sample := fmt.Sprintf("(SELECT cob_id FROM facial_features ORDER BY rand() LIMIT %d)", verifySampleSize)
+	query := "SELECT count() FROM " + sample + " WHERE cob_id NOT IN (SELECT id FROM control_objects)"
+	if counts.queries[3] != query {
+		t.Errorf("FFVs without control objects are counted with %s, expected %s", counts.queries[3], query)
+	}
+
+	// Mismatches fail verification and the JUnit suite.
+	counts.rows["facial_features"] = 26
+	counts.sampled = map[string]uint64{"length(ff) != 128": 2}
+	suite := newJUnitReport("junit.xml", "run").suite("verify")
+	_, err = v.check(context.Background(), g, 11, suite)
+	verifyErr, ok := err.(*verifyError)
+	if !ok {
+		t.Fatalf("failed verification returns %v", err)
+	}
+	expectedFailures := []string{
+		"inserted 10 of 11 pairs",
+		"facial_features grew by 19 rows instead of 20",
+		"2 sampled FFVs of other dimension",
+	}
+	if !reflect.DeepEqual(verifyErr.failures, expectedFailures) {
+		t.Errorf("verification fails with %q, expected %q", verifyErr.failures, expectedFailures)
+	}
+	if (suite.Tests != 6) || (suite.Failures != 3) {
+		t.Errorf("JUnit suite has %d checks with %d failures, expected 6 with 3", suite.Tests, suite.Failures)
+	}
+
+	// Merges may collapse versions of upserts, expected pairs are skipped
+	// when negative.
+	counts.rows = map[string]uint64{"control_objects": 17, "facial_features": 27}
+	counts.sampled = nil
+	g.cobRows = 14
+	g.cfg.GeneratorCFG.Upsert = UpsertCFG{Mode: writeModeUpsert, Rate: 0.5}
+	if _, err := v.check(context.Background(), g, -1, nil); err != nil {
+		t.Errorf("verification of collapsed upserts fails: %v", err)
+	}
+	g.cfg.GeneratorCFG.Upsert = UpsertCFG{}
+	if _, err := v.check(context.Background(), g, -1, nil); err == nil {
+		t.Error("verification of missing control objects succeeds")
+	}
+}
+
+// TestVerifyOmittedColumns checks that checks of omitted columns are
+// skipped and mapped names are queried.
+func TestVerifyOmittedColumns(t *testing.T) {
+	cfg, _ := testConfig(t, 10)
+	counts := &fakeCounts{rows: map[string]uint64{}}
+	opts := testInsertOptions(t, SchemaCFG{
+		ControlObjects: TableSchemaCFG{Name: "persons"},
+		FFVs:           TableSchemaCFG{Columns: map[string]string{"cob_id": "-", "ff": "embedding"}},
+	})
+	v, err := newVerification(context.Background(), counts.query, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &generation{cfg: cfg, vectors: &ffvGenerator{dim: 128}}
+	report, err := v.check(context.Background(), g, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (len(report) != 3) || (report[0] != "persons grew by 0 rows, 0 written") ||
+		!strings.Contains(counts.queries[len(counts.queries)-1], "length(embedding) != 128") {
+		t.Errorf("verification reports %q with queries %q", report, counts.queries)
+	}
+}
+
+func TestVerifyNeedsClickHouse(t *testing.T) {
+	cfg, _ := testConfig(t, 10)
+	_, err := run(context.Background(), cfg, Options{Verify: true}, cfg.GeneratorCFG.Seed, nil, time.Now(),
+		&logger{quiet: true})
+	if (err == nil) || (err.Error() != "-verify needs ClickHouse storage") {
+		t.Errorf("verified run into files returns %v", err)
+	}
+}
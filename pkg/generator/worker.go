@@ -0,0 +1,559 @@
+package generator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nofacedb/generator/pkg/datagen"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// generation holds everything workers share during a run. Generators and
+// labels files are safe for concurrent use.
+type generation struct {
+	cfg       *Config
+	db        *sql.DB
+	namespace uuid.UUID
+	// Workers draw from streams derived from the seed. Deterministic runs
+	// also derive IDs and timestamps from it.
+	seed          int64
+	deterministic bool
+	// First numeric IDs of tables with numeric IDs.
+	idOffsets map[string]uint64
+	opts      insertOptions
+	log       *logger
+	metrics   *stageMetrics
+	slo       *sloStats
+	// Sinks of batches, ClickHouse inserts with retries or output files.
+	writeControlObjects func(ctx context.Context, cobs []controlObject, times *batchTimes) error
+	writeFFVs           func(ctx context.Context, ffvs []ffv, times *batchTimes) error
+
+	personal   *datagen.Generator
+	identities *identityList
+	rules      *constraints
+	compliance *complianceGenerator
+	employment *employmentGenerator
+	attributes *attributesGenerator
+	vectors    *ffvGenerator
+	faceBoxes  *faceBoxGenerator
+	cameras    *cameraClocks
+	timestamps *timestamps
+	partitions partitions
+	probes     *probeGenerator
+
+	labels         *labelsFile
+	pairLabels     *labelsFile
+	identityEvents *labelsFile
+	nameVariants   *labelsFile
+	duplicates     *labelsFile
+	upserts        *labelsFile
+	probeLabels    *labelsFile
+	pseudonyms     *pseudonymsFile
+	enrollment     *enroller
+
+	cobBatchSize int
+	ffvBatchSize int
+	// Holds -target-rows-per-sec, nil without a target.
+	throughput *throughputController
+	// Caps of generator.rate_limit_rows_per_sec and
+	// generator.max_inflight_batches, nil without them.
+	rateLimit *rateLimiter
+	inflight  chan struct{}
+	// Spills batches while the sink is slower than generation, nil without
+	// generator.spool.
+	spool *spool
+	// Batch regenerated by -replay-batch, nil in other runs.
+	replay *batchRecord
+
+	// Reports of recovered panics, and cancellation of workers of the
+	// current runWorkers when one of them panics.
+	crashes     *crashReports
+	stopWorkers context.CancelFunc
+
+	inserted int64
+	// Rows written to both tables, upserts and extra FFVs included.
+	cobRows int64
+	ffvRows int64
+}
+
+// useClickHouse makes workers insert batches into ClickHouse.
+func (g *generation) useClickHouse(db *sql.DB) {
+	g.db = db
+	g.useDriver(clickHouseDriver{db: db, opts: g.opts})
+}
+
+// useDriver makes workers insert batches with retries through the driver.
+func (g *generation) useDriver(d storageDriver) {
+	g.writeControlObjects = func(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+		return insertWithRetries(ctx, g.cfg.StorageCFG.Retries, g.log, func() error {
+			err := d.InsertControlObjects(ctx, cobs, times)
+			g.slo.attempt(err)
+			return err
+		})
+	}
+	g.writeFFVs = func(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+		return insertWithRetries(ctx, g.cfg.StorageCFG.Retries, g.log, func() error {
+			err := d.InsertFFVs(ctx, ffvs, times)
+			g.slo.attempt(err)
+			return err
+		})
+	}
+}
+
+// useFiles makes workers write batches to output files.
+func (g *generation) useFiles(cobFile, ffvFile *tableFile) {
+	d := fileDriver{cobFile: cobFile, ffvFile: ffvFile, opts: g.opts}
+	g.writeControlObjects, g.writeFFVs = d.InsertControlObjects, d.InsertFFVs
+}
+
+// runWorkers runs a worker per range, each with its own batches and table
+// writers, and waits for all of them. Failed workers do not stop the others,
+// their errors are reported together. Returned ranges record progress of
+// every worker.
+func (g *generation) runWorkers(ctx context.Context, ranges []workerRange) (int, []workerRange, error) {
+	ranges = append([]workerRange{}, ranges...)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	g.stopWorkers = cancel
+	flushTimeout := time.Duration(g.cfg.GeneratorCFG.Checkpoint.FlushTimeoutMS) * time.Millisecond
+	if flushTimeout <= 0 {
+		flushTimeout = 10 * time.Second
+	}
+	// Batches outlive a stop of generation for at most the flush timeout, so
+	// that rows generated so far are written and covered by the checkpoint.
+	writeCtx, cancelWrites := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWrites()
+	defer context.AfterFunc(ctx, func() {
+		sleepContext(writeCtx, flushTimeout)
+		cancelWrites()
+	})()
+
+	bytesSent := make([]int, len(ranges))
+	errs := make([]error, len(ranges))
+	wg := sync.WaitGroup{}
+	wg.Add(len(ranges))
+	for w := range ranges {
+		go func(w int) {
+			defer wg.Done()
+			bytesSent[w], ranges[w].Next, errs[w] = g.work(ctx, writeCtx, w, ranges[w])
+		}(w)
+	}
+	wg.Wait()
+
+	total := 0
+	failed := []string{}
+	for w := range errs {
+		total += bytesSent[w]
+		if errs[w] != nil {
+			failed = append(failed, fmt.Sprintf("worker %d: %v", w+1, errs[w]))
+		}
+	}
+	switch {
+	case len(failed) == 0:
+		return total, ranges, nil
+	case len(ranges) == 1:
+		return total, ranges, errs[0]
+	}
+	return total, ranges, fmt.Errorf("%d of %d workers failed:\n%s", len(failed), len(ranges), strings.Join(failed, "\n"))
+}
+
+// worker holds random streams, table writers and progress of rows of one
+// worker in both tables.
+type worker struct {
+	index     int
+	rnd       *streams
+	writeCtx  context.Context
+	cobWriter *tableWriter
+	ffvWriter *tableWriter
+	cobs      *rowProgress
+	ffvs      *rowProgress
+	// Row being generated, for crash reports.
+	row int
+	// First row generated, where streams start.
+	start int
+}
+
+// work generates rows of r from r.Next and returns the first row not
+// inserted into both tables.
+func (g *generation) work(ctx, writeCtx context.Context, index int, r workerRange) (int, int, error) {
+	w := &worker{
+		index:     index,
+		start:     r.Next,
+		rnd:       newStreams(g.seed, index, g.cfg.GeneratorCFG.SeedOffsets),
+		writeCtx:  writeCtx,
+		cobWriter: newTableWriter(g.cfg.GeneratorCFG.ControlObjects.Parallelism),
+		ffvWriter: newTableWriter(g.cfg.GeneratorCFG.FFVs.Parallelism),
+		cobs:      newRowProgress(r.Next),
+		ffvs:      newRowProgress(r.Next),
+	}
+	bytesSent, err := func() (bytesSent int, err error) {
+		defer g.recoverPanic(func() string {
+			return fmt.Sprintf("worker %d generating row %d of rows [%d, %d)", index+1, w.row, r.From, r.To)
+		}, &err)
+		return g.generate(ctx, w, r.Next, r.To)
+	}()
+	g.throughput.finish(index)
+	cobErr := w.cobWriter.close()
+	ffvErr := w.ffvWriter.close()
+	next := w.cobs.position()
+	if ffvNext := w.ffvs.position(); ffvNext < next {
+		next = ffvNext
+	}
+	switch {
+	case err != nil:
+		return bytesSent, next, err
+	case cobErr != nil:
+		return bytesSent, next, errors.Wrap(cobErr, "unable to insert generated control objects")
+	case ffvErr != nil:
+		return bytesSent, next, errors.Wrap(ffvErr, "unable to insert generated facial features vectors")
+	}
+	return bytesSent, next, nil
+}
+
+// deterministicEpoch is the timestamp of the first row of deterministic runs,
+// every next row is a second later.
+var deterministicEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// seedNamespace is the UUIDv5 namespace of IDs of deterministic runs.
+var seedNamespace = uuid.NewV5(uuid.NamespaceOID, "github.com/nofacedb/generator")
+
+// newID returns a random UUIDv4 or, in deterministic runs, a UUIDv5 of the
+// seed, kind of the row and its index.
+func (g *generation) newID(kind string, i int) string {
+	if !g.deterministic {
+		return uuid.Must(uuid.NewV4()).String()
+	}
+	return uuid.NewV5(seedNamespace, fmt.Sprintf("%d/%s/%d", g.seed, kind, i)).String()
+}
+
+// controlObjectID derives IDs from passports when a namespace is configured.
+func (g *generation) controlObjectID(i int, passport string) string {
+	if offset, ok := g.idOffsets["control_objects"]; ok {
+		return strconv.FormatUint(offset+uint64(i), 10)
+	}
+	if !uuid.Equal(g.namespace, uuid.Nil) {
+		return uuid.NewV5(g.namespace, passport).String()
+	}
+	return g.newID("control_object", i)
+}
+
+// duplicateID returns the ID of the duplicate of kind at row i with the
+// copied passport. IDs derived from passports mix the kind and the row in,
+// so duplicates never share the ID of the original.
+func (g *generation) duplicateID(i int, kind, passport string) string {
+	if _, ok := g.idOffsets["control_objects"]; ok || uuid.Equal(g.namespace, uuid.Nil) {
+		return g.controlObjectID(i, passport)
+	}
+	return uuid.NewV5(g.namespace, fmt.Sprintf("%s/%s/%d", passport, kind, i)).String()
+}
+
+func (g *generation) now(rnd *rand.Rand, i int) time.Time {
+	if g.partitions != nil {
+		return g.partitions.sample(rnd, i)
+	}
+	if g.timestamps != nil {
+		return g.timestamps.sample(rnd)
+	}
+	if !g.deterministic {
+		return time.Now()
+	}
+	return deterministicEpoch.Add(time.Duration(i) * time.Second)
+}
+
+func (g *generation) generate(ctx context.Context, w *worker, from, to int) (int, error) {
+	genCFG := g.cfg.GeneratorCFG
+	rnd := w.rnd
+	bytesSent := 0
+	cobs := make([]controlObject, 0, g.cobBatchSize)
+	ffvs := make([]ffv, 0, g.ffvBatchSize)
+	cobGeneration, ffvGeneration := time.Duration(0), time.Duration(0)
+	// First rows of current batches.
+	cobFrom, ffvFrom := from, from
+
+	// Batches cover rows from the first row of the batch through a given one.
+	flushControlObjects := func(through int) error {
+		batch, generation, batchFrom := cobs, cobGeneration, cobFrom
+		insert := func(batch []controlObject) (err error) {
+			defer g.recordBatch(w, "control_objects", batchFrom, through, len(batch), &err)
+			defer g.recoverPanic(func() string {
+				return fmt.Sprintf("worker %d inserting control objects of rows [%d, %d)", w.index+1, batchFrom, through)
+			}, &err)
+			times := batchTimes{generation: generation}
+			var writeStart time.Time
+			err = g.limitedWrite(w.writeCtx, len(batch), func() error {
+				writeStart = time.Now()
+				return g.writeControlObjects(w.writeCtx, batch, &times)
+			})
+			if !writeStart.IsZero() {
+				g.slo.batch(time.Now().Sub(writeStart))
+			}
+			g.metrics.record("control_objects", len(batch), times)
+			if err == nil {
+				// Upserts are not new pairs.
+				atomic.AddInt64(&g.inserted, int64(through-batchFrom))
+				atomic.AddInt64(&g.cobRows, int64(len(batch)))
+				w.cobs.mark(batchFrom, through)
+			}
+			return err
+		}
+		if err := w.cobWriter.write(func() error { return insert(batch) }, g.spool.controlObjects(batch, insert)); err != nil {
+			return errors.Wrap(err, "unable to insert generated control objects")
+		}
+		bytesSent += controlObjectsPayloadSize(batch)
+		cobs = make([]controlObject, 0, g.cobBatchSize)
+		cobGeneration, cobFrom = 0, through
+		return nil
+	}
+	flushFFVs := func(through int) error {
+		batch, generation, batchFrom := ffvs, ffvGeneration, ffvFrom
+		insert := func(batch []ffv) (err error) {
+			defer g.recordBatch(w, "facial_features", batchFrom, through, len(batch), &err)
+			defer g.recoverPanic(func() string {
+				return fmt.Sprintf("worker %d inserting facial features of rows [%d, %d)", w.index+1, batchFrom, through)
+			}, &err)
+			times := batchTimes{generation: generation}
+			var writeStart time.Time
+			err = g.limitedWrite(w.writeCtx, 0, func() error {
+				writeStart = time.Now()
+				return g.writeFFVs(w.writeCtx, batch, &times)
+			})
+			if !writeStart.IsZero() {
+				g.slo.batch(time.Now().Sub(writeStart))
+			}
+			g.metrics.record("facial_features", len(batch), times)
+			if err == nil {
+				atomic.AddInt64(&g.ffvRows, int64(len(batch)))
+				w.ffvs.mark(batchFrom, through)
+			}
+			return err
+		}
+		if err := w.ffvWriter.write(func() error { return insert(batch) }, g.spool.ffvs(batch, insert)); err != nil {
+			return errors.Wrap(err, "unable to insert generated facial features vectors")
+		}
+		bytesSent += ffvsPayloadSize(batch)
+		ffvs = make([]ffv, 0, g.ffvBatchSize)
+		ffvGeneration, ffvFrom = 0, through
+		return nil
+	}
+	// stop flushes rows generated before through, so that a checkpoint
+	// covers them.
+	stop := func(err error, through int) (int, error) {
+		if len(cobs) != 0 {
+			if err := flushControlObjects(through); err != nil {
+				return bytesSent, err
+			}
+		}
+		if len(ffvs) != 0 {
+			if err := flushFFVs(through); err != nil {
+				return bytesSent, err
+			}
+		}
+		return bytesSent, errors.Wrap(err, "generation stopped")
+	}
+
+	var partner *plantedPartner
+	var previous *ffv
+	var previousAnchor []uint64
+	var canonical *controlObject
+	// First FFV of the canonical person, which FFVs of duplicates are near.
+	var canonicalFFV []float64
+	// Centroid of the canonical person, which duplicates share.
+	var canonicalIdentity []float64
+	pool := newUpsertPool(genCFG.Upsert)
+	for i := from; i < to; i++ {
+		w.row = i
+		if err := ctx.Err(); err != nil {
+			return stop(err, i)
+		}
+		if err := g.throughput.wait(ctx, w.index); err != nil {
+			return stop(err, i)
+		}
+		generationStart := time.Now()
+		now := g.now(rnd.ts, i)
+		listed := g.identities.at(i)
+		passport := g.opts.passports.generate(rnd.passport)
+		if (listed != nil) && (listed.passport != "") {
+			passport = listed.passport
+		}
+		cob := controlObject{
+			id:         g.controlObjectID(i, passport),
+			ts:         now,
+			passport:   passport,
+			surname:    "-",
+			name:       "-",
+			patronymic: "-",
+			sex:        "-",
+			birthDate:  "-",
+			phoneNum:   "-",
+			email:      "-",
+			address:    "-",
+		}
+		// Persons violating constraints are generated again.
+		base := cob
+		for attempt := 1; ; attempt++ {
+			fillPersonalData(rnd.personalData, &cob, g.personal, now, listed.known())
+			g.opts.fields.fill(rnd.fields, &cob, listed.extras())
+			rule := g.rules.violated(cob)
+			if rule == nil {
+				break
+			}
+			if attempt == g.rules.maxAttempts {
+				return stop(fmt.Errorf("row %d violates constraint \"%s\" after %d attempts", i, rule, attempt), i)
+			}
+			cob = base
+		}
+		if (g.opts.fields != nil) && g.opts.fields.passport {
+			cob.id = g.controlObjectID(i, cob.passport)
+		}
+		// Variants and duplicates refer to the last canonical person.
+		variant := false
+		duplicate := ""
+		if kind := pickDuplicate(genCFG, rnd.duplicates); (kind != "") && (canonical != nil) {
+			fields := applyDuplicate(rnd.duplicates, kind, *canonical, &cob)
+			cob.id = g.duplicateID(i, kind, cob.passport)
+			g.duplicates.write(cob.id, canonical.id, kind, fields)
+			duplicate = kind
+		} else if genCFG.NameVariants.enabled() {
+			if kind := genCFG.NameVariants.pickKind(rnd.nameVariants); (kind != "") && (canonical != nil) {
+				kind, fields := applyNameVariant(rnd.nameVariants, kind, *canonical, &cob)
+				g.nameVariants.write(cob.id, canonical.id, kind, fields)
+				variant = true
+			}
+		}
+		if g.opts.naturalKey {
+			cob.naturalKey = naturalKey(cob.passport, cob.birthDate)
+		}
+		g.compliance.fill(rnd.compliance, &cob)
+		g.employment.fill(rnd.employment, &cob)
+		g.attributes.fill(rnd.attributes, &cob)
+		if g.opts.versioned {
+			cob.version = 1
+		}
+		// Upserts take changed fields from the current person.
+		upsert, upserted := pool.next(rnd.upserts, cob)
+		pool.add(rnd.upserts, cob)
+		cobGenerated := time.Now()
+		cobGeneration += cobGenerated.Sub(generationStart)
+		anchor := g.faceBoxes.anchor(rnd.faceBoxes)
+		identity := g.vectors.demographicIdentity(rnd.ffvs, cob, now)
+		perCOB := genCFG.FFVPerCOB.pick(rnd.scenarios)
+		fv := ffv{
+			id:                   g.ffvID(i, 0),
+			cobID:                cob.id,
+			imgID:                "00000000-0000-0000-0000-000000000000",
+			faceBox:              g.faceBoxes.capture(rnd.faceBoxes, anchor),
+			facialFeaturesVector: g.vectors.sighting(rnd.ffvs, identity),
+		}
+		if duplicate != "" {
+			fv.facialFeaturesVector = g.vectors.perturb(rnd.duplicates, canonicalFFV, duplicateNoise(genCFG))
+		}
+		outlier := genCFG.Outliers.pickKind(rnd.scenarios)
+		if outlier != "" {
+			fv.facialFeaturesVector = g.vectors.outlier(rnd.ffvs, outlier)
+			g.labels.write(fv.id, fv.cobID, outlier)
+		} else if partner != nil {
+			fv.facialFeaturesVector = partner.vector
+			g.pairLabels.write(partner.ffvID, fv.id, genCFG.PlantedPairs.Metric,
+				strconv.FormatFloat(partner.distance, 'f', -1, 64))
+			partner = nil
+		} else if distance, ok := genCFG.PlantedPairs.pickDistance(rnd.scenarios); ok {
+			partner = &plantedPartner{
+				ffvID:    fv.id,
+				distance: distance,
+				vector:   plantPartner(rnd.ffvs, fv.facialFeaturesVector, genCFG.PlantedPairs.Metric, distance),
+			}
+		} else if event := genCFG.IdentityEvents.pickEvent(rnd.scenarios); (event == identityMerge) && (previous != nil) {
+			fv.facialFeaturesVector = plantPartner(rnd.ffvs, previous.facialFeaturesVector, distanceCosine,
+				genCFG.IdentityEvents.SamePersonDistance)
+			if previousAnchor != nil {
+				anchor = previousAnchor
+				fv.faceBox = g.faceBoxes.capture(rnd.faceBoxes, anchor)
+			}
+			g.identityEvents.write(identityMerge, previous.cobID, cob.id)
+		} else if event == identitySplit {
+			foreign := ffv{
+				id:                   g.ffvID(i, splitSighting),
+				cobID:                cob.id,
+				imgID:                "00000000-0000-0000-0000-000000000000",
+				faceBox:              g.faceBoxes.capture(rnd.faceBoxes, g.faceBoxes.anchor(rnd.faceBoxes)),
+				facialFeaturesVector: g.vectors.generate(rnd.ffvs),
+			}
+			genCFG.EventTime.fill(rnd.eventTime, &foreign, now, g.cameras)
+			ffvs = append(ffvs, foreign)
+			g.identityEvents.write(identitySplit, cob.id, foreign.id)
+		}
+		genCFG.EventTime.fill(rnd.eventTime, &fv, now, g.cameras)
+		if genCFG.FFVPerCOB.Max > 1 {
+			fv.imgID = g.newID("image", i)
+		}
+		ffvGeneration += time.Now().Sub(cobGenerated)
+		cobs = append(cobs, cob)
+		if upserted {
+			cobs = append(cobs, upsert)
+			g.upserts.write(upsert.id, strconv.FormatUint(upsert.version, 10), strings.Join(genCFG.Upsert.fields(), ","))
+		}
+		ffvs = append(ffvs, fv)
+		for j := 1; j < perCOB; j++ {
+			sighting := ffv{
+				id:                   g.ffvID(i, j),
+				cobID:                cob.id,
+				imgID:                g.newID(fmt.Sprintf("image_%d", j), i),
+				faceBox:              g.faceBoxes.capture(rnd.faceBoxes, anchor),
+				facialFeaturesVector: g.vectors.sighting(rnd.ffvs, identity),
+			}
+			if duplicate != "" {
+				sighting.facialFeaturesVector = g.vectors.perturb(rnd.duplicates, canonicalFFV, duplicateNoise(genCFG))
+			}
+			genCFG.EventTime.fill(rnd.eventTime, &sighting, now, g.cameras)
+			ffvs = append(ffvs, sighting)
+		}
+		if outlier == "" {
+			g.probes.write(rnd.probes, g.probeLabels, g, i, cob, fv)
+		}
+		if duplicate != "" {
+			g.pseudonyms.write(w.index, i, canonicalIdentity, cob)
+		} else {
+			g.pseudonyms.write(w.index, i, identity, cob)
+		}
+		g.enrollment.add(ctx, cob, fv)
+		previous = &fv
+		previousAnchor = anchor
+		if !variant && (duplicate == "") {
+			canonical, canonicalFFV, canonicalIdentity = &cob, fv.facialFeaturesVector, identity
+		}
+		if err := genCFG.ThinkTime.wait(ctx, rnd.thinkTime, thinkTimePerRow); err != nil {
+			return stop(err, i+1)
+		}
+		// Replays drop rows before the batch.
+		if g.replay.drops(i) {
+			cobs, ffvs = cobs[:0], ffvs[:0]
+			cobGeneration, ffvGeneration = 0, 0
+			cobFrom, ffvFrom = i+1, i+1
+			continue
+		}
+
+		last := i == to-1
+		if (len(cobs) >= g.throughput.batchSize(g.cobBatchSize)) || (last && (len(cobs) != 0)) {
+			if err := genCFG.ThinkTime.wait(ctx, rnd.thinkTime, thinkTimePerBatch); err != nil {
+				return stop(err, i+1)
+			}
+			if err := flushControlObjects(i + 1); err != nil {
+				return bytesSent, err
+			}
+		}
+		if (len(ffvs) >= g.throughput.batchSize(g.ffvBatchSize)) || (last && (len(ffvs) != 0)) {
+			if err := flushFFVs(i + 1); err != nil {
+				return bytesSent, err
+			}
+		}
+	}
+	return bytesSent, nil
+}
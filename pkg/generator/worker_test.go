@@ -0,0 +1,173 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func BenchmarkControlObjectID(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		g    *generation
+	}{
+		{"random", &generation{}},
+		{"seeded", &generation{seed: 1, deterministic: true}},
+		{"namespace", &generation{namespace: uuid.NamespaceOID}},
+		{"numeric", &generation{idOffsets: map[string]uint64{"control_objects": 1}}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bench.g.controlObjectID(i, "12 34 567890")
+			}
+		})
+	}
+}
+
+// TestUUIDNamespace checks that control objects of namespaces get UUIDv5 IDs
+// of their passports, the same in every run.
+func TestSplitRows(t *testing.T) {
+	expected := []workerRange{{0, 0, 3}, {3, 3, 6}, {6, 6, 10}}
+	if ranges := splitRows(3, 10); !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("10 rows are split between 3 workers as %v", ranges)
+	}
+	if ranges := splitRows(0, 10); !reflect.DeepEqual(ranges, []workerRange{{0, 0, 10}}) {
+		t.Errorf("10 rows are split without workers as %v", ranges)
+	}
+}
+
+// TestWorkerErrors checks that a failed worker does not stop the others and
+// that errors of workers are reported together.
+func TestWorkerErrors(t *testing.T) {
+	cfg, dir := testConfig(t, 30)
+	cfg.GeneratorCFG.Workers = 3
+	mu := sync.Mutex{}
+	written := map[string]bool{}
+	g := testReplayGeneration(t, cfg, nil)
+	failingID := g.newID("control_object", 15)
+	g.writeControlObjects = func(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, cob := range cobs {
+			if cob.id == failingID {
+				return fmt.Errorf("Cannot parse input")
+			}
+		}
+		for _, cob := range cobs {
+			written[cob.id] = true
+		}
+		return nil
+	}
+	g.cobBatchSize = 5
+	_, ranges, err := g.runWorkers(context.Background(), splitRows(3, 30))
+	if (err == nil) || !strings.Contains(err.Error(), "1 of 3 workers failed") ||
+		!strings.Contains(err.Error(), "worker 2: ") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if (ranges[0].Next != 10) || (ranges[1].Next != 15) || (ranges[2].Next != 30) {
+		t.Errorf("unexpected progress of workers %v", ranges)
+	}
+	for _, i := range []int{0, 9, 10, 14, 20, 29} {
+		if !written[g.newID("control_object", i)] {
+			t.Errorf("row %d is not written", i)
+		}
+	}
+
+	// Rows of all workers are written exactly once.
+	cfg, dir = testConfig(t, 100)
+	cfg.GeneratorCFG.Workers = 4
+	testRun(t, cfg)
+	ids := map[string]bool{}
+	for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+		ids[row[0]] = true
+	}
+	if len(ids) != 100 {
+		t.Errorf("4 workers wrote %d distinct control objects of 100", len(ids))
+	}
+}
+
+func TestUUIDNamespace(t *testing.T) {
+	for _, namespace := range []uuid.UUID{uuid.NamespaceOID, uuid.NamespaceURL} {
+		cfg, dir := testConfig(t, 20)
+		cfg.GeneratorCFG.UUIDNamespace = namespace.String()
+		cfg.GeneratorCFG.DuplicateRate, cfg.GeneratorCFG.NearDuplicateRate = 0, 0
+		testRun(t, cfg)
+		for _, row := range readTSV(t, filepath.Join(dir, "control_objects.0001.tsv")) {
+			if expected := uuid.NewV5(namespace, row[2]).String(); row[0] != expected {
+				t.Errorf("control object with passport %s has ID %s, expected %s", row[2], row[0], expected)
+			}
+		}
+	}
+
+	cfg, _ := testConfig(t, 1)
+	cfg.GeneratorCFG.UUIDNamespace = "not a UUID"
+	if _, err := run(context.Background(), cfg, Options{}, 1, nil, time.Now(), &logger{quiet: true}); err == nil {
+		t.Error("invalid UUID namespace is accepted")
+	}
+}
+
+// TestTableBatches checks that tables are inserted in batches of their own
+// sizes by their own number of goroutines.
+func TestTableBatches(t *testing.T) {
+	cfg, _ := testConfig(t, 60)
+	cfg.GeneratorCFG.InIter = 20
+	cfg.GeneratorCFG.ControlObjects = TableCFG{BatchSize: 30}
+	cfg.GeneratorCFG.FFVs = TableCFG{BatchSize: 4, Parallelism: 3}
+	g := testReplayGeneration(t, cfg, nil)
+	mu := sync.Mutex{}
+	var cobBatches, ffvBatches []int
+	running, maxRunning := 0, 0
+	g.writeControlObjects = func(ctx context.Context, cobs []controlObject, times *batchTimes) error {
+		mu.Lock()
+		defer mu.Unlock()
+		cobBatches = append(cobBatches, len(cobs))
+		return nil
+	}
+	g.writeFFVs = func(ctx context.Context, ffvs []ffv, times *batchTimes) error {
+		mu.Lock()
+		ffvBatches = append(ffvBatches, len(ffvs))
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+	if _, _, err := g.runWorkers(context.Background(), splitRows(1, 60)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cobBatches, []int{30, 30}) {
+		t.Errorf("control objects are inserted in batches of %v, expected 30", cobBatches)
+	}
+	ffvs := 0
+	for _, n := range ffvBatches {
+		if n != 4 {
+			t.Errorf("FFVs are inserted in batches of %v, expected 4", ffvBatches)
+			break
+		}
+		ffvs += n
+	}
+	if ffvs != 60 {
+		t.Errorf("%d FFVs are inserted, expected 60", ffvs)
+	}
+	if maxRunning != 3 {
+		t.Errorf("%d FFV batches are inserted at once, expected 3", maxRunning)
+	}
+
+	// Tables without batch sizes are inserted in batches of in_iter rows.
+	if n := (TableCFG{}).batchSize(20); n != 20 {
+		t.Errorf("batch size defaults to %d, in_iter is 20", n)
+	}
+}
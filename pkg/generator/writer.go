@@ -0,0 +1,141 @@
+package generator
+
+import (
+	"sync"
+)
+
+// TableCFG configures batches of inserts into a table.
+type TableCFG struct {
+	BatchSize   int `yaml:"batch_size"`
+	Parallelism int `yaml:"parallelism"`
+}
+
+func (cfg TableCFG) batchSize(inIter int) int {
+	if cfg.BatchSize > 0 {
+		return cfg.BatchSize
+	}
+	return inIter
+}
+
+// tableWriter runs batch inserts into one table on a fixed number of
+// goroutines and keeps the first error that occurred. While as many batches
+// as goroutines wait in memory, further batches are spilled to the spool and
+// inserted in order when goroutines catch up, or producers block without a
+// spool or while it is full.
+type tableWriter struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// Batches waiting in order, inMemory of them not spilled.
+	queue    []queuedBatch
+	inMemory int
+	capacity int
+	closed   bool
+	wg       sync.WaitGroup
+	err      error
+}
+
+type queuedBatch struct {
+	insert  func() error
+	spilled bool
+}
+
+func newTableWriter(parallelism int) *tableWriter {
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	w := &tableWriter{capacity: parallelism}
+	w.cond = sync.NewCond(&w.mu)
+	w.wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer w.wg.Done()
+			for {
+				batch, ok := w.next()
+				if !ok {
+					return
+				}
+				if w.failed() != nil {
+					continue
+				}
+				if err := batch.insert(); err != nil {
+					w.mu.Lock()
+					if w.err == nil {
+						w.err = err
+					}
+					w.cond.Broadcast()
+					w.mu.Unlock()
+				}
+			}
+		}()
+	}
+	return w
+}
+
+// next waits for the first queued batch, false when the writer is closed and
+// no batches are left.
+func (w *tableWriter) next() (queuedBatch, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for (len(w.queue) == 0) && !w.closed {
+		w.cond.Wait()
+	}
+	if len(w.queue) == 0 {
+		return queuedBatch{}, false
+	}
+	batch := w.queue[0]
+	w.queue = w.queue[1:]
+	if !batch.spilled {
+		w.inMemory--
+	}
+	w.cond.Broadcast()
+	return batch, true
+}
+
+func (w *tableWriter) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// write queues insert of a batch, or the insert spill returns when the batch
+// does not fit in memory. Nil spill blocks until it fits.
+func (w *tableWriter) write(insert func() error, spill spillFunc) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.err == nil {
+		if w.inMemory < w.capacity {
+			w.queue = append(w.queue, queuedBatch{insert: insert})
+			w.inMemory++
+			w.cond.Broadcast()
+			return nil
+		}
+		if spill != nil {
+			w.mu.Unlock()
+			spilled, err := spill()
+			w.mu.Lock()
+			if err != nil {
+				return err
+			}
+			if spilled != nil {
+				w.queue = append(w.queue, queuedBatch{insert: spilled, spilled: true})
+				w.cond.Broadcast()
+				return nil
+			}
+			// The spool is full, wait for room in memory like without
+			// it.
+			spill = nil
+			continue
+		}
+		w.cond.Wait()
+	}
+	return w.err
+}
+
+func (w *tableWriter) close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	w.wg.Wait()
+	return w.failed()
+}
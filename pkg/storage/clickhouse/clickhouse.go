@@ -0,0 +1,125 @@
+// Package clickhouse is a client of the ClickHouse HTTP interface, which
+// sends queries and inserts with data in the request body.
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Client sends queries to the HTTP interface at Endpoint, e.g.
+// http://localhost:8123/, as User in Database.
+type Client struct {
+	Endpoint string
+	Database string
+	User     string
+	Password string
+	// HTTP sends requests, http.DefaultClient when nil.
+	HTTP *http.Client
+}
+
+// SendError is returned by inserts whose requests fail before a response,
+// e.g. on timeouts, so that the insert may still have been committed.
+type SendError struct {
+	Err error
+}
+
+func (e *SendError) Error() string {
+	return e.Err.Error()
+}
+
+// Query sends query and returns the response body.
+func (c *Client) Query(ctx context.Context, query string) ([]byte, error) {
+	return c.QueryParams(ctx, query, nil)
+}
+
+// QueryParams sends query with values of its {name:Type} parameters.
+func (c *Client) QueryParams(ctx context.Context, query string, values map[string]string) ([]byte, error) {
+	params := url.Values{}
+	for name, value := range values {
+		params.Set("param_"+name, value)
+	}
+	req, err := c.request(ctx, params, strings.NewReader(query), "")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to send HTTP request")
+	}
+	defer resp.Body.Close()
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read HTTP response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP query failed with %s: %s", resp.Status, strings.TrimSpace(string(result)))
+	}
+	return result, nil
+}
+
+// QueryUint64 sends query and parses its single number result.
+func (c *Client) QueryUint64(ctx context.Context, query string) (uint64, error) {
+	result, err := c.Query(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(result)), 10, 64)
+}
+
+// Insert sends query, an INSERT with a FORMAT clause, with body as its data.
+// Settings, e.g. insert_quorum, are sent as URL parameters, and encoding as
+// Content-Encoding of compressed bodies unless empty. Requests failing
+// before a response return *SendError.
+func (c *Client) Insert(ctx context.Context, query string, settings map[string]string, body []byte,
+	encoding string) error {
+	params := url.Values{}
+	params.Set("query", query)
+	for name, value := range settings {
+		params.Set(name, value)
+	}
+	req, err := c.request(ctx, params, bytes.NewReader(body), encoding)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return &SendError{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("HTTP insert failed with %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+func (c *Client) request(ctx context.Context, params url.Values, body io.Reader, encoding string) (*http.Request, error) {
+	params.Set("database", c.Database)
+	req, err := http.NewRequest(http.MethodPost, c.Endpoint+"?"+params.Encode(), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create HTTP request")
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	req.Header.Set("X-ClickHouse-User", c.User)
+	req.Header.Set("X-ClickHouse-Key", c.Password)
+	return req.WithContext(ctx), nil
+}
+
+func (c *Client) client() *http.Client {
+	if c.HTTP == nil {
+		return http.DefaultClient
+	}
+	return c.HTTP
+}
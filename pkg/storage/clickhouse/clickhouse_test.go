@@ -0,0 +1,71 @@
+package clickhouse
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params := r.URL.Query()
+		if (params.Get("database") != "facedb") || (r.Header.Get("X-ClickHouse-User") != "generator") ||
+			(r.Header.Get("X-ClickHouse-Key") != "secret") {
+			http.Error(w, "Code: 516. DB::Exception: Authentication failed", http.StatusUnauthorized)
+			return
+		}
+		if string(body) != "SELECT {n:UInt64} + 1" {
+			http.Error(w, "Code: 62. DB::Exception: Syntax error", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(params.Get("param_n") + "1\n"))
+	}))
+	defer server.Close()
+	c := &Client{Endpoint: server.URL + "/", Database: "facedb", User: "generator", Password: "secret"}
+
+	result, err := c.QueryParams(context.Background(), "SELECT {n:UInt64} + 1", map[string]string{"n": "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != "41\n" {
+		t.Errorf("query returned %q", result)
+	}
+	if _, err := c.QueryUint64(context.Background(), "SELECT 1"); (err == nil) || !strings.Contains(err.Error(), "Syntax error") {
+		t.Errorf("failed query returned %v", err)
+	}
+	c.Password = ""
+	if _, err := c.Query(context.Background(), "SELECT {n:UInt64} + 1"); (err == nil) || !strings.Contains(err.Error(), "401") {
+		t.Errorf("unauthorized query returned %v", err)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params := r.URL.Query()
+		if (params.Get("query") != "INSERT INTO t (id) FORMAT CSV") || (params.Get("insert_quorum") != "2") ||
+			(r.Header.Get("Content-Encoding") != "gzip") || (string(body) != "1\n") {
+			http.Error(w, "Code: 27. DB::Exception: Cannot parse input", http.StatusBadRequest)
+		}
+	}))
+	c := &Client{Endpoint: server.URL + "/"}
+	settings := map[string]string{"insert_quorum": "2"}
+	if err := c.Insert(context.Background(), "INSERT INTO t (id) FORMAT CSV", settings, []byte("1\n"), "gzip"); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Insert(context.Background(), "INSERT INTO t (id) FORMAT CSV", nil, []byte("1\n"), "")
+	if _, ok := err.(*SendError); (err == nil) || ok {
+		t.Errorf("rejected insert returned %v", err)
+	}
+
+	// Without a response the insert may be committed.
+	server.Close()
+	err = c.Insert(context.Background(), "INSERT INTO t (id) FORMAT CSV", settings, []byte("1\n"), "gzip")
+	if _, ok := err.(*SendError); !ok {
+		t.Errorf("insert into a stopped server returned %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package sinktest checks storage sinks of the generator against the
+// contract generation relies on: rows of successful batches are stored
+// exactly once, failed inserts and cancelled contexts return errors, and
+// sinks retried after failures keep working.
+//
+// A sink is tested together with its backend, usually a fake server, which
+// reports stored rows and fails requests on demand:
+//
+//	sinktest.Run(t, func(t *testing.T) (sinktest.Sink, sinktest.Backend) {
+//		b := newFakeServer(t)
+//		return newSink(b.addr()), b
+//	}, sinktest.Contract{Tables: []string{"control_objects", "facial_features"}, Atomic: true, Retried: true})
+package sinktest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Sink inserts batches of rows into tables.
+type Sink interface {
+	// Insert inserts a batch of rows with ids into table.
+	Insert(ctx context.Context, table string, ids []string) error
+}
+
+// Backend is the storage a Sink writes to.
+type Backend interface {
+	// Stored returns IDs of rows stored in table in any order.
+	Stored(table string) ([]string, error)
+	// Reject makes the backend fail requests after accepting n more of
+	// them, negative n makes it accept all requests again.
+	Reject(n int)
+}
+
+// Contract lists tables of a sink and guarantees it gives beyond the common
+// ones.
+type Contract struct {
+	// Tables every batch is inserted into, in order.
+	Tables []string
+	// Atomic sinks store no rows of failed batches, others may store part
+	// of them.
+	Atomic bool
+	// Retried sinks keep working after failed inserts, so that the
+	// generator can retry them. Others are not used after a failure.
+	Retried bool
+}
+
+// MakeSink returns a new sink with its backend, both stopped after the
+// test.
+type MakeSink func(t *testing.T) (Sink, Backend)
+
+// Run runs conformance tests of sinks made by makeSink, each with a new
+// sink.
+func Run(t *testing.T, makeSink MakeSink, c Contract) {
+	t.Run("Insert", func(t *testing.T) {
+		s := newSinkState(t, makeSink, c)
+		for _, n := range []int{10, 1, 100} {
+			if err := s.insert(context.Background(), n); err != nil {
+				t.Fatalf("unable to insert batches of %d rows: %v", n, err)
+			}
+			s.check(fmt.Sprintf("insert of %d rows", n))
+		}
+	})
+	for accepted := range c.Tables {
+		t.Run(fmt.Sprintf("RejectedAfter%d", accepted), func(t *testing.T) {
+			s := newSinkState(t, makeSink, c)
+			if err := s.insert(context.Background(), 10); err != nil {
+				t.Fatalf("unable to insert batches: %v", err)
+			}
+			s.backend.Reject(accepted)
+			if err := s.insert(context.Background(), 10); err == nil {
+				t.Fatalf("insert succeeded while the backend rejected requests after %d", accepted)
+			}
+			if c.Atomic {
+				s.check(fmt.Sprintf("failure after %d requests", accepted))
+			}
+		})
+	}
+	t.Run("Cancelled", func(t *testing.T) {
+		s := newSinkState(t, makeSink, c)
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := s.insert(cancelled, 10); err == nil {
+			t.Fatal("insert succeeded with a cancelled context")
+		}
+		if c.Atomic {
+			s.check("cancelled context")
+		}
+	})
+	if !c.Retried {
+		return
+	}
+	t.Run("Recovery", func(t *testing.T) {
+		s := newSinkState(t, makeSink, c)
+		for accepted := range c.Tables {
+			s.backend.Reject(accepted)
+			if err := s.insert(context.Background(), 10); err == nil {
+				t.Fatalf("insert succeeded while the backend rejected requests after %d", accepted)
+			}
+			// Non-atomic sinks may have stored part of failed batches.
+			s.sync()
+		}
+		s.backend.Reject(-1)
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := s.insert(cancelled, 10); err == nil {
+			t.Fatal("insert succeeded with a cancelled context")
+		}
+		s.sync()
+		if err := s.insert(context.Background(), 100); err != nil {
+			t.Fatalf("unable to insert batches after failures: %v", err)
+		}
+		s.check("insert after failures")
+	})
+}
+
+// sinkState tracks rows a sink is expected to have stored.
+type sinkState struct {
+	t       *testing.T
+	c       Contract
+	sink    Sink
+	backend Backend
+	stored  map[string][]string
+}
+
+func newSinkState(t *testing.T, makeSink MakeSink, c Contract) *sinkState {
+	s := &sinkState{t: t, c: c, stored: map[string][]string{}}
+	s.sink, s.backend = makeSink(t)
+	for _, table := range c.Tables {
+		s.stored[table] = []string{}
+	}
+	return s
+}
+
+// insert inserts a batch of n new rows into every table and records rows of
+// successful batches as stored.
+func (s *sinkState) insert(ctx context.Context, n int) error {
+	for _, table := range s.c.Tables {
+		ids := make([]string, n)
+		for i := range ids {
+			ids[i] = uuid.Must(uuid.NewV4()).String()
+		}
+		if err := s.sink.Insert(ctx, table, ids); err != nil {
+			return err
+		}
+		s.stored[table] = append(s.stored[table], ids...)
+	}
+	return nil
+}
+
+// check fails the test unless the backend stored exactly the recorded rows.
+func (s *sinkState) check(step string) {
+	s.t.Helper()
+	for table, expected := range s.stored {
+		got := s.get(table)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(got, expected) {
+			s.t.Fatalf("%s: %d rows of %s are stored, expected %d", step, len(got), table, len(expected))
+		}
+	}
+}
+
+// sync records rows stored by the backend as expected.
+func (s *sinkState) sync() {
+	s.t.Helper()
+	for table := range s.stored {
+		s.stored[table] = s.get(table)
+	}
+}
+
+func (s *sinkState) get(table string) []string {
+	s.t.Helper()
+	ids, err := s.backend.Stored(table)
+	if err != nil {
+		s.t.Fatalf("unable to get rows of %s: %v", table, err)
+	}
+	ids = append([]string{}, ids...)
+	sort.Strings(ids)
+	return ids
+}